@@ -9,7 +9,9 @@ import (
 	informers "github.com/h3poteto/fluentd-sidecar-injector/pkg/client/informers/externalversions"
 	"github.com/h3poteto/fluentd-sidecar-injector/pkg/controller/sidecarinjector"
 	"github.com/h3poteto/fluentd-sidecar-injector/pkg/leaderelection"
+	"github.com/h3poteto/fluentd-sidecar-injector/pkg/metrics"
 	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -18,8 +20,12 @@ import (
 )
 
 type sidecarInjectorOption struct {
-	useCertManager bool
-	workers        int
+	useCertManager         bool
+	workers                int
+	caValidity             time.Duration
+	certificateValidity    time.Duration
+	certificateRenewBefore time.Duration
+	metricsPort            int32
 }
 
 func sidecarInjectorCmd() *cobra.Command {
@@ -32,11 +38,21 @@ func sidecarInjectorCmd() *cobra.Command {
 	flags := cmd.Flags()
 	flags.BoolVar(&o.useCertManager, "use-cert-manager", false, "If you already use cert-manager, please enable this flag. If false, this controller generates its own certificate for webhook server. ")
 	flags.IntVarP(&o.workers, "workers", "w", 1, "Concurrent workers number for controller.")
+	flags.DurationVar(&o.caValidity, "ca-validity", sidecarinjector.DefaultCAValidity, "Lifetime of the self-signed CA certificate which signs certificates for webhook servers. It is not used with cert-manager.")
+	flags.DurationVar(&o.certificateValidity, "certificate-validity", sidecarinjector.DefaultCertificateValidity, "Lifetime of server certificates for webhook servers. It is not used with cert-manager.")
+	flags.DurationVar(&o.certificateRenewBefore, "certificate-renew-before", sidecarinjector.DefaultCertificateRenewBefore, "CA and server certificates are renewed when the remaining lifetime is less than this period. It is not used with cert-manager.")
+	flags.Int32Var(&o.metricsPort, "metrics-port", 8080, "Port of the metrics endpoint. If 0, metrics are not served.")
 
 	return cmd
 }
 
 func (o *sidecarInjectorOption) run(cmd *cobra.Command, args []string) {
+	if o.certificateRenewBefore >= o.certificateValidity {
+		klog.Fatalf("certificate-renew-before (%s) must be less than certificate-validity (%s)", o.certificateRenewBefore, o.certificateValidity)
+	}
+	if o.certificateValidity > o.caValidity {
+		klog.Fatalf("certificate-validity (%s) must not be greater than ca-validity (%s)", o.certificateValidity, o.caValidity)
+	}
 	kubeconfig, masterURL := controllerConfig()
 	if kubeconfig != "" {
 		klog.Infof("Using kubeconfig: %s", kubeconfig)
@@ -52,6 +68,15 @@ func (o *sidecarInjectorOption) run(cmd *cobra.Command, args []string) {
 	if ns == "" {
 		ns = "default"
 	}
+	// Metrics are served also by standby replicas, so they can be scraped regardless of the leader.
+	if o.metricsPort != 0 {
+		go func() {
+			if err := metrics.Serve(o.metricsPort); err != nil {
+				klog.Fatal(err)
+			}
+		}()
+	}
+
 	le := leaderelection.NewLeaderElection("sidecar-injector", ns)
 	ctx := context.Background()
 	err = le.Run(ctx, cfg, func(ctx context.Context, clientConfig *rest.Config, stopCh <-chan struct{}) {
@@ -72,6 +97,10 @@ func (o *sidecarInjectorOption) run(cmd *cobra.Command, args []string) {
 
 		kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, time.Second*30)
 		ownInformerFactory := informers.NewSharedInformerFactory(ownClient, time.Second*30)
+		// Only objects which have the injector label are watched, which are injected pods and ConfigMaps of pipelines.
+		labeledInformerFactory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, time.Second*30, kubeinformers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = sidecarinjector.InjectorLabel
+		}))
 
 		controller := sidecarinjector.NewController(
 			kubeClient,
@@ -79,11 +108,16 @@ func (o *sidecarInjectorOption) run(cmd *cobra.Command, args []string) {
 			dynamicClient,
 			kubeInformerFactory,
 			ownInformerFactory,
+			labeledInformerFactory,
 			o.useCertManager,
+			o.caValidity,
+			o.certificateValidity,
+			o.certificateRenewBefore,
 		)
 
 		go kubeInformerFactory.Start(stopCh)
 		go ownInformerFactory.Start(stopCh)
+		go labeledInformerFactory.Start(stopCh)
 
 		if err = controller.Run(o.workers, stopCh); err != nil {
 			klog.Fatalf("Error running controller: %s", err.Error())
@@ -10,21 +10,29 @@ import (
 )
 
 type certificateOption struct {
-	outputKeyFile  string
-	outputCertFile string
+	outputKeyFile    string
+	outputCertFile   string
+	outputCAKeyFile  string
+	outputCACertFile string
+	serviceName      string
+	namespace        string
 }
 
 func certificateCmd() *cobra.Command {
 	o := &certificateOption{}
 	cmd := &cobra.Command{
 		Use:   "certificate",
-		Short: "Generate server certificates and save it to files",
+		Short: "Generate a CA and a server certificate signed by the CA, and save them to files",
 		Run:   o.run,
 	}
 
 	flags := cmd.Flags()
 	flags.StringVar(&o.outputKeyFile, "key-file", "server.key", "Path to a server key file name which you want to output.")
 	flags.StringVar(&o.outputCertFile, "cert-file", "server.crt", "Path to a server certificate file name which you want to output.")
+	flags.StringVar(&o.outputCAKeyFile, "ca-key-file", "ca.key", "Path to a CA key file name which you want to output.")
+	flags.StringVar(&o.outputCACertFile, "ca-cert-file", "ca.crt", "Path to a CA certificate file name which you want to output. Please use it as caBundle.")
+	flags.StringVar(&o.serviceName, "service", "test-svc", "Service name of the webhook server.")
+	flags.StringVar(&o.namespace, "namespace", "test-ns", "Namespace of the webhook server.")
 
 	return cmd
 }
@@ -36,29 +44,36 @@ func (o *certificateOption) run(cmd *cobra.Command, args []string) {
 	if o.outputCertFile == "" {
 		klog.Fatal("cert-file argument is required")
 	}
-
-	key, cert, err := sidecarinjector.NewCertificates("test-svc", "test-ns")
-	if err != nil {
-		klog.Fatal(err)
+	if o.outputCAKeyFile == "" {
+		klog.Fatal("ca-key-file argument is required")
+	}
+	if o.outputCACertFile == "" {
+		klog.Fatal("ca-cert-file argument is required")
 	}
 
-	keyOut, err := os.Create(o.outputKeyFile)
+	caKey, caCert, err := sidecarinjector.NewCA(o.serviceName, sidecarinjector.DefaultCAValidity)
 	if err != nil {
 		klog.Fatal(err)
 	}
-	defer keyOut.Close()
-	keyPem, _ := pem.Decode(key)
-	if err = pem.Encode(keyOut, keyPem); err != nil {
+	key, cert, err := sidecarinjector.NewServerCertificate(o.serviceName, o.namespace, caKey, caCert, sidecarinjector.DefaultCertificateValidity)
+	if err != nil {
 		klog.Fatal(err)
 	}
 
-	certOut, err := os.Create(o.outputCertFile)
+	writePEM(o.outputCAKeyFile, caKey)
+	writePEM(o.outputCACertFile, caCert)
+	writePEM(o.outputKeyFile, key)
+	writePEM(o.outputCertFile, cert)
+}
+
+func writePEM(fileName string, data []byte) {
+	out, err := os.Create(fileName)
 	if err != nil {
 		klog.Fatal(err)
 	}
-	defer certOut.Close()
-	certPem, _ := pem.Decode(cert)
-	if err = pem.Encode(certOut, certPem); err != nil {
+	defer out.Close()
+	block, _ := pem.Decode(data)
+	if err = pem.Encode(out, block); err != nil {
 		klog.Fatal(err)
 	}
 }
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	"github.com/h3poteto/fluentd-sidecar-injector/pkg/inject"
+	"github.com/h3poteto/fluentd-sidecar-injector/pkg/webhook/sidecarinjector"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+type injectOption struct {
+	filename  string
+	namespace string
+	output    string
+	injectorFlags
+}
+
+// injectorFlags configure the injector without clusters.
+type injectorFlags struct {
+	sidecarInjector   string
+	verbose           bool
+	collector         string
+	dockerImage       string
+	aggregatorHost    string
+	aggregatorPort    int32
+	otlpEndpoint      string
+	applicationLogDir string
+	tagPrefix         string
+	nativeSidecar     bool
+	strictAnnotations bool
+}
+
+func injectCmd() *cobra.Command {
+	o := &injectOption{}
+	cmd := &cobra.Command{
+		Use:   "inject",
+		Short: "Render manifests with the injected sidecar without clusters",
+		Long: `Render manifests with the injected sidecar without clusters.
+Pods, and pod templates of Deployment, StatefulSet, DaemonSet, ReplicaSet, Job and CronJob are mutated in the same way as the webhook server.
+Other objects are written as they are.`,
+		Example: `  fluentd-sidecar-injector inject -f deployment.yaml --aggregator-host=aggregator.logging
+  kubectl kustomize overlays/production | fluentd-sidecar-injector inject --sidecar-injector=sidecar-injector.yaml -o patch`,
+		RunE: o.run,
+	}
+	flags := cmd.Flags()
+	flags.StringVarP(&o.filename, "filename", "f", "-", "Path to a manifest which contains one or more YAML or JSON documents. If -, it is read from stdin.")
+	flags.StringVarP(&o.namespace, "namespace", "n", "default", "Namespace of objects which do not have the namespace.")
+	flags.StringVarP(&o.output, "output", "o", inject.OutputYAML, "Output format, which is yaml or patch. If patch, a JSON patch for each object is written in a line.")
+	o.injectorFlags.addFlags(flags)
+
+	return cmd
+}
+
+func (f *injectorFlags) addFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&f.sidecarInjector, "sidecar-injector", "", "Path to a SidecarInjector manifest. Its spec is used as defaults, and other flags override them.")
+	flags.BoolVarP(&f.verbose, "verbose", "v", false, "Write logs of the injector to stderr.")
+	flags.StringVar(&f.collector, "collector", "", "Collector, which is fluentd, fluent-bit or otel-collector.")
+	flags.StringVar(&f.dockerImage, "docker-image", "", "Docker image of the sidecar.")
+	flags.StringVar(&f.aggregatorHost, "aggregator-host", "", "Host of the aggregator.")
+	flags.Int32Var(&f.aggregatorPort, "aggregator-port", 0, "Port of the aggregator.")
+	flags.StringVar(&f.otlpEndpoint, "otlp-endpoint", "", "OTLP endpoint of otel-collector.")
+	flags.StringVar(&f.applicationLogDir, "application-log-dir", "", "Log directory of applications.")
+	flags.StringVar(&f.tagPrefix, "tag-prefix", "", "Prefix of tags of logs.")
+	flags.BoolVar(&f.nativeSidecar, "native-sidecar", false, "Inject the collector as a native sidecar.")
+	flags.BoolVar(&f.strictAnnotations, "strict-annotations", false, "Reject pods which have unknown or malformed annotations.")
+}
+
+func (o *injectOption) run(cmd *cobra.Command, args []string) error {
+	injector, err := o.injector(cmd.Flags())
+	if err != nil {
+		return err
+	}
+
+	in := cmd.InOrStdin()
+	if o.filename != "-" {
+		f, err := os.Open(o.filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	return inject.Render(injector, in, cmd.OutOrStdout(), o.namespace, o.output)
+}
+
+// injector returns an injector without listers. The spec of the SidecarInjector is read from the file and overridden by flags.
+func (f *injectorFlags) injector(flags *pflag.FlagSet) (*sidecarinjector.Injector, error) {
+	if !f.verbose {
+		// Errors are also written to stderr by default, so the threshold is raised.
+		klogFlags := flag.NewFlagSet("klog", flag.ContinueOnError)
+		klog.InitFlags(klogFlags)
+		if err := klogFlags.Set("stderrthreshold", "FATAL"); err != nil {
+			return nil, err
+		}
+		klog.LogToStderr(false)
+		klog.SetOutput(io.Discard)
+	}
+	sidecarInjector := &sidecarinjectorv1alpha1.SidecarInjector{}
+	if f.sidecarInjector != "" {
+		data, err := os.ReadFile(f.sidecarInjector)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.UnmarshalStrict(data, sidecarInjector); err != nil {
+			return nil, fmt.Errorf("failed to parse SidecarInjector: %w", err)
+		}
+		if sidecarInjector.Kind != "SidecarInjector" {
+			return nil, fmt.Errorf("%s is not SidecarInjector", f.sidecarInjector)
+		}
+	}
+	spec := &sidecarInjector.Spec
+	if flags.Changed("collector") {
+		spec.Collector = f.collector
+	}
+	if flags.Changed("native-sidecar") {
+		spec.NativeSidecar = &f.nativeSidecar
+	}
+	if flags.Changed("strict-annotations") {
+		spec.StrictAnnotations = &f.strictAnnotations
+	}
+	if spec.FluentD == nil {
+		spec.FluentD = &sidecarinjectorv1alpha1.FluentDSpec{}
+	}
+	if spec.FluentBit == nil {
+		spec.FluentBit = &sidecarinjectorv1alpha1.FluentBitSpec{}
+	}
+	if spec.OtelCollector == nil {
+		spec.OtelCollector = &sidecarinjectorv1alpha1.OtelCollectorSpec{}
+	}
+	if flags.Changed("docker-image") {
+		spec.FluentD.DockerImage = f.dockerImage
+		spec.FluentBit.DockerImage = f.dockerImage
+		spec.OtelCollector.DockerImage = f.dockerImage
+	}
+	if flags.Changed("aggregator-host") {
+		spec.FluentD.AggregatorHost = f.aggregatorHost
+		spec.FluentBit.AggregatorHost = f.aggregatorHost
+	}
+	if flags.Changed("aggregator-port") {
+		spec.FluentD.AggregatorPort = f.aggregatorPort
+		spec.FluentBit.AggregatorPort = f.aggregatorPort
+	}
+	if flags.Changed("otlp-endpoint") {
+		spec.OtelCollector.Endpoint = f.otlpEndpoint
+	}
+	if flags.Changed("application-log-dir") {
+		spec.FluentD.ApplicationLogDir = f.applicationLogDir
+		spec.FluentBit.ApplicationLogDir = f.applicationLogDir
+		spec.OtelCollector.ApplicationLogDir = f.applicationLogDir
+	}
+	if flags.Changed("tag-prefix") {
+		spec.FluentD.TagPrefix = f.tagPrefix
+		spec.FluentBit.TagPrefix = f.tagPrefix
+		spec.OtelCollector.TagPrefix = f.tagPrefix
+	}
+	injector := sidecarinjector.NewInjector(sidecarInjector.Name, nil, nil, nil, nil)
+	injector.SetSidecarInjectorSpec(spec)
+	return injector, nil
+}
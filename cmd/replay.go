@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/h3poteto/fluentd-sidecar-injector/pkg/webhook"
+	"github.com/spf13/cobra"
+)
+
+const goldenSuffix = ".golden.json"
+
+type replayOption struct {
+	update bool
+	injectorFlags
+}
+
+func replayCmd() *cobra.Command {
+	o := &replayOption{}
+	cmd := &cobra.Command{
+		Use:   "replay FILE_OR_DIRECTORY...",
+		Short: "Replay recorded AdmissionReviews and compare the results with golden files",
+		Long: `Replay recorded AdmissionReview v1 or v1beta1 JSON files without clusters, and compare the results with golden files.
+The golden file of name.json is name.golden.json in the same directory. JSON files in directories are replayed except golden files.`,
+		Example: `  fluentd-sidecar-injector replay testdata/admissionreviews
+  fluentd-sidecar-injector replay testdata/admissionreviews --update`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: o.run,
+	}
+	flags := cmd.Flags()
+	flags.BoolVar(&o.update, "update", false, "Write results to golden files instead of comparing them.")
+	o.injectorFlags.addFlags(flags)
+
+	return cmd
+}
+
+func (o *replayOption) run(cmd *cobra.Command, args []string) error {
+	injector, err := o.injector(cmd.Flags())
+	if err != nil {
+		return err
+	}
+	files, err := reviewFiles(args)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, file := range files {
+		golden := strings.TrimSuffix(file, ".json") + goldenSuffix
+		diff, err := webhook.ReplayFile(injector, file, golden, o.update)
+		if err != nil {
+			return err
+		}
+		if diff != "" {
+			failed++
+			fmt.Fprintf(cmd.OutOrStdout(), "--- %s\n+++ %s\n%s", golden, file, diff)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d AdmissionReviews are not matched with golden files", failed, len(files))
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "%d AdmissionReviews are replayed\n", len(files))
+	return nil
+}
+
+// reviewFiles returns JSON files in the arguments, and golden files are excluded from directories.
+func reviewFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(arg, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			if !strings.HasSuffix(match, goldenSuffix) {
+				files = append(files, match)
+			}
+		}
+	}
+	return files, nil
+}
@@ -18,6 +18,8 @@ func init() {
 	cobra.OnInitialize()
 	RootCmd.AddCommand(
 		webhookCmd(),
+		injectCmd(),
+		replayCmd(),
 		versionCmd(),
 		controller.ControllerCmd(),
 		dev.DevCmd(),
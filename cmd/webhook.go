@@ -1,14 +1,37 @@
 package cmd
 
 import (
+	"context"
+	"time"
+
+	clientset "github.com/h3poteto/fluentd-sidecar-injector/pkg/client/clientset/versioned"
+	informers "github.com/h3poteto/fluentd-sidecar-injector/pkg/client/informers/externalversions"
+	controller "github.com/h3poteto/fluentd-sidecar-injector/pkg/controller/sidecarinjector"
+	"github.com/h3poteto/fluentd-sidecar-injector/pkg/metrics"
+	"github.com/h3poteto/fluentd-sidecar-injector/pkg/pipeline"
+	"github.com/h3poteto/fluentd-sidecar-injector/pkg/signals"
 	"github.com/h3poteto/fluentd-sidecar-injector/pkg/webhook"
+	"github.com/h3poteto/fluentd-sidecar-injector/pkg/webhook/sidecarinjector"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 type webhookOption struct {
-	tlsCertFile string
-	tlsKeyFile  string
+	tlsCertFile     string
+	tlsKeyFile      string
+	kubeconfig      string
+	master          string
+	sidecarInjector string
+	metricsPort     int32
+	syncTimeout     time.Duration
 }
 
 func webhookCmd() *cobra.Command {
@@ -21,6 +44,11 @@ func webhookCmd() *cobra.Command {
 	flags := cmd.Flags()
 	flags.StringVarP(&s.tlsCertFile, "tls-cert-file", "c", "", "Certificate file name of TLS")
 	flags.StringVarP(&s.tlsKeyFile, "tls-key-file", "k", "", "Key file name of TLS")
+	flags.StringVar(&s.kubeconfig, "kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster.")
+	flags.StringVar(&s.master, "master", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
+	flags.StringVar(&s.sidecarInjector, "sidecar-injector", "", "Name of the SidecarInjector which owns this webhook server. The server watches it and reloads configuration when it is changed. If empty, configuration is read from environment variables.")
+	flags.DurationVar(&s.syncTimeout, "cache-sync-timeout", 2*time.Minute, "Timeout to wait for caches of SidecarInjector, SidecarInjectorPolicy and Namespace to sync. The server exits when it is exceeded.")
+	flags.Int32Var(&s.metricsPort, "metrics-port", 8081, "Port of the metrics endpoint, which is served with plain HTTP. If 0, metrics are not served.")
 
 	return cmd
 }
@@ -33,7 +61,87 @@ func (o *webhookOption) run(cmd *cobra.Command, args []string) {
 		logrus.Fatal("tls-key-file is required parameter")
 	}
 
-	if err := webhook.Server(int32(8080), o.tlsCertFile, o.tlsKeyFile); err != nil {
+	cfg, err := clientcmd.BuildConfigFromFlags(o.master, o.kubeconfig)
+	if err != nil {
+		logrus.Fatalf("Error building rest config: %s", err.Error())
+	}
+	ownClient, err := clientset.NewForConfig(cfg)
+	if err != nil {
+		logrus.Fatalf("Error building own clientset: %s", err.Error())
+	}
+	kubeClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		logrus.Fatalf("Error building kubernetes clientset: %s", err.Error())
+	}
+	dynamicClient, err := controller.NewDynamicClient(cfg, kubeClient)
+	if err != nil {
+		logrus.Fatalf("Error building dynamic client: %s", err.Error())
+	}
+	metadataClient, err := metadata.NewForConfig(cfg)
+	if err != nil {
+		logrus.Fatalf("Error building metadata client: %s", err.Error())
+	}
+
+	stopCh := signals.SetupSignalHandler()
+	ownInformerFactory := informers.NewSharedInformerFactory(ownClient, time.Second*30)
+	policyInformer := ownInformerFactory.Operator().V1alpha1().SidecarInjectorPolicies()
+	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, time.Second*30)
+	namespaceInformer := kubeInformerFactory.Core().V1().Namespaces()
+	var configMapLister corelisters.ConfigMapLister
+	ownerResolver := controller.NewOwnerResolver(dynamicClient, metadataClient)
+	informersSynced := []cache.InformerSynced{policyInformer.Informer().HasSynced, namespaceInformer.Informer().HasSynced}
+
+	if o.sidecarInjector != "" {
+		// Watch only ConfigMaps of the pipeline, which are published to namespaces by the controller.
+		configMapInformerFactory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, time.Second*30, kubeinformers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", pipeline.ConfigMapName(o.sidecarInjector)).String()
+		}))
+		configMapInformer := configMapInformerFactory.Core().V1().ConfigMaps()
+		configMapLister = configMapInformer.Lister()
+		informersSynced = append(informersSynced, configMapInformer.Informer().HasSynced)
+		configMapInformerFactory.Start(stopCh)
+	}
+	injector := sidecarinjector.NewInjector(o.sidecarInjector, policyInformer.Lister(), namespaceInformer.Lister(), ownerResolver, configMapLister)
+
+	if o.sidecarInjector != "" {
+		// Watch only the owner SidecarInjector.
+		ownerInformerFactory := informers.NewSharedInformerFactoryWithOptions(ownClient, time.Second*30, informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", o.sidecarInjector).String()
+		}))
+		sidecarInjectorInformer := ownerInformerFactory.Operator().V1alpha1().SidecarInjectors()
+		if _, err := sidecarInjectorInformer.Informer().AddEventHandler(injector.SidecarInjectorEventHandler(o.sidecarInjector)); err != nil {
+			logrus.Fatal(err)
+		}
+		informersSynced = append(informersSynced, sidecarInjectorInformer.Informer().HasSynced)
+		ownerInformerFactory.Start(stopCh)
+	}
+
+	ownInformerFactory.Start(stopCh)
+	kubeInformerFactory.Start(stopCh)
+	// The webhook server does not wait for the metadata cache of owners, because owners which are not cached are fetched from the API server.
+	ownerResolver.Start(stopCh)
+	syncCtx, cancel := context.WithTimeout(context.Background(), o.syncTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-syncCtx.Done():
+		}
+	}()
+	if ok := cache.WaitForCacheSync(syncCtx.Done(), informersSynced...); !ok {
+		logrus.Fatalf("failed to wait for caches to sync within %s, please make sure the service account of the webhook server can get, list and watch sidecarinjectors, sidecarinjectorpolicies, namespaces and configmaps (see config/rbac/webhook_role.yaml)", o.syncTimeout)
+	}
+
+	if o.metricsPort != 0 {
+		go func() {
+			if err := metrics.Serve(o.metricsPort); err != nil {
+				logrus.Fatal(err)
+			}
+		}()
+	}
+
+	if err := webhook.Server(int32(8080), o.tlsCertFile, o.tlsKeyFile, injector, stopCh); err != nil {
 		logrus.Fatal(err)
 	}
 }
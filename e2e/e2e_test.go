@@ -4,10 +4,12 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/h3poteto/fluentd-sidecar-injector/e2e/pkg/fixtures"
 	"github.com/h3poteto/fluentd-sidecar-injector/e2e/pkg/util"
+	v1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
 	clientset "github.com/h3poteto/fluentd-sidecar-injector/pkg/client/clientset/versioned"
 	"github.com/h3poteto/fluentd-sidecar-injector/pkg/controller/sidecarinjector"
 	pkgwebhook "github.com/h3poteto/fluentd-sidecar-injector/pkg/webhook/sidecarinjector"
@@ -66,47 +68,16 @@ var _ = Describe("E2E", func() {
 		)
 
 		JustBeforeEach(func() {
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-			defer cancel()
-
-			if err := applyCRD(ctx, cfg, client); err != nil {
-				panic(err)
-			}
-			klog.Info("applying RBAC")
-			if err := util.ApplyRBAC(ctx, cfg); err != nil {
-				panic(err)
-			}
-			klog.Info("applying manager")
-
-			// Apply manager
-			if err := applyManager(ctx, client, managerNS, useCertManager); err != nil {
-				panic(err)
-			}
-
-			webhook, setupError = applySidecarInjector(context.Background(), client, ownClient, collector)
+			setupManager(useCertManager)
+			webhook, setupError = applySidecarInjector(context.Background(), client, ownClient, fixtures.NewSidecarInjector(collector))
 		})
 
 		AfterEach(func() {
-			ctx := context.Background()
-			err := deleteSidecarInjector(ctx, client, ownClient, collector)
+			err := deleteSidecarInjector(context.Background(), client, ownClient, collector)
 			if err != nil {
 				panic(err)
 			}
-
-			// Delete operator controller and custom resources
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-			defer cancel()
-
-			if err := deleteManager(ctx, client, managerNS); err != nil {
-				panic(err)
-			}
-
-			if err := util.DeleteRBAC(ctx, cfg); err != nil {
-				panic(err)
-			}
-			if err := util.DeleteCRD(ctx, cfg); err != nil {
-				panic(err)
-			}
+			teardownManager()
 		})
 		Context("Use self managed certificate", func() {
 			BeforeEach(func() {
@@ -144,8 +115,89 @@ var _ = Describe("E2E", func() {
 			})
 		})
 	})
+
+	Describe("Logs are sent to the HTTP output", func() {
+		var (
+			collector  string
+			webhook    *admissionregistrationv1.MutatingWebhookConfiguration
+			setupError error
+		)
+		sinkNS := "default"
+
+		JustBeforeEach(func() {
+			setupManager(false)
+			if err := applyHTTPSink(context.Background(), client, sinkNS); err != nil {
+				panic(err)
+			}
+			sidecarInjector := fixtures.NewSidecarInjectorWithHTTPOutput(collector, fixtures.HTTPSinkURL(sinkNS))
+			webhook, setupError = applySidecarInjector(context.Background(), client, ownClient, sidecarInjector)
+		})
+
+		AfterEach(func() {
+			ctx := context.Background()
+			if err := deleteHTTPSink(ctx, client, sinkNS); err != nil {
+				panic(err)
+			}
+			if err := deleteSidecarInjector(ctx, client, ownClient, collector); err != nil {
+				panic(err)
+			}
+			teardownManager()
+		})
+		Context("Collector is fluentd", func() {
+			BeforeEach(func() {
+				collector = "fluentd"
+			})
+			It("records arrive at the sink", func() {
+				outputSpec(setupError, webhook, client, managerNS, sinkNS)
+			})
+		})
+		Context("Collector is fluent-bit", func() {
+			BeforeEach(func() {
+				collector = "fluent-bit"
+			})
+			It("records arrive at the sink", func() {
+				outputSpec(setupError, webhook, client, managerNS, sinkNS)
+			})
+		})
+	})
 })
 
+func setupManager(useCertManager bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	if err := applyCRD(ctx, cfg, client); err != nil {
+		panic(err)
+	}
+	klog.Info("applying RBAC")
+	if err := util.ApplyRBAC(ctx, cfg); err != nil {
+		panic(err)
+	}
+	klog.Info("applying manager")
+
+	// Apply manager
+	if err := applyManager(ctx, client, managerNS, useCertManager); err != nil {
+		panic(err)
+	}
+}
+
+// teardownManager deletes operator controller and custom resources.
+func teardownManager() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	if err := deleteManager(ctx, client, managerNS); err != nil {
+		panic(err)
+	}
+
+	if err := util.DeleteRBAC(ctx, cfg); err != nil {
+		panic(err)
+	}
+	if err := util.DeleteCRD(ctx, cfg); err != nil {
+		panic(err)
+	}
+}
+
 func waitUntilReady(ctx context.Context, client *kubernetes.Clientset) error {
 	klog.Info("Waiting until kubernetes cluster is ready")
 	err := wait.Poll(10*time.Second, 10*time.Minute, func() (bool, error) {
@@ -202,6 +254,13 @@ func applyManager(ctx context.Context, client *kubernetes.Clientset, ns string,
 	if _, err := client.RbacV1().ClusterRoleBindings().Create(ctx, clusterRoleBinding, metav1.CreateOptions{}); err != nil {
 		return err
 	}
+	webhookSA, webhookRoleBinding := fixtures.NewWebhookManifests(ns, "sidecar-injector-webhook-role")
+	if _, err := client.CoreV1().ServiceAccounts(ns).Create(ctx, webhookSA, metav1.CreateOptions{}); err != nil {
+		return err
+	}
+	if _, err := client.RbacV1().ClusterRoleBindings().Create(ctx, webhookRoleBinding, metav1.CreateOptions{}); err != nil {
+		return err
+	}
 	if _, err := client.RbacV1().Roles(ns).Create(ctx, role, metav1.CreateOptions{}); err != nil {
 		return err
 	}
@@ -250,6 +309,13 @@ func deleteManager(ctx context.Context, client *kubernetes.Clientset, ns string)
 	if err := client.RbacV1().ClusterRoleBindings().Delete(ctx, clusterRoleBinding.Name, metav1.DeleteOptions{}); err != nil {
 		return err
 	}
+	webhookSA, webhookRoleBinding := fixtures.NewWebhookManifests(ns, "sidecar-injector-webhook-role")
+	if err := client.RbacV1().ClusterRoleBindings().Delete(ctx, webhookRoleBinding.Name, metav1.DeleteOptions{}); err != nil {
+		return err
+	}
+	if err := client.CoreV1().ServiceAccounts(ns).Delete(ctx, webhookSA.Name, metav1.DeleteOptions{}); err != nil {
+		return err
+	}
 	if err := client.CoreV1().ServiceAccounts(ns).Delete(ctx, sa.Name, metav1.DeleteOptions{}); err != nil {
 		return err
 	}
@@ -287,8 +353,7 @@ func deleteTestPod(ctx context.Context, client *kubernetes.Clientset, ns string)
 	return client.AppsV1().Deployments(ns).Delete(ctx, nginx.Name, metav1.DeleteOptions{})
 }
 
-func applySidecarInjector(ctx context.Context, client *kubernetes.Clientset, ownClient *clientset.Clientset, collector string) (*admissionregistrationv1.MutatingWebhookConfiguration, error) {
-	sidecarInjector := fixtures.NewSidecarInjector(collector)
+func applySidecarInjector(ctx context.Context, client *kubernetes.Clientset, ownClient *clientset.Clientset, sidecarInjector *v1alpha1.SidecarInjector) (*admissionregistrationv1.MutatingWebhookConfiguration, error) {
 	_, err := ownClient.OperatorV1alpha1().SidecarInjectors().Create(ctx, sidecarInjector, metav1.CreateOptions{})
 	if err != nil {
 		return nil, err
@@ -348,44 +413,14 @@ func spec(
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
 	defer cancel()
 
-	// Wait until webhook servers are deployed.
-	err := wait.Poll(10*time.Second, 5*time.Minute, func() (bool, error) {
-		podList, err := client.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{
-			LabelSelector: fmt.Sprintf("%s=%s", sidecarinjector.WebhookServerLabelKey, sidecarinjector.WebhookServerLabelValue),
-		})
-		if err != nil {
-			if kerrors.IsNotFound(err) {
-				klog.Info("Webhook servers have not been deployed yet")
-				return false, nil
-			}
-			return false, err
-		}
-		return util.WaitPodRunning(podList)
-
-	})
+	err := waitWebhookServers(ctx, client, ns)
 	Expect(err).To(BeNil())
 
 	testPodNS := "default"
 	_, err = applyTestPod(ctx, client, testPodNS)
 	Expect(err).To(BeNil())
 
-	var pods []corev1.Pod
-	err = wait.Poll(10*time.Second, 5*time.Minute, func() (bool, error) {
-		podList, err := client.CoreV1().Pods(testPodNS).List(ctx, metav1.ListOptions{
-			LabelSelector: fmt.Sprintf("%s=%s", fixtures.TestPodLabelKey, fixtures.TestPodLabelValue),
-		})
-		if err != nil {
-			if kerrors.IsNotFound(err) {
-				return false, nil
-			}
-			return false, err
-		}
-		running, err := util.WaitPodRunning(podList)
-		if running {
-			pods = podList.Items
-		}
-		return running, err
-	})
+	pods, err := waitPods(ctx, client, testPodNS, fixtures.TestPodLabelKey, fixtures.TestPodLabelValue)
 	Expect(err).To(BeNil())
 
 	for i := range pods {
@@ -433,3 +468,109 @@ func spec(
 	})
 	Expect(err).To(BeNil())
 }
+
+// waitWebhookServers waits until webhook servers are deployed.
+func waitWebhookServers(ctx context.Context, client *kubernetes.Clientset, ns string) error {
+	return wait.Poll(10*time.Second, 5*time.Minute, func() (bool, error) {
+		podList, err := client.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("%s=%s", sidecarinjector.WebhookServerLabelKey, sidecarinjector.WebhookServerLabelValue),
+		})
+		if err != nil {
+			if kerrors.IsNotFound(err) {
+				klog.Info("Webhook servers have not been deployed yet")
+				return false, nil
+			}
+			return false, err
+		}
+		return util.WaitPodRunning(podList)
+	})
+}
+
+// waitPods waits until pods of the label are running, and returns them.
+func waitPods(ctx context.Context, client *kubernetes.Clientset, ns, labelKey, labelValue string) ([]corev1.Pod, error) {
+	var pods []corev1.Pod
+	err := wait.Poll(10*time.Second, 5*time.Minute, func() (bool, error) {
+		podList, err := client.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("%s=%s", labelKey, labelValue),
+		})
+		if err != nil {
+			if kerrors.IsNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		running, err := util.WaitPodRunning(podList)
+		if running {
+			pods = podList.Items
+		}
+		return running, err
+	})
+	return pods, err
+}
+
+func applyHTTPSink(ctx context.Context, client *kubernetes.Clientset, ns string) error {
+	deployment, service := fixtures.NewHTTPSink(ns)
+	if _, err := client.CoreV1().Services(ns).Create(ctx, service, metav1.CreateOptions{}); err != nil {
+		return err
+	}
+	if _, err := client.AppsV1().Deployments(ns).Create(ctx, deployment, metav1.CreateOptions{}); err != nil {
+		return err
+	}
+	_, err := waitPods(ctx, client, ns, fixtures.HTTPSinkLabelKey, fixtures.HTTPSinkLabelValue)
+	return err
+}
+
+func deleteHTTPSink(ctx context.Context, client *kubernetes.Clientset, ns string) error {
+	deployment, service := fixtures.NewHTTPSink(ns)
+	if err := client.AppsV1().Deployments(ns).Delete(ctx, deployment.Name, metav1.DeleteOptions{}); err != nil {
+		return err
+	}
+	return client.CoreV1().Services(ns).Delete(ctx, service.Name, metav1.DeleteOptions{})
+}
+
+// outputSpec checks that the sidecar sends logs of the application to the HTTP sink.
+func outputSpec(
+	setupError error,
+	webhook *admissionregistrationv1.MutatingWebhookConfiguration,
+	client *kubernetes.Clientset,
+	ns,
+	sinkNS string) {
+	Expect(setupError).To(BeNil())
+	Expect(webhook).NotTo(BeNil())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	err := waitWebhookServers(ctx, client, ns)
+	Expect(err).To(BeNil())
+
+	writer := fixtures.NewLogWriter(sinkNS)
+	_, err = client.AppsV1().Deployments(sinkNS).Create(ctx, writer, metav1.CreateOptions{})
+	Expect(err).To(BeNil())
+	defer func() {
+		err := client.AppsV1().Deployments(sinkNS).Delete(context.Background(), writer.Name, metav1.DeleteOptions{})
+		Expect(err).To(BeNil())
+	}()
+
+	pods, err := waitPods(ctx, client, sinkNS, fixtures.LogWriterLabelKey, fixtures.LogWriterLabelValue)
+	Expect(err).To(BeNil())
+	for i := range pods {
+		Expect(util.FindContainer(&pods[i], pkgwebhook.ContainerName)).NotTo(BeNil(), "Sidecar container is not found")
+	}
+
+	sinks, err := waitPods(ctx, client, sinkNS, fixtures.HTTPSinkLabelKey, fixtures.HTTPSinkLabelValue)
+	Expect(err).To(BeNil())
+	// The sink writes received records to stdout, so they are found in its logs.
+	err = wait.Poll(10*time.Second, 5*time.Minute, func() (bool, error) {
+		logs, err := client.CoreV1().Pods(sinkNS).GetLogs(sinks[0].Name, &corev1.PodLogOptions{Container: fixtures.HTTPSinkContainerName}).DoRaw(ctx)
+		if err != nil {
+			return false, err
+		}
+		if !strings.Contains(string(logs), fixtures.LogWriterMessage) {
+			klog.Info("Records have not arrived at the sink yet")
+			return false, nil
+		}
+		return true, nil
+	})
+	Expect(err).To(BeNil(), "Records do not arrive at the sink")
+}
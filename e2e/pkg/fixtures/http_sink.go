@@ -0,0 +1,81 @@
+package fixtures
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	HTTPSinkName          = "http-sink"
+	HTTPSinkLabelKey      = "e2e-test-key"
+	HTTPSinkLabelValue    = "http-sink"
+	HTTPSinkContainerName = "fluent-bit"
+	httpSinkPort          = 9880
+)
+
+// HTTPSinkURL returns the URL which the sidecar sends records to.
+func HTTPSinkURL(ns string) string {
+	return fmt.Sprintf("http://%s.%s.svc:%d/e2e", HTTPSinkName, ns, httpSinkPort)
+}
+
+// NewHTTPSink returns fluent-bit which receives records with the http input, and writes them to stdout.
+func NewHTTPSink(ns string) (*appsv1.Deployment, *corev1.Service) {
+	labels := map[string]string{
+		HTTPSinkLabelKey: HTTPSinkLabelValue,
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      HTTPSinkName,
+			Namespace: ns,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: ptr.To[int32](1),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  HTTPSinkContainerName,
+							Image: "fluent/fluent-bit:latest",
+							Args: []string{
+								"-i", "http", "-p", fmt.Sprintf("port=%d", httpSinkPort),
+								"-o", "stdout", "-m", "*",
+							},
+							Ports: []corev1.ContainerPort{
+								{
+									ContainerPort: httpSinkPort,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      HTTPSinkName,
+			Namespace: ns,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: labels,
+			Ports: []corev1.ServicePort{
+				{
+					Port:       httpSinkPort,
+					TargetPort: intstr.FromInt32(httpSinkPort),
+				},
+			},
+		},
+	}
+	return deployment, service
+}
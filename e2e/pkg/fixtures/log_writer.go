@@ -0,0 +1,57 @@
+package fixtures
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	LogWriterName       = "log-writer"
+	LogWriterLabelKey   = "e2e-test-key"
+	LogWriterLabelValue = "log-writer"
+	// LogWriterMessage is written to logs, and it is searched in the sink.
+	LogWriterMessage = "fluentd-sidecar-injector-e2e"
+	logWriterDir     = "/var/log/app"
+)
+
+// NewLogWriter returns a Deployment which writes a JSON log every second. The sidecar is injected to it.
+func NewLogWriter(ns string) *appsv1.Deployment {
+	labels := map[string]string{
+		LogWriterLabelKey: LogWriterLabelValue,
+	}
+	script := fmt.Sprintf(`while true; do echo '{"message":"%s"}' >> %s/app.log; sleep 1; done`, LogWriterMessage, logWriterDir)
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      LogWriterName,
+			Namespace: ns,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: ptr.To[int32](1),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+					Annotations: map[string]string{
+						"fluentd-sidecar-injector.h3poteto.dev/injection":           "enabled",
+						"fluentd-sidecar-injector.h3poteto.dev/application-log-dir": logWriterDir,
+					},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:    "writer",
+							Image:   "busybox:latest",
+							Command: []string{"sh", "-c", script},
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -9,10 +9,11 @@ import (
 )
 
 const (
-	ServiceAccountName   = "manager-sa"
-	ManagerName          = "manager"
-	ManagerPodLabelKey   = "operator.h3poteto.dev"
-	ManagerPodLabelValue = "control-plane"
+	ServiceAccountName        = "manager-sa"
+	WebhookServiceAccountName = "webhook-sa"
+	ManagerName               = "manager"
+	ManagerPodLabelKey        = "operator.h3poteto.dev"
+	ManagerPodLabelValue      = "control-plane"
 )
 
 var ManagerPodLabels = map[string]string{
@@ -24,6 +25,34 @@ func NewManagerManifests(ns, clusterRoleName, image string, useCertManager bool)
 	return serviceAccount(ns), roleBinding(ns, clusterRoleName), leaderElectionRole(ns, leName), leaderElectionRoleBinding(ns, leName), deployment(ns, image, useCertManager)
 }
 
+// NewWebhookManifests returns the service account of webhook servers and the binding to the webhook role.
+func NewWebhookManifests(ns, clusterRoleName string) (*corev1.ServiceAccount, *rbacv1.ClusterRoleBinding) {
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      WebhookServiceAccountName,
+			Namespace: ns,
+		},
+	}
+	binding := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "webhook-role-binding",
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				Kind:      rbacv1.ServiceAccountKind,
+				Name:      WebhookServiceAccountName,
+				Namespace: ns,
+			},
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     "ClusterRole",
+			Name:     clusterRoleName,
+		},
+	}
+	return sa, binding
+}
+
 func serviceAccount(ns string) *corev1.ServiceAccount {
 	return &corev1.ServiceAccount{
 		ObjectMeta: metav1.ObjectMeta{
@@ -110,6 +139,10 @@ func deployment(ns, image string, useCertManager bool) *appsv1.Deployment {
 									Name:  "WEBHOOK_CONTAINER_IMAGE",
 									Value: image,
 								},
+								{
+									Name:  "WEBHOOK_SERVICE_ACCOUNT",
+									Value: WebhookServiceAccountName,
+								},
 							},
 							TerminationMessagePath:   "",
 							TerminationMessagePolicy: "",
@@ -3,12 +3,25 @@ package fixtures
 import (
 	v1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
 )
 
 func NewSidecarInjector(collector string) *v1alpha1.SidecarInjector {
 	return sidecarInjector(collector)
 }
 
+// NewSidecarInjectorWithHTTPOutput returns a SidecarInjector which sends logs to the URL with the http output.
+func NewSidecarInjectorWithHTTPOutput(collector, url string) *v1alpha1.SidecarInjector {
+	sidecarInjector := sidecarInjector(collector)
+	sidecarInjector.Spec.Output = &v1alpha1.OutputSpec{
+		Type: v1alpha1.OutputHTTP,
+		HTTP: &v1alpha1.HTTPOutputSpec{
+			URL: url,
+		},
+	}
+	return sidecarInjector
+}
+
 func sidecarInjector(collector string) *v1alpha1.SidecarInjector {
 	return &v1alpha1.SidecarInjector{
 		ObjectMeta: metav1.ObjectMeta{
@@ -16,6 +29,7 @@ func sidecarInjector(collector string) *v1alpha1.SidecarInjector {
 		},
 		Spec: v1alpha1.SidecarInjectorSpec{
 			Collector: collector,
+			Default:   ptr.To(true),
 		},
 	}
 }
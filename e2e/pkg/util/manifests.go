@@ -29,19 +29,32 @@ import (
 	"k8s.io/klog/v2"
 )
 
+var crdFiles = []string{
+	"../config/crd/operator.h3poteto.dev_sidecarinjectors.yaml",
+	"../config/crd/operator.h3poteto.dev_sidecarinjectorpolicies.yaml",
+}
+
+var rbacFiles = []string{
+	"../config/rbac/role.yaml",
+	"../config/rbac/webhook_role.yaml",
+}
+
 // ApplyCRD applies custom resource definitions for sidecar-injector which is located in cmd/config/crd.
 func ApplyCRD(ctx context.Context, cfg *rest.Config) error {
 	p, err := os.Getwd()
 	if err != nil {
 		return err
 	}
-	path := filepath.Join(p, "../config/crd/operator.h3poteto.dev_sidecarinjectors.yaml")
-
-	buf, err := ioutil.ReadFile(path)
-	if err != nil {
-		return err
+	for _, file := range crdFiles {
+		buf, err := ioutil.ReadFile(filepath.Join(p, file))
+		if err != nil {
+			return err
+		}
+		if err := apply(ctx, cfg, buf); err != nil {
+			return err
+		}
 	}
-	return apply(ctx, cfg, buf)
+	return nil
 }
 
 // DeleteCRD deletes custom resource definitions for sidecar-injector.
@@ -50,28 +63,34 @@ func DeleteCRD(ctx context.Context, cfg *rest.Config) error {
 	if err != nil {
 		return err
 	}
-	path := filepath.Join(p, "../config/crd/operator.h3poteto.dev_sidecarinjectors.yaml")
-
-	buf, err := ioutil.ReadFile(path)
-	if err != nil {
-		return err
+	for _, file := range crdFiles {
+		buf, err := ioutil.ReadFile(filepath.Join(p, file))
+		if err != nil {
+			return err
+		}
+		if err := delete(ctx, cfg, buf); err != nil {
+			return err
+		}
 	}
-	return delete(ctx, cfg, buf)
+	return nil
 }
 
-// ApplyRBAC applies role based access control for operator which is located in cmd/config/rbac.
+// ApplyRBAC applies role based access control for operator and webhook servers which is located in cmd/config/rbac.
 func ApplyRBAC(ctx context.Context, cfg *rest.Config) error {
 	p, err := os.Getwd()
 	if err != nil {
 		return err
 	}
-	path := filepath.Join(p, "../config/rbac/role.yaml")
-
-	buf, err := ioutil.ReadFile(path)
-	if err != nil {
-		return err
+	for _, file := range rbacFiles {
+		buf, err := ioutil.ReadFile(filepath.Join(p, file))
+		if err != nil {
+			return err
+		}
+		if err := apply(ctx, cfg, buf); err != nil {
+			return err
+		}
 	}
-	return apply(ctx, cfg, buf)
+	return nil
 }
 
 // DeleteRBAC deletes role based access control for operator.
@@ -80,13 +99,16 @@ func DeleteRBAC(ctx context.Context, cfg *rest.Config) error {
 	if err != nil {
 		return err
 	}
-	path := filepath.Join(p, "../config/rbac/role.yaml")
-
-	buf, err := ioutil.ReadFile(path)
-	if err != nil {
-		return err
+	for _, file := range rbacFiles {
+		buf, err := ioutil.ReadFile(filepath.Join(p, file))
+		if err != nil {
+			return err
+		}
+		if err := delete(ctx, cfg, buf); err != nil {
+			return err
+		}
 	}
-	return delete(ctx, cfg, buf)
+	return nil
 }
 
 func apply(ctx context.Context, cfg *rest.Config, data []byte) error {
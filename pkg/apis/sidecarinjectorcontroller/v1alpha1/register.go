@@ -23,6 +23,8 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&SidecarInjector{},
 		&SidecarInjectorList{},
+		&SidecarInjectorPolicy{},
+		&SidecarInjectorPolicyList{},
 	)
 
 	scheme.AddKnownTypes(SchemeGroupVersion,
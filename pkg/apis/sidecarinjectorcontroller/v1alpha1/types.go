@@ -1,12 +1,20 @@
 package v1alpha1
 
-import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+import (
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
 
 // +genclient
 // +genclient:nonNamespaced
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 // +kubebuilder:object:root=true
 // +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Collector",type=string,JSONPath=`.spec.collector`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Injected",type=integer,JSONPath=`.status.injectedPodCount`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // SidecarInjector is a top-level type. A client is created for it.
 type SidecarInjector struct {
@@ -22,8 +30,8 @@ type SidecarInjectorSpec struct {
 	// +kubebuilder:validation:Required
 	// +kubebuilder:validation:Type:=string
 	// +kubebuilder:default=fluentd
-	// +kubebuilder:validation:Enum=fluentd;fluent-bit
-	// Default collector name which you want to inject. The name must be fluentd or fluent-bit. Default is fluentd.
+	// +kubebuilder:validation:Enum=fluentd;fluent-bit;otel-collector
+	// Default collector name which you want to inject. The name must be fluentd, fluent-bit or otel-collector. Default is fluentd.
 	Collector string `json:"collector"`
 	// +optional
 	// +nullable
@@ -33,6 +41,63 @@ type SidecarInjectorSpec struct {
 	// +nullable
 	// Please specify this argument when you specify fluent-bit as collector
 	FluentBit *FluentBitSpec `json:"fluentbit"`
+	// +optional
+	// +nullable
+	// Please specify this argument when you specify otel-collector as collector.
+	OtelCollector *OtelCollectorSpec `json:"otelCollector,omitempty"`
+	// +optional
+	// +nullable
+	// Inject the collector as a native sidecar, which is an init container with restartPolicy Always. It requires Kubernetes 1.29 or later.
+	NativeSidecar *bool `json:"nativeSidecar,omitempty"`
+	// +optional
+	// +nullable
+	// Inject pods which do not specify a SidecarInjector in the injector annotation. Other SidecarInjectors only inject pods whose annotation is their name.
+	// Only one SidecarInjector should be the default. Default is false.
+	Default *bool `json:"default,omitempty"`
+	// +optional
+	// +nullable
+	// Reject pods which have unknown or malformed annotations of the injector. Otherwise they are returned as warnings. Default is false.
+	StrictAnnotations *bool `json:"strictAnnotations,omitempty"`
+	// +optional
+	// +nullable
+	// Only pods in namespaces which match this selector are sent to the webhook. Default is all namespaces.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// +optional
+	// +nullable
+	// Only pods which match this selector are sent to the webhook. Pods of the webhook server are always excluded.
+	ObjectSelector *metav1.LabelSelector `json:"objectSelector,omitempty"`
+	// +optional
+	// +kubebuilder:default=Ignore
+	// +kubebuilder:validation:Enum=Ignore;Fail
+	// How the API server handles errors of the webhook. If Fail, pods are rejected while the webhook server is unavailable. Default is Ignore.
+	FailurePolicy *admissionregistrationv1.FailurePolicyType `json:"failurePolicy,omitempty"`
+	// +optional
+	// +kubebuilder:default=30
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=30
+	// Timeout of the webhook in seconds. Default is 30.
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+	// +optional
+	// +kubebuilder:default=Equivalent
+	// +kubebuilder:validation:Enum=Exact;Equivalent
+	// How the rules of the webhook match requests to other versions of pods. Default is Equivalent.
+	MatchPolicy *admissionregistrationv1.MatchPolicyType `json:"matchPolicy,omitempty"`
+	// +optional
+	// +kubebuilder:default=None
+	// +kubebuilder:validation:Enum=None;NoneOnDryRun
+	// Side effects of the webhook. Default is None.
+	SideEffects *admissionregistrationv1.SideEffectClass `json:"sideEffects,omitempty"`
+	// +optional
+	// Namespaces which are excluded from the webhook in addition to kube-system and the namespace of the controller.
+	ExcludedNamespaces []string `json:"excludedNamespaces,omitempty"`
+	// +optional
+	// +nullable
+	// Pipeline of the collector. The controller renders fluent.conf and fluent-bit.conf from it into a ConfigMap in namespaces of the webhook, and the ConfigMap is mounted to the sidecar.
+	Pipeline *PipelineSpec `json:"pipeline,omitempty"`
+	// +optional
+	// +nullable
+	// Output of the sidecar. If the type is not forward, the sidecar sends logs to the backend directly, and the aggregator is not required.
+	Output *OutputSpec `json:"output,omitempty"`
 }
 
 // SdecarInjectorStatus defines the observed state of SidecarInjector
@@ -42,8 +107,42 @@ type SidecarInjectorStatus struct {
 	InjectorPodCount int32 `json:"injectorPodCount"`
 	// Whether the webhook service is available.
 	InjectorServiceReady bool `json:"injectorServiceReady"`
+	// +optional
+	// +nullable
+	// Expiration time of the webhook server certificate.
+	CertificateNotAfter *metav1.Time `json:"certificateNotAfter,omitempty"`
+	// +optional
+	// The generation of the spec which is observed by the controller.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// Conditions of the SidecarInjector, which are CertificateReady, WebhookConfigured, DeploymentAvailable, ServiceEndpointsReady, Ready and ForwardSecretsFound.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// +optional
+	// SHA-256 hash of the caBundle in the MutatingWebhookConfiguration.
+	WebhookCABundleHash string `json:"webhookCABundleHash,omitempty"`
+	// +optional
+	// Number of running pods which the sidecar is injected to by this SidecarInjector.
+	InjectedPodCount int32 `json:"injectedPodCount"`
 }
 
+// Condition types of SidecarInjector.
+const (
+	// ConditionCertificateReady indicates that the webhook server has a valid certificate.
+	ConditionCertificateReady = "CertificateReady"
+	// ConditionWebhookConfigured indicates that the MutatingWebhookConfiguration exists with caBundle.
+	ConditionWebhookConfigured = "WebhookConfigured"
+	// ConditionDeploymentAvailable indicates that the Deployment of the webhook server is available.
+	ConditionDeploymentAvailable = "DeploymentAvailable"
+	// ConditionServiceEndpointsReady indicates that the Service of the webhook server has ready endpoints.
+	ConditionServiceEndpointsReady = "ServiceEndpointsReady"
+	// ConditionReady indicates that all other conditions are true, and the webhook server injects sidecars.
+	ConditionReady = "Ready"
+	// ConditionForwardSecretsFound indicates that Secrets of the forward security exist in namespaces of the webhook. It does not affect Ready.
+	ConditionForwardSecretsFound = "ForwardSecretsFound"
+)
+
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 // +kubebuilder:object:root=true
 
@@ -68,6 +167,9 @@ type FluentDSpec struct {
 	// A FluentD port number as a aggregator.
 	AggregatorPort int32 `json:"aggregatorPort"`
 	// +optional
+	// Aggregators which the sidecar balances logs between, and fails over to. They are used instead of aggregatorHost.
+	Aggregators []AggregatorServer `json:"aggregators,omitempty"`
+	// +optional
 	// Lod directory path in your pods. SidecarInjector will mount a volume in this directory, and share it with injected fluentd pod. So fluentd pod can read application logs in this volume.
 	ApplicationLogDir string `json:"applicationLogDir"`
 	// +optional
@@ -82,6 +184,10 @@ type FluentDSpec struct {
 	// +optional
 	// Additional environment variables for SidecarInjector
 	CustomEnv string `json:"customEnv"`
+	// +optional
+	// +nullable
+	// TLS and authentication of the forward protocol to the aggregator.
+	Security *ForwardSecuritySpec `json:"security,omitempty"`
 }
 
 // FluentBitSpec describe fluent-bit options for SidecarInjector.
@@ -96,6 +202,10 @@ type FluentBitSpec struct {
 	// A FluentD port number as a aggregator.
 	AggregatorPort int32 `json:"aggregatorPort"`
 	// +optional
+	// +kubebuilder:validation:XValidation:rule="self.all(s, !has(s.standby) || !s.standby)",message="standby is not supported by fluent-bit"
+	// Aggregators which the sidecar balances logs between. They are used instead of aggregatorHost. fluent-bit can not fail over, so standby is not supported.
+	Aggregators []AggregatorServer `json:"aggregators,omitempty"`
+	// +optional
 	// Lod directory path in your pods. SidecarInjector will mount a volume in this directory, and share it with injected fluent-bit pod. So fluent-bit pod can read application logs in this volume.
 	ApplicationLogDir string `json:"applicationLogDir"`
 	// +optional
@@ -104,4 +214,330 @@ type FluentBitSpec struct {
 	// +optional
 	// Additional environment variables for SidecarInjector
 	CustomEnv string `json:"customEnv"`
+	// +optional
+	// +nullable
+	// TLS and authentication of the forward protocol to the aggregator.
+	Security *ForwardSecuritySpec `json:"security,omitempty"`
+}
+
+// Protocols of OtelCollectorSpec.
+const (
+	OTLPProtocolGRPC = "grpc"
+	OTLPProtocolHTTP = "http"
+)
+
+// OtelCollectorSpec describes OpenTelemetry Collector options for SidecarInjector.
+// The collector tails logs in the log volume with the filelog receiver, and exports them with OTLP.
+type OtelCollectorSpec struct {
+	// +optional
+	// Docker image name which you want to inject to your pods as sidecars. It requires the filelog receiver, for example otel/opentelemetry-collector-contrib:latest
+	DockerImage string `json:"dockerImage,omitempty"`
+	// +optional
+	// OTLP endpoint which the collector exports logs to, for example otel-gateway.monitoring.svc:4317 for grpc and http://otel-gateway.monitoring.svc:4318 for http.
+	Endpoint string `json:"endpoint,omitempty"`
+	// +optional
+	// +kubebuilder:validation:Enum=grpc;http
+	// Protocol of OTLP. Default is grpc.
+	Protocol string `json:"protocol,omitempty"`
+	// +optional
+	// Export logs without TLS.
+	Insecure bool `json:"insecure,omitempty"`
+	// +optional
+	// Log directory path in your pods. SidecarInjector will mount a volume in this directory, and share it with the injected collector.
+	ApplicationLogDir string `json:"applicationLogDir,omitempty"`
+	// +optional
+	// This tag is prefix of tags of log sources, which are set to the tag attribute of records.
+	TagPrefix string `json:"tagPrefix,omitempty"`
+	// +optional
+	// Additional environment variables for SidecarInjector
+	CustomEnv string `json:"customEnv,omitempty"`
+}
+
+// AggregatorServer describes one of aggregators of the forward output.
+type AggregatorServer struct {
+	// Hostname of the aggregator.
+	Host string `json:"host"`
+	// +optional
+	// Port number of the aggregator. Default is aggregatorPort.
+	Port int32 `json:"port,omitempty"`
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// Weight of load balancing between active aggregators. Default is 60. It is ignored by fluent-bit.
+	Weight int32 `json:"weight,omitempty"`
+	// +optional
+	// Standby aggregators receive logs only when all active aggregators are down.
+	Standby bool `json:"standby,omitempty"`
+	// +optional
+	// Zone of the aggregator. Aggregators in other zones are used as standby, if the zone of the pod has active aggregators.
+	Zone string `json:"zone,omitempty"`
+}
+
+// ForwardSecuritySpec describes TLS and authentication of the forward protocol. Secrets are read in the namespace of pods.
+type ForwardSecuritySpec struct {
+	// +optional
+	// Connect to the aggregator with TLS.
+	TLS bool `json:"tls,omitempty"`
+	// +optional
+	// +nullable
+	// Verify the certificate and the hostname of the aggregator. Default is true.
+	TLSVerify *bool `json:"tlsVerify,omitempty"`
+	// +optional
+	// Name of a Secret which has ca.crt to verify the aggregator.
+	CASecretName string `json:"caSecretName,omitempty"`
+	// +optional
+	// Name of a Secret which has tls.crt and tls.key of the client certificate.
+	ClientCertSecretName string `json:"clientCertSecretName,omitempty"`
+	// +optional
+	// Name of a Secret which has shared_key of the aggregator.
+	SharedKeySecretName string `json:"sharedKeySecretName,omitempty"`
+	// +optional
+	// Name of a Secret which has username and password of the aggregator. It requires the shared key.
+	UserSecretName string `json:"userSecretName,omitempty"`
+}
+
+// Keys of Secrets of the forward security. The client certificate and the user are the keys of kubernetes.io/tls and kubernetes.io/basic-auth Secrets.
+const (
+	ForwardCAKey        = "ca.crt"
+	ForwardSharedKeyKey = "shared_key"
+)
+
+// Types of OutputSpec.
+const (
+	OutputForward       = "forward"
+	OutputStdout        = "stdout"
+	OutputElasticsearch = "elasticsearch"
+	OutputOpenSearch    = "opensearch"
+	OutputLoki          = "loki"
+	OutputS3            = "s3"
+	OutputKafka         = "kafka"
+	OutputHTTP          = "http"
+)
+
+// OutputSpec describes a backend which the sidecar sends logs to. Only the field of the type is used.
+type OutputSpec struct {
+	// +kubebuilder:validation:Enum=forward;stdout;elasticsearch;opensearch;loki;s3;kafka;http
+	// Type of the output. forward sends logs to the aggregator.
+	Type string `json:"type"`
+	// +optional
+	// Name of a Secret which has credentials of the backend in the namespace of pods.
+	// It has username and password for basic authentication and SASL of Kafka, or access_key_id and secret_access_key for S3.
+	CredentialsSecretName string `json:"credentialsSecretName,omitempty"`
+	// +optional
+	// +nullable
+	// It is required if the type is elasticsearch.
+	Elasticsearch *SearchOutputSpec `json:"elasticsearch,omitempty"`
+	// +optional
+	// +nullable
+	// It is required if the type is opensearch.
+	OpenSearch *SearchOutputSpec `json:"opensearch,omitempty"`
+	// +optional
+	// +nullable
+	// It is required if the type is loki.
+	Loki *LokiOutputSpec `json:"loki,omitempty"`
+	// +optional
+	// +nullable
+	// It is required if the type is s3.
+	S3 *S3OutputSpec `json:"s3,omitempty"`
+	// +optional
+	// +nullable
+	// It is required if the type is kafka.
+	Kafka *KafkaOutputSpec `json:"kafka,omitempty"`
+	// +optional
+	// +nullable
+	// It is required if the type is http.
+	HTTP *HTTPOutputSpec `json:"http,omitempty"`
+}
+
+// SearchOutputSpec describes Elasticsearch or OpenSearch.
+type SearchOutputSpec struct {
+	// +kubebuilder:validation:MinLength=1
+	// Hostname of the cluster.
+	Host string `json:"host"`
+	// +optional
+	// Port number of the cluster. Default is 9200.
+	Port int32 `json:"port,omitempty"`
+	// +optional
+	// Connect to the cluster with TLS.
+	TLS bool `json:"tls,omitempty"`
+	// +optional
+	// Index of records. Default is fluentd.
+	Index string `json:"index,omitempty"`
+}
+
+// LokiOutputSpec describes Grafana Loki.
+type LokiOutputSpec struct {
+	// +kubebuilder:validation:MinLength=1
+	// Base URL of Loki, for example http://loki.monitoring.svc:3100, or http://gateway.monitoring.svc/loki behind a path prefix.
+	// /loki/api/v1/push is appended to it, so it must not contain the push path and queries.
+	URL string `json:"url"`
+	// +optional
+	// Labels of log streams. Default is job=fluentd-sidecar-injector.
+	Labels map[string]string `json:"labels,omitempty"`
+	// +optional
+	// Tenant ID of multi-tenant Loki.
+	TenantID string `json:"tenantID,omitempty"`
+}
+
+// S3OutputSpec describes Amazon S3 or S3 compatible storage.
+type S3OutputSpec struct {
+	// +kubebuilder:validation:MinLength=1
+	// Name of the bucket.
+	Bucket string `json:"bucket"`
+	// +optional
+	// Region of the bucket. Default is us-east-1.
+	Region string `json:"region,omitempty"`
+	// +optional
+	// Endpoint of S3 compatible storage such as MinIO. Path style requests are used if it is specified.
+	Endpoint string `json:"endpoint,omitempty"`
+	// +optional
+	// Prefix of object keys.
+	PathPrefix string `json:"pathPrefix,omitempty"`
+}
+
+// KafkaOutputSpec describes Apache Kafka.
+type KafkaOutputSpec struct {
+	// +kubebuilder:validation:MinItems=1
+	// Brokers of the cluster, for example kafka-0.kafka:9092.
+	Brokers []string `json:"brokers"`
+	// +kubebuilder:validation:MinLength=1
+	// Topic of records.
+	Topic string `json:"topic"`
+	// +optional
+	// Connect to brokers with TLS.
+	TLS bool `json:"tls,omitempty"`
+}
+
+// HTTPOutputSpec describes an HTTP endpoint which receives records as JSON.
+type HTTPOutputSpec struct {
+	// +kubebuilder:validation:MinLength=1
+	// URL of the endpoint, for example https://logs.example.com/ingest.
+	URL string `json:"url"`
+	// +optional
+	// Headers of requests.
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Keys of Secrets of S3 credentials. Other outputs use the keys of kubernetes.io/basic-auth Secrets.
+const (
+	OutputAccessKeyIDKey     = "access_key_id"
+	OutputSecretAccessKeyKey = "secret_access_key"
+)
+
+// PipelineSpec describes the configuration of the collector. Plugins are rendered in the order of the lists.
+type PipelineSpec struct {
+	// +optional
+	// Input plugins, which are source in fluentd and INPUT in fluent-bit.
+	Inputs []PipelinePlugin `json:"inputs,omitempty"`
+	// +optional
+	// Parsers which are referenced by inputs.
+	Parsers []PipelineParser `json:"parsers,omitempty"`
+	// +optional
+	// Filter plugins, which are filter in fluentd and FILTER in fluent-bit.
+	Filters []PipelinePlugin `json:"filters,omitempty"`
+	// +kubebuilder:validation:MinItems=1
+	// Output plugins, which are match in fluentd and OUTPUT in fluent-bit.
+	Outputs []PipelinePlugin `json:"outputs"`
+}
+
+// PipelinePlugin is a plugin of the collector.
+type PipelinePlugin struct {
+	// +kubebuilder:validation:MinLength=1
+	// Type of the plugin, for example tail or forward. It is @type in fluentd and Name in fluent-bit.
+	Type string `json:"type"`
+	// +optional
+	// Tag of records which are read by the input.
+	Tag string `json:"tag,omitempty"`
+	// +optional
+	// Pattern of tags for filters and outputs. Default is ** in fluentd and * in fluent-bit.
+	Match string `json:"match,omitempty"`
+	// +optional
+	// Name of the parser for the input.
+	Parser string `json:"parser,omitempty"`
+	// +optional
+	// Parameters of the plugin. Environment variables of the sidecar can be used, for example "#{ENV['AGGREGATOR_HOST']}" in fluentd and ${AGGREGATOR_HOST} in fluent-bit.
+	Parameters map[string]string `json:"parameters,omitempty"`
+	// +optional
+	// Sub sections of the plugin, for example server in the forward output of fluentd. They are not used in fluent-bit.
+	Sections []PipelineSection `json:"sections,omitempty"`
+}
+
+// PipelineSection is a sub section of a fluentd plugin.
+type PipelineSection struct {
+	// +kubebuilder:validation:MinLength=1
+	// Name of the section, for example server or buffer.
+	Name string `json:"name"`
+	// +optional
+	// Parameters of the section.
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// PipelineParser is a parser for inputs.
+type PipelineParser struct {
+	// +kubebuilder:validation:MinLength=1
+	// Name of the parser, which is referenced by inputs.
+	Name string `json:"name"`
+	// +kubebuilder:validation:MinLength=1
+	// Format of the parser, for example json or regexp. It is @type in fluentd and Format in fluent-bit.
+	Format string `json:"format"`
+	// +optional
+	// Parameters of the parser.
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Namespaced
+
+// SidecarInjectorPolicy is a namespaced resource which overrides defaults of SidecarInjector for pods in the namespace.
+type SidecarInjectorPolicy struct {
+	metav1.TypeMeta `json:",inline"`
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              SidecarInjectorPolicySpec `json:"spec"`
+}
+
+// SidecarInjectorPolicySpec defines defaults for pods in the namespace. Empty fields fall back to SidecarInjector, and pod annotations override all of them.
+type SidecarInjectorPolicySpec struct {
+	// +optional
+	// +kubebuilder:validation:Type:=string
+	// +kubebuilder:validation:Enum=fluentd;fluent-bit;otel-collector
+	// Default collector name in the namespace. The name must be fluentd, fluent-bit or otel-collector.
+	Collector string `json:"collector,omitempty"`
+	// +optional
+	// +nullable
+	// Defaults for fluentd in the namespace.
+	FluentD *FluentDSpec `json:"fluentd"`
+	// +optional
+	// +nullable
+	// Defaults for fluent-bit in the namespace.
+	FluentBit *FluentBitSpec `json:"fluentbit"`
+	// +optional
+	// +nullable
+	// Defaults for otel-collector in the namespace.
+	OtelCollector *OtelCollectorSpec `json:"otelCollector,omitempty"`
+	// +optional
+	// +nullable
+	// Whether the collector is injected as a native sidecar in the namespace.
+	NativeSidecar *bool `json:"nativeSidecar,omitempty"`
+	// +optional
+	// +nullable
+	// Whether pods which have unknown or malformed annotations are rejected in the namespace.
+	StrictAnnotations *bool `json:"strictAnnotations,omitempty"`
+	// +optional
+	// +nullable
+	// Output of the sidecar in the namespace.
+	Output *OutputSpec `json:"output,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+
+// SidecarInjectorPolicyList
+type SidecarInjectorPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	// +optional
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []SidecarInjectorPolicy `json:"items"`
 }
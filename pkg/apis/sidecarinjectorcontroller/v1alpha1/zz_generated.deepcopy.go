@@ -22,12 +22,40 @@ limitations under the License.
 package v1alpha1
 
 import (
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AggregatorServer) DeepCopyInto(out *AggregatorServer) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AggregatorServer.
+func (in *AggregatorServer) DeepCopy() *AggregatorServer {
+	if in == nil {
+		return nil
+	}
+	out := new(AggregatorServer)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FluentBitSpec) DeepCopyInto(out *FluentBitSpec) {
 	*out = *in
+	if in.Aggregators != nil {
+		in, out := &in.Aggregators, &out.Aggregators
+		*out = make([]AggregatorServer, len(*in))
+		copy(*out, *in)
+	}
+	if in.Security != nil {
+		in, out := &in.Security, &out.Security
+		*out = new(ForwardSecuritySpec)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -44,6 +72,16 @@ func (in *FluentBitSpec) DeepCopy() *FluentBitSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FluentDSpec) DeepCopyInto(out *FluentDSpec) {
 	*out = *in
+	if in.Aggregators != nil {
+		in, out := &in.Aggregators, &out.Aggregators
+		*out = make([]AggregatorServer, len(*in))
+		copy(*out, *in)
+	}
+	if in.Security != nil {
+		in, out := &in.Security, &out.Security
+		*out = new(ForwardSecuritySpec)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -57,13 +95,315 @@ func (in *FluentDSpec) DeepCopy() *FluentDSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ForwardSecuritySpec) DeepCopyInto(out *ForwardSecuritySpec) {
+	*out = *in
+	if in.TLSVerify != nil {
+		in, out := &in.TLSVerify, &out.TLSVerify
+		*out = new(bool)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ForwardSecuritySpec.
+func (in *ForwardSecuritySpec) DeepCopy() *ForwardSecuritySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ForwardSecuritySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HTTPOutputSpec) DeepCopyInto(out *HTTPOutputSpec) {
+	*out = *in
+	if in.Headers != nil {
+		in, out := &in.Headers, &out.Headers
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HTTPOutputSpec.
+func (in *HTTPOutputSpec) DeepCopy() *HTTPOutputSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(HTTPOutputSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KafkaOutputSpec) DeepCopyInto(out *KafkaOutputSpec) {
+	*out = *in
+	if in.Brokers != nil {
+		in, out := &in.Brokers, &out.Brokers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KafkaOutputSpec.
+func (in *KafkaOutputSpec) DeepCopy() *KafkaOutputSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KafkaOutputSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LokiOutputSpec) DeepCopyInto(out *LokiOutputSpec) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LokiOutputSpec.
+func (in *LokiOutputSpec) DeepCopy() *LokiOutputSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(LokiOutputSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OtelCollectorSpec) DeepCopyInto(out *OtelCollectorSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OtelCollectorSpec.
+func (in *OtelCollectorSpec) DeepCopy() *OtelCollectorSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(OtelCollectorSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OutputSpec) DeepCopyInto(out *OutputSpec) {
+	*out = *in
+	if in.Elasticsearch != nil {
+		in, out := &in.Elasticsearch, &out.Elasticsearch
+		*out = new(SearchOutputSpec)
+		**out = **in
+	}
+	if in.OpenSearch != nil {
+		in, out := &in.OpenSearch, &out.OpenSearch
+		*out = new(SearchOutputSpec)
+		**out = **in
+	}
+	if in.Loki != nil {
+		in, out := &in.Loki, &out.Loki
+		*out = new(LokiOutputSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.S3 != nil {
+		in, out := &in.S3, &out.S3
+		*out = new(S3OutputSpec)
+		**out = **in
+	}
+	if in.Kafka != nil {
+		in, out := &in.Kafka, &out.Kafka
+		*out = new(KafkaOutputSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HTTP != nil {
+		in, out := &in.HTTP, &out.HTTP
+		*out = new(HTTPOutputSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OutputSpec.
+func (in *OutputSpec) DeepCopy() *OutputSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(OutputSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PipelineParser) DeepCopyInto(out *PipelineParser) {
+	*out = *in
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PipelineParser.
+func (in *PipelineParser) DeepCopy() *PipelineParser {
+	if in == nil {
+		return nil
+	}
+	out := new(PipelineParser)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PipelinePlugin) DeepCopyInto(out *PipelinePlugin) {
+	*out = *in
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Sections != nil {
+		in, out := &in.Sections, &out.Sections
+		*out = make([]PipelineSection, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PipelinePlugin.
+func (in *PipelinePlugin) DeepCopy() *PipelinePlugin {
+	if in == nil {
+		return nil
+	}
+	out := new(PipelinePlugin)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PipelineSection) DeepCopyInto(out *PipelineSection) {
+	*out = *in
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PipelineSection.
+func (in *PipelineSection) DeepCopy() *PipelineSection {
+	if in == nil {
+		return nil
+	}
+	out := new(PipelineSection)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PipelineSpec) DeepCopyInto(out *PipelineSpec) {
+	*out = *in
+	if in.Inputs != nil {
+		in, out := &in.Inputs, &out.Inputs
+		*out = make([]PipelinePlugin, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Parsers != nil {
+		in, out := &in.Parsers, &out.Parsers
+		*out = make([]PipelineParser, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Filters != nil {
+		in, out := &in.Filters, &out.Filters
+		*out = make([]PipelinePlugin, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Outputs != nil {
+		in, out := &in.Outputs, &out.Outputs
+		*out = make([]PipelinePlugin, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PipelineSpec.
+func (in *PipelineSpec) DeepCopy() *PipelineSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PipelineSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *S3OutputSpec) DeepCopyInto(out *S3OutputSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new S3OutputSpec.
+func (in *S3OutputSpec) DeepCopy() *S3OutputSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(S3OutputSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SearchOutputSpec) DeepCopyInto(out *SearchOutputSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SearchOutputSpec.
+func (in *SearchOutputSpec) DeepCopy() *SearchOutputSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SearchOutputSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SidecarInjector) DeepCopyInto(out *SidecarInjector) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -119,18 +459,189 @@ func (in *SidecarInjectorList) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *SidecarInjectorSpec) DeepCopyInto(out *SidecarInjectorSpec) {
+func (in *SidecarInjectorPolicy) DeepCopyInto(out *SidecarInjectorPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SidecarInjectorPolicy.
+func (in *SidecarInjectorPolicy) DeepCopy() *SidecarInjectorPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(SidecarInjectorPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SidecarInjectorPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SidecarInjectorPolicyList) DeepCopyInto(out *SidecarInjectorPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]SidecarInjectorPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SidecarInjectorPolicyList.
+func (in *SidecarInjectorPolicyList) DeepCopy() *SidecarInjectorPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(SidecarInjectorPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SidecarInjectorPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SidecarInjectorPolicySpec) DeepCopyInto(out *SidecarInjectorPolicySpec) {
 	*out = *in
 	if in.FluentD != nil {
 		in, out := &in.FluentD, &out.FluentD
 		*out = new(FluentDSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.FluentBit != nil {
+		in, out := &in.FluentBit, &out.FluentBit
+		*out = new(FluentBitSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OtelCollector != nil {
+		in, out := &in.OtelCollector, &out.OtelCollector
+		*out = new(OtelCollectorSpec)
 		**out = **in
 	}
+	if in.NativeSidecar != nil {
+		in, out := &in.NativeSidecar, &out.NativeSidecar
+		*out = new(bool)
+		**out = **in
+	}
+	if in.StrictAnnotations != nil {
+		in, out := &in.StrictAnnotations, &out.StrictAnnotations
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Output != nil {
+		in, out := &in.Output, &out.Output
+		*out = new(OutputSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SidecarInjectorPolicySpec.
+func (in *SidecarInjectorPolicySpec) DeepCopy() *SidecarInjectorPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SidecarInjectorPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SidecarInjectorSpec) DeepCopyInto(out *SidecarInjectorSpec) {
+	*out = *in
+	if in.FluentD != nil {
+		in, out := &in.FluentD, &out.FluentD
+		*out = new(FluentDSpec)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.FluentBit != nil {
 		in, out := &in.FluentBit, &out.FluentBit
 		*out = new(FluentBitSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OtelCollector != nil {
+		in, out := &in.OtelCollector, &out.OtelCollector
+		*out = new(OtelCollectorSpec)
+		**out = **in
+	}
+	if in.NativeSidecar != nil {
+		in, out := &in.NativeSidecar, &out.NativeSidecar
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Default != nil {
+		in, out := &in.Default, &out.Default
+		*out = new(bool)
+		**out = **in
+	}
+	if in.StrictAnnotations != nil {
+		in, out := &in.StrictAnnotations, &out.StrictAnnotations
+		*out = new(bool)
+		**out = **in
+	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ObjectSelector != nil {
+		in, out := &in.ObjectSelector, &out.ObjectSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.FailurePolicy != nil {
+		in, out := &in.FailurePolicy, &out.FailurePolicy
+		*out = new(admissionregistrationv1.FailurePolicyType)
 		**out = **in
 	}
+	if in.TimeoutSeconds != nil {
+		in, out := &in.TimeoutSeconds, &out.TimeoutSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MatchPolicy != nil {
+		in, out := &in.MatchPolicy, &out.MatchPolicy
+		*out = new(admissionregistrationv1.MatchPolicyType)
+		**out = **in
+	}
+	if in.SideEffects != nil {
+		in, out := &in.SideEffects, &out.SideEffects
+		*out = new(admissionregistrationv1.SideEffectClass)
+		**out = **in
+	}
+	if in.ExcludedNamespaces != nil {
+		in, out := &in.ExcludedNamespaces, &out.ExcludedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Pipeline != nil {
+		in, out := &in.Pipeline, &out.Pipeline
+		*out = new(PipelineSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Output != nil {
+		in, out := &in.Output, &out.Output
+		*out = new(OutputSpec)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -147,6 +658,17 @@ func (in *SidecarInjectorSpec) DeepCopy() *SidecarInjectorSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SidecarInjectorStatus) DeepCopyInto(out *SidecarInjectorStatus) {
 	*out = *in
+	if in.CertificateNotAfter != nil {
+		in, out := &in.CertificateNotAfter, &out.CertificateNotAfter
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -32,6 +32,10 @@ func (c *FakeOperatorV1alpha1) SidecarInjectors() v1alpha1.SidecarInjectorInterf
 	return newFakeSidecarInjectors(c)
 }
 
+func (c *FakeOperatorV1alpha1) SidecarInjectorPolicies(namespace string) v1alpha1.SidecarInjectorPolicyInterface {
+	return newFakeSidecarInjectorPolicies(c, namespace)
+}
+
 // RESTClient returns a RESTClient that is used to communicate
 // with API server by this client implementation.
 func (c *FakeOperatorV1alpha1) RESTClient() rest.Interface {
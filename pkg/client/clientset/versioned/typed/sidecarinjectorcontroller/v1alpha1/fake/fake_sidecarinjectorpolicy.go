@@ -0,0 +1,52 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	v1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	sidecarinjectorcontrollerv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/client/clientset/versioned/typed/sidecarinjectorcontroller/v1alpha1"
+	gentype "k8s.io/client-go/gentype"
+)
+
+// fakeSidecarInjectorPolicies implements SidecarInjectorPolicyInterface
+type fakeSidecarInjectorPolicies struct {
+	*gentype.FakeClientWithList[*v1alpha1.SidecarInjectorPolicy, *v1alpha1.SidecarInjectorPolicyList]
+	Fake *FakeOperatorV1alpha1
+}
+
+func newFakeSidecarInjectorPolicies(fake *FakeOperatorV1alpha1, namespace string) sidecarinjectorcontrollerv1alpha1.SidecarInjectorPolicyInterface {
+	return &fakeSidecarInjectorPolicies{
+		gentype.NewFakeClientWithList[*v1alpha1.SidecarInjectorPolicy, *v1alpha1.SidecarInjectorPolicyList](
+			fake.Fake,
+			namespace,
+			v1alpha1.SchemeGroupVersion.WithResource("sidecarinjectorpolicies"),
+			v1alpha1.SchemeGroupVersion.WithKind("SidecarInjectorPolicy"),
+			func() *v1alpha1.SidecarInjectorPolicy { return &v1alpha1.SidecarInjectorPolicy{} },
+			func() *v1alpha1.SidecarInjectorPolicyList { return &v1alpha1.SidecarInjectorPolicyList{} },
+			func(dst, src *v1alpha1.SidecarInjectorPolicyList) { dst.ListMeta = src.ListMeta },
+			func(list *v1alpha1.SidecarInjectorPolicyList) []*v1alpha1.SidecarInjectorPolicy {
+				return gentype.ToPointerSlice(list.Items)
+			},
+			func(list *v1alpha1.SidecarInjectorPolicyList, items []*v1alpha1.SidecarInjectorPolicy) {
+				list.Items = gentype.FromPointerSlice(items)
+			},
+		),
+		fake,
+	}
+}
@@ -29,6 +29,7 @@ import (
 type OperatorV1alpha1Interface interface {
 	RESTClient() rest.Interface
 	SidecarInjectorsGetter
+	SidecarInjectorPoliciesGetter
 }
 
 // OperatorV1alpha1Client is used to interact with features provided by the operator.h3poteto.dev group.
@@ -40,6 +41,10 @@ func (c *OperatorV1alpha1Client) SidecarInjectors() SidecarInjectorInterface {
 	return newSidecarInjectors(c)
 }
 
+func (c *OperatorV1alpha1Client) SidecarInjectorPolicies(namespace string) SidecarInjectorPolicyInterface {
+	return newSidecarInjectorPolicies(c, namespace)
+}
+
 // NewForConfig creates a new OperatorV1alpha1Client for the given config.
 // NewForConfig is equivalent to NewForConfigAndClient(c, httpClient),
 // where httpClient was generated with rest.HTTPClientFor(c).
@@ -0,0 +1,72 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	context "context"
+
+	sidecarinjectorcontrollerv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	scheme "github.com/h3poteto/fluentd-sidecar-injector/pkg/client/clientset/versioned/scheme"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	gentype "k8s.io/client-go/gentype"
+)
+
+// SidecarInjectorPoliciesGetter has a method to return a SidecarInjectorPolicyInterface.
+// A group's client should implement this interface.
+type SidecarInjectorPoliciesGetter interface {
+	SidecarInjectorPolicies(namespace string) SidecarInjectorPolicyInterface
+}
+
+// SidecarInjectorPolicyInterface has methods to work with SidecarInjectorPolicy resources.
+type SidecarInjectorPolicyInterface interface {
+	Create(ctx context.Context, sidecarInjectorPolicy *sidecarinjectorcontrollerv1alpha1.SidecarInjectorPolicy, opts v1.CreateOptions) (*sidecarinjectorcontrollerv1alpha1.SidecarInjectorPolicy, error)
+	Update(ctx context.Context, sidecarInjectorPolicy *sidecarinjectorcontrollerv1alpha1.SidecarInjectorPolicy, opts v1.UpdateOptions) (*sidecarinjectorcontrollerv1alpha1.SidecarInjectorPolicy, error)
+	Delete(ctx context.Context, name string, opts v1.DeleteOptions) error
+	DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error
+	Get(ctx context.Context, name string, opts v1.GetOptions) (*sidecarinjectorcontrollerv1alpha1.SidecarInjectorPolicy, error)
+	List(ctx context.Context, opts v1.ListOptions) (*sidecarinjectorcontrollerv1alpha1.SidecarInjectorPolicyList, error)
+	Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *sidecarinjectorcontrollerv1alpha1.SidecarInjectorPolicy, err error)
+	SidecarInjectorPolicyExpansion
+}
+
+// sidecarInjectorPolicies implements SidecarInjectorPolicyInterface
+type sidecarInjectorPolicies struct {
+	*gentype.ClientWithList[*sidecarinjectorcontrollerv1alpha1.SidecarInjectorPolicy, *sidecarinjectorcontrollerv1alpha1.SidecarInjectorPolicyList]
+}
+
+// newSidecarInjectorPolicies returns a SidecarInjectorPolicies
+func newSidecarInjectorPolicies(c *OperatorV1alpha1Client, namespace string) *sidecarInjectorPolicies {
+	return &sidecarInjectorPolicies{
+		gentype.NewClientWithList[*sidecarinjectorcontrollerv1alpha1.SidecarInjectorPolicy, *sidecarinjectorcontrollerv1alpha1.SidecarInjectorPolicyList](
+			"sidecarinjectorpolicies",
+			c.RESTClient(),
+			scheme.ParameterCodec,
+			namespace,
+			func() *sidecarinjectorcontrollerv1alpha1.SidecarInjectorPolicy {
+				return &sidecarinjectorcontrollerv1alpha1.SidecarInjectorPolicy{}
+			},
+			func() *sidecarinjectorcontrollerv1alpha1.SidecarInjectorPolicyList {
+				return &sidecarinjectorcontrollerv1alpha1.SidecarInjectorPolicyList{}
+			},
+		),
+	}
+}
@@ -55,6 +55,8 @@ func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource
 	// Group=operator.h3poteto.dev, Version=v1alpha1
 	case v1alpha1.SchemeGroupVersion.WithResource("sidecarinjectors"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Operator().V1alpha1().SidecarInjectors().Informer()}, nil
+	case v1alpha1.SchemeGroupVersion.WithResource("sidecarinjectorpolicies"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Operator().V1alpha1().SidecarInjectorPolicies().Informer()}, nil
 
 	}
 
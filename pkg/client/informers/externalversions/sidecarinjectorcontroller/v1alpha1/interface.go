@@ -26,6 +26,8 @@ import (
 type Interface interface {
 	// SidecarInjectors returns a SidecarInjectorInformer.
 	SidecarInjectors() SidecarInjectorInformer
+	// SidecarInjectorPolicies returns a SidecarInjectorPolicyInformer.
+	SidecarInjectorPolicies() SidecarInjectorPolicyInformer
 }
 
 type version struct {
@@ -43,3 +45,8 @@ func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakList
 func (v *version) SidecarInjectors() SidecarInjectorInformer {
 	return &sidecarInjectorInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
 }
+
+// SidecarInjectorPolicies returns a SidecarInjectorPolicyInformer.
+func (v *version) SidecarInjectorPolicies() SidecarInjectorPolicyInformer {
+	return &sidecarInjectorPolicyInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
@@ -21,3 +21,11 @@ package v1alpha1
 // SidecarInjectorListerExpansion allows custom methods to be added to
 // SidecarInjectorLister.
 type SidecarInjectorListerExpansion interface{}
+
+// SidecarInjectorPolicyListerExpansion allows custom methods to be added to
+// SidecarInjectorPolicyLister.
+type SidecarInjectorPolicyListerExpansion interface{}
+
+// SidecarInjectorPolicyNamespaceListerExpansion allows custom methods to be added to
+// SidecarInjectorPolicyNamespaceLister.
+type SidecarInjectorPolicyNamespaceListerExpansion interface{}
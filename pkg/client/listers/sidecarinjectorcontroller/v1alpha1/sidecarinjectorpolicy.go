@@ -0,0 +1,70 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by lister-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	sidecarinjectorcontrollerv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	listers "k8s.io/client-go/listers"
+	cache "k8s.io/client-go/tools/cache"
+)
+
+// SidecarInjectorPolicyLister helps list SidecarInjectorPolicies.
+// All objects returned here must be treated as read-only.
+type SidecarInjectorPolicyLister interface {
+	// List lists all SidecarInjectorPolicies in the indexer.
+	// Objects returned here must be treated as read-only.
+	List(selector labels.Selector) (ret []*sidecarinjectorcontrollerv1alpha1.SidecarInjectorPolicy, err error)
+	// SidecarInjectorPolicies returns an object that can list and get SidecarInjectorPolicies.
+	SidecarInjectorPolicies(namespace string) SidecarInjectorPolicyNamespaceLister
+	SidecarInjectorPolicyListerExpansion
+}
+
+// sidecarInjectorPolicyLister implements the SidecarInjectorPolicyLister interface.
+type sidecarInjectorPolicyLister struct {
+	listers.ResourceIndexer[*sidecarinjectorcontrollerv1alpha1.SidecarInjectorPolicy]
+}
+
+// NewSidecarInjectorPolicyLister returns a new SidecarInjectorPolicyLister.
+func NewSidecarInjectorPolicyLister(indexer cache.Indexer) SidecarInjectorPolicyLister {
+	return &sidecarInjectorPolicyLister{listers.New[*sidecarinjectorcontrollerv1alpha1.SidecarInjectorPolicy](indexer, sidecarinjectorcontrollerv1alpha1.Resource("sidecarinjectorpolicy"))}
+}
+
+// SidecarInjectorPolicies returns an object that can list and get SidecarInjectorPolicies.
+func (s *sidecarInjectorPolicyLister) SidecarInjectorPolicies(namespace string) SidecarInjectorPolicyNamespaceLister {
+	return sidecarInjectorPolicyNamespaceLister{listers.NewNamespaced[*sidecarinjectorcontrollerv1alpha1.SidecarInjectorPolicy](s.ResourceIndexer, namespace)}
+}
+
+// SidecarInjectorPolicyNamespaceLister helps list and get SidecarInjectorPolicies.
+// All objects returned here must be treated as read-only.
+type SidecarInjectorPolicyNamespaceLister interface {
+	// List lists all SidecarInjectorPolicies in the indexer for a given namespace.
+	// Objects returned here must be treated as read-only.
+	List(selector labels.Selector) (ret []*sidecarinjectorcontrollerv1alpha1.SidecarInjectorPolicy, err error)
+	// Get retrieves the SidecarInjectorPolicy from the indexer for a given namespace and name.
+	// Objects returned here must be treated as read-only.
+	Get(name string) (*sidecarinjectorcontrollerv1alpha1.SidecarInjectorPolicy, error)
+	SidecarInjectorPolicyNamespaceListerExpansion
+}
+
+// sidecarInjectorPolicyNamespaceLister implements the SidecarInjectorPolicyNamespaceLister
+// interface.
+type sidecarInjectorPolicyNamespaceLister struct {
+	listers.ResourceIndexer[*sidecarinjectorcontrollerv1alpha1.SidecarInjectorPolicy]
+}
@@ -0,0 +1,201 @@
+package sidecarinjector
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// DefaultCAValidity is the default lifetime of self-signed CA certificates.
+	DefaultCAValidity = 360 * 24 * time.Hour
+	// DefaultCertificateValidity is the default lifetime of server certificates for webhook servers.
+	DefaultCertificateValidity = 90 * 24 * time.Hour
+	// DefaultCertificateRenewBefore is the default period before the expiration in which certificates are renewed.
+	DefaultCertificateRenewBefore = 30 * 24 * time.Hour
+	// previousCertName is a key of the CA secret to keep the previous CA certificate after rotation.
+	previousCertName = "previous.crt"
+)
+
+// certificateNotAfter returns the expiration time of the first certificate in the PEM data.
+func certificateNotAfter(data []byte) (time.Time, error) {
+	cert, err := parseCertificate(data)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cert.NotAfter, nil
+}
+
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("failed to decode certificate PEM")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// webhookCABundle returns the caBundle for the MutatingWebhookConfiguration from the CA secret.
+// It contains the previous CA certificate until it expires, because webhook pods reload a server certificate signed by the new CA with a delay.
+func webhookCABundle(caSecret *corev1.Secret, now time.Time) []byte {
+	bundle := append([]byte{}, caSecret.Data[caCertName]...)
+	previous, ok := caSecret.Data[previousCertName]
+	if !ok {
+		return bundle
+	}
+	if notAfter, err := certificateNotAfter(previous); err == nil && now.Before(notAfter) {
+		bundle = append(bundle, previous...)
+	}
+	return bundle
+}
+
+// needsRenewal returns true when the certificate is in the renewal window.
+func needsRenewal(notAfter, now time.Time, renewBefore time.Duration) bool {
+	return !now.Before(notAfter.Add(-renewBefore))
+}
+
+// rotateCASecret replaces the CA key pair, and keeps the current CA certificate as the previous one.
+func (c *Controller) rotateCASecret(ctx context.Context, sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, caSecret *corev1.Secret) (*corev1.Secret, error) {
+	desired, err := newCASecret(sidecarInjector, caSecret.Namespace, caSecret.Name, c.caValidity)
+	if err != nil {
+		return nil, err
+	}
+	desired.Data[previousCertName] = caSecret.Data[caCertName]
+	if _, err := c.dynamicClient.ApplyObject(ctx, desired, secretGVK); err != nil {
+		return nil, err
+	}
+	c.recordRotation(sidecarInjector, desired.Name, desired.Data[caCertName])
+	return desired, nil
+}
+
+// rotateSecret issues a new server certificate with the CA.
+func (c *Controller) rotateSecret(ctx context.Context, sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, secret, caSecret *corev1.Secret, serviceName string) (*corev1.Secret, error) {
+	desired, err := newSecret(sidecarInjector, secret.Namespace, serviceName, secret.Name, caSecret, c.certificateValidity)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.dynamicClient.ApplyObject(ctx, desired, secretGVK); err != nil {
+		return nil, err
+	}
+	c.recordRotation(sidecarInjector, desired.Name, desired.Data[serverCertName])
+	return desired, nil
+}
+
+func (c *Controller) recordRotation(sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, secretName string, cert []byte) {
+	notAfter, err := certificateNotAfter(cert)
+	if err != nil {
+		return
+	}
+	c.recorder.Eventf(sidecarInjector, corev1.EventTypeNormal, "CertificateRotated", "Certificate in Secret %q was rotated, and it expires at %s", secretName, notAfter.Format(time.RFC3339))
+}
+
+// syncCertificates ensures the CA secret and the secret for the webhook server, and renews certificates in them.
+// It returns the caBundle for the MutatingWebhookConfiguration and the expiration of the server certificate.
+func (c *Controller) syncCertificates(ctx context.Context, key string, sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, namespace, serviceName, secretName string) ([]byte, time.Time, error) {
+	now := time.Now()
+
+	// CA
+	caSecretName := caSecretNamePrefix + sidecarInjector.Name
+	caSecret, err := c.secretsLister.Secrets(namespace).Get(caSecretName)
+	if errors.IsNotFound(err) {
+		caSecret, err = newCASecret(sidecarInjector, namespace, caSecretName, c.caValidity)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		caSecret, err = c.kubeclientset.CoreV1().Secrets(namespace).Create(ctx, caSecret, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if !metav1.IsControlledBy(caSecret, sidecarInjector) {
+		msg := fmt.Sprintf("Resource %q already exists and is not managed by SidecarInjector", caSecret.Name)
+		c.recorder.Event(sidecarInjector, corev1.EventTypeWarning, "ErrResourceExists", msg)
+		return nil, time.Time{}, fmt.Errorf("%s", msg)
+	}
+	// The key pair can not be restored, so a new key pair is generated when the secret is broken.
+	caRotated := false
+	if fields := caSecretDrift(caSecret); len(fields) > 0 {
+		desired, err := newCASecret(sidecarInjector, namespace, caSecretName, c.caValidity)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		if err := c.correctDrift(ctx, sidecarInjector, desired, secretGVK, fields); err != nil {
+			return nil, time.Time{}, err
+		}
+		caSecret = desired
+		caRotated = true
+	}
+	caNotAfter, err := certificateNotAfter(caSecret.Data[caCertName])
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if needsRenewal(caNotAfter, now, c.certificateRenewBefore) {
+		if caSecret, err = c.rotateCASecret(ctx, sidecarInjector, caSecret); err != nil {
+			return nil, time.Time{}, err
+		}
+		if caNotAfter, err = certificateNotAfter(caSecret.Data[caCertName]); err != nil {
+			return nil, time.Time{}, err
+		}
+		caRotated = true
+	}
+
+	// Server certificate
+	secret, err := c.secretsLister.Secrets(namespace).Get(secretName)
+	if errors.IsNotFound(err) {
+		secret, err = newSecret(sidecarInjector, namespace, serviceName, secretName, caSecret, c.certificateValidity)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		secret, err = c.kubeclientset.CoreV1().Secrets(namespace).Create(ctx, secret, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if !metav1.IsControlledBy(secret, sidecarInjector) {
+		msg := fmt.Sprintf("Resource %q already exists and is not managed by SidecarInjector", secret.Name)
+		c.recorder.Event(sidecarInjector, corev1.EventTypeWarning, "ErrResourceExists", msg)
+		return nil, time.Time{}, fmt.Errorf("%s", msg)
+	}
+	if caRotated {
+		// The server certificate has to be signed by the new CA.
+		if secret, err = c.rotateSecret(ctx, sidecarInjector, secret, caSecret, serviceName); err != nil {
+			return nil, time.Time{}, err
+		}
+	} else if fields := secretDrift(secret, caSecret, serviceName, namespace, now); len(fields) > 0 {
+		desired, err := newSecret(sidecarInjector, namespace, serviceName, secretName, caSecret, c.certificateValidity)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		if err := c.correctDrift(ctx, sidecarInjector, desired, secretGVK, fields); err != nil {
+			return nil, time.Time{}, err
+		}
+		secret = desired
+	}
+	notAfter, err := certificateNotAfter(secret.Data[serverCertName])
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if needsRenewal(notAfter, now, c.certificateRenewBefore) {
+		if secret, err = c.rotateSecret(ctx, sidecarInjector, secret, caSecret, serviceName); err != nil {
+			return nil, time.Time{}, err
+		}
+		if notAfter, err = certificateNotAfter(secret.Data[serverCertName]); err != nil {
+			return nil, time.Time{}, err
+		}
+	}
+
+	// Resync periodically enqueues SidecarInjector, but renew certificates on time even if resync is disabled.
+	renewAt := notAfter.Add(-c.certificateRenewBefore)
+	if caRenewAt := caNotAfter.Add(-c.certificateRenewBefore); caRenewAt.Before(renewAt) {
+		renewAt = caRenewAt
+	}
+	c.workqueue.AddAfter(key, time.Until(renewAt))
+
+	return webhookCABundle(caSecret, now), notAfter, nil
+}
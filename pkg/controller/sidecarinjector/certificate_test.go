@@ -0,0 +1,55 @@
+package sidecarinjector
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestNeedsRenewal(t *testing.T) {
+	now := time.Now()
+	notAfter := now.Add(40 * 24 * time.Hour)
+	if needsRenewal(notAfter, now, DefaultCertificateRenewBefore) {
+		t.Errorf("Certificate should not be renewed: %s", notAfter)
+	}
+	if !needsRenewal(notAfter, now.Add(11*24*time.Hour), DefaultCertificateRenewBefore) {
+		t.Errorf("Certificate should be renewed: %s", notAfter)
+	}
+	if !needsRenewal(notAfter, now.Add(41*24*time.Hour), DefaultCertificateRenewBefore) {
+		t.Errorf("Expired certificate should be renewed: %s", notAfter)
+	}
+}
+
+func TestWebhookCABundle(t *testing.T) {
+	_, current, err := NewCA("my-injector", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, previous, err := NewCA("my-injector", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caSecret := &corev1.Secret{
+		Data: map[string][]byte{
+			caCertName: current,
+			caKeyName:  []byte("secret"),
+		},
+	}
+
+	if bundle := webhookCABundle(caSecret, time.Now()); !bytes.Equal(bundle, current) {
+		t.Errorf("CA bundle is not matched: %s", string(bundle))
+	}
+
+	caSecret.Data[previousCertName] = previous
+	bundle := webhookCABundle(caSecret, time.Now())
+	if !bytes.HasPrefix(bundle, current) || !bytes.HasSuffix(bundle, previous) {
+		t.Errorf("CA bundle does not contain the previous CA: %s", string(bundle))
+	}
+
+	// The previous CA is dropped after it expires.
+	if bundle := webhookCABundle(caSecret, time.Now().Add(2*time.Hour)); !bytes.Equal(bundle, current) {
+		t.Errorf("CA bundle contains the expired CA: %s", string(bundle))
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
@@ -16,7 +17,10 @@ import (
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -31,6 +35,7 @@ import (
 	admissionregistrationlisters "k8s.io/client-go/listers/admissionregistration/v1"
 	appslisters "k8s.io/client-go/listers/apps/v1"
 	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
@@ -39,11 +44,20 @@ import (
 
 const controllerAgentName = "sidecar-injector-controller"
 const secretNamePrefix = "sidecar-injector-certs-"
+const caSecretNamePrefix = "sidecar-injector-ca-"
 const serviceNamePrefix = "sidecar-injector-"
 const MutatingNamePrefix = "sidecar-injector-webhook-"
 const issuerNamePrefix = "sidecar-injector-issuer-"
 const certificateNamePrefix = "sidecar-injecter-certificate-"
 
+var (
+	deploymentGVK                   = appsv1.SchemeGroupVersion.WithKind("Deployment")
+	serviceGVK                      = corev1.SchemeGroupVersion.WithKind("Service")
+	secretGVK                       = corev1.SchemeGroupVersion.WithKind("Secret")
+	configMapGVK                    = corev1.SchemeGroupVersion.WithKind("ConfigMap")
+	mutatingWebhookConfigurationGVK = admissionregistrationv1.SchemeGroupVersion.WithKind("MutatingWebhookConfiguration")
+)
+
 type Controller struct {
 	kubeclientset kubernetes.Interface
 	ownclientset  clientset.Interface
@@ -59,20 +73,39 @@ type Controller struct {
 	mutatingSynced        cache.InformerSynced
 	sidecarInjectorLister listers.SidecarInjectorLister
 	sidecarInjectorSynced cache.InformerSynced
+	endpointSliceLister   discoverylisters.EndpointSliceLister
+	endpointSliceSynced   cache.InformerSynced
+	namespaceLister       corelisters.NamespaceLister
+	namespaceSynced       cache.InformerSynced
+	// injectedPodLister lists only pods which have the injector label.
+	injectedPodLister corelisters.PodLister
+	injectedPodSynced cache.InformerSynced
+	// configMapLister lists only ConfigMaps of pipelines, which have the injector label.
+	configMapLister corelisters.ConfigMapLister
+	configMapSynced cache.InformerSynced
 
 	workqueue workqueue.RateLimitingInterface
 
 	recorder record.EventRecorder
 
 	useCertManager bool
+	// Lifetime of self-signed certificates, and the period before the expiration in which they are renewed.
+	// They are not used with cert-manager.
+	caValidity             time.Duration
+	certificateValidity    time.Duration
+	certificateRenewBefore time.Duration
 }
 
 // +kubebuilder:rbac:groups=operator.h3poteto.dev,resources=sidecarinjectors,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=operator.h3poteto.dev,resources=sidecarinjectors/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=operator.h3poteto.dev,resources=sidecarinjectorpolicies,verbs=get;list;watch
 // +kubebuilder:rbac:groups="apps",resources=deployments,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=secrets;services,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="admissionregistration.k8s.io",resources=mutatingwebhookconfigurations,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups="",resources=pods;namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="discovery.k8s.io",resources=endpointslices,verbs=get;list;watch
 // +kubebuilder:rbac:groups="cert-manager.io",resources=issuers;certificates,verbs=get;list;watch;create;update;patch;delete
 
 func NewController(
@@ -81,7 +114,11 @@ func NewController(
 	dynamicClient *DynamicClient,
 	kubeInformerFactory kubeinformers.SharedInformerFactory,
 	ownInformerFactory informers.SharedInformerFactory,
+	labeledInformerFactory kubeinformers.SharedInformerFactory,
 	useCertManager bool,
+	caValidity time.Duration,
+	certificateValidity time.Duration,
+	certificateRenewBefore time.Duration,
 ) *Controller {
 	err := ownscheme.AddToScheme(scheme.Scheme)
 	if err != nil {
@@ -99,24 +136,39 @@ func NewController(
 	serviceInformer := kubeInformerFactory.Core().V1().Services()
 	mutatingInformer := kubeInformerFactory.Admissionregistration().V1().MutatingWebhookConfigurations()
 	sidecarInjectorInformer := ownInformerFactory.Operator().V1alpha1().SidecarInjectors()
+	endpointSliceInformer := kubeInformerFactory.Discovery().V1().EndpointSlices()
+	namespaceInformer := kubeInformerFactory.Core().V1().Namespaces()
+	injectedPodInformer := labeledInformerFactory.Core().V1().Pods()
+	configMapInformer := labeledInformerFactory.Core().V1().ConfigMaps()
 
 	controller := &Controller{
-		kubeclientset:         kubeclientset,
-		ownclientset:          ownclientset,
-		dynamicClient:         dynamicClient,
-		deploymentsLister:     deploymentInformer.Lister(),
-		deploymentsSynced:     deploymentInformer.Informer().HasSynced,
-		secretsLister:         secretInformer.Lister(),
-		secretsSynced:         secretInformer.Informer().HasSynced,
-		serviceLister:         serviceInformer.Lister(),
-		serviceSynced:         serviceInformer.Informer().HasSynced,
-		mutatingLister:        mutatingInformer.Lister(),
-		mutatingSynced:        mutatingInformer.Informer().HasSynced,
-		sidecarInjectorLister: sidecarInjectorInformer.Lister(),
-		sidecarInjectorSynced: sidecarInjectorInformer.Informer().HasSynced,
-		workqueue:             workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerAgentName),
-		recorder:              recorder,
-		useCertManager:        useCertManager,
+		kubeclientset:          kubeclientset,
+		ownclientset:           ownclientset,
+		dynamicClient:          dynamicClient,
+		deploymentsLister:      deploymentInformer.Lister(),
+		deploymentsSynced:      deploymentInformer.Informer().HasSynced,
+		secretsLister:          secretInformer.Lister(),
+		secretsSynced:          secretInformer.Informer().HasSynced,
+		serviceLister:          serviceInformer.Lister(),
+		serviceSynced:          serviceInformer.Informer().HasSynced,
+		mutatingLister:         mutatingInformer.Lister(),
+		mutatingSynced:         mutatingInformer.Informer().HasSynced,
+		sidecarInjectorLister:  sidecarInjectorInformer.Lister(),
+		sidecarInjectorSynced:  sidecarInjectorInformer.Informer().HasSynced,
+		endpointSliceLister:    endpointSliceInformer.Lister(),
+		endpointSliceSynced:    endpointSliceInformer.Informer().HasSynced,
+		namespaceLister:        namespaceInformer.Lister(),
+		namespaceSynced:        namespaceInformer.Informer().HasSynced,
+		injectedPodLister:      injectedPodInformer.Lister(),
+		injectedPodSynced:      injectedPodInformer.Informer().HasSynced,
+		configMapLister:        configMapInformer.Lister(),
+		configMapSynced:        configMapInformer.Informer().HasSynced,
+		workqueue:              workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerAgentName),
+		recorder:               recorder,
+		useCertManager:         useCertManager,
+		caValidity:             caValidity,
+		certificateValidity:    certificateValidity,
+		certificateRenewBefore: certificateRenewBefore,
 	}
 
 	klog.Infof("Setting up event handlers")
@@ -161,6 +213,72 @@ func NewController(
 		DeleteFunc: controller.handleObject,
 	})
 
+	serviceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.handleObject,
+		UpdateFunc: func(old, new interface{}) {
+			newSvc := new.(*corev1.Service)
+			oldSvc := old.(*corev1.Service)
+			if newSvc.ResourceVersion == oldSvc.ResourceVersion {
+				return
+			}
+			controller.handleObject(new)
+		},
+		DeleteFunc: controller.handleObject,
+	})
+
+	mutatingInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.handleObject,
+		UpdateFunc: func(old, new interface{}) {
+			newMutating := new.(*admissionregistrationv1.MutatingWebhookConfiguration)
+			oldMutating := old.(*admissionregistrationv1.MutatingWebhookConfiguration)
+			if newMutating.ResourceVersion == oldMutating.ResourceVersion {
+				return
+			}
+			controller.handleObject(new)
+		},
+		DeleteFunc: controller.handleObject,
+	})
+
+	// EndpointSlices are not owned by SidecarInjector, so they are mapped to the owner of the Service.
+	endpointSliceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.handleEndpointSlice,
+		UpdateFunc: func(old, new interface{}) {
+			newSlice := new.(*discoveryv1.EndpointSlice)
+			oldSlice := old.(*discoveryv1.EndpointSlice)
+			if newSlice.ResourceVersion == oldSlice.ResourceVersion {
+				return
+			}
+			controller.handleEndpointSlice(new)
+		},
+		DeleteFunc: controller.handleEndpointSlice,
+	})
+
+	configMapInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.handleObject,
+		UpdateFunc: func(old, new interface{}) {
+			newConfigMap := new.(*corev1.ConfigMap)
+			oldConfigMap := old.(*corev1.ConfigMap)
+			if newConfigMap.ResourceVersion == oldConfigMap.ResourceVersion {
+				return
+			}
+			controller.handleObject(new)
+		},
+		DeleteFunc: controller.handleObject,
+	})
+
+	// Namespaces are not owned by SidecarInjector, so ConfigMaps of pipelines are published when namespaces are created or their labels are changed.
+	namespaceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.handleNamespace,
+		UpdateFunc: func(old, new interface{}) {
+			newNamespace := new.(*corev1.Namespace)
+			oldNamespace := old.(*corev1.Namespace)
+			if equality.Semantic.DeepEqual(newNamespace.Labels, oldNamespace.Labels) {
+				return
+			}
+			controller.handleNamespace(new)
+		},
+	})
+
 	return controller
 }
 
@@ -171,7 +289,7 @@ func (c *Controller) Run(threadiness int, stopCh <-chan struct{}) error {
 	klog.Info("Starting SidecarInjector controller")
 
 	klog.Info("Waiting for informer caches to sync")
-	if ok := cache.WaitForCacheSync(stopCh, c.deploymentsSynced, c.sidecarInjectorSynced); !ok {
+	if ok := cache.WaitForCacheSync(stopCh, c.deploymentsSynced, c.secretsSynced, c.serviceSynced, c.mutatingSynced, c.sidecarInjectorSynced, c.endpointSliceSynced, c.namespaceSynced, c.injectedPodSynced, c.configMapSynced); !ok {
 		return fmt.Errorf("failed to wait for caches to sync")
 	}
 
@@ -237,6 +355,7 @@ func (c *Controller) syncHandler(key string) error {
 	if err != nil {
 		if errors.IsNotFound(err) {
 			utilruntime.HandleError(fmt.Errorf("sidecarInjector '%s' in workqueue no longer exists", key))
+			forgetSidecarInjector(name)
 			return nil
 		}
 
@@ -248,6 +367,27 @@ func (c *Controller) syncHandler(key string) error {
 		return fmt.Errorf("POD_NAMESPACE is required, so please set downward API")
 	}
 
+	start := time.Now()
+	result := &syncResult{}
+	syncErr := c.syncResources(ctx, key, sidecarInjector, ownerNamespace, result)
+	observeReconcile(sidecarInjector, ownerNamespace, result.certificateExpiration, start, syncErr)
+	// The status is updated even if the sync fails, so the failure is reported in the conditions.
+	if err := c.updateSidecarInjectorStatus(ctx, sidecarInjector, ownerNamespace, result, syncErr); err != nil {
+		klog.Error(err)
+		if syncErr == nil {
+			return err
+		}
+	}
+	if syncErr != nil {
+		return syncErr
+	}
+
+	c.recorder.Event(sidecarInjector, corev1.EventTypeNormal, "Synced", "SidecarInjector synced successfully")
+	return nil
+}
+
+// syncResources creates or corrects resources of the webhook server, and records observed resources to the result.
+func (c *Controller) syncResources(ctx context.Context, key string, sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, ownerNamespace string, result *syncResult) error {
 	secretName := secretNamePrefix + sidecarInjector.Name
 	serviceName := serviceNamePrefix + sidecarInjector.Name
 	mutatingName := MutatingNamePrefix + sidecarInjector.Name
@@ -277,26 +417,38 @@ func (c *Controller) syncHandler(key string) error {
 			c.recorder.Event(sidecarInjector, corev1.EventTypeWarning, "ErrResourceExists", msg)
 			return fmt.Errorf("%s", msg)
 		}
-	} else {
-		// Secrets and Certificate
-		var serverCertificate []byte
+		// cert-manager renews the certificate, so the expiration is only recorded.
 		secret, err := c.secretsLister.Secrets(ownerNamespace).Get(secretName)
-		if errors.IsNotFound(err) {
-			secret, serverCertificate, err = c.createSecret(ctx, sidecarInjector, ownerNamespace, serviceName, secretName)
+		if err == nil {
+			if notAfter, err := certificateNotAfter(secret.Data[serverCertName]); err == nil {
+				result.certificateExpiration = &metav1.Time{Time: notAfter}
+			}
+		} else if !errors.IsNotFound(err) {
+			return err
 		}
-		if err != nil {
+		// The caBundle is injected by cert-manager.
+		result.mutating = mutating
+		if len(mutating.Webhooks) > 0 {
+			result.caBundle = mutating.Webhooks[0].ClientConfig.CABundle
+		}
+		desiredMutating := newMutatingWebhookConfigurationWithCertManager(sidecarInjector, mutatingName, ownerNamespace, serviceName, certificateName)
+		if err := c.correctDrift(ctx, sidecarInjector, desiredMutating, mutatingWebhookConfigurationGVK, mutatingWebhookConfigurationDrift(mutating, desiredMutating)); err != nil {
+			klog.Error(err)
 			return err
 		}
-		if !metav1.IsControlledBy(secret, sidecarInjector) {
-			msg := fmt.Sprintf("Resource %q already exists and is not managed by SidecarInjector", secret.Name)
-			c.recorder.Event(sidecarInjector, corev1.EventTypeWarning, "ErrResourceExists", msg)
-			return fmt.Errorf("%s", msg)
+	} else {
+		// Secrets and Certificate
+		caBundle, notAfter, err := c.syncCertificates(ctx, key, sidecarInjector, ownerNamespace, serviceName, secretName)
+		if err != nil {
+			klog.Error(err)
+			return err
 		}
+		result.certificateExpiration = &metav1.Time{Time: notAfter}
 
 		// WebhookConfiguration
 		mutating, err := c.mutatingLister.Get(mutatingName)
 		if errors.IsNotFound(err) {
-			mutating, err = c.createMutatingWebhookConfiguration(ctx, sidecarInjector, mutatingName, ownerNamespace, serviceName, serverCertificate)
+			mutating, err = c.createMutatingWebhookConfiguration(ctx, sidecarInjector, mutatingName, ownerNamespace, serviceName, caBundle)
 		}
 		if err != nil {
 			return err
@@ -306,6 +458,13 @@ func (c *Controller) syncHandler(key string) error {
 			c.recorder.Event(sidecarInjector, corev1.EventTypeWarning, "ErrResourceExists", msg)
 			return fmt.Errorf("%s", msg)
 		}
+		result.mutating = mutating
+		result.caBundle = caBundle
+		desiredMutating := newMutatingWebhookConfigurationWithCABundle(sidecarInjector, mutatingName, ownerNamespace, serviceName, caBundle)
+		if err := c.correctDrift(ctx, sidecarInjector, desiredMutating, mutatingWebhookConfigurationGVK, mutatingWebhookConfigurationDrift(mutating, desiredMutating)); err != nil {
+			klog.Error(err)
+			return err
+		}
 	}
 
 	// Deployment
@@ -313,14 +472,20 @@ func (c *Controller) syncHandler(key string) error {
 	if containerImage == "" {
 		return fmt.Errorf("The environment variable WEBHOOK_CONTAINER_IMAGE is required, please set it")
 	}
+	// The webhook server reads SidecarInjectorPolicy, so the service account requires permissions for it.
+	serviceAccountName := os.Getenv("WEBHOOK_SERVICE_ACCOUNT")
+	if serviceAccountName == "" {
+		serviceAccountName = "default"
+	}
 	var deployment *appsv1.Deployment
+	var err error
 	deploymentName := sidecarInjector.Status.InjectorDeploymentName
 	if deploymentName == "" {
-		deployment, err = c.createDeployment(ctx, sidecarInjector, ownerNamespace, secretName, containerImage)
+		deployment, err = c.createDeployment(ctx, sidecarInjector, ownerNamespace, secretName, containerImage, serviceAccountName)
 	} else {
 		deployment, err = c.deploymentsLister.Deployments(ownerNamespace).Get(deploymentName)
 		if errors.IsNotFound(err) {
-			deployment, err = c.createDeployment(ctx, sidecarInjector, ownerNamespace, secretName, containerImage)
+			deployment, err = c.createDeployment(ctx, sidecarInjector, ownerNamespace, secretName, containerImage, serviceAccountName)
 		}
 	}
 	if err != nil {
@@ -332,6 +497,29 @@ func (c *Controller) syncHandler(key string) error {
 		c.recorder.Event(sidecarInjector, corev1.EventTypeWarning, "ErrResourceExists", msg)
 		return fmt.Errorf("%s", msg)
 	}
+	result.deployment = deployment
+	desiredDeployment := newDeployment(sidecarInjector, ownerNamespace, secretName, containerImage, serviceAccountName)
+	desiredDeployment.Name = deployment.Name
+	serviceSelector := desiredDeployment.Spec.Template.Labels
+	var replaced *appsv1.Deployment
+	// The selector is immutable, so another Deployment is created when it is changed, e.g. the selector was shared between SidecarInjectors in older versions.
+	// The Service keeps selecting the current pods until the new Deployment is available, because pods are rejected without endpoints if failurePolicy is Fail.
+	if !equality.Semantic.DeepEqual(deployment.Spec.Selector, desiredDeployment.Spec.Selector) {
+		migrated, err := c.migrateDeployment(ctx, sidecarInjector, deployment, desiredDeployment)
+		if err != nil {
+			klog.Error(err)
+			return err
+		}
+		if deploymentAvailable(migrated) {
+			replaced = deployment
+			result.deployment = migrated
+		} else {
+			serviceSelector = deployment.Spec.Template.Labels
+		}
+	} else if err := c.correctDrift(ctx, sidecarInjector, desiredDeployment, deploymentGVK, deploymentDrift(deployment, desiredDeployment)); err != nil {
+		klog.Error(err)
+		return err
+	}
 
 	// Service
 	service, err := c.serviceLister.Services(ownerNamespace).Get(serviceName)
@@ -347,30 +535,39 @@ func (c *Controller) syncHandler(key string) error {
 		c.recorder.Event(sidecarInjector, corev1.EventTypeWarning, "ErrResourceExists", msg)
 		return fmt.Errorf("%s", msg)
 	}
+	result.service = service
+	desiredService := newService(sidecarInjector, ownerNamespace, serviceName)
+	desiredService.Spec.Selector = serviceSelector
+	if err := c.correctDrift(ctx, sidecarInjector, desiredService, serviceGVK, serviceDrift(service, desiredService)); err != nil {
+		klog.Error(err)
+		return err
+	}
+	// The Service has been switched to the new Deployment, so the replaced one can be deleted.
+	if replaced != nil {
+		if err := c.kubeclientset.AppsV1().Deployments(ownerNamespace).Delete(ctx, replaced.Name, metav1.DeleteOptions{}); err != nil {
+			klog.Error(err)
+			return err
+		}
+		c.recorder.Eventf(sidecarInjector, corev1.EventTypeNormal, "DeploymentReplaced", "Deployment %q is replaced with %q, because the selector is changed", replaced.Name, result.deployment.Name)
+	}
+
+	// ConfigMaps of the pipeline
+	if err := c.syncPipeline(ctx, sidecarInjector, ownerNamespace); err != nil {
+		klog.Error(err)
+		return err
+	}
 
-	err = c.updateSidecarInjectorStatus(ctx, sidecarInjector, deployment, service)
+	// Secrets of the forward security are created by users, so they are only reported.
+	missing, err := c.missingForwardSecrets(sidecarInjector, ownerNamespace)
 	if err != nil {
 		klog.Error(err)
 		return err
 	}
+	result.missingForwardSecrets = missing
 
-	c.recorder.Event(sidecarInjector, corev1.EventTypeNormal, "Synced", "SidecarInjector synced successfully")
 	return nil
 }
 
-func (c *Controller) updateSidecarInjectorStatus(ctx context.Context, sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, deployment *appsv1.Deployment, service *corev1.Service) error {
-	serviceReady := false
-	if service != nil && len(service.Spec.Ports) > 0 && service.Spec.ClusterIP != "" {
-		serviceReady = true
-	}
-	sidecarInjectorCopy := sidecarInjector.DeepCopy()
-	sidecarInjectorCopy.Status.InjectorDeploymentName = deployment.Name
-	sidecarInjectorCopy.Status.InjectorPodCount = deployment.Status.AvailableReplicas
-	sidecarInjectorCopy.Status.InjectorServiceReady = serviceReady
-	_, err := c.ownclientset.OperatorV1alpha1().SidecarInjectors().Update(ctx, sidecarInjectorCopy, metav1.UpdateOptions{})
-	return err
-}
-
 func (c *Controller) enqueueSidecarInjector(obj interface{}) {
 	var key string
 	var err error
@@ -414,21 +611,32 @@ func (c *Controller) handleObject(obj interface{}) {
 	}
 }
 
-func (c *Controller) createDeployment(ctx context.Context, sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, namespace, secretName, image string) (*appsv1.Deployment, error) {
-	deployment := newDeployment(sidecarInjector, namespace, secretName, image)
+func (c *Controller) createDeployment(ctx context.Context, sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, namespace, secretName, image, serviceAccountName string) (*appsv1.Deployment, error) {
+	deployment := newDeployment(sidecarInjector, namespace, secretName, image, serviceAccountName)
 	return c.kubeclientset.AppsV1().Deployments(deployment.Namespace).Create(ctx, deployment, metav1.CreateOptions{})
 }
 
-func (c *Controller) createSecret(ctx context.Context, sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, namespace, serviceName, secretName string) (*corev1.Secret, []byte, error) {
-	secret, serverCertificate, err := newSecret(sidecarInjector, namespace, serviceName, secretName)
-	if err != nil {
-		return nil, nil, err
+// migrateDeployment returns the Deployment which replaces the current one with the new selector, and creates it if it does not exist.
+func (c *Controller) migrateDeployment(ctx context.Context, sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, current, desired *appsv1.Deployment) (*appsv1.Deployment, error) {
+	name := migratedDeploymentName(desired)
+	deployment, err := c.deploymentsLister.Deployments(desired.Namespace).Get(name)
+	if errors.IsNotFound(err) {
+		migrated := desired.DeepCopy()
+		migrated.Name = name
+		deployment, err = c.kubeclientset.AppsV1().Deployments(migrated.Namespace).Create(ctx, migrated, metav1.CreateOptions{})
+		if err == nil {
+			c.recorder.Eventf(sidecarInjector, corev1.EventTypeNormal, "DeploymentMigrating", "Deployment %q is created to replace %q, because the selector is changed", name, current.Name)
+		}
 	}
-	res, err := c.kubeclientset.CoreV1().Secrets(secret.Namespace).Create(ctx, secret, metav1.CreateOptions{})
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	if !metav1.IsControlledBy(deployment, sidecarInjector) {
+		msg := fmt.Sprintf("Resource %q already exists and is not managed by SidecarInjector", deployment.Name)
+		c.recorder.Event(sidecarInjector, corev1.EventTypeWarning, "ErrResourceExists", msg)
+		return nil, fmt.Errorf("%s", msg)
 	}
-	return res, serverCertificate, nil
+	return deployment, nil
 }
 
 func (c *Controller) createService(ctx context.Context, sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, namespace, serviceName string) (*corev1.Service, error) {
@@ -437,20 +645,32 @@ func (c *Controller) createService(ctx context.Context, sidecarInjector *sidecar
 }
 
 func (c *Controller) createMutatingWebhookConfiguration(ctx context.Context, sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, mutatingName, namespace, serviceName string, serverCetriicate []byte) (*admissionregistrationv1.MutatingWebhookConfiguration, error) {
-	mutating := newMutatingWebhookConfiguration(sidecarInjector, mutatingName, namespace, serviceName)
-	for i := range mutating.Webhooks {
-		mutating.Webhooks[i].ClientConfig.CABundle = serverCetriicate
-	}
+	mutating := newMutatingWebhookConfigurationWithCABundle(sidecarInjector, mutatingName, namespace, serviceName, serverCetriicate)
 	return c.kubeclientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Create(ctx, mutating, metav1.CreateOptions{})
 }
 
 func (c *Controller) createMutatingWebhookConfigurationWithCertManager(ctx context.Context, sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, mutatingName, namespace, serviceName, certificateName string) (*admissionregistrationv1.MutatingWebhookConfiguration, error) {
-	mutating := newMutatingWebhookConfiguration(sidecarInjector, mutatingName, namespace, serviceName)
-	mutating.Annotations["cert-manager.io/inject-ca-from"] = namespace + "/" + certificateName
-
+	mutating := newMutatingWebhookConfigurationWithCertManager(sidecarInjector, mutatingName, namespace, serviceName, certificateName)
 	return c.kubeclientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Create(ctx, mutating, metav1.CreateOptions{})
 }
 
+// correctDrift applies the desired object with server-side apply when any fields have drifted, and records the fields as an event.
+func (c *Controller) correctDrift(ctx context.Context, sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, desired runtime.Object, gvk schema.GroupVersionKind, fields []string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	object, err := meta.Accessor(desired)
+	if err != nil {
+		return err
+	}
+	klog.Infof("%s %q has drifted: %s", gvk.Kind, object.GetName(), strings.Join(fields, ", "))
+	if _, err := c.dynamicClient.ApplyObject(ctx, desired, gvk); err != nil {
+		return err
+	}
+	c.recorder.Eventf(sidecarInjector, corev1.EventTypeNormal, "DriftCorrected", "%s %q was corrected: %s", gvk.Kind, object.GetName(), strings.Join(fields, ", "))
+	return nil
+}
+
 func (c *Controller) applyIssuer(ctx context.Context, issuerName, namespace string, sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector) error {
 	ownerRef := metav1.NewControllerRef(sidecarInjector, schema.GroupVersionKind{
 		Group:   sidecarinjectorv1alpha1.SchemeGroupVersion.Group,
@@ -508,3 +728,29 @@ func (c *Controller) applyManifest(ctx context.Context, manifest *bytes.Buffer)
 	}
 	return nil
 }
+
+// handleEndpointSlice enqueues the SidecarInjector which owns the Service of the EndpointSlice.
+func (c *Controller) handleEndpointSlice(obj interface{}) {
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("error decoding object, invalid type"))
+			return
+		}
+		slice, ok = tombstone.Obj.(*discoveryv1.EndpointSlice)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("error decoding object tombstone, invalid type"))
+			return
+		}
+	}
+	serviceName := slice.Labels[discoveryv1.LabelServiceName]
+	if !strings.HasPrefix(serviceName, serviceNamePrefix) {
+		return
+	}
+	service, err := c.serviceLister.Services(slice.Namespace).Get(serviceName)
+	if err != nil {
+		return
+	}
+	c.handleObject(service)
+}
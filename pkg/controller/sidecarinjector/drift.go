@@ -0,0 +1,329 @@
+package sidecarinjector
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The drift functions compare an existing object with the desired object which is generated by the controller.
+// They return paths of the fields which differ, and only fields which are set by the controller are compared,
+// because the API server fills default values in the other fields.
+
+func deploymentDrift(existing, desired *appsv1.Deployment) []string {
+	var fields []string
+	if !equality.Semantic.DeepEqual(existing.Spec.Replicas, desired.Spec.Replicas) {
+		fields = append(fields, "spec.replicas")
+	}
+	if !containsLabels(existing.Spec.Template.Labels, desired.Spec.Template.Labels) {
+		fields = append(fields, "spec.template.metadata.labels")
+	}
+	if !containsLabels(existing.Spec.Template.Annotations, desired.Spec.Template.Annotations) {
+		fields = append(fields, "spec.template.metadata.annotations")
+	}
+	if existing.Spec.Template.Spec.ServiceAccountName != desired.Spec.Template.Spec.ServiceAccountName {
+		fields = append(fields, "spec.template.spec.serviceAccountName")
+	}
+	for i := range desired.Spec.Template.Spec.Volumes {
+		d := &desired.Spec.Template.Spec.Volumes[i]
+		e := findVolume(existing.Spec.Template.Spec.Volumes, d.Name)
+		if e == nil || !sameVolumeSource(e, d) {
+			fields = append(fields, fmt.Sprintf("spec.template.spec.volumes[%s]", d.Name))
+		}
+	}
+	if len(existing.Spec.Template.Spec.Containers) != len(desired.Spec.Template.Spec.Containers) {
+		fields = append(fields, "spec.template.spec.containers")
+	}
+	for i := range desired.Spec.Template.Spec.Containers {
+		d := &desired.Spec.Template.Spec.Containers[i]
+		e := findContainer(existing.Spec.Template.Spec.Containers, d.Name)
+		path := fmt.Sprintf("spec.template.spec.containers[%s]", d.Name)
+		if e == nil {
+			fields = append(fields, path)
+			continue
+		}
+		fields = append(fields, containerDrift(path, e, d)...)
+	}
+	return fields
+}
+
+func containerDrift(path string, existing, desired *corev1.Container) []string {
+	var fields []string
+	if existing.Image != desired.Image {
+		fields = append(fields, path+".image")
+	}
+	if !equality.Semantic.DeepEqual(existing.Command, desired.Command) {
+		fields = append(fields, path+".command")
+	}
+	if !equality.Semantic.DeepEqual(existing.Args, desired.Args) {
+		fields = append(fields, path+".args")
+	}
+	if !equality.Semantic.DeepEqual(existing.Ports, desired.Ports) {
+		fields = append(fields, path+".ports")
+	}
+	if !equality.Semantic.DeepEqual(existing.Env, desired.Env) {
+		fields = append(fields, path+".env")
+	}
+	if !equality.Semantic.DeepEqual(existing.Resources, desired.Resources) {
+		fields = append(fields, path+".resources")
+	}
+	if len(existing.VolumeMounts) != len(desired.VolumeMounts) {
+		fields = append(fields, path+".volumeMounts")
+	} else {
+		for i := range desired.VolumeMounts {
+			e, d := &existing.VolumeMounts[i], &desired.VolumeMounts[i]
+			if e.Name != d.Name || e.MountPath != d.MountPath || e.ReadOnly != d.ReadOnly || e.SubPath != d.SubPath {
+				fields = append(fields, path+".volumeMounts")
+				break
+			}
+		}
+	}
+	if !equality.Semantic.DeepEqual(existing.LivenessProbe, desired.LivenessProbe) {
+		fields = append(fields, path+".livenessProbe")
+	}
+	if !equality.Semantic.DeepEqual(existing.ReadinessProbe, desired.ReadinessProbe) {
+		fields = append(fields, path+".readinessProbe")
+	}
+	if desired.ImagePullPolicy != "" && existing.ImagePullPolicy != desired.ImagePullPolicy {
+		fields = append(fields, path+".imagePullPolicy")
+	}
+	return fields
+}
+
+func serviceDrift(existing, desired *corev1.Service) []string {
+	var fields []string
+	if existing.Spec.Type != desired.Spec.Type {
+		fields = append(fields, "spec.type")
+	}
+	if !equality.Semantic.DeepEqual(existing.Spec.Selector, desired.Spec.Selector) {
+		fields = append(fields, "spec.selector")
+	}
+	if len(existing.Spec.Ports) != len(desired.Spec.Ports) {
+		fields = append(fields, "spec.ports")
+		return fields
+	}
+	for i := range desired.Spec.Ports {
+		e, d := &existing.Spec.Ports[i], &desired.Spec.Ports[i]
+		if e.Name != d.Name || e.Port != d.Port || e.TargetPort != d.TargetPort || e.Protocol != d.Protocol {
+			fields = append(fields, fmt.Sprintf("spec.ports[%s]", d.Name))
+		}
+	}
+	return fields
+}
+
+func configMapDrift(existing, desired *corev1.ConfigMap) []string {
+	var fields []string
+	if !containsLabels(existing.Labels, desired.Labels) {
+		fields = append(fields, "metadata.labels")
+	}
+	for key, value := range desired.Data {
+		if existing.Data[key] != value {
+			fields = append(fields, fmt.Sprintf("data[%s]", key))
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// mutatingWebhookConfigurationDrift compares webhooks. The caBundle is compared only when the desired one has it,
+// because cert-manager injects the caBundle when the controller uses cert-manager.
+func mutatingWebhookConfigurationDrift(existing, desired *admissionregistrationv1.MutatingWebhookConfiguration) []string {
+	var fields []string
+	if !containsLabels(existing.Annotations, desired.Annotations) {
+		fields = append(fields, "metadata.annotations")
+	}
+	if len(existing.Webhooks) != len(desired.Webhooks) {
+		fields = append(fields, "webhooks")
+	}
+	for i := range desired.Webhooks {
+		d := &desired.Webhooks[i]
+		e := findWebhook(existing.Webhooks, d.Name)
+		path := fmt.Sprintf("webhooks[%s]", d.Name)
+		if e == nil {
+			fields = append(fields, path)
+			continue
+		}
+		if !sameServiceReference(e.ClientConfig.Service, d.ClientConfig.Service) {
+			fields = append(fields, path+".clientConfig.service")
+		}
+		if d.ClientConfig.CABundle != nil && !bytes.Equal(e.ClientConfig.CABundle, d.ClientConfig.CABundle) {
+			fields = append(fields, path+".clientConfig.caBundle")
+		}
+		if !equality.Semantic.DeepEqual(e.Rules, d.Rules) {
+			fields = append(fields, path+".rules")
+		}
+		if !equality.Semantic.DeepEqual(e.FailurePolicy, d.FailurePolicy) {
+			fields = append(fields, path+".failurePolicy")
+		}
+		if !equality.Semantic.DeepEqual(e.MatchPolicy, d.MatchPolicy) {
+			fields = append(fields, path+".matchPolicy")
+		}
+		if !sameLabelSelector(e.NamespaceSelector, d.NamespaceSelector) {
+			fields = append(fields, path+".namespaceSelector")
+		}
+		if !sameLabelSelector(e.ObjectSelector, d.ObjectSelector) {
+			fields = append(fields, path+".objectSelector")
+		}
+		if !equality.Semantic.DeepEqual(e.SideEffects, d.SideEffects) {
+			fields = append(fields, path+".sideEffects")
+		}
+		if !equality.Semantic.DeepEqual(e.TimeoutSeconds, d.TimeoutSeconds) {
+			fields = append(fields, path+".timeoutSeconds")
+		}
+		if !equality.Semantic.DeepEqual(e.AdmissionReviewVersions, d.AdmissionReviewVersions) {
+			fields = append(fields, path+".admissionReviewVersions")
+		}
+		if !equality.Semantic.DeepEqual(e.MatchConditions, d.MatchConditions) {
+			fields = append(fields, path+".matchConditions")
+		}
+		if d.ReinvocationPolicy != nil && !equality.Semantic.DeepEqual(e.ReinvocationPolicy, d.ReinvocationPolicy) {
+			fields = append(fields, path+".reinvocationPolicy")
+		}
+	}
+	return fields
+}
+
+// secretDrift verifies the server key pair in the secret, and the certificate has to be signed by the CA in caSecret.
+// The secret has to be regenerated when it returns fields.
+func secretDrift(secret, caSecret *corev1.Secret, serviceName, namespace string, now time.Time) []string {
+	fields := keyPairDrift(secret, serverKeyName, serverCertName)
+	if len(fields) > 0 {
+		return fields
+	}
+	cert, err := parseCertificate(secret.Data[serverCertName])
+	if err != nil {
+		return []string{fmt.Sprintf("data[%s]", serverCertName)}
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caSecret.Data[caCertName]) {
+		return []string{fmt.Sprintf("data[%s]", serverCertName)}
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{
+		DNSName:     serviceName + "." + namespace + ".svc",
+		Roots:       roots,
+		CurrentTime: now,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}); err != nil {
+		return []string{fmt.Sprintf("data[%s]", serverCertName)}
+	}
+	if !bytes.Equal(secret.Data[caCertName], caSecret.Data[caCertName]) {
+		return []string{fmt.Sprintf("data[%s]", caCertName)}
+	}
+	return nil
+}
+
+// caSecretDrift verifies the CA key pair in the secret. The secret has to be regenerated when it returns fields.
+func caSecretDrift(caSecret *corev1.Secret) []string {
+	fields := keyPairDrift(caSecret, caKeyName, caCertName)
+	if len(fields) > 0 {
+		return fields
+	}
+	cert, err := parseCertificate(caSecret.Data[caCertName])
+	if err != nil || !cert.IsCA {
+		return []string{fmt.Sprintf("data[%s]", caCertName)}
+	}
+	return nil
+}
+
+func keyPairDrift(secret *corev1.Secret, keyName, certName string) []string {
+	var fields []string
+	key, hasKey := secret.Data[keyName]
+	cert, hasCert := secret.Data[certName]
+	if !hasKey {
+		fields = append(fields, fmt.Sprintf("data[%s]", keyName))
+	}
+	if !hasCert {
+		fields = append(fields, fmt.Sprintf("data[%s]", certName))
+	}
+	if len(fields) > 0 {
+		return fields
+	}
+	if _, err := tls.X509KeyPair(cert, key); err != nil {
+		return []string{fmt.Sprintf("data[%s]", keyName), fmt.Sprintf("data[%s]", certName)}
+	}
+	return nil
+}
+
+func containsLabels(existing, desired map[string]string) bool {
+	for k, v := range desired {
+		if value, ok := existing[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+func sameVolumeSource(existing, desired *corev1.Volume) bool {
+	if desired.Secret != nil {
+		return existing.Secret != nil && existing.Secret.SecretName == desired.Secret.SecretName
+	}
+	if desired.ConfigMap != nil {
+		return existing.ConfigMap != nil && existing.ConfigMap.Name == desired.ConfigMap.Name
+	}
+	return true
+}
+
+func sameServiceReference(existing, desired *admissionregistrationv1.ServiceReference) bool {
+	if existing == nil || desired == nil {
+		return existing == desired
+	}
+	// The API server sets 443 to the port by default.
+	existingPort, desiredPort := int32(443), int32(443)
+	if existing.Port != nil {
+		existingPort = *existing.Port
+	}
+	if desired.Port != nil {
+		desiredPort = *desired.Port
+	}
+	return existing.Namespace == desired.Namespace &&
+		existing.Name == desired.Name &&
+		equality.Semantic.DeepEqual(existing.Path, desired.Path) &&
+		existingPort == desiredPort
+}
+
+// sameLabelSelector compares label selectors, and nil is equal to an empty selector because the API server sets an empty selector by default.
+func sameLabelSelector(existing, desired *metav1.LabelSelector) bool {
+	if existing == nil {
+		existing = &metav1.LabelSelector{}
+	}
+	if desired == nil {
+		desired = &metav1.LabelSelector{}
+	}
+	return equality.Semantic.DeepEqual(existing, desired)
+}
+
+func findVolume(volumes []corev1.Volume, name string) *corev1.Volume {
+	for i := range volumes {
+		if volumes[i].Name == name {
+			return &volumes[i]
+		}
+	}
+	return nil
+}
+
+func findContainer(containers []corev1.Container, name string) *corev1.Container {
+	for i := range containers {
+		if containers[i].Name == name {
+			return &containers[i]
+		}
+	}
+	return nil
+}
+
+func findWebhook(webhooks []admissionregistrationv1.MutatingWebhook, name string) *admissionregistrationv1.MutatingWebhook {
+	for i := range webhooks {
+		if webhooks[i].Name == name {
+			return &webhooks[i]
+		}
+	}
+	return nil
+}
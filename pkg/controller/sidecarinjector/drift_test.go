@@ -0,0 +1,187 @@
+package sidecarinjector
+
+import (
+	"testing"
+	"time"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+)
+
+var driftTestSidecarInjector = &sidecarinjectorv1alpha1.SidecarInjector{
+	ObjectMeta: metav1.ObjectMeta{
+		Name: "unit-test",
+	},
+}
+
+func containsField(fields []string, target string) bool {
+	for _, field := range fields {
+		if field == target {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDeploymentDrift(t *testing.T) {
+	desired := newDeployment(driftTestSidecarInjector, "my-managers", "test-secret", "my-injector-image:tag", "webhook-sa")
+
+	existing := desired.DeepCopy()
+	// Fields which are filled by the API server should be ignored.
+	existing.Spec.Template.Spec.RestartPolicy = corev1.RestartPolicyAlways
+	existing.Spec.Template.Spec.Containers[0].TerminationMessagePath = corev1.TerminationMessagePathDefault
+	existing.Spec.Template.Spec.Volumes[0].Secret.DefaultMode = ptr.To[int32](0644)
+	existing.Spec.Template.Labels["pod-template-hash"] = "abcdef"
+	if fields := deploymentDrift(existing, desired); len(fields) != 0 {
+		t.Errorf("Drift should not be detected: %v", fields)
+	}
+
+	existing.Spec.Replicas = ptr.To[int32](0)
+	existing.Spec.Template.Spec.Containers[0].Image = "other-image:tag"
+	existing.Spec.Template.Spec.Containers[0].Args = existing.Spec.Template.Spec.Containers[0].Args[:2]
+	existing.Spec.Template.Spec.Volumes[0].Secret.SecretName = "other-secret"
+	fields := deploymentDrift(existing, desired)
+	for _, field := range []string{
+		"spec.replicas",
+		"spec.template.spec.containers[webhook-handler].image",
+		"spec.template.spec.containers[webhook-handler].args",
+		"spec.template.spec.volumes[webhook-certs]",
+	} {
+		if !containsField(fields, field) {
+			t.Errorf("Drift of %s is not detected: %v", field, fields)
+		}
+	}
+	if len(fields) != 4 {
+		t.Errorf("Fields are not matched: %v", fields)
+	}
+
+	existing = desired.DeepCopy()
+	existing.Spec.Template.Spec.Containers[0].Name = "renamed"
+	fields = deploymentDrift(existing, desired)
+	if !containsField(fields, "spec.template.spec.containers[webhook-handler]") {
+		t.Errorf("Drift of container is not detected: %v", fields)
+	}
+}
+
+func TestServiceDrift(t *testing.T) {
+	desired := newService(driftTestSidecarInjector, "my-managers", "sidecar-injector-unit-test")
+
+	existing := desired.DeepCopy()
+	existing.Spec.ClusterIP = "10.0.0.1"
+	existing.Spec.SessionAffinity = corev1.ServiceAffinityNone
+	if fields := serviceDrift(existing, desired); len(fields) != 0 {
+		t.Errorf("Drift should not be detected: %v", fields)
+	}
+
+	existing.Spec.Ports[0].TargetPort = intstr.FromInt(9090)
+	existing.Spec.Selector = map[string]string{"app": "other"}
+	fields := serviceDrift(existing, desired)
+	if !containsField(fields, "spec.ports[https]") {
+		t.Errorf("Drift of port is not detected: %v", fields)
+	}
+	if !containsField(fields, "spec.selector") {
+		t.Errorf("Drift of selector is not detected: %v", fields)
+	}
+}
+
+func TestMutatingWebhookConfigurationDrift(t *testing.T) {
+	desired := newMutatingWebhookConfigurationWithCABundle(driftTestSidecarInjector, "sidecar-injector-webhook-unit-test", "my-managers", "sidecar-injector-unit-test", []byte("ca"))
+
+	existing := desired.DeepCopy()
+	existing.Webhooks[0].ClientConfig.Service.Port = ptr.To[int32](443)
+	if fields := mutatingWebhookConfigurationDrift(existing, desired); len(fields) != 0 {
+		t.Errorf("Drift should not be detected: %v", fields)
+	}
+
+	fail := admissionregistrationv1.Fail
+	never := admissionregistrationv1.NeverReinvocationPolicy
+	existing.Webhooks[0].FailurePolicy = &fail
+	existing.Webhooks[0].ReinvocationPolicy = &never
+	existing.Webhooks[0].MatchConditions = nil
+	existing.Webhooks[0].ClientConfig.CABundle = []byte("other")
+	existing.Webhooks[0].ClientConfig.Service.Port = ptr.To[int32](8443)
+	// Namespaces are excluded even if the selector is not specified.
+	existing.Webhooks[0].NamespaceSelector = &metav1.LabelSelector{}
+	fields := mutatingWebhookConfigurationDrift(existing, desired)
+	for _, field := range []string{
+		"webhooks[sidecar-injector-unit-test.my-managers.svc].failurePolicy",
+		"webhooks[sidecar-injector-unit-test.my-managers.svc].clientConfig.caBundle",
+		"webhooks[sidecar-injector-unit-test.my-managers.svc].clientConfig.service",
+		"webhooks[sidecar-injector-unit-test.my-managers.svc].reinvocationPolicy",
+		"webhooks[sidecar-injector-unit-test.my-managers.svc].matchConditions",
+		"webhooks[sidecar-injector-unit-test.my-managers.svc].namespaceSelector",
+	} {
+		if !containsField(fields, field) {
+			t.Errorf("Drift of %s is not detected: %v", field, fields)
+		}
+	}
+
+	// caBundle is injected by cert-manager.
+	desired = newMutatingWebhookConfigurationWithCertManager(driftTestSidecarInjector, "sidecar-injector-webhook-unit-test", "my-managers", "sidecar-injector-unit-test", "certificate")
+	existing = desired.DeepCopy()
+	existing.Webhooks[0].ClientConfig.CABundle = []byte("injected")
+	if fields := mutatingWebhookConfigurationDrift(existing, desired); len(fields) != 0 {
+		t.Errorf("Drift should not be detected: %v", fields)
+	}
+	existing.Annotations = map[string]string{}
+	if fields := mutatingWebhookConfigurationDrift(existing, desired); !containsField(fields, "metadata.annotations") {
+		t.Errorf("Drift of annotations is not detected: %v", fields)
+	}
+}
+
+func TestSecretDrift(t *testing.T) {
+	caSecret, err := newCASecret(driftTestSidecarInjector, "my-managers", "sidecar-injector-ca-unit-test", DefaultCAValidity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields := caSecretDrift(caSecret); len(fields) != 0 {
+		t.Errorf("Drift should not be detected: %v", fields)
+	}
+	secret, err := newSecret(driftTestSidecarInjector, "my-managers", "sidecar-injector-unit-test", "sidecar-injector-certs-unit-test", caSecret, DefaultCertificateValidity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := secret.Data[caKeyName]; ok {
+		t.Error("Secret for the webhook server should not contain the CA key")
+	}
+	now := time.Now()
+	if fields := secretDrift(secret, caSecret, "sidecar-injector-unit-test", "my-managers", now); len(fields) != 0 {
+		t.Errorf("Drift should not be detected: %v", fields)
+	}
+	if fields := secretDrift(secret, caSecret, "other-service", "my-managers", now); !containsField(fields, "data[tls.crt]") {
+		t.Errorf("Drift of the hostname is not detected: %v", fields)
+	}
+	if fields := secretDrift(secret, caSecret, "sidecar-injector-unit-test", "my-managers", now.Add(DefaultCertificateValidity+time.Hour)); !containsField(fields, "data[tls.crt]") {
+		t.Errorf("Drift of the expired certificate is not detected: %v", fields)
+	}
+
+	// The server certificate is not signed by the CA.
+	otherCASecret, err := newCASecret(driftTestSidecarInjector, "my-managers", "sidecar-injector-ca-unit-test", DefaultCAValidity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields := secretDrift(secret, otherCASecret, "sidecar-injector-unit-test", "my-managers", now); !containsField(fields, "data[tls.crt]") {
+		t.Errorf("Drift of the CA is not detected: %v", fields)
+	}
+
+	broken := secret.DeepCopy()
+	broken.Data[serverKeyName] = []byte("broken")
+	if fields := secretDrift(broken, caSecret, "sidecar-injector-unit-test", "my-managers", now); !containsField(fields, "data[tls.key]") {
+		t.Errorf("Drift of the key is not detected: %v", fields)
+	}
+
+	delete(broken.Data, serverCertName)
+	if fields := secretDrift(broken, caSecret, "sidecar-injector-unit-test", "my-managers", now); !containsField(fields, "data[tls.crt]") {
+		t.Errorf("Drift of the certificate is not detected: %v", fields)
+	}
+
+	brokenCA := caSecret.DeepCopy()
+	delete(brokenCA.Data, caKeyName)
+	if fields := caSecretDrift(brokenCA); !containsField(fields, "data[ca.key]") {
+		t.Errorf("Drift of the CA key is not detected: %v", fields)
+	}
+}
@@ -3,17 +3,23 @@ package sidecarinjector
 import (
 	"context"
 	"encoding/json"
+	"sync"
+	"time"
 
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer/yaml"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/restmapper"
+	"k8s.io/utils/ptr"
 )
 
 type DynamicClient struct {
@@ -22,13 +28,10 @@ type DynamicClient struct {
 	mapper    meta.RESTMapper
 }
 
+// NewDynamicClient returns a new DynamicClient. The REST mapper discovers resources lazily, and it refreshes them when a kind is not found,
+// so kinds of custom resources which are installed after the start, e.g. Argo Rollouts, can be used.
 func NewDynamicClient(restConfig *rest.Config, clientset kubernetes.Interface) (*DynamicClient, error) {
 	discoveryClient := clientset.Discovery()
-	groupResources, err := restmapper.GetAPIGroupResources(discoveryClient)
-	if err != nil {
-		return nil, err
-	}
-	mapper := restmapper.NewDiscoveryRESTMapper(groupResources)
 	dyn, err := dynamic.NewForConfig(restConfig)
 	if err != nil {
 		return nil, err
@@ -37,10 +40,48 @@ func NewDynamicClient(restConfig *rest.Config, clientset kubernetes.Interface) (
 	return &DynamicClient{
 		client:    dyn,
 		discovery: discoveryClient,
-		mapper:    mapper,
+		mapper:    newDeferredRESTMapper(discoveryClient),
 	}, nil
 }
 
+// mapperResetInterval limits discovery requests which are caused by unknown kinds.
+const mapperResetInterval = 30 * time.Second
+
+func newDeferredRESTMapper(discoveryClient discovery.DiscoveryInterface) meta.RESTMapper {
+	return &refreshingRESTMapper{
+		DeferredDiscoveryRESTMapper: restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient)),
+		interval:                    mapperResetInterval,
+	}
+}
+
+// refreshingRESTMapper resets the discovery cache when a kind is not found.
+// DeferredDiscoveryRESTMapper does not reset it by itself once the cache is filled.
+type refreshingRESTMapper struct {
+	*restmapper.DeferredDiscoveryRESTMapper
+	interval  time.Duration
+	mu        sync.Mutex
+	lastReset time.Time
+}
+
+func (m *refreshingRESTMapper) RESTMapping(gk schema.GroupKind, versions ...string) (*meta.RESTMapping, error) {
+	mapping, err := m.DeferredDiscoveryRESTMapper.RESTMapping(gk, versions...)
+	if meta.IsNoMatchError(err) && m.reset() {
+		return m.DeferredDiscoveryRESTMapper.RESTMapping(gk, versions...)
+	}
+	return mapping, err
+}
+
+func (m *refreshingRESTMapper) reset() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.lastReset.IsZero() && time.Since(m.lastReset) < m.interval {
+		return false
+	}
+	m.lastReset = time.Now()
+	m.DeferredDiscoveryRESTMapper.Reset()
+	return true
+}
+
 func (d *DynamicClient) ResourceClient(data []byte, obj *unstructured.Unstructured) (dynamic.ResourceInterface, error) {
 	dec := yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme)
 	_, gvk, err := dec.Decode(data, nil, obj)
@@ -48,6 +89,10 @@ func (d *DynamicClient) ResourceClient(data []byte, obj *unstructured.Unstructur
 		return nil, err
 	}
 
+	return d.resourceClientFor(*gvk, obj)
+}
+
+func (d *DynamicClient) resourceClientFor(gvk schema.GroupVersionKind, obj *unstructured.Unstructured) (dynamic.ResourceInterface, error) {
 	mapping, err := d.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
 	if err != nil {
 		return nil, err
@@ -67,6 +112,19 @@ func (d *DynamicClient) Get(ctx context.Context, client dynamic.ResourceInterfac
 	return client.Get(ctx, obj.GetName(), metav1.GetOptions{})
 }
 
+// GetObject gets an object of any kinds.
+func (d *DynamicClient) GetObject(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string) (*unstructured.Unstructured, error) {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(gvk)
+	u.SetNamespace(namespace)
+	u.SetName(name)
+	client, err := d.resourceClientFor(gvk, u)
+	if err != nil {
+		return nil, err
+	}
+	return d.Get(ctx, client, u)
+}
+
 func (d *DynamicClient) Create(ctx context.Context, client dynamic.ResourceInterface, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
 	return client.Create(ctx, obj, metav1.CreateOptions{})
 }
@@ -79,5 +137,26 @@ func (d *DynamicClient) Apply(ctx context.Context, client dynamic.ResourceInterf
 
 	return client.Patch(ctx, obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
 		FieldManager: "sidecar-injector",
+		// Resources are owned by SidecarInjector, so the controller takes over fields which are changed by others.
+		Force: ptr.To(true),
 	})
 }
+
+// ApplyObject applies a typed object with server-side apply.
+func (d *DynamicClient) ApplyObject(ctx context.Context, obj runtime.Object, gvk schema.GroupVersionKind) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{Object: content}
+	u.SetGroupVersionKind(gvk)
+	// These fields are not managed by the controller.
+	unstructured.RemoveNestedField(u.Object, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(u.Object, "status")
+
+	client, err := d.resourceClientFor(gvk, u)
+	if err != nil {
+		return nil, err
+	}
+	return d.Apply(ctx, client, u)
+}
@@ -0,0 +1,44 @@
+package sidecarinjector
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	discoveryfake "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestDeferredRESTMapper(t *testing.T) {
+	discoveryClient := &discoveryfake.FakeDiscovery{Fake: &clienttesting.Fake{
+		Resources: []*metav1.APIResourceList{
+			{
+				GroupVersion: "apps/v1",
+				APIResources: []metav1.APIResource{{Name: "replicasets", Namespaced: true, Kind: "ReplicaSet"}},
+			},
+		},
+	}}
+	mapper := newDeferredRESTMapper(discoveryClient)
+
+	if _, err := mapper.RESTMapping(schema.GroupKind{Group: "apps", Kind: "ReplicaSet"}, "v1"); err != nil {
+		t.Fatal(err)
+	}
+	rollout := schema.GroupKind{Group: "argoproj.io", Kind: "Rollout"}
+	if _, err := mapper.RESTMapping(rollout, "v1alpha1"); err == nil {
+		t.Error("Rollout should not be found before the CRD is installed")
+	}
+
+	// Install the CRD after the mapper is filled.
+	discoveryClient.Resources = append(discoveryClient.Resources, &metav1.APIResourceList{
+		GroupVersion: "argoproj.io/v1alpha1",
+		APIResources: []metav1.APIResource{{Name: "rollouts", Namespaced: true, Kind: "Rollout"}},
+	})
+	mapper.(*refreshingRESTMapper).interval = 0
+	mapping, err := mapper.RESTMapping(rollout, "v1alpha1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mapping.Resource.Resource != "rollouts" {
+		t.Errorf("Resource is not matched: %v", mapping.Resource)
+	}
+}
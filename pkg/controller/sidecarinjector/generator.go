@@ -3,14 +3,19 @@ package sidecarinjector
 import (
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"fmt"
 	"math/big"
+	"slices"
+	"strconv"
 	"time"
 
 	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	"github.com/h3poteto/fluentd-sidecar-injector/pkg/pipeline"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -18,6 +23,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/utils/ptr"
 )
 
@@ -25,105 +31,56 @@ const (
 	// According to cert-manager's certificate name.
 	serverKeyName           = "tls.key"
 	serverCertName          = "tls.crt"
+	caKeyName               = "ca.key"
+	caCertName              = "ca.crt"
 	WebhookServerLabelKey   = "sidecarinjectors.operator.h3poteto.dev"
 	WebhookServerLabelValue = "webhook-pod"
+	// WebhookServerNameLabelKey is a label key of webhook pods, and the value is the name of the SidecarInjector.
+	WebhookServerNameLabelKey = "sidecarinjectors.operator.h3poteto.dev/name"
+	// InjectorAnnotation is an annotation of pods to specify the SidecarInjector which injects the sidecar.
+	InjectorAnnotation = "fluentd-sidecar-injector.h3poteto.dev/injector"
+	// InjectorLabel is a label of injected pods, and the value is the name of the SidecarInjector which injects the sidecar.
+	InjectorLabel = "fluentd-sidecar-injector.h3poteto.dev/injector"
+	// WebhookMetricsPort is a port of the metrics endpoint of webhook servers.
+	WebhookMetricsPort = 8081
 )
 
-func newDeployment(sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, namespace, secretName, image string) *appsv1.Deployment {
-	env := []corev1.EnvVar{
-		{
-			Name:  "COLLECTOR",
-			Value: sidecarInjector.Spec.Collector,
-		},
+// webhookPodLabels returns labels of webhook pods. They contain the name of the SidecarInjector, so each Service routes requests only to pods of its own SidecarInjector.
+func webhookPodLabels(sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector) map[string]string {
+	return map[string]string{
+		WebhookServerLabelKey:     WebhookServerLabelValue,
+		WebhookServerNameLabelKey: sidecarInjector.Name,
 	}
-	if sidecarInjector.Spec.FluentD != nil {
-		if sidecarInjector.Spec.FluentD.DockerImage != "" {
-			env = append(env, corev1.EnvVar{
-				Name:  "FLUENTD_DOCKER_IMAGE",
-				Value: sidecarInjector.Spec.FluentD.DockerImage,
-			})
-		}
-		if sidecarInjector.Spec.FluentD.AggregatorHost != "" {
-			env = append(env, corev1.EnvVar{
-				Name:  "FLUENTD_AGGREGATOR_HOST",
-				Value: sidecarInjector.Spec.FluentD.AggregatorHost,
-			})
-		}
-		if sidecarInjector.Spec.FluentD.AggregatorPort != 0 {
-			env = append(env, corev1.EnvVar{
-				Name:  "FLUENTD_AGGREGATOR_PORT",
-				Value: fmt.Sprintf("%d", sidecarInjector.Spec.FluentD.AggregatorPort),
-			})
-		}
-		if sidecarInjector.Spec.FluentD.ApplicationLogDir != "" {
-			env = append(env, corev1.EnvVar{
-				Name:  "FLUENTD_APPLICATION_LOG_DIR",
-				Value: sidecarInjector.Spec.FluentD.ApplicationLogDir,
-			})
-		}
-		if sidecarInjector.Spec.FluentD.TagPrefix != "" {
-			env = append(env, corev1.EnvVar{
-				Name:  "FLUENTD_TAG_PREFIX",
-				Value: sidecarInjector.Spec.FluentD.TagPrefix,
-			})
-		}
-		if sidecarInjector.Spec.FluentD.TimeKey != "" {
-			env = append(env, corev1.EnvVar{
-				Name:  "FLUENTD_TIME_KEY",
-				Value: sidecarInjector.Spec.FluentD.TimeKey,
-			})
-		}
-		if sidecarInjector.Spec.FluentD.TimeFormat != "" {
-			env = append(env, corev1.EnvVar{
-				Name:  "FLUENTD_TIME_FORMAT",
-				Value: sidecarInjector.Spec.FluentD.TimeFormat,
-			})
-		}
-		if sidecarInjector.Spec.FluentD.CustomEnv != "" {
-			env = append(env, corev1.EnvVar{
-				Name:  "FLUENTD_CUSTOM_ENV",
-				Value: sidecarInjector.Spec.FluentD.CustomEnv,
-			})
-		}
+}
+
+// migratedDeploymentName returns the name of the Deployment which replaces a Deployment with another selector.
+// It contains a hash of the selector, because the selector can not be changed with the same name.
+func migratedDeploymentName(desired *appsv1.Deployment) string {
+	keys := make([]string, 0, len(desired.Spec.Selector.MatchLabels))
+	for key := range desired.Spec.Selector.MatchLabels {
+		keys = append(keys, key)
 	}
-	if sidecarInjector.Spec.FluentBit != nil {
-		if sidecarInjector.Spec.FluentBit.DockerImage != "" {
-			env = append(env, corev1.EnvVar{
-				Name:  "FLUENTBIT_DOCKER_IMAGE",
-				Value: sidecarInjector.Spec.FluentBit.DockerImage,
-			})
-		}
-		if sidecarInjector.Spec.FluentBit.AggregatorHost != "" {
-			env = append(env, corev1.EnvVar{
-				Name:  "FLUENTBIT_AGGREGATOR_HOST",
-				Value: sidecarInjector.Spec.FluentBit.AggregatorHost,
-			})
-		}
-		if sidecarInjector.Spec.FluentBit.AggregatorPort != 0 {
-			env = append(env, corev1.EnvVar{
-				Name:  "FLUENTBIT_AGGREGATOR_PORT",
-				Value: fmt.Sprintf("%d", sidecarInjector.Spec.FluentBit.AggregatorPort),
-			})
-		}
-		if sidecarInjector.Spec.FluentBit.ApplicationLogDir != "" {
-			env = append(env, corev1.EnvVar{
-				Name:  "FLUENTBIT_APPLICATION_LOG_DIR",
-				Value: sidecarInjector.Spec.FluentBit.ApplicationLogDir,
-			})
-		}
-		if sidecarInjector.Spec.FluentBit.TagPrefix != "" {
-			env = append(env, corev1.EnvVar{
-				Name:  "FLUENTBIT_TAG_PREFIX",
-				Value: sidecarInjector.Spec.FluentBit.TagPrefix,
-			})
-		}
-		if sidecarInjector.Spec.FluentBit.CustomEnv != "" {
-			env = append(env, corev1.EnvVar{
-				Name:  "FLUENTBIT_CUSTOM_ENV",
-				Value: sidecarInjector.Spec.FluentBit.CustomEnv,
-			})
-		}
+	slices.Sort(keys)
+	h := sha256.New()
+	for _, key := range keys {
+		fmt.Fprintf(h, "%s=%s,", key, desired.Spec.Selector.MatchLabels[key])
 	}
+	return fmt.Sprintf("%s-%x", desired.Name, h.Sum(nil)[:4])
+}
+
+// deploymentAvailable returns true when all replicas of the current generation are available.
+func deploymentAvailable(deployment *appsv1.Deployment) bool {
+	if deployment.Status.ObservedGeneration < deployment.Generation {
+		return false
+	}
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return deployment.Status.UpdatedReplicas >= replicas && deployment.Status.AvailableReplicas >= replicas
+}
+
+func newDeployment(sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, namespace, secretName, image, serviceAccountName string) *appsv1.Deployment {
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      sidecarInjector.Name + "-handler",
@@ -143,16 +100,16 @@ func newDeployment(sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, nam
 		Spec: appsv1.DeploymentSpec{
 			Replicas: ptr.To[int32](2),
 			Selector: &metav1.LabelSelector{
-				MatchLabels: map[string]string{
-					WebhookServerLabelKey: WebhookServerLabelValue,
-				},
+				MatchLabels: webhookPodLabels(sidecarInjector),
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{
-						WebhookServerLabelKey: WebhookServerLabelValue,
+					Labels: webhookPodLabels(sidecarInjector),
+					Annotations: map[string]string{
+						"prometheus.io/scrape": "true",
+						"prometheus.io/port":   strconv.Itoa(WebhookMetricsPort),
+						"prometheus.io/path":   "/metrics",
 					},
-					Annotations: map[string]string{},
 				},
 				Spec: corev1.PodSpec{
 					Volumes: []corev1.Volume{
@@ -175,6 +132,9 @@ func newDeployment(sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, nam
 								"webhook",
 								"--tls-cert-file=/etc/webhook/certs/" + serverCertName,
 								"--tls-key-file=/etc/webhook/certs/" + serverKeyName,
+								// The webhook server watches the SidecarInjector, so changes of the spec are applied without restarting.
+								"--sidecar-injector=" + sidecarInjector.Name,
+								"--metrics-port=" + strconv.Itoa(WebhookMetricsPort),
 							},
 							Ports: []corev1.ContainerPort{
 								{
@@ -182,9 +142,13 @@ func newDeployment(sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, nam
 									ContainerPort: 8080,
 									Protocol:      corev1.ProtocolTCP,
 								},
+								{
+									Name:          "metrics",
+									ContainerPort: WebhookMetricsPort,
+									Protocol:      corev1.ProtocolTCP,
+								},
 							},
 							EnvFrom: nil,
-							Env:     env,
 							Resources: corev1.ResourceRequirements{
 								Limits: map[corev1.ResourceName]resource.Quantity{
 									corev1.ResourceMemory: {
@@ -237,7 +201,7 @@ func newDeployment(sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, nam
 							ImagePullPolicy: corev1.PullAlways,
 						},
 					},
-					ServiceAccountName: "default",
+					ServiceAccountName: serviceAccountName,
 				},
 			},
 		},
@@ -245,10 +209,11 @@ func newDeployment(sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, nam
 	return deployment
 }
 
-func newSecret(sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, namespace, serviceName, secretName string) (*corev1.Secret, []byte, error) {
-	key, cert, err := NewCertificates(serviceName, namespace)
+// newSecret returns a secret for the webhook server, which contains a server certificate signed by the CA in caSecret.
+func newSecret(sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, namespace, serviceName, secretName string, caSecret *corev1.Secret, validity time.Duration) (*corev1.Secret, error) {
+	key, cert, err := NewServerCertificate(serviceName, namespace, caSecret.Data[caKeyName], caSecret.Data[caCertName], validity)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
@@ -268,43 +233,135 @@ func newSecret(sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, namespa
 		Data: map[string][]byte{
 			serverKeyName:  key,
 			serverCertName: cert,
+			// Only the CA certificate, the CA key is not shared with the webhook server.
+			caCertName: caSecret.Data[caCertName],
 		},
 		Type: corev1.SecretTypeOpaque,
 	}
-	return secret, cert, nil
+	return secret, nil
 }
 
-func NewCertificates(serviceName, namespace string) ([]byte, []byte, error) {
+// newCASecret returns a secret which contains a CA key pair. It is read only by the controller, and is not mounted to webhook servers.
+func newCASecret(sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, namespace, secretName string, validity time.Duration) (*corev1.Secret, error) {
+	key, cert, err := NewCA(sidecarInjector.Name, validity)
+	if err != nil {
+		return nil, err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secretName,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"sidecarinjectors.operator.h3poteto.dev": "webhook-ca",
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(sidecarInjector, schema.GroupVersionKind{
+					Group:   sidecarinjectorv1alpha1.SchemeGroupVersion.Group,
+					Version: sidecarinjectorv1alpha1.SchemeGroupVersion.Version,
+					Kind:    "SidecarInjector",
+				}),
+			},
+		},
+		Data: map[string][]byte{
+			caKeyName:  key,
+			caCertName: cert,
+		},
+		Type: corev1.SecretTypeOpaque,
+	}
+	return secret, nil
+}
+
+// NewCA generates a private key and a self-signed CA certificate, which is valid during the validity.
+func NewCA(name string, validity time.Duration) ([]byte, []byte, error) {
 	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
 		return nil, nil, err
 	}
-
-	name := pkix.Name{
-		Country:      []string{},
-		Organization: []string{},
-		Locality:     []string{},
-		CommonName:   serviceName + "." + namespace + ".svc",
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, nil, err
 	}
 
-	CA := x509.Certificate{
-		SerialNumber:          big.NewInt(2048),
-		Subject:               name,
-		NotBefore:             time.Now(),
-		NotAfter:              time.Now().AddDate(10, 0, 0),
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName: "sidecar-injector-ca." + name,
+		},
+		// Allow clock skew between the controller and the API server.
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              now.Add(validity),
 		IsCA:                  true,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
 		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
 		BasicConstraintsValid: true,
-		// To generate extensions included SANs.
-		DNSNames: []string{
-			serviceName + "." + namespace + ".svc",
+		MaxPathLenZero:        true,
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, &template, &template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encodeKeyPair(privateKey, cert)
+}
+
+// NewServerCertificate generates a private key and a server certificate for the webhook service, which is signed by the CA.
+// The certificate is valid during the validity, but it does not outlive the CA.
+func NewServerCertificate(serviceName, namespace string, caKeyPEM, caCertPEM []byte, validity time.Duration) ([]byte, []byte, error) {
+	ca, err := tls.X509KeyPair(caCertPEM, caKeyPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	caCert, err := x509.ParseCertificate(ca.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	notAfter := now.Add(validity)
+	if notAfter.After(caCert.NotAfter) {
+		notAfter = caCert.NotAfter
+	}
+	template := x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName: serviceName + "." + namespace + ".svc",
 		},
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              notAfter,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		BasicConstraintsValid: true,
+		DNSNames:              serverDNSNames(serviceName, namespace),
 	}
-	cert, err := x509.CreateCertificate(rand.Reader, &CA, &CA, &privateKey.PublicKey, privateKey)
+	cert, err := x509.CreateCertificate(rand.Reader, &template, caCert, &privateKey.PublicKey, ca.PrivateKey)
 	if err != nil {
 		return nil, nil, err
 	}
+	return encodeKeyPair(privateKey, cert)
+}
+
+func serverDNSNames(serviceName, namespace string) []string {
+	return []string{
+		serviceName,
+		serviceName + "." + namespace,
+		serviceName + "." + namespace + ".svc",
+		serviceName + "." + namespace + ".svc.cluster.local",
+	}
+}
+
+// newSerialNumber returns a random serial number. Serial numbers must be unique, otherwise clients may confuse a renewed certificate with the old one.
+func newSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+func encodeKeyPair(privateKey *rsa.PrivateKey, cert []byte) ([]byte, []byte, error) {
 	keyPem := &pem.Block{
 		Type:  "RSA PRIVATE KEY",
 		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
@@ -341,21 +398,40 @@ func newService(sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, namesp
 					Port:       443,
 					TargetPort: intstr.FromInt(8080),
 				},
+				{
+					Name:       "metrics",
+					Protocol:   corev1.ProtocolTCP,
+					Port:       WebhookMetricsPort,
+					TargetPort: intstr.FromString("metrics"),
+				},
 			},
-			Selector: map[string]string{
-				"sidecarinjectors.operator.h3poteto.dev": "webhook-pod",
-			},
-			Type: corev1.ServiceTypeClusterIP,
+			Selector: webhookPodLabels(sidecarInjector),
+			Type:     corev1.ServiceTypeClusterIP,
 		},
 	}
 	return service
 }
 
 func newMutatingWebhookConfiguration(sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, mutatingName, serviceNamespace, serviceName string) *admissionregistrationv1.MutatingWebhookConfiguration {
-	ignore := admissionregistrationv1.Ignore
+	failurePolicy := admissionregistrationv1.Ignore
+	if sidecarInjector.Spec.FailurePolicy != nil {
+		failurePolicy = *sidecarInjector.Spec.FailurePolicy
+	}
+	matchPolicy := admissionregistrationv1.Equivalent
+	if sidecarInjector.Spec.MatchPolicy != nil {
+		matchPolicy = *sidecarInjector.Spec.MatchPolicy
+	}
+	sideEffects := admissionregistrationv1.SideEffectClassNone
+	if sidecarInjector.Spec.SideEffects != nil {
+		sideEffects = *sidecarInjector.Spec.SideEffects
+	}
+	timeoutSeconds := int32(30)
+	if sidecarInjector.Spec.TimeoutSeconds != nil {
+		timeoutSeconds = *sidecarInjector.Spec.TimeoutSeconds
+	}
 	allscopes := admissionregistrationv1.AllScopes
-	equivalent := admissionregistrationv1.Equivalent
-	sideeffect := admissionregistrationv1.SideEffectClassNone
+	// Pods are mutated again if other webhooks change them after injection.
+	ifNeeded := admissionregistrationv1.IfNeededReinvocationPolicy
 	mutating := &admissionregistrationv1.MutatingWebhookConfiguration{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: mutatingName,
@@ -395,23 +471,107 @@ func newMutatingWebhookConfiguration(sidecarInjector *sidecarinjectorv1alpha1.Si
 						},
 					},
 				},
-				FailurePolicy: &ignore,
-				MatchPolicy:   &equivalent,
-				ObjectSelector: &metav1.LabelSelector{
-					MatchExpressions: []metav1.LabelSelectorRequirement{
-						{
-							Key:      "sidecarinjectors.operator.h3poteto.dev",
-							Operator: metav1.LabelSelectorOpNotIn,
-							Values:   []string{"webhook-pod"},
-						},
+				FailurePolicy:           &failurePolicy,
+				MatchPolicy:             &matchPolicy,
+				NamespaceSelector:       webhookNamespaceSelector(sidecarInjector.Spec.NamespaceSelector, serviceNamespace, sidecarInjector.Spec.ExcludedNamespaces),
+				ObjectSelector:          webhookObjectSelector(sidecarInjector.Spec.ObjectSelector),
+				SideEffects:             &sideEffects,
+				TimeoutSeconds:          &timeoutSeconds,
+				AdmissionReviewVersions: []string{"v1"},
+				ReinvocationPolicy:      &ifNeeded,
+				MatchConditions: []admissionregistrationv1.MatchCondition{
+					{
+						Name:       "injector",
+						Expression: injectorMatchExpression(sidecarInjector.Name, ptr.Deref(sidecarInjector.Spec.Default, false)),
 					},
 				},
-				SideEffects:             &sideeffect,
-				TimeoutSeconds:          ptr.To[int32](30),
-				AdmissionReviewVersions: []string{"v1"},
 			},
 		},
 	}
 
 	return mutating
 }
+
+// injectorMatchExpression returns a CEL expression which matches pods which specify the SidecarInjector in the injector annotation.
+// The default SidecarInjector also matches pods without the annotation.
+func injectorMatchExpression(name string, isDefault bool) string {
+	if isDefault {
+		return fmt.Sprintf("!has(object.metadata.annotations) || !('%s' in object.metadata.annotations) || object.metadata.annotations['%s'] == '%s'", InjectorAnnotation, InjectorAnnotation, name)
+	}
+	return fmt.Sprintf("has(object.metadata.annotations) && '%s' in object.metadata.annotations && object.metadata.annotations['%s'] == '%s'", InjectorAnnotation, InjectorAnnotation, name)
+}
+
+// webhookNamespaceSelector adds a requirement to exclude kube-system, the namespace of the controller and the excluded namespaces to the selector.
+// The namespace of the controller is always excluded, so the webhook server can start even if the failure policy is Fail.
+func webhookNamespaceSelector(selector *metav1.LabelSelector, controllerNamespace string, excluded []string) *metav1.LabelSelector {
+	result := selector.DeepCopy()
+	if result == nil {
+		result = &metav1.LabelSelector{}
+	}
+	namespaces := []string{metav1.NamespaceSystem}
+	for _, namespace := range append([]string{controllerNamespace}, excluded...) {
+		if namespace != "" && !slices.Contains(namespaces, namespace) {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	result.MatchExpressions = append(result.MatchExpressions, metav1.LabelSelectorRequirement{
+		Key:      corev1.LabelMetadataName,
+		Operator: metav1.LabelSelectorOpNotIn,
+		Values:   namespaces,
+	})
+	return result
+}
+
+// webhookObjectSelector adds a requirement to exclude pods of the webhook server to the selector.
+func webhookObjectSelector(selector *metav1.LabelSelector) *metav1.LabelSelector {
+	result := selector.DeepCopy()
+	if result == nil {
+		result = &metav1.LabelSelector{}
+	}
+	result.MatchExpressions = append(result.MatchExpressions, metav1.LabelSelectorRequirement{
+		Key:      "sidecarinjectors.operator.h3poteto.dev",
+		Operator: metav1.LabelSelectorOpNotIn,
+		Values:   []string{"webhook-pod"},
+	})
+	return result
+}
+
+func newMutatingWebhookConfigurationWithCABundle(sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, mutatingName, serviceNamespace, serviceName string, caBundle []byte) *admissionregistrationv1.MutatingWebhookConfiguration {
+	mutating := newMutatingWebhookConfiguration(sidecarInjector, mutatingName, serviceNamespace, serviceName)
+	for i := range mutating.Webhooks {
+		mutating.Webhooks[i].ClientConfig.CABundle = caBundle
+	}
+	return mutating
+}
+
+// newMutatingWebhookConfigurationWithCertManager returns a MutatingWebhookConfiguration without caBundle, because cert-manager injects it.
+func newMutatingWebhookConfigurationWithCertManager(sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, mutatingName, serviceNamespace, serviceName, certificateName string) *admissionregistrationv1.MutatingWebhookConfiguration {
+	mutating := newMutatingWebhookConfiguration(sidecarInjector, mutatingName, serviceNamespace, serviceName)
+	mutating.Annotations["cert-manager.io/inject-ca-from"] = serviceNamespace + "/" + certificateName
+	return mutating
+}
+
+// newPipelineConfigMap returns a ConfigMap which has configuration files rendered from the pipeline.
+// It is labeled with the name of the SidecarInjector, so the controller watches only these ConfigMaps.
+func newPipelineConfigMap(sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, namespace string, data map[string]string) *corev1.ConfigMap {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pipeline.ConfigMapName(sidecarInjector.Name),
+			Namespace: namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(sidecarInjector, schema.GroupVersionKind{
+					Group:   sidecarinjectorv1alpha1.SchemeGroupVersion.Group,
+					Version: sidecarinjectorv1alpha1.SchemeGroupVersion.Version,
+					Kind:    "SidecarInjector",
+				}),
+			},
+		},
+		Data: data,
+	}
+	if len(validation.IsValidLabelValue(sidecarInjector.Name)) == 0 {
+		configMap.Labels = map[string]string{
+			InjectorLabel: sidecarInjector.Name,
+		}
+	}
+	return configMap
+}
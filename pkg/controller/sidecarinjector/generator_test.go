@@ -2,12 +2,18 @@ package sidecarinjector
 
 import (
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
 )
 
 func TestFluentDNewDeployment(t *testing.T) {
@@ -31,7 +37,7 @@ func TestFluentDNewDeployment(t *testing.T) {
 	}
 	namespace := "my-managers"
 
-	deployment := newDeployment(manifest, namespace, "test-secret", "my-injector-image:tag")
+	deployment := newDeployment(manifest, namespace, "test-secret", "my-injector-image:tag", "webhook-sa")
 
 	if deployment.Name != "unit-test-handler" {
 		t.Errorf("Deployment name is not matched: %s", deployment.Name)
@@ -48,33 +54,90 @@ func TestFluentDNewDeployment(t *testing.T) {
 	if deployment.Spec.Template.Spec.Volumes[0].VolumeSource.Secret.SecretName != "test-secret" {
 		t.Errorf("Deployment volume secret is not matched: %s", deployment.Spec.Template.Spec.Volumes[0].VolumeSource.Secret.SecretName)
 	}
+	if deployment.Spec.Template.Spec.ServiceAccountName != "webhook-sa" {
+		t.Errorf("Deployment service account is not matched: %s", deployment.Spec.Template.Spec.ServiceAccountName)
+	}
 	if deployment.Spec.Template.Spec.Containers[0].Name != "webhook-handler" {
 		t.Errorf("Deployment container name is not matched: %s", deployment.Spec.Template.Spec.Containers[0].Name)
 	}
 	if deployment.Spec.Template.Spec.Containers[0].Image != "my-injector-image:tag" {
 		t.Errorf("Deployment container image is not matched: %s", deployment.Spec.Template.Spec.Containers[0].Image)
 	}
+	if !containsArg(deployment.Spec.Template.Spec.Containers[0].Args, "--sidecar-injector=unit-test") {
+		t.Errorf("Deployment container args are not matched: %v", deployment.Spec.Template.Spec.Containers[0].Args)
+	}
+	if deployment.Spec.Selector.MatchLabels[WebhookServerNameLabelKey] != "unit-test" {
+		t.Errorf("Deployment selector is not matched: %v", deployment.Spec.Selector)
+	}
+	if deployment.Spec.Template.Labels[WebhookServerNameLabelKey] != "unit-test" || deployment.Spec.Template.Labels[WebhookServerLabelKey] != WebhookServerLabelValue {
+		t.Errorf("Deployment pod labels are not matched: %v", deployment.Spec.Template.Labels)
+	}
+	if !containsArg(deployment.Spec.Template.Spec.Containers[0].Args, "--metrics-port=8081") {
+		t.Errorf("Deployment container args are not matched: %v", deployment.Spec.Template.Spec.Containers[0].Args)
+	}
+	if ports := deployment.Spec.Template.Spec.Containers[0].Ports; len(ports) != 2 || ports[1].Name != "metrics" || ports[1].ContainerPort != WebhookMetricsPort {
+		t.Errorf("Deployment container ports are not matched: %v", ports)
+	}
+	if deployment.Spec.Template.Annotations["prometheus.io/port"] != "8081" {
+		t.Errorf("Deployment pod annotations are not matched: %v", deployment.Spec.Template.Annotations)
+	}
+}
 
-	if dockerImage := findEnv(deployment.Spec.Template.Spec.Containers[0].Env, "FLUENTD_DOCKER_IMAGE"); dockerImage == nil || dockerImage.Value != "my-fluentd-image:some-tag" {
-		t.Errorf("Container env docker image is not matched: %v", dockerImage)
+func TestMigratedDeploymentName(t *testing.T) {
+	manifest := &sidecarinjectorv1alpha1.SidecarInjector{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "unit-test",
+		},
 	}
-	if aggregatorHost := findEnv(deployment.Spec.Template.Spec.Containers[0].Env, "FLUENTD_AGGREGATOR_HOST"); aggregatorHost == nil || aggregatorHost.Value != "my-aggregator-host.local" {
-		t.Errorf("Container env aggregator host is not matched: %v", aggregatorHost)
+	deployment := newDeployment(manifest, "my-managers", "test-secret", "my-injector-image:tag", "webhook-sa")
+	name := migratedDeploymentName(deployment)
+	if !strings.HasPrefix(name, "unit-test-handler-") || name == deployment.Name {
+		t.Errorf("Migrated deployment name is not matched: %s", name)
 	}
-	if aggregatorPort := findEnv(deployment.Spec.Template.Spec.Containers[0].Env, "FLUENTD_AGGREGATOR_PORT"); aggregatorPort == nil || aggregatorPort.Value != "24224" {
-		t.Errorf("Container env aggregator port is not matched: %v", aggregatorPort)
+	if again := migratedDeploymentName(deployment); again != name {
+		t.Errorf("Migrated deployment name is not stable: %s, %s", name, again)
 	}
-	if aggregatorLogDir := findEnv(deployment.Spec.Template.Spec.Containers[0].Env, "FLUENTD_APPLICATION_LOG_DIR"); aggregatorLogDir == nil || aggregatorLogDir.Value != "/var/log/my-logs" {
-		t.Errorf("Container env aggregator log dir is not matched: %v", aggregatorLogDir)
+	deployment.Spec.Selector.MatchLabels = map[string]string{WebhookServerLabelKey: WebhookServerLabelValue}
+	if other := migratedDeploymentName(deployment); other == name {
+		t.Errorf("Migrated deployment name should be changed with the selector: %s", other)
 	}
-	if tagPrefix := findEnv(deployment.Spec.Template.Spec.Containers[0].Env, "FLUENTD_TAG_PREFIX"); tagPrefix == nil || tagPrefix.Value != "my-tag" {
-		t.Errorf("Container env tag prefix is not matched: %v", tagPrefix)
+}
+
+func TestDeploymentAvailable(t *testing.T) {
+	manifest := &sidecarinjectorv1alpha1.SidecarInjector{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "unit-test",
+		},
 	}
-	if timeKey := findEnv(deployment.Spec.Template.Spec.Containers[0].Env, "FLUENTD_TIME_KEY"); timeKey == nil || timeKey.Value != "time" {
-		t.Errorf("Container env time key is not matched: %v", timeKey)
+	deployment := newDeployment(manifest, "my-managers", "test-secret", "my-injector-image:tag", "webhook-sa")
+	deployment.Generation = 1
+	if deploymentAvailable(deployment) {
+		t.Error("New deployment should not be available")
 	}
-	if timeFormat := findEnv(deployment.Spec.Template.Spec.Containers[0].Env, "FLUENTD_TIME_FORMAT"); timeFormat == nil || timeFormat.Value != "%Y-%m-%dT%H:%M:%S" {
-		t.Errorf("Container env time format is not matched: %v", timeFormat)
+	deployment.Status.ObservedGeneration = 1
+	deployment.Status.UpdatedReplicas = 2
+	deployment.Status.AvailableReplicas = 1
+	if deploymentAvailable(deployment) {
+		t.Error("Deployment should not be available until all replicas are available")
+	}
+	deployment.Status.AvailableReplicas = 2
+	if !deploymentAvailable(deployment) {
+		t.Error("Deployment should be available")
+	}
+}
+
+func TestNewService(t *testing.T) {
+	manifest := &sidecarinjectorv1alpha1.SidecarInjector{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "unit-test",
+		},
+	}
+	service := newService(manifest, "my-managers", "my-service")
+	if service.Spec.Selector[WebhookServerNameLabelKey] != "unit-test" || service.Spec.Selector[WebhookServerLabelKey] != WebhookServerLabelValue {
+		t.Errorf("Service selector is not matched: %v", service.Spec.Selector)
+	}
+	if ports := service.Spec.Ports; len(ports) != 2 || ports[1].Name != "metrics" || ports[1].Port != WebhookMetricsPort {
+		t.Errorf("Service ports are not matched: %v", ports)
 	}
 }
 
@@ -98,7 +161,7 @@ func TestFluentBitNewDeployment(t *testing.T) {
 
 	namespace := "my-managers"
 
-	deployment := newDeployment(manifest, namespace, "test-secret", "my-injector-image:tag")
+	deployment := newDeployment(manifest, namespace, "test-secret", "my-injector-image:tag", "webhook-sa")
 
 	if deployment.Name != "unit-test-handler" {
 		t.Errorf("Deployment name is not matched: %s", deployment.Name)
@@ -115,65 +178,114 @@ func TestFluentBitNewDeployment(t *testing.T) {
 	if deployment.Spec.Template.Spec.Volumes[0].VolumeSource.Secret.SecretName != "test-secret" {
 		t.Errorf("Deployment volume secret is not matched: %s", deployment.Spec.Template.Spec.Volumes[0].VolumeSource.Secret.SecretName)
 	}
+	if deployment.Spec.Template.Spec.ServiceAccountName != "webhook-sa" {
+		t.Errorf("Deployment service account is not matched: %s", deployment.Spec.Template.Spec.ServiceAccountName)
+	}
 	if deployment.Spec.Template.Spec.Containers[0].Name != "webhook-handler" {
 		t.Errorf("Deployment container name is not matched: %s", deployment.Spec.Template.Spec.Containers[0].Name)
 	}
 	if deployment.Spec.Template.Spec.Containers[0].Image != "my-injector-image:tag" {
 		t.Errorf("Deployment container image is not matched: %s", deployment.Spec.Template.Spec.Containers[0].Image)
 	}
-	if dockerImage := findEnv(deployment.Spec.Template.Spec.Containers[0].Env, "FLUENTBIT_DOCKER_IMAGE"); dockerImage == nil || dockerImage.Value != "my-fluent-bit-image:some-tag" {
-		t.Errorf("Container env docker image is not matched: %v", dockerImage)
-	}
-	if aggregatorHost := findEnv(deployment.Spec.Template.Spec.Containers[0].Env, "FLUENTBIT_AGGREGATOR_HOST"); aggregatorHost == nil || aggregatorHost.Value != "my-aggregator-host.local" {
-		t.Errorf("Container env aggregator host is not matched: %v", aggregatorHost)
-	}
-	if aggregatorPort := findEnv(deployment.Spec.Template.Spec.Containers[0].Env, "FLUENTBIT_AGGREGATOR_PORT"); aggregatorPort == nil || aggregatorPort.Value != "24224" {
-		t.Errorf("Container env aggregator port is not matched: %v", aggregatorPort)
-	}
-	if aggregatorLogDir := findEnv(deployment.Spec.Template.Spec.Containers[0].Env, "FLUENTBIT_APPLICATION_LOG_DIR"); aggregatorLogDir == nil || aggregatorLogDir.Value != "/var/log/my-logs" {
-		t.Errorf("Container env aggregator log dir is not matched: %v", aggregatorLogDir)
-	}
-	if tagPrefix := findEnv(deployment.Spec.Template.Spec.Containers[0].Env, "FLUENTBIT_TAG_PREFIX"); tagPrefix == nil || tagPrefix.Value != "my-tag" {
-		t.Errorf("Container env tag prefix is not matched: %v", tagPrefix)
+	if !containsArg(deployment.Spec.Template.Spec.Containers[0].Args, "--sidecar-injector=unit-test") {
+		t.Errorf("Deployment container args are not matched: %v", deployment.Spec.Template.Spec.Containers[0].Args)
 	}
 }
 
-func findEnv(env []corev1.EnvVar, targetName string) *corev1.EnvVar {
-	for i := range env {
-		if env[i].Name == targetName {
-			return &env[i]
+func containsArg(args []string, target string) bool {
+	for _, arg := range args {
+		if arg == target {
+			return true
 		}
 	}
-	return nil
+	return false
 }
 
-func TestNewCertificates(t *testing.T) {
-	serviceName := "my-cluster"
-	namespace := "kube-system"
-	key, cert, err := NewCertificates(serviceName, namespace)
+func TestNewCA(t *testing.T) {
+	key, cert, err := NewCA("my-injector", 48*time.Hour)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 	certificate, err := tls.X509KeyPair(cert, key)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 
 	// https://pkg.go.dev/crypto/tls@go1.23.8#X509KeyPair
 	// Before Go 1.23 Certificate.Leaf was left nil, and the parsed certificate was discarded. This behavior can be re-enabled by setting "x509keypairleaf=0" in the GODEBUG environment variable.
-	if certificate.Leaf != nil {
-		t.Errorf("Failed to parse certificate: %v", certificate)
+	if certificate.Leaf == nil {
+		t.Fatalf("Failed to parse certificate: %v", certificate)
+	}
+	if !certificate.Leaf.IsCA {
+		t.Errorf("Certificate is not CA: %v", certificate.Leaf)
+	}
+	if certificate.Leaf.KeyUsage&x509.KeyUsageCertSign == 0 {
+		t.Errorf("CA can not sign certificates: %v", certificate.Leaf.KeyUsage)
+	}
+	if lifetime := time.Until(certificate.Leaf.NotAfter); lifetime > 48*time.Hour || lifetime < 47*time.Hour {
+		t.Errorf("Certificate expiration is not matched: %s", certificate.Leaf.NotAfter)
 	}
 }
 
-func TestNewMutatingWebhookConfiguration(t *testing.T) {
+func TestNewServerCertificate(t *testing.T) {
 	serviceName := "my-cluster"
 	namespace := "kube-system"
-	_, _, err := NewCertificates(serviceName, namespace)
+	caKey, caCert, err := NewCA("my-injector", 48*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, cert, err := NewServerCertificate(serviceName, namespace, caKey, caCert, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := tls.X509KeyPair(cert, key)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	if certificate.Leaf.IsCA {
+		t.Errorf("Server certificate should not be CA: %v", certificate.Leaf)
+	}
+	if len(certificate.Leaf.ExtKeyUsage) != 1 || certificate.Leaf.ExtKeyUsage[0] != x509.ExtKeyUsageServerAuth {
+		t.Errorf("ExtKeyUsage is not matched: %v", certificate.Leaf.ExtKeyUsage)
+	}
+	if lifetime := time.Until(certificate.Leaf.NotAfter); lifetime > 24*time.Hour || lifetime < 23*time.Hour {
+		t.Errorf("Certificate expiration is not matched: %s", certificate.Leaf.NotAfter)
 	}
 
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caCert)
+	for _, name := range []string{"my-cluster.kube-system.svc", "my-cluster.kube-system.svc.cluster.local"} {
+		if _, err := certificate.Leaf.Verify(x509.VerifyOptions{
+			DNSName:   name,
+			Roots:     roots,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}); err != nil {
+			t.Errorf("Failed to verify certificate for %s: %v", name, err)
+		}
+	}
+
+	// The server certificate does not outlive the CA.
+	_, capped, err := NewServerCertificate(serviceName, namespace, caKey, caCert, 72*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(capped)
+	cappedLeaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Until(cappedLeaf.NotAfter) > 48*time.Hour {
+		t.Errorf("Certificate outlives the CA: %s", cappedLeaf.NotAfter)
+	}
+	if cappedLeaf.SerialNumber.Cmp(certificate.Leaf.SerialNumber) == 0 {
+		t.Errorf("Serial number is not unique: %s", certificate.Leaf.SerialNumber)
+	}
+}
+
+func TestNewMutatingWebhookConfiguration(t *testing.T) {
+	serviceName := "my-cluster"
+	namespace := "kube-system"
+
 	injector := &sidecarinjectorv1alpha1.SidecarInjector{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: "test",
@@ -204,4 +316,111 @@ func TestNewMutatingWebhookConfiguration(t *testing.T) {
 	if conf.Webhooks[0].AdmissionReviewVersions[0] != "v1" {
 		t.Errorf("Webhook AdmissionReviewVersions is not matched: %v", conf.Webhooks[0].AdmissionReviewVersions)
 	}
+	if *conf.Webhooks[0].ReinvocationPolicy != admissionregistrationv1.IfNeededReinvocationPolicy {
+		t.Errorf("Webhook ReinvocationPolicy is not matched: %v", *conf.Webhooks[0].ReinvocationPolicy)
+	}
+	if len(conf.Webhooks[0].MatchConditions) != 1 || conf.Webhooks[0].MatchConditions[0].Expression != injectorMatchExpression("test", false) {
+		t.Errorf("Webhook MatchConditions are not matched: %v", conf.Webhooks[0].MatchConditions)
+	}
+}
+
+func TestNewMutatingWebhookConfigurationWithSelectors(t *testing.T) {
+	injector := &sidecarinjectorv1alpha1.SidecarInjector{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test",
+		},
+		Spec: sidecarinjectorv1alpha1.SidecarInjectorSpec{
+			Collector: "fluentd",
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"fluentd-sidecar-injector.h3poteto.dev/injection": "enabled",
+				},
+			},
+			ObjectSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app": "web",
+				},
+			},
+		},
+	}
+
+	conf := newMutatingWebhookConfiguration(injector, "my-cluster", "kube-system", "my-cluster")
+	webhook := conf.Webhooks[0]
+	if webhook.NamespaceSelector.MatchLabels["fluentd-sidecar-injector.h3poteto.dev/injection"] != "enabled" {
+		t.Errorf("Webhook NamespaceSelector is not matched: %v", webhook.NamespaceSelector)
+	}
+	if webhook.ObjectSelector.MatchLabels["app"] != "web" {
+		t.Errorf("Webhook ObjectSelector is not matched: %v", webhook.ObjectSelector)
+	}
+	if len(webhook.ObjectSelector.MatchExpressions) != 1 || webhook.ObjectSelector.MatchExpressions[0].Values[0] != "webhook-pod" {
+		t.Errorf("Webhook pods are not excluded: %v", webhook.ObjectSelector)
+	}
+	if len(injector.Spec.ObjectSelector.MatchExpressions) != 0 {
+		t.Errorf("Spec is modified: %v", injector.Spec.ObjectSelector)
+	}
+}
+
+func TestNewMutatingWebhookConfigurationWithPolicies(t *testing.T) {
+	fail := admissionregistrationv1.Fail
+	exact := admissionregistrationv1.Exact
+	noneOnDryRun := admissionregistrationv1.SideEffectClassNoneOnDryRun
+	injector := &sidecarinjectorv1alpha1.SidecarInjector{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test",
+		},
+		Spec: sidecarinjectorv1alpha1.SidecarInjectorSpec{
+			Collector:          "fluentd",
+			FailurePolicy:      &fail,
+			TimeoutSeconds:     ptr.To[int32](5),
+			MatchPolicy:        &exact,
+			SideEffects:        &noneOnDryRun,
+			ExcludedNamespaces: []string{"monitoring", "kube-system"},
+		},
+	}
+
+	webhook := newMutatingWebhookConfiguration(injector, "my-cluster", "sidecar-injector", "my-cluster").Webhooks[0]
+	if *webhook.FailurePolicy != admissionregistrationv1.Fail {
+		t.Errorf("Webhook FailurePolicy is not matched: %v", *webhook.FailurePolicy)
+	}
+	if *webhook.TimeoutSeconds != 5 {
+		t.Errorf("Webhook TimeoutSeconds is not matched: %d", *webhook.TimeoutSeconds)
+	}
+	if *webhook.MatchPolicy != admissionregistrationv1.Exact {
+		t.Errorf("Webhook MatchPolicy is not matched: %v", *webhook.MatchPolicy)
+	}
+	if *webhook.SideEffects != admissionregistrationv1.SideEffectClassNoneOnDryRun {
+		t.Errorf("Webhook SideEffects is not matched: %v", *webhook.SideEffects)
+	}
+	expressions := webhook.NamespaceSelector.MatchExpressions
+	if len(expressions) != 1 || expressions[0].Key != corev1.LabelMetadataName || expressions[0].Operator != metav1.LabelSelectorOpNotIn {
+		t.Fatalf("Webhook NamespaceSelector is not matched: %v", webhook.NamespaceSelector)
+	}
+	if !reflect.DeepEqual(expressions[0].Values, []string{"kube-system", "sidecar-injector", "monitoring"}) {
+		t.Errorf("Excluded namespaces are not matched: %v", expressions[0].Values)
+	}
+
+	// kube-system and the namespace of the controller are excluded by default.
+	injector.Spec = sidecarinjectorv1alpha1.SidecarInjectorSpec{Collector: "fluentd"}
+	webhook = newMutatingWebhookConfiguration(injector, "my-cluster", "sidecar-injector", "my-cluster").Webhooks[0]
+	if values := webhook.NamespaceSelector.MatchExpressions[0].Values; !reflect.DeepEqual(values, []string{"kube-system", "sidecar-injector"}) {
+		t.Errorf("Excluded namespaces are not matched: %v", values)
+	}
+	if *webhook.FailurePolicy != admissionregistrationv1.Ignore || *webhook.TimeoutSeconds != 30 {
+		t.Errorf("Webhook defaults are not matched: %v %d", *webhook.FailurePolicy, *webhook.TimeoutSeconds)
+	}
+}
+
+func TestInjectorMatchExpression(t *testing.T) {
+	expression := injectorMatchExpression("test", false)
+	expected := "has(object.metadata.annotations) && 'fluentd-sidecar-injector.h3poteto.dev/injector' in object.metadata.annotations && object.metadata.annotations['fluentd-sidecar-injector.h3poteto.dev/injector'] == 'test'"
+	if expression != expected {
+		t.Errorf("Expression is not matched: %s", expression)
+	}
+
+	// The default SidecarInjector also matches pods without the annotation.
+	expression = injectorMatchExpression("test", true)
+	expected = "!has(object.metadata.annotations) || !('fluentd-sidecar-injector.h3poteto.dev/injector' in object.metadata.annotations) || object.metadata.annotations['fluentd-sidecar-injector.h3poteto.dev/injector'] == 'test'"
+	if expression != expected {
+		t.Errorf("Expression is not matched: %s", expression)
+	}
 }
@@ -0,0 +1,51 @@
+package sidecarinjector
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestObserveReconcile(t *testing.T) {
+	sidecarInjector := &sidecarinjectorv1alpha1.SidecarInjector{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "metrics-test",
+		},
+		Spec: sidecarinjectorv1alpha1.SidecarInjectorSpec{
+			Collector: "fluent-bit",
+		},
+	}
+	expiration := &metav1.Time{Time: time.Unix(1700000000, 0)}
+	before := testutil.CollectAndCount(reconcileDuration)
+	observeReconcile(sidecarInjector, "kube-system", expiration, time.Now(), nil)
+	observeReconcile(sidecarInjector, "kube-system", nil, time.Now(), fmt.Errorf("forbidden"))
+	if count := testutil.CollectAndCount(reconcileDuration); count != before+2 {
+		t.Errorf("Reconcile duration series is not matched: %d", count)
+	}
+	if value := testutil.ToFloat64(certificateExpiration.WithLabelValues("metrics-test", "fluent-bit", "kube-system")); value != 1700000000 {
+		t.Errorf("Certificate expiration is not matched: %f", value)
+	}
+
+	forgetSidecarInjector("metrics-test")
+	if count := testutil.CollectAndCount(certificateExpiration); count != 0 {
+		t.Errorf("Certificate expiration of the deleted SidecarInjector should be removed: %d", count)
+	}
+}
+
+func TestWorkqueueMetrics(t *testing.T) {
+	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "metrics-test-queue")
+	queue.Add("item")
+	if value := testutil.ToFloat64(workqueueDepth.WithLabelValues("metrics-test-queue")); value != 1 {
+		t.Errorf("Workqueue depth is not matched: %f", value)
+	}
+	queue.AddRateLimited("another")
+	if value := testutil.ToFloat64(workqueueRetries.WithLabelValues("metrics-test-queue")); value != 1 {
+		t.Errorf("Workqueue retries is not matched: %f", value)
+	}
+	queue.ShutDown()
+}
@@ -3,49 +3,119 @@ package sidecarinjector
 import (
 	"context"
 	"fmt"
+	"time"
 
-	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/klog/v2"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/metadata/metadatalister"
 )
 
-// GetOwnerDeployment gets a deployment which owns the pod.
-func (c *Controller) GetOwnerDeployment(ctx context.Context, ns, name string) (*appsv1.Deployment, error) {
-	pod, err := c.kubeclientset.CoreV1().Pods(ns).Get(ctx, name, metav1.GetOptions{})
-	if err != nil {
-		klog.Errorf("failed to get pod: %v", err)
-		return nil, err
-	}
+// maxOwnerDepth limits the owner chain to avoid infinite loops by broken references.
+const maxOwnerDepth = 5
+
+// workloadKinds are top-level workloads, so owners of them are not fetched.
+// Job is not included, because it may be owned by CronJob.
+var workloadKinds = map[schema.GroupKind]bool{
+	{Group: "apps", Kind: "Deployment"}:     true,
+	{Group: "apps", Kind: "StatefulSet"}:    true,
+	{Group: "apps", Kind: "DaemonSet"}:      true,
+	{Group: "batch", Kind: "CronJob"}:       true,
+	{Group: "argoproj.io", Kind: "Rollout"}: true,
+}
+
+// cachedOwnerResources are owners of pods which built-in workloads create. Metadata of them are cached with informers,
+// so resolving workloads does not request the API server on every pod creation.
+var cachedOwnerResources = map[schema.GroupKind]schema.GroupVersionResource{
+	{Group: "apps", Kind: "ReplicaSet"}: {Group: "apps", Version: "v1", Resource: "replicasets"},
+	{Group: "batch", Kind: "Job"}:       {Group: "batch", Version: "v1", Resource: "jobs"},
+}
 
-	ownerRS := findOwner(pod.OwnerReferences, "ReplicaSet")
-	if ownerRS == nil {
-		return nil, fmt.Errorf("failed to get OwnerReferences in Pod %s/%s", pod.Namespace, pod.Name)
+// OwnerResolver resolves the top-level workload which owns a pod, e.g. Deployment, StatefulSet, DaemonSet, CronJob and Argo Rollouts.
+// It follows controller references in the metadata cache, and fetches other kinds of owners with the dynamic client, so it supports any kinds of workloads.
+type OwnerResolver struct {
+	dynamicClient   *DynamicClient
+	informerFactory metadatainformer.SharedInformerFactory
+	listers         map[schema.GroupKind]metadatalister.Lister
+}
+
+// NewOwnerResolver returns a new OwnerResolver. If metadataClient is nil, owners are always fetched from the API server.
+func NewOwnerResolver(dynamicClient *DynamicClient, metadataClient metadata.Interface) *OwnerResolver {
+	r := &OwnerResolver{
+		dynamicClient: dynamicClient,
+		listers:       map[schema.GroupKind]metadatalister.Lister{},
+	}
+	if metadataClient == nil {
+		return r
 	}
+	r.informerFactory = metadatainformer.NewSharedInformerFactory(metadataClient, time.Second*30)
+	for gk, gvr := range cachedOwnerResources {
+		r.listers[gk] = metadatalister.New(r.informerFactory.ForResource(gvr).Informer().GetIndexer(), gvr)
+	}
+	return r
+}
 
-	rs, err := c.kubeclientset.AppsV1().ReplicaSets(ns).Get(ctx, ownerRS.Name, metav1.GetOptions{})
-	if err != nil {
-		klog.Errorf("failed to get replicaset: %v", err)
-		return nil, err
+// Start starts informers of the metadata cache.
+func (r *OwnerResolver) Start(stopCh <-chan struct{}) {
+	if r.informerFactory != nil {
+		r.informerFactory.Start(stopCh)
 	}
+}
 
-	ownerDeploy := findOwner(rs.OwnerReferences, "Deployment")
-	if ownerDeploy == nil {
-		return nil, fmt.Errorf("failed to get OwnerReferences in ReplicaSet %s/%s", rs.Namespace, rs.Name)
+// ResolveWorkload returns the kind and the name of the top-level controller in the owner references.
+// It returns empty strings if there is no controller. When an owner can not be fetched, it returns the last resolved owner with the error.
+func (r *OwnerResolver) ResolveWorkload(ctx context.Context, namespace string, refs []metav1.OwnerReference) (string, string, error) {
+	owner := controllerOf(refs)
+	if owner == nil {
+		return "", "", nil
+	}
+	kind, name := owner.Kind, owner.Name
+	for i := 0; i < maxOwnerDepth; i++ {
+		gv, err := schema.ParseGroupVersion(owner.APIVersion)
+		if err != nil {
+			return kind, name, err
+		}
+		if workloadKinds[gv.WithKind(owner.Kind).GroupKind()] {
+			return kind, name, nil
+		}
+		refs, err := r.ownerReferences(ctx, gv.WithKind(owner.Kind), namespace, owner.Name)
+		if err != nil {
+			return kind, name, fmt.Errorf("failed to get %s %s/%s: %w", owner.Kind, namespace, owner.Name, err)
+		}
+		owner = controllerOf(refs)
+		if owner == nil {
+			return kind, name, nil
+		}
+		kind, name = owner.Kind, owner.Name
 	}
+	return kind, name, fmt.Errorf("owner references of %s %s/%s are too deep", kind, namespace, name)
+}
 
-	deploy, err := c.kubeclientset.AppsV1().Deployments(ns).Get(ctx, ownerDeploy.Name, metav1.GetOptions{})
+// ownerReferences returns owner references of the object in the metadata cache, or from the API server if it is not cached.
+func (r *OwnerResolver) ownerReferences(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string) ([]metav1.OwnerReference, error) {
+	if lister, ok := r.listers[gvk.GroupKind()]; ok {
+		obj, err := lister.Namespace(namespace).Get(name)
+		if err == nil {
+			return obj.GetOwnerReferences(), nil
+		}
+		// The owner may be created just before the pod, and the informer may not receive it yet.
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+	obj, err := r.dynamicClient.GetObject(ctx, gvk, namespace, name)
 	if err != nil {
-		klog.Errorf("failed to get deployment: %v", err)
 		return nil, err
 	}
-
-	return deploy, nil
+	return obj.GetOwnerReferences(), nil
 }
 
-func findOwner(refs []metav1.OwnerReference, kind string) *metav1.OwnerReference {
+func controllerOf(refs []metav1.OwnerReference) *metav1.OwnerReference {
 	for i := range refs {
 		o := &refs[i]
-		if o.Kind == kind {
+		if o.Controller != nil && *o.Controller {
 			return o
 		}
 	}
@@ -0,0 +1,139 @@
+package sidecarinjector
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/utils/ptr"
+)
+
+func newOwnedObject(apiVersion, kind, name string, owner *metav1.OwnerReference) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace("default")
+	obj.SetName(name)
+	if owner != nil {
+		obj.SetOwnerReferences([]metav1.OwnerReference{*owner})
+	}
+	return obj
+}
+
+func newControllerRef(apiVersion, kind, name string) *metav1.OwnerReference {
+	return &metav1.OwnerReference{
+		APIVersion: apiVersion,
+		Kind:       kind,
+		Name:       name,
+		Controller: ptr.To(true),
+	}
+}
+
+func TestResolveWorkload(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "ReplicaSet"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"}, meta.RESTScopeNamespace)
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		newOwnedObject("apps/v1", "ReplicaSet", "web-5d4f", newControllerRef("apps/v1", "Deployment", "web")),
+		newOwnedObject("apps/v1", "ReplicaSet", "canary-7b9c", newControllerRef("argoproj.io/v1alpha1", "Rollout", "canary")),
+		newOwnedObject("batch/v1", "Job", "backup-28000000", newControllerRef("batch/v1", "CronJob", "backup")),
+		newOwnedObject("batch/v1", "Job", "migration", nil),
+	)
+	resolver := NewOwnerResolver(&DynamicClient{client: client, mapper: mapper}, nil)
+
+	cases := []struct {
+		owner *metav1.OwnerReference
+		kind  string
+		name  string
+	}{
+		{newControllerRef("apps/v1", "ReplicaSet", "web-5d4f"), "Deployment", "web"},
+		{newControllerRef("apps/v1", "ReplicaSet", "canary-7b9c"), "Rollout", "canary"},
+		{newControllerRef("batch/v1", "Job", "backup-28000000"), "CronJob", "backup"},
+		{newControllerRef("batch/v1", "Job", "migration"), "Job", "migration"},
+		{newControllerRef("apps/v1", "StatefulSet", "db"), "StatefulSet", "db"},
+		{newControllerRef("apps/v1", "DaemonSet", "agent"), "DaemonSet", "agent"},
+	}
+	for _, c := range cases {
+		kind, name, err := resolver.ResolveWorkload(context.Background(), "default", []metav1.OwnerReference{*c.owner})
+		if err != nil {
+			t.Errorf("Failed to resolve %s %s: %v", c.owner.Kind, c.owner.Name, err)
+			continue
+		}
+		if kind != c.kind || name != c.name {
+			t.Errorf("Workload of %s %s is not matched: %s %s", c.owner.Kind, c.owner.Name, kind, name)
+		}
+	}
+
+	kind, name, err := resolver.ResolveWorkload(context.Background(), "default", nil)
+	if err != nil || kind != "" || name != "" {
+		t.Errorf("Workload of a pod without owners is not matched: %s %s %v", kind, name, err)
+	}
+
+	// The last resolved owner is returned when the owner can not be fetched.
+	kind, name, err = resolver.ResolveWorkload(context.Background(), "default", []metav1.OwnerReference{*newControllerRef("apps/v1", "ReplicaSet", "unknown")})
+	if err == nil {
+		t.Error("Missing owner should be an error")
+	}
+	if kind != "ReplicaSet" || name != "unknown" {
+		t.Errorf("Workload is not matched: %s %s", kind, name)
+	}
+}
+
+func TestResolveWorkloadWithMetadataCache(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "ReplicaSet"}, meta.RESTScopeNamespace)
+	// The ReplicaSet which is created after the cache is synced exists only in the API server.
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		newOwnedObject("apps/v1", "ReplicaSet", "api-6c8d", newControllerRef("apps/v1", "Deployment", "api")),
+	)
+	cached := &metav1.PartialObjectMetadata{
+		TypeMeta: metav1.TypeMeta{APIVersion: "apps/v1", Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            "web-5d4f",
+			OwnerReferences: []metav1.OwnerReference{*newControllerRef("apps/v1", "Deployment", "web")},
+		},
+	}
+	scheme := metadatafake.NewTestScheme()
+	if err := metav1.AddMetaToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	resolver := NewOwnerResolver(&DynamicClient{client: client, mapper: mapper}, metadatafake.NewSimpleMetadataClient(scheme, cached))
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	resolver.Start(stopCh)
+	for gvr, synced := range resolver.informerFactory.WaitForCacheSync(stopCh) {
+		if !synced {
+			t.Fatalf("Failed to sync %s", gvr)
+		}
+	}
+
+	for _, c := range []struct {
+		owner string
+		name  string
+	}{
+		{"web-5d4f", "web"},
+		{"api-6c8d", "api"},
+	} {
+		kind, name, err := resolver.ResolveWorkload(context.Background(), "default", []metav1.OwnerReference{*newControllerRef("apps/v1", "ReplicaSet", c.owner)})
+		if err != nil {
+			t.Errorf("Failed to resolve ReplicaSet %s: %v", c.owner, err)
+			continue
+		}
+		if kind != "Deployment" || name != c.name {
+			t.Errorf("Workload of ReplicaSet %s is not matched: %s %s", c.owner, kind, name)
+		}
+	}
+	for _, action := range client.Actions() {
+		if action.(clienttesting.GetAction).GetName() == "web-5d4f" {
+			t.Error("Cached ReplicaSet should not be fetched from the API server")
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package sidecarinjector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	"github.com/h3poteto/fluentd-sidecar-injector/pkg/pipeline"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+)
+
+// syncPipeline publishes the configuration which is rendered from the pipeline as ConfigMaps in namespaces of the webhook,
+// because pods can mount only ConfigMaps in their namespace. ConfigMaps are published before pods are injected, because the first pod requires it,
+// so the controller requires permissions for ConfigMaps in all namespaces. ConfigMaps in namespaces which are no longer selected are deleted.
+func (c *Controller) syncPipeline(ctx context.Context, sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, ownerNamespace string) error {
+	targets := map[string]bool{}
+	if sidecarInjector.Spec.Pipeline != nil {
+		data, err := pipeline.Render(sidecarInjector.Spec.Pipeline)
+		if err != nil {
+			c.recorder.Eventf(sidecarInjector, corev1.EventTypeWarning, "InvalidPipeline", "Failed to render the pipeline: %v", err)
+			return err
+		}
+		namespaces, err := c.namespaceLister.List(labels.Everything())
+		if err != nil {
+			return err
+		}
+		selected, err := selectedNamespaces(sidecarInjector, namespaces, ownerNamespace)
+		if err != nil {
+			return err
+		}
+		for _, namespace := range selected {
+			targets[namespace] = true
+			if err := c.applyPipelineConfigMap(ctx, sidecarInjector, newPipelineConfigMap(sidecarInjector, namespace, data)); err != nil {
+				return err
+			}
+		}
+	}
+
+	// ConfigMaps without the label are deleted by the garbage collector with the SidecarInjector.
+	if len(validation.IsValidLabelValue(sidecarInjector.Name)) > 0 {
+		return nil
+	}
+	configMaps, err := c.configMapLister.List(labels.SelectorFromSet(labels.Set{InjectorLabel: sidecarInjector.Name}))
+	if err != nil {
+		return err
+	}
+	for _, configMap := range configMaps {
+		if targets[configMap.Namespace] || configMap.Name != pipeline.ConfigMapName(sidecarInjector.Name) || !metav1.IsControlledBy(configMap, sidecarInjector) {
+			continue
+		}
+		klog.Infof("Deleting ConfigMap %s/%s, because the namespace is not selected", configMap.Namespace, configMap.Name)
+		if err := c.kubeclientset.CoreV1().ConfigMaps(configMap.Namespace).Delete(ctx, configMap.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Controller) applyPipelineConfigMap(ctx context.Context, sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, desired *corev1.ConfigMap) error {
+	configMap, err := c.configMapLister.ConfigMaps(desired.Namespace).Get(desired.Name)
+	if errors.IsNotFound(err) {
+		configMap, err = c.kubeclientset.CoreV1().ConfigMaps(desired.Namespace).Create(ctx, desired, metav1.CreateOptions{})
+		// The ConfigMap is not in the cache if it does not have the label.
+		if errors.IsAlreadyExists(err) {
+			configMap, err = c.kubeclientset.CoreV1().ConfigMaps(desired.Namespace).Get(ctx, desired.Name, metav1.GetOptions{})
+		}
+	}
+	if err != nil {
+		klog.Error(err)
+		return err
+	}
+	if !metav1.IsControlledBy(configMap, sidecarInjector) {
+		msg := fmt.Sprintf("Resource %q already exists in %s and is not managed by SidecarInjector", configMap.Name, configMap.Namespace)
+		c.recorder.Event(sidecarInjector, corev1.EventTypeWarning, "ErrResourceExists", msg)
+		return fmt.Errorf("%s", msg)
+	}
+	return c.correctDrift(ctx, sidecarInjector, desired, configMapGVK, configMapDrift(configMap, desired))
+}
+
+// selectedNamespaces returns names of namespaces which are selected by the webhook, and which are not terminating.
+func selectedNamespaces(sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, namespaces []*corev1.Namespace, controllerNamespace string) ([]string, error) {
+	selector, err := metav1.LabelSelectorAsSelector(webhookNamespaceSelector(sidecarInjector.Spec.NamespaceSelector, controllerNamespace, sidecarInjector.Spec.ExcludedNamespaces))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, namespace := range namespaces {
+		if namespace.DeletionTimestamp != nil || namespace.Status.Phase == corev1.NamespaceTerminating {
+			continue
+		}
+		if selector.Matches(labels.Set(namespace.Labels)) {
+			names = append(names, namespace.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// handleNamespace enqueues SidecarInjectors which have pipelines, so ConfigMaps are published to new namespaces.
+func (c *Controller) handleNamespace(obj interface{}) {
+	sidecarInjectors, err := c.sidecarInjectorLister.List(labels.Everything())
+	if err != nil {
+		klog.Error(err)
+		return
+	}
+	for _, sidecarInjector := range sidecarInjectors {
+		if sidecarInjector.Spec.Pipeline != nil {
+			c.enqueueSidecarInjector(sidecarInjector)
+		}
+	}
+}
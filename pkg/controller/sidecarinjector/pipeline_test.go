@@ -0,0 +1,106 @@
+package sidecarinjector
+
+import (
+	"strings"
+	"testing"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	"github.com/h3poteto/fluentd-sidecar-injector/pkg/pipeline"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestNamespace(name string, labels map[string]string) *corev1.Namespace {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[corev1.LabelMetadataName] = name
+	return &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+	}
+}
+
+func TestSelectedNamespaces(t *testing.T) {
+	terminating := newTestNamespace("terminating", nil)
+	terminating.Status.Phase = corev1.NamespaceTerminating
+	namespaces := []*corev1.Namespace{
+		newTestNamespace("kube-system", nil),
+		newTestNamespace("my-managers", nil),
+		newTestNamespace("default", nil),
+		newTestNamespace("monitoring", nil),
+		newTestNamespace("app", map[string]string{"logging": "enabled"}),
+		terminating,
+	}
+	sidecarInjector := &sidecarinjectorv1alpha1.SidecarInjector{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "unit-test",
+		},
+		Spec: sidecarinjectorv1alpha1.SidecarInjectorSpec{
+			ExcludedNamespaces: []string{"monitoring"},
+		},
+	}
+
+	names, err := selectedNamespaces(sidecarInjector, namespaces, "my-managers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "app,default" {
+		t.Errorf("Namespaces are not matched: %v", names)
+	}
+
+	sidecarInjector.Spec.NamespaceSelector = &metav1.LabelSelector{
+		MatchLabels: map[string]string{"logging": "enabled"},
+	}
+	names, err = selectedNamespaces(sidecarInjector, namespaces, "my-managers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "app" {
+		t.Errorf("Namespaces with the selector are not matched: %v", names)
+	}
+}
+
+func TestNewPipelineConfigMap(t *testing.T) {
+	data := map[string]string{pipeline.FluentDConfigKey: "<match **>\n  @type stdout\n</match>\n"}
+	configMap := newPipelineConfigMap(driftTestSidecarInjector, "app", data)
+	if configMap.Name != "fluentd-sidecar-injector-config-unit-test" || configMap.Namespace != "app" {
+		t.Errorf("ConfigMap name is not matched: %s/%s", configMap.Namespace, configMap.Name)
+	}
+	if configMap.Labels[InjectorLabel] != "unit-test" {
+		t.Errorf("ConfigMap label is not matched: %v", configMap.Labels)
+	}
+	if !metav1.IsControlledBy(configMap, driftTestSidecarInjector) {
+		t.Errorf("ConfigMap should be controlled by SidecarInjector: %v", configMap.OwnerReferences)
+	}
+
+	longName := &sidecarinjectorv1alpha1.SidecarInjector{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: strings.Repeat("a", 64),
+		},
+	}
+	if configMap := newPipelineConfigMap(longName, "app", data); len(configMap.Labels) != 0 {
+		t.Errorf("Invalid label value should not be set: %v", configMap.Labels)
+	}
+}
+
+func TestConfigMapDrift(t *testing.T) {
+	desired := newPipelineConfigMap(driftTestSidecarInjector, "app", map[string]string{
+		pipeline.FluentDConfigKey:   "fluentd",
+		pipeline.FluentBitConfigKey: "fluent-bit",
+	})
+	existing := desired.DeepCopy()
+	existing.Labels["other"] = "label"
+	if fields := configMapDrift(existing, desired); len(fields) != 0 {
+		t.Errorf("Drift should not be detected: %v", fields)
+	}
+
+	existing.Data[pipeline.FluentDConfigKey] = "changed"
+	delete(existing.Labels, InjectorLabel)
+	fields := configMapDrift(existing, desired)
+	if strings.Join(fields, ",") != "data[fluent.conf],metadata.labels" {
+		t.Errorf("Fields are not matched: %v", fields)
+	}
+}
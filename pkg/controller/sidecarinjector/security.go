@@ -0,0 +1,122 @@
+package sidecarinjector
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// maxReportedSecrets is the number of missing Secrets in the message of the condition.
+const maxReportedSecrets = 10
+
+// forwardSecretKeys returns Secrets which are referenced by the forward security of collectors, and keys which the sidecar reads.
+func forwardSecretKeys(spec *sidecarinjectorv1alpha1.SidecarInjectorSpec) map[string][]string {
+	var securities []*sidecarinjectorv1alpha1.ForwardSecuritySpec
+	if spec.FluentD != nil {
+		securities = append(securities, spec.FluentD.Security)
+	}
+	if spec.FluentBit != nil {
+		securities = append(securities, spec.FluentBit.Security)
+	}
+	secrets := map[string][]string{}
+	add := func(name string, keys ...string) {
+		if name != "" {
+			secrets[name] = append(secrets[name], keys...)
+		}
+	}
+	for _, security := range securities {
+		if security == nil {
+			continue
+		}
+		add(security.CASecretName, sidecarinjectorv1alpha1.ForwardCAKey)
+		add(security.ClientCertSecretName, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+		add(security.SharedKeySecretName, sidecarinjectorv1alpha1.ForwardSharedKeyKey)
+		add(security.UserSecretName, corev1.BasicAuthUsernameKey, corev1.BasicAuthPasswordKey)
+	}
+	return secrets
+}
+
+// missingForwardSecrets returns Secrets of the forward security which do not exist, or which do not have the keys, in namespaces of the webhook.
+// Pods read the Secrets in their namespaces, so the Secrets are required in all selected namespaces.
+func (c *Controller) missingForwardSecrets(sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, ownerNamespace string) ([]string, error) {
+	secrets := forwardSecretKeys(&sidecarInjector.Spec)
+	if len(secrets) == 0 {
+		return []string{}, nil
+	}
+	namespaces, err := c.namespaceLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	selected, err := selectedNamespaces(sidecarInjector, namespaces, ownerNamespace)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(secrets))
+	for name := range secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	missing := []string{}
+	for _, namespace := range selected {
+		for _, name := range names {
+			secret, err := c.secretsLister.Secrets(namespace).Get(name)
+			if errors.IsNotFound(err) {
+				missing = append(missing, namespace+"/"+name)
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if keys := missingKeys(secret, secrets[name]); len(keys) > 0 {
+				missing = append(missing, fmt.Sprintf("%s/%s (%s)", namespace, name, strings.Join(keys, ", ")))
+			}
+		}
+	}
+	return missing, nil
+}
+
+func missingKeys(secret *corev1.Secret, keys []string) []string {
+	var missing []string
+	for _, key := range keys {
+		if _, ok := secret.Data[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
+
+// forwardSecretsCondition reports Secrets of the forward security. It is unknown if the sync fails before checking them.
+func forwardSecretsCondition(missing []string) metav1.Condition {
+	condition := metav1.Condition{
+		Type: sidecarinjectorv1alpha1.ConditionForwardSecretsFound,
+	}
+	switch {
+	case missing == nil:
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = "NotChecked"
+		condition.Message = "Secrets are not checked"
+	case len(missing) > 0:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "SecretsNotFound"
+		reported := missing
+		if len(reported) > maxReportedSecrets {
+			reported = reported[:maxReportedSecrets]
+		}
+		condition.Message = fmt.Sprintf("Secrets are not found: %s", strings.Join(reported, ", "))
+		if len(missing) > maxReportedSecrets {
+			condition.Message += fmt.Sprintf(" and %d more", len(missing)-maxReportedSecrets)
+		}
+	default:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "SecretsFound"
+		condition.Message = "Secrets of the forward security exist"
+	}
+	return condition
+}
@@ -0,0 +1,80 @@
+package sidecarinjector
+
+import (
+	"strings"
+	"testing"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestMissingForwardSecrets(t *testing.T) {
+	sidecarInjector := &sidecarinjectorv1alpha1.SidecarInjector{
+		ObjectMeta: metav1.ObjectMeta{Name: "unit-test"},
+		Spec: sidecarinjectorv1alpha1.SidecarInjectorSpec{
+			FluentD: &sidecarinjectorv1alpha1.FluentDSpec{
+				Security: &sidecarinjectorv1alpha1.ForwardSecuritySpec{
+					TLS:                 true,
+					CASecretName:        "aggregator-ca",
+					SharedKeySecretName: "aggregator-key",
+				},
+			},
+		},
+	}
+
+	namespaces := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	secrets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, name := range []string{"default", "team-a", "kube-system"} {
+		namespaces.Add(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{corev1.LabelMetadataName: name}}})
+	}
+	secrets.Add(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "aggregator-ca"},
+		Data:       map[string][]byte{"ca.crt": []byte("ca")},
+	})
+	secrets.Add(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "aggregator-key"},
+		Data:       map[string][]byte{"key": []byte("secret")},
+	})
+	c := &Controller{
+		namespaceLister: corelisters.NewNamespaceLister(namespaces),
+		secretsLister:   corelisters.NewSecretLister(secrets),
+	}
+
+	missing, err := c.missingForwardSecrets(sidecarInjector, "kube-system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"default/aggregator-key (shared_key)", "team-a/aggregator-ca", "team-a/aggregator-key"}
+	if strings.Join(missing, ",") != strings.Join(expected, ",") {
+		t.Errorf("Missing secrets are not matched: %#v", missing)
+	}
+	condition := forwardSecretsCondition(missing)
+	if condition.Status != metav1.ConditionFalse || condition.Reason != "SecretsNotFound" {
+		t.Errorf("Condition is not matched: %#v", condition)
+	}
+
+	sidecarInjector.Spec.FluentD.Security = nil
+	missing, err = c.missingForwardSecrets(sidecarInjector, "kube-system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if condition := forwardSecretsCondition(missing); condition.Status != metav1.ConditionTrue {
+		t.Errorf("Condition without secrets is not matched: %#v", condition)
+	}
+}
+
+func TestForwardSecretsCondition(t *testing.T) {
+	if condition := forwardSecretsCondition(nil); condition.Status != metav1.ConditionUnknown {
+		t.Errorf("Condition before the check is not matched: %#v", condition)
+	}
+	var missing []string
+	for i := 0; i < maxReportedSecrets+2; i++ {
+		missing = append(missing, "default/secret")
+	}
+	if condition := forwardSecretsCondition(missing); !strings.HasSuffix(condition.Message, " and 2 more") {
+		t.Errorf("Message is not matched: %s", condition.Message)
+	}
+}
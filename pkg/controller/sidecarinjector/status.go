@@ -0,0 +1,239 @@
+package sidecarinjector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// syncResult is resources which are observed in a sync. They are nil if the sync fails before observing them.
+type syncResult struct {
+	certificateExpiration *metav1.Time
+	mutating              *admissionregistrationv1.MutatingWebhookConfiguration
+	caBundle              []byte
+	deployment            *appsv1.Deployment
+	service               *corev1.Service
+	// missingForwardSecrets is nil if Secrets are not checked.
+	missingForwardSecrets []string
+}
+
+func (c *Controller) updateSidecarInjectorStatus(ctx context.Context, sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector, namespace string, result *syncResult, syncErr error) error {
+	readyEndpoints := 0
+	if result.service != nil {
+		slices, err := c.endpointSliceLister.EndpointSlices(namespace).List(labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: result.service.Name}))
+		if err != nil {
+			return err
+		}
+		readyEndpoints = countReadyEndpoints(slices)
+	}
+	injectedPods, err := c.countInjectedPods(sidecarInjector.Name)
+	if err != nil {
+		return err
+	}
+
+	status := sidecarInjector.Status.DeepCopy()
+	status.ObservedGeneration = sidecarInjector.Generation
+	if result.deployment != nil {
+		status.InjectorDeploymentName = result.deployment.Name
+		status.InjectorPodCount = result.deployment.Status.AvailableReplicas
+	}
+	status.InjectorServiceReady = readyEndpoints > 0
+	if result.certificateExpiration != nil {
+		status.CertificateNotAfter = result.certificateExpiration
+	}
+	status.WebhookCABundleHash = caBundleHash(result.caBundle)
+	status.InjectedPodCount = injectedPods
+	for _, condition := range newConditions(result, readyEndpoints, syncErr, time.Now()) {
+		condition.ObservedGeneration = sidecarInjector.Generation
+		meta.SetStatusCondition(&status.Conditions, condition)
+	}
+
+	if equality.Semantic.DeepEqual(&sidecarInjector.Status, status) {
+		return nil
+	}
+	sidecarInjectorCopy := sidecarInjector.DeepCopy()
+	sidecarInjectorCopy.Status = *status
+	_, err = c.ownclientset.OperatorV1alpha1().SidecarInjectors().UpdateStatus(ctx, sidecarInjectorCopy, metav1.UpdateOptions{})
+	return err
+}
+
+// newConditions returns conditions of the SidecarInjector from the observed resources.
+// Ready is true only when other conditions of the webhook are true and the sync succeeds. Secrets of the forward security do not affect it.
+func newConditions(result *syncResult, readyEndpoints int, syncErr error, now time.Time) []metav1.Condition {
+	conditions := []metav1.Condition{
+		certificateCondition(result.certificateExpiration, now),
+		webhookCondition(result.mutating, result.caBundle),
+		deploymentCondition(result.deployment),
+		endpointsCondition(result.service, readyEndpoints),
+	}
+
+	ready := metav1.Condition{
+		Type:    sidecarinjectorv1alpha1.ConditionReady,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Ready",
+		Message: "Webhook server is ready to inject sidecars",
+	}
+	var notReady []string
+	for _, condition := range conditions {
+		if condition.Status != metav1.ConditionTrue {
+			notReady = append(notReady, condition.Type)
+		}
+	}
+	if syncErr != nil {
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = "SyncFailed"
+		ready.Message = syncErr.Error()
+	} else if len(notReady) > 0 {
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = "NotReady"
+		ready.Message = fmt.Sprintf("%s are not ready", strings.Join(notReady, ", "))
+	}
+	return append(conditions, ready, forwardSecretsCondition(result.missingForwardSecrets))
+}
+
+func certificateCondition(expiration *metav1.Time, now time.Time) metav1.Condition {
+	condition := metav1.Condition{
+		Type: sidecarinjectorv1alpha1.ConditionCertificateReady,
+	}
+	switch {
+	case expiration == nil:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "CertificateNotFound"
+		condition.Message = "Certificate of the webhook server is not issued yet"
+	case !now.Before(expiration.Time):
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "CertificateExpired"
+		condition.Message = fmt.Sprintf("Certificate of the webhook server expired at %s", expiration.UTC().Format(time.RFC3339))
+	default:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "CertificateIssued"
+		condition.Message = fmt.Sprintf("Certificate of the webhook server expires at %s", expiration.UTC().Format(time.RFC3339))
+	}
+	return condition
+}
+
+func webhookCondition(mutating *admissionregistrationv1.MutatingWebhookConfiguration, caBundle []byte) metav1.Condition {
+	condition := metav1.Condition{
+		Type: sidecarinjectorv1alpha1.ConditionWebhookConfigured,
+	}
+	switch {
+	case mutating == nil:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "WebhookConfigurationNotFound"
+		condition.Message = "MutatingWebhookConfiguration is not created yet"
+	case len(caBundle) == 0:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "CABundleMissing"
+		condition.Message = fmt.Sprintf("MutatingWebhookConfiguration %s does not have caBundle", mutating.Name)
+	default:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Configured"
+		condition.Message = fmt.Sprintf("MutatingWebhookConfiguration %s is configured", mutating.Name)
+	}
+	return condition
+}
+
+func deploymentCondition(deployment *appsv1.Deployment) metav1.Condition {
+	condition := metav1.Condition{
+		Type:    sidecarinjectorv1alpha1.ConditionDeploymentAvailable,
+		Status:  metav1.ConditionFalse,
+		Reason:  "DeploymentNotFound",
+		Message: "Deployment of the webhook server is not created yet",
+	}
+	if deployment == nil {
+		return condition
+	}
+	condition.Reason = "DeploymentUnavailable"
+	condition.Message = fmt.Sprintf("Deployment %s does not have available replicas", deployment.Name)
+	for _, c := range deployment.Status.Conditions {
+		if c.Type != appsv1.DeploymentAvailable {
+			continue
+		}
+		if c.Status == corev1.ConditionTrue && deployment.Status.AvailableReplicas > 0 {
+			condition.Status = metav1.ConditionTrue
+		}
+		if c.Reason != "" {
+			condition.Reason = c.Reason
+		}
+		if c.Message != "" {
+			condition.Message = c.Message
+		}
+	}
+	return condition
+}
+
+func endpointsCondition(service *corev1.Service, readyEndpoints int) metav1.Condition {
+	condition := metav1.Condition{
+		Type: sidecarinjectorv1alpha1.ConditionServiceEndpointsReady,
+	}
+	switch {
+	case service == nil:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "ServiceNotFound"
+		condition.Message = "Service of the webhook server is not created yet"
+	case readyEndpoints == 0:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "NoReadyEndpoints"
+		condition.Message = fmt.Sprintf("Service %s does not have ready endpoints", service.Name)
+	default:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "EndpointsReady"
+		condition.Message = fmt.Sprintf("Service %s has %d ready endpoints", service.Name, readyEndpoints)
+	}
+	return condition
+}
+
+// countReadyEndpoints counts endpoints which are ready. An endpoint is ready if the ready condition is unknown.
+func countReadyEndpoints(slices []*discoveryv1.EndpointSlice) int {
+	count := 0
+	for _, slice := range slices {
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// countInjectedPods counts pods which are not terminated and injected by the SidecarInjector.
+// The webhook server does not label pods if the name of the SidecarInjector is not a valid label value.
+func (c *Controller) countInjectedPods(name string) (int32, error) {
+	if len(validation.IsValidLabelValue(name)) > 0 {
+		return 0, nil
+	}
+	pods, err := c.injectedPodLister.List(labels.SelectorFromSet(labels.Set{InjectorLabel: name}))
+	if err != nil {
+		return 0, err
+	}
+	var count int32
+	for _, pod := range pods {
+		if pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// caBundleHash returns SHA-256 hash of the caBundle, so users can compare it without reading the whole caBundle.
+func caBundleHash(caBundle []byte) string {
+	if len(caBundle) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(caBundle)
+	return hex.EncodeToString(sum[:])
+}
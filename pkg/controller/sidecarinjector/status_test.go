@@ -0,0 +1,115 @@
+package sidecarinjector
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func newReadySyncResult(now time.Time) *syncResult {
+	return &syncResult{
+		certificateExpiration: &metav1.Time{Time: now.Add(time.Hour)},
+		mutating: &admissionregistrationv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "sidecar-injector-webhook-unit-test"},
+		},
+		caBundle: []byte("ca"),
+		deployment: &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "unit-test-handler"},
+			Status: appsv1.DeploymentStatus{
+				AvailableReplicas: 1,
+				Conditions: []appsv1.DeploymentCondition{
+					{
+						Type:   appsv1.DeploymentAvailable,
+						Status: corev1.ConditionTrue,
+						Reason: "MinimumReplicasAvailable",
+					},
+				},
+			},
+		},
+		service: &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "sidecar-injector-unit-test"},
+		},
+	}
+}
+
+func TestNewConditions(t *testing.T) {
+	now := time.Now()
+	conditions := newConditions(newReadySyncResult(now), 1, nil, now)
+	for _, conditionType := range []string{
+		sidecarinjectorv1alpha1.ConditionCertificateReady,
+		sidecarinjectorv1alpha1.ConditionWebhookConfigured,
+		sidecarinjectorv1alpha1.ConditionDeploymentAvailable,
+		sidecarinjectorv1alpha1.ConditionServiceEndpointsReady,
+		sidecarinjectorv1alpha1.ConditionReady,
+	} {
+		if !meta.IsStatusConditionTrue(conditions, conditionType) {
+			t.Errorf("Condition %s is not matched: %#v", conditionType, meta.FindStatusCondition(conditions, conditionType))
+		}
+	}
+
+	cases := []struct {
+		title         string
+		modify        func(result *syncResult)
+		endpoints     int
+		syncErr       error
+		conditionType string
+		reason        string
+	}{
+		{"expired certificate", func(r *syncResult) { r.certificateExpiration = &metav1.Time{Time: now.Add(-time.Hour)} }, 1, nil, sidecarinjectorv1alpha1.ConditionCertificateReady, "CertificateExpired"},
+		{"missing certificate", func(r *syncResult) { r.certificateExpiration = nil }, 1, nil, sidecarinjectorv1alpha1.ConditionCertificateReady, "CertificateNotFound"},
+		{"missing caBundle", func(r *syncResult) { r.caBundle = nil }, 1, nil, sidecarinjectorv1alpha1.ConditionWebhookConfigured, "CABundleMissing"},
+		{"unavailable deployment", func(r *syncResult) { r.deployment.Status = appsv1.DeploymentStatus{} }, 1, nil, sidecarinjectorv1alpha1.ConditionDeploymentAvailable, "DeploymentUnavailable"},
+		{"recreating deployment", func(r *syncResult) { r.deployment = nil }, 1, nil, sidecarinjectorv1alpha1.ConditionDeploymentAvailable, "DeploymentNotFound"},
+		{"no endpoints", func(r *syncResult) {}, 0, nil, sidecarinjectorv1alpha1.ConditionServiceEndpointsReady, "NoReadyEndpoints"},
+		{"sync error", func(r *syncResult) {}, 1, fmt.Errorf("forbidden"), sidecarinjectorv1alpha1.ConditionReady, "SyncFailed"},
+	}
+	for _, c := range cases {
+		result := newReadySyncResult(now)
+		c.modify(result)
+		conditions := newConditions(result, c.endpoints, c.syncErr, now)
+		condition := meta.FindStatusCondition(conditions, c.conditionType)
+		if condition == nil || condition.Status != metav1.ConditionFalse || condition.Reason != c.reason {
+			t.Errorf("Condition %s is not matched in %s: %#v", c.conditionType, c.title, condition)
+		}
+		if meta.IsStatusConditionTrue(conditions, sidecarinjectorv1alpha1.ConditionReady) {
+			t.Errorf("Ready condition should be false in %s", c.title)
+		}
+	}
+}
+
+func TestCountReadyEndpoints(t *testing.T) {
+	slices := []*discoveryv1.EndpointSlice{
+		{
+			Endpoints: []discoveryv1.Endpoint{
+				{Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(true)}},
+				{Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(false)}},
+			},
+		},
+		{
+			Endpoints: []discoveryv1.Endpoint{
+				{Conditions: discoveryv1.EndpointConditions{}},
+			},
+		},
+	}
+	if count := countReadyEndpoints(slices); count != 2 {
+		t.Errorf("Ready endpoints is not matched: %d", count)
+	}
+}
+
+func TestCABundleHash(t *testing.T) {
+	if hash := caBundleHash(nil); hash != "" {
+		t.Errorf("Hash of empty caBundle is not matched: %s", hash)
+	}
+	if hash := caBundleHash([]byte("ca")); len(hash) != 64 || hash == caBundleHash([]byte("another-ca")) {
+		t.Errorf("Hash of caBundle is not matched: %s", hash)
+	}
+}
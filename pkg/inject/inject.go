@@ -0,0 +1,230 @@
+// Package inject renders manifests with the sidecar which is injected by the webhook server, without any clusters.
+package inject
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/h3poteto/fluentd-sidecar-injector/pkg/webhook/sidecarinjector"
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/yaml"
+)
+
+// Output formats of Render.
+const (
+	OutputYAML  = "yaml"
+	OutputPatch = "patch"
+)
+
+// templatePaths are paths of pod templates in workloads. Pods are mutated directly.
+var templatePaths = map[string][]string{
+	"Pod":         {},
+	"Deployment":  {"spec", "template"},
+	"StatefulSet": {"spec", "template"},
+	"DaemonSet":   {"spec", "template"},
+	"ReplicaSet":  {"spec", "template"},
+	"Job":         {"spec", "template"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template"},
+}
+
+// Render reads manifests from the reader, and writes them with the injected sidecar.
+// Objects which do not have pods are written as they are. If the output is patch, a JSON patch for each object is written in a line.
+// The namespace is used for objects without the namespace.
+func Render(injector *sidecarinjector.Injector, in io.Reader, out io.Writer, namespace, output string) error {
+	if output != OutputYAML && output != OutputPatch {
+		return fmt.Errorf("output must be %s or %s, %s is not matched", OutputYAML, OutputPatch, output)
+	}
+	decoder := utilyaml.NewYAMLOrJSONDecoder(in, 4096)
+	first := true
+	for {
+		var raw runtime.RawExtension
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		raw.Raw = bytes.TrimSpace(raw.Raw)
+		if len(raw.Raw) == 0 || string(raw.Raw) == "null" {
+			continue
+		}
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(raw.Raw); err != nil {
+			return err
+		}
+		objects := []*unstructured.Unstructured{obj}
+		if obj.IsList() {
+			list, err := obj.ToList()
+			if err != nil {
+				return err
+			}
+			objects = objects[:0]
+			for i := range list.Items {
+				objects = append(objects, &list.Items[i])
+			}
+		}
+		for _, o := range objects {
+			patch, err := injectObject(injector, o, namespace)
+			if err != nil {
+				return fmt.Errorf("failed to inject %s %s: %w", o.GetKind(), o.GetName(), err)
+			}
+			if err := write(out, o, patch, output, first); err != nil {
+				return err
+			}
+			first = false
+		}
+	}
+}
+
+// injectObject injects the sidecar to the pod or the pod template of the object, and returns the JSON patch for the object.
+func injectObject(injector *sidecarinjector.Injector, obj *unstructured.Unstructured, namespace string) ([]byte, error) {
+	path, ok := templatePaths[obj.GetKind()]
+	if !ok {
+		return []byte("[]"), nil
+	}
+	if obj.GetNamespace() != "" {
+		namespace = obj.GetNamespace()
+	}
+	template := obj.Object
+	if len(path) > 0 {
+		t, found, err := unstructured.NestedMap(obj.Object, path...)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("pod template is not found in %s", strings.Join(path, "."))
+		}
+		template = t
+	}
+	if _, ok := template["metadata"].(map[string]interface{}); !ok {
+		template["metadata"] = map[string]interface{}{}
+	}
+
+	pod := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   template["metadata"],
+		"spec":       template["spec"],
+	}}
+	pod = pod.DeepCopy()
+	if len(path) > 0 {
+		// Pods which are created from templates are owned by the workload, so the workload is exposed to the sidecar.
+		pod.SetGenerateName(obj.GetName() + "-")
+		pod.SetOwnerReferences([]metav1.OwnerReference{
+			{
+				APIVersion: obj.GetAPIVersion(),
+				Kind:       obj.GetKind(),
+				Name:       obj.GetName(),
+				Controller: ptr.To(true),
+			},
+		})
+	}
+	// The pod is normalized in the same way as the API server, so the patch contains only the injection.
+	typed := &corev1.Pod{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(pod.Object, typed); err != nil {
+		return nil, err
+	}
+	podJSON, err := json.Marshal(typed)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := mutate(injector, podJSON, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if patch == nil {
+		return []byte("[]"), nil
+	}
+
+	// The patch is applied to the template, because metadata and spec are at the same paths as the pod.
+	decoded, err := jsonpatch.DecodePatch(patch)
+	if err != nil {
+		return nil, err
+	}
+	templateJSON, err := json.Marshal(template)
+	if err != nil {
+		return nil, err
+	}
+	patchedJSON, err := decoded.Apply(templateJSON)
+	if err != nil {
+		return nil, err
+	}
+	patched := map[string]interface{}{}
+	if err := json.Unmarshal(patchedJSON, &patched); err != nil {
+		return nil, err
+	}
+	if len(path) == 0 {
+		obj.Object = patched
+	} else if err := unstructured.SetNestedMap(obj.Object, patched, path...); err != nil {
+		return nil, err
+	}
+	return prefixPatch(patch, path)
+}
+
+// mutate sends the pod to the injector in the same way as the API server. It returns nil if the pod is not mutated.
+func mutate(injector *sidecarinjector.Injector, pod []byte, namespace string) ([]byte, error) {
+	review := injector.Validate(&sidecarinjector.AdmissionReviewRequest{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "AdmissionReview",
+			APIVersion: "admission.k8s.io/v1",
+		},
+		Request: &sidecarinjector.AdmissionRequest{
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Namespace: namespace,
+			Operation: "CREATE",
+			Object:    runtime.RawExtension{Raw: pod},
+		},
+	})
+	if !review.Response.Allowed {
+		return nil, fmt.Errorf("pod is rejected: %s", strings.Join(review.Response.Warnings, ", "))
+	}
+	return review.Response.Patch, nil
+}
+
+// prefixPatch moves paths of the patch to the pod template.
+func prefixPatch(patch []byte, path []string) ([]byte, error) {
+	if len(path) == 0 {
+		return patch, nil
+	}
+	var operations []map[string]interface{}
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, err
+	}
+	prefix := "/" + strings.Join(path, "/")
+	for _, operation := range operations {
+		for _, key := range []string{"path", "from"} {
+			if p, ok := operation[key].(string); ok {
+				operation[key] = prefix + p
+			}
+		}
+	}
+	return json.Marshal(operations)
+}
+
+func write(out io.Writer, obj *unstructured.Unstructured, patch []byte, output string, first bool) error {
+	if output == OutputPatch {
+		_, err := fmt.Fprintf(out, "%s\n", patch)
+		return err
+	}
+	data, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		return err
+	}
+	if !first {
+		if _, err := fmt.Fprintln(out, "---"); err != nil {
+			return err
+		}
+	}
+	_, err = out.Write(data)
+	return err
+}
@@ -0,0 +1,167 @@
+package inject
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/h3poteto/fluentd-sidecar-injector/pkg/webhook/sidecarinjector"
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const manifests = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+      annotations:
+        fluentd-sidecar-injector.h3poteto.dev/injection: enabled
+        fluentd-sidecar-injector.h3poteto.dev/aggregator-host: aggregator.local
+        fluentd-sidecar-injector.h3poteto.dev/application-log-dir: /var/log/nginx
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:latest
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  ports:
+  - port: 80
+`
+
+func findContainer(containers []corev1.Container, name string) *corev1.Container {
+	for i := range containers {
+		if containers[i].Name == name {
+			return &containers[i]
+		}
+	}
+	return nil
+}
+
+func findEnv(env []corev1.EnvVar, name string) *corev1.EnvVar {
+	for i := range env {
+		if env[i].Name == name {
+			return &env[i]
+		}
+	}
+	return nil
+}
+
+func TestRenderYAML(t *testing.T) {
+	out := new(bytes.Buffer)
+	if err := Render(sidecarinjector.NewInjector("", nil, nil, nil, nil), strings.NewReader(manifests), out, "default", OutputYAML); err != nil {
+		t.Fatal(err)
+	}
+	documents := strings.Split(out.String(), "\n---\n")
+	if len(documents) != 2 {
+		t.Fatalf("Documents are not matched: %s", out.String())
+	}
+
+	deployment := &appsv1.Deployment{}
+	if err := yaml.UnmarshalStrict([]byte(documents[0]), deployment); err != nil {
+		t.Fatal(err)
+	}
+	sidecar := findContainer(deployment.Spec.Template.Spec.Containers, sidecarinjector.ContainerName)
+	if sidecar == nil {
+		t.Fatalf("Sidecar is not injected: %#v", deployment.Spec.Template.Spec.Containers)
+	}
+	if kind := findEnv(sidecar.Env, sidecarinjector.WorkloadKindEnv); kind == nil || kind.Value != "Deployment" {
+		t.Errorf("Workload kind is not matched: %v", kind)
+	}
+	if name := findEnv(sidecar.Env, sidecarinjector.WorkloadNameEnv); name == nil || name.Value != "web" {
+		t.Errorf("Workload name is not matched: %v", name)
+	}
+	if len(deployment.Spec.Template.OwnerReferences) != 0 || deployment.Spec.Template.GenerateName != "" {
+		t.Errorf("Metadata of the pod is leaked to the template: %#v", deployment.Spec.Template.ObjectMeta)
+	}
+	if deployment.Spec.Template.Labels["app"] != "web" {
+		t.Errorf("Labels are not matched: %v", deployment.Spec.Template.Labels)
+	}
+
+	if !strings.Contains(documents[1], "kind: Service") || strings.Contains(documents[1], sidecarinjector.ContainerName) {
+		t.Errorf("Service is not matched: %s", documents[1])
+	}
+}
+
+func TestRenderPatch(t *testing.T) {
+	cronJob := `apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: backup
+spec:
+  schedule: "0 * * * *"
+  jobTemplate:
+    spec:
+      template:
+        metadata:
+          annotations:
+            fluentd-sidecar-injector.h3poteto.dev/injection: enabled
+            fluentd-sidecar-injector.h3poteto.dev/aggregator-host: aggregator.local
+            fluentd-sidecar-injector.h3poteto.dev/application-log-dir: /var/log/backup
+        spec:
+          restartPolicy: OnFailure
+          containers:
+          - name: backup
+            image: backup:latest
+`
+	out := new(bytes.Buffer)
+	if err := Render(sidecarinjector.NewInjector("", nil, nil, nil, nil), strings.NewReader(cronJob), out, "default", OutputPatch); err != nil {
+		t.Fatal(err)
+	}
+	patch, err := jsonpatch.DecodePatch(bytes.TrimSpace(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	original, err := yaml.YAMLToJSON([]byte(cronJob))
+	if err != nil {
+		t.Fatal(err)
+	}
+	patched, err := patch.Apply(original)
+	if err != nil {
+		t.Fatalf("Patch can not be applied to the CronJob: %v", err)
+	}
+	result := &batchv1.CronJob{}
+	if err := json.Unmarshal(patched, result); err != nil {
+		t.Fatal(err)
+	}
+	if findContainer(result.Spec.JobTemplate.Spec.Template.Spec.Containers, sidecarinjector.ContainerName) == nil {
+		t.Errorf("Sidecar is not injected: %#v", result.Spec.JobTemplate.Spec.Template.Spec.Containers)
+	}
+}
+
+func TestRenderRejectedPod(t *testing.T) {
+	pod := `apiVersion: v1
+kind: Pod
+metadata:
+  name: web
+  annotations:
+    fluentd-sidecar-injector.h3poteto.dev/injection: enabled
+spec:
+  containers:
+  - name: nginx
+    image: nginx:latest
+`
+	err := Render(sidecarinjector.NewInjector("", nil, nil, nil, nil), strings.NewReader(pod), new(bytes.Buffer), "default", OutputYAML)
+	if err == nil || !strings.Contains(err.Error(), "aggregator host is required") {
+		t.Errorf("Pod without aggregator host should be rejected: %v", err)
+	}
+
+	if err := Render(sidecarinjector.NewInjector("", nil, nil, nil, nil), strings.NewReader(pod), new(bytes.Buffer), "default", "json"); err == nil {
+		t.Error("Invalid output should be rejected")
+	}
+}
@@ -0,0 +1,21 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	klog "k8s.io/klog/v2"
+)
+
+// Namespace is the prefix of all metrics which are exposed by the controller and the webhook server.
+const Namespace = "fluentd_sidecar_injector"
+
+// Serve exposes metrics of the default registry on /metrics with plain HTTP, so Prometheus can scrape them without the webhook certificate.
+func Serve(port int32) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	listen := fmt.Sprintf(":%d", port)
+	klog.Infof("Serving metrics on %s", listen)
+	return http.ListenAndServe(listen, mux)
+}
@@ -0,0 +1,209 @@
+// Package pipeline renders configuration files of collectors from the pipeline of SidecarInjector.
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+)
+
+// Keys of the ConfigMap.
+const (
+	FluentDConfigKey    = "fluent.conf"
+	FluentBitConfigKey  = "fluent-bit.conf"
+	FluentBitParsersKey = "parsers.conf"
+)
+
+const configMapNamePrefix = "fluentd-sidecar-injector-config-"
+
+// ConfigMapName returns the name of the ConfigMap which has the configuration of the SidecarInjector.
+func ConfigMapName(sidecarInjectorName string) string {
+	return configMapNamePrefix + sidecarInjectorName
+}
+
+// Keys returns keys of the ConfigMap which are read by the collector.
+func Keys(collector string) []string {
+	if collector == "fluent-bit" {
+		return []string{FluentBitConfigKey, FluentBitParsersKey}
+	}
+	return []string{FluentDConfigKey}
+}
+
+// Render returns the data of the ConfigMap, which has configuration files of fluentd and fluent-bit.
+func Render(spec *sidecarinjectorv1alpha1.PipelineSpec) (map[string]string, error) {
+	if err := validate(spec); err != nil {
+		return nil, err
+	}
+	fluentBitConfig, fluentBitParsers := renderFluentBit(spec)
+	return map[string]string{
+		FluentDConfigKey:    renderFluentD(spec),
+		FluentBitConfigKey:  fluentBitConfig,
+		FluentBitParsersKey: fluentBitParsers,
+	}, nil
+}
+
+// validate rejects unknown parsers, and line breaks which break configuration files.
+func validate(spec *sidecarinjectorv1alpha1.PipelineSpec) error {
+	if len(spec.Outputs) == 0 {
+		return fmt.Errorf("pipeline requires at least one output")
+	}
+	parsers := map[string]bool{}
+	for _, parser := range spec.Parsers {
+		if err := validateValues("parser "+parser.Name, parser.Parameters, parser.Name, parser.Format); err != nil {
+			return err
+		}
+		parsers[parser.Name] = true
+	}
+	for _, input := range spec.Inputs {
+		if input.Parser != "" && !parsers[input.Parser] {
+			return fmt.Errorf("parser %s of input %s is not defined", input.Parser, input.Type)
+		}
+	}
+	for _, plugins := range [][]sidecarinjectorv1alpha1.PipelinePlugin{spec.Inputs, spec.Filters, spec.Outputs} {
+		for _, plugin := range plugins {
+			if plugin.Type == "" {
+				return fmt.Errorf("type of plugins is required")
+			}
+			if err := validateValues("plugin "+plugin.Type, plugin.Parameters, plugin.Type, plugin.Tag, plugin.Match, plugin.Parser); err != nil {
+				return err
+			}
+			for _, section := range plugin.Sections {
+				if err := validateValues("section "+section.Name+" of plugin "+plugin.Type, section.Parameters, section.Name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func validateValues(name string, parameters map[string]string, values ...string) error {
+	for key, value := range parameters {
+		values = append(values, key, value)
+	}
+	for _, value := range values {
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("%s must not contain line breaks: %q", name, value)
+		}
+	}
+	return nil
+}
+
+func renderFluentD(spec *sidecarinjectorv1alpha1.PipelineSpec) string {
+	parsers := map[string]sidecarinjectorv1alpha1.PipelineParser{}
+	for _, parser := range spec.Parsers {
+		parsers[parser.Name] = parser
+	}
+
+	var b strings.Builder
+	for _, input := range spec.Inputs {
+		b.WriteString("<source>\n")
+		writeFluentDParameters(&b, "  ", input.Type, input.Parameters)
+		if input.Tag != "" {
+			fmt.Fprintf(&b, "  tag %s\n", input.Tag)
+		}
+		if parser, ok := parsers[input.Parser]; ok {
+			b.WriteString("  <parse>\n")
+			writeFluentDParameters(&b, "    ", parser.Format, parser.Parameters)
+			b.WriteString("  </parse>\n")
+		}
+		writeFluentDSections(&b, input.Sections)
+		b.WriteString("</source>\n\n")
+	}
+	for _, filter := range spec.Filters {
+		fmt.Fprintf(&b, "<filter %s>\n", fluentDMatch(filter.Match))
+		writeFluentDParameters(&b, "  ", filter.Type, filter.Parameters)
+		writeFluentDSections(&b, filter.Sections)
+		b.WriteString("</filter>\n\n")
+	}
+	for _, output := range spec.Outputs {
+		fmt.Fprintf(&b, "<match %s>\n", fluentDMatch(output.Match))
+		writeFluentDParameters(&b, "  ", output.Type, output.Parameters)
+		writeFluentDSections(&b, output.Sections)
+		b.WriteString("</match>\n\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func fluentDMatch(match string) string {
+	if match == "" {
+		return "**"
+	}
+	return match
+}
+
+func writeFluentDParameters(b *strings.Builder, indent, typ string, parameters map[string]string) {
+	if typ != "" {
+		fmt.Fprintf(b, "%s@type %s\n", indent, typ)
+	}
+	for _, key := range sortedKeys(parameters) {
+		fmt.Fprintf(b, "%s%s %s\n", indent, key, parameters[key])
+	}
+}
+
+func writeFluentDSections(b *strings.Builder, sections []sidecarinjectorv1alpha1.PipelineSection) {
+	for _, section := range sections {
+		fmt.Fprintf(b, "  <%s>\n", section.Name)
+		writeFluentDParameters(b, "    ", "", section.Parameters)
+		fmt.Fprintf(b, "  </%s>\n", section.Name)
+	}
+}
+
+func renderFluentBit(spec *sidecarinjectorv1alpha1.PipelineSpec) (string, string) {
+	var config strings.Builder
+	config.WriteString("[SERVICE]\n")
+	fmt.Fprintf(&config, "    Parsers_File %s\n\n", FluentBitParsersKey)
+	for _, input := range spec.Inputs {
+		parameters := map[string]string{}
+		if input.Tag != "" {
+			parameters["Tag"] = input.Tag
+		}
+		if input.Parser != "" {
+			parameters["Parser"] = input.Parser
+		}
+		writeFluentBitSection(&config, "INPUT", input.Type, parameters, input.Parameters)
+	}
+	for _, filter := range spec.Filters {
+		writeFluentBitSection(&config, "FILTER", filter.Type, map[string]string{"Match": fluentBitMatch(filter.Match)}, filter.Parameters)
+	}
+	for _, output := range spec.Outputs {
+		writeFluentBitSection(&config, "OUTPUT", output.Type, map[string]string{"Match": fluentBitMatch(output.Match)}, output.Parameters)
+	}
+
+	var parsers strings.Builder
+	for _, parser := range spec.Parsers {
+		writeFluentBitSection(&parsers, "PARSER", parser.Name, map[string]string{"Format": parser.Format}, parser.Parameters)
+	}
+	return strings.TrimSuffix(config.String(), "\n"), strings.TrimSuffix(parsers.String(), "\n")
+}
+
+func fluentBitMatch(match string) string {
+	if match == "" {
+		return "*"
+	}
+	return match
+}
+
+// writeFluentBitSection writes the section with the name, and fixed parameters are written before parameters of users.
+func writeFluentBitSection(b *strings.Builder, section, name string, fixed, parameters map[string]string) {
+	fmt.Fprintf(b, "[%s]\n", section)
+	fmt.Fprintf(b, "    Name %s\n", name)
+	for _, key := range sortedKeys(fixed) {
+		fmt.Fprintf(b, "    %s %s\n", key, fixed[key])
+	}
+	for _, key := range sortedKeys(parameters) {
+		fmt.Fprintf(b, "    %s %s\n", key, parameters[key])
+	}
+	b.WriteString("\n")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,105 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+)
+
+func newPipelineSpec() *sidecarinjectorv1alpha1.PipelineSpec {
+	return &sidecarinjectorv1alpha1.PipelineSpec{
+		Inputs: []sidecarinjectorv1alpha1.PipelinePlugin{
+			{
+				Type:   "tail",
+				Tag:    "app.nginx",
+				Parser: "nginx",
+				Parameters: map[string]string{
+					"path":     "/var/log/nginx/access.log",
+					"pos_file": "/var/log/nginx/access.log.pos",
+				},
+			},
+		},
+		Parsers: []sidecarinjectorv1alpha1.PipelineParser{
+			{
+				Name:   "nginx",
+				Format: "json",
+				Parameters: map[string]string{
+					"time_key": "time",
+				},
+			},
+		},
+		Filters: []sidecarinjectorv1alpha1.PipelinePlugin{
+			{
+				Type:  "grep",
+				Match: "app.**",
+				Parameters: map[string]string{
+					"exclude": "path /healthz",
+				},
+			},
+		},
+		Outputs: []sidecarinjectorv1alpha1.PipelinePlugin{
+			{
+				Type: "forward",
+				Parameters: map[string]string{
+					"send_timeout": "60s",
+				},
+				Sections: []sidecarinjectorv1alpha1.PipelineSection{
+					{
+						Name: "server",
+						Parameters: map[string]string{
+							"host": "\"#{ENV['AGGREGATOR_HOST']}\"",
+							"port": "24224",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestRender(t *testing.T) {
+	data, err := Render(newPipelineSpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{FluentDConfigKey, FluentBitConfigKey, FluentBitParsersKey} {
+		expected, err := os.ReadFile(filepath.Join("testdata", key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data[key] != string(expected) {
+			t.Errorf("%s is not matched:\n%s", key, data[key])
+		}
+	}
+}
+
+func TestRenderWithInvalidPipeline(t *testing.T) {
+	spec := newPipelineSpec()
+	spec.Inputs[0].Parser = "apache"
+	if _, err := Render(spec); err == nil {
+		t.Error("Undefined parser should be rejected")
+	}
+
+	spec = newPipelineSpec()
+	spec.Outputs[0].Parameters["host"] = "aggregator\n</match>"
+	if _, err := Render(spec); err == nil {
+		t.Error("Line breaks should be rejected")
+	}
+
+	spec = newPipelineSpec()
+	spec.Outputs = nil
+	if _, err := Render(spec); err == nil {
+		t.Error("Pipeline without outputs should be rejected")
+	}
+}
+
+func TestKeys(t *testing.T) {
+	if keys := Keys("fluent-bit"); len(keys) != 2 || keys[0] != FluentBitConfigKey {
+		t.Errorf("Keys of fluent-bit are not matched: %v", keys)
+	}
+	if keys := Keys("fluentd"); len(keys) != 1 || keys[0] != FluentDConfigKey {
+		t.Errorf("Keys of fluentd are not matched: %v", keys)
+	}
+}
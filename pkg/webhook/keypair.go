@@ -0,0 +1,94 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	klog "k8s.io/klog/v2"
+)
+
+// keyPairReloader serves a TLS key pair which is read from files, and reloads it when the files are changed.
+// Kubernetes updates files of a mounted secret when the secret is changed, so rotated certificates are used without restarting.
+type keyPairReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newKeyPairReloader(certFile, keyFile string) (*keyPairReloader, error) {
+	r := &keyPairReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload reads the files, and replaces the key pair if they are changed. It returns true when the key pair is replaced.
+func (r *keyPairReloader) reload() (bool, error) {
+	certPEM, err := os.ReadFile(r.certFile)
+	if err != nil {
+		return false, err
+	}
+	keyPEM, err := os.ReadFile(r.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	unchanged := bytes.Equal(certPEM, r.certPEM) && bytes.Equal(keyPEM, r.keyPEM)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	// The files may be read in the middle of update, in which case the key pair does not match and it is retried later.
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.certPEM = certPEM
+	r.keyPEM = keyPEM
+	return true, nil
+}
+
+// Watch reloads the key pair at the interval until stopCh is closed.
+func (r *keyPairReloader) Watch(interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			reloaded, err := r.reload()
+			if err != nil {
+				klog.Errorf("Failed to reload key pair: %v", err)
+				continue
+			}
+			if reloaded {
+				klog.Infof("Key pair is reloaded from %s and %s", r.certFile, r.keyFile)
+			}
+		}
+	}
+}
+
+// GetCertificate is used for tls.Config.
+func (r *keyPairReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
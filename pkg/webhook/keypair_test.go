@@ -0,0 +1,79 @@
+package webhook
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/h3poteto/fluentd-sidecar-injector/pkg/controller/sidecarinjector"
+)
+
+func writeKeyPair(t *testing.T, certFile, keyFile string) {
+	caKey, caCert, err := sidecarinjector.NewCA("my-injector", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, cert, err := sidecarinjector.NewServerCertificate("my-service", "my-namespace", caKey, caCert, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, cert, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, key, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyPairReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	writeKeyPair(t, certFile, keyFile)
+
+	reloader, err := newKeyPairReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := reloader.reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded {
+		t.Error("Key pair should not be reloaded when files are not changed")
+	}
+
+	writeKeyPair(t, certFile, keyFile)
+	reloaded, err = reloader.reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded {
+		t.Error("Key pair should be reloaded when files are changed")
+	}
+	second, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Leaf.SerialNumber.Cmp(first.Leaf.SerialNumber) == 0 {
+		t.Errorf("Certificate is not replaced: %s", second.Leaf.SerialNumber)
+	}
+
+	// A broken key pair is not used.
+	if err := os.WriteFile(keyFile, []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloader.reload(); err == nil {
+		t.Error("Broken key pair should not be loaded")
+	}
+	third, _ := reloader.GetCertificate(nil)
+	if third != second {
+		t.Error("Certificate should be kept when reloading is failed")
+	}
+}
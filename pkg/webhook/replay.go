@@ -0,0 +1,140 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/h3poteto/fluentd-sidecar-injector/pkg/webhook/sidecarinjector"
+)
+
+// ReplayResult is the result of an AdmissionReview which is replayed offline.
+// Operations of the patch are sorted, because the order of them is not stable.
+type ReplayResult struct {
+	Allowed  bool              `json:"allowed"`
+	Warnings []string          `json:"warnings,omitempty"`
+	Patch    []json.RawMessage `json:"patch,omitempty"`
+}
+
+// Replay sends a recorded AdmissionReview v1 or v1beta1 to the injector in the same way as the webhook server.
+func Replay(injector *sidecarinjector.Injector, body []byte) (*ReplayResult, error) {
+	review, err := parseAdmissionReview(body)
+	if err != nil {
+		return nil, err
+	}
+	response := injector.Validate(review)
+	result := &ReplayResult{
+		Allowed:  response.Response.Allowed,
+		Warnings: response.Response.Warnings,
+	}
+	if response.Response.Patch == nil {
+		return result, nil
+	}
+	if err := json.Unmarshal(response.Response.Patch, &result.Patch); err != nil {
+		return nil, err
+	}
+	for i := range result.Patch {
+		var compacted bytes.Buffer
+		if err := json.Compact(&compacted, result.Patch[i]); err != nil {
+			return nil, err
+		}
+		result.Patch[i] = compacted.Bytes()
+	}
+	sort.Slice(result.Patch, func(i, j int) bool {
+		return bytes.Compare(result.Patch[i], result.Patch[j]) < 0
+	})
+	return result, nil
+}
+
+// ReplayFile replays the AdmissionReview in reviewFile, and compares the result with goldenFile.
+// It returns the diff, which is empty if the result is matched. If update is true, the result is written to goldenFile.
+func ReplayFile(injector *sidecarinjector.Injector, reviewFile, goldenFile string, update bool) (string, error) {
+	body, err := os.ReadFile(reviewFile)
+	if err != nil {
+		return "", err
+	}
+	result, err := Replay(injector, body)
+	if err != nil {
+		return "", fmt.Errorf("failed to replay %s: %w", reviewFile, err)
+	}
+	actual, err := formatReplayResult(result)
+	if err != nil {
+		return "", err
+	}
+	if update {
+		return "", os.WriteFile(goldenFile, actual, 0644)
+	}
+	expected, err := os.ReadFile(goldenFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("golden file %s does not exist, please update it", goldenFile)
+	}
+	if err != nil {
+		return "", err
+	}
+	return diffLines(string(expected), string(actual)), nil
+}
+
+// formatReplayResult writes each operation of the patch in a line, so diffs of golden files are readable.
+func formatReplayResult(result *ReplayResult) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "{\n  \"allowed\": %t,\n", result.Allowed)
+	warnings, err := json.Marshal(result.Warnings)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(buf, "  \"warnings\": %s,\n  \"patch\": [", warnings)
+	for i, operation := range result.Patch {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		fmt.Fprintf(buf, "\n    %s", operation)
+	}
+	if len(result.Patch) > 0 {
+		buf.WriteString("\n  ")
+	}
+	buf.WriteString("]\n}\n")
+	return buf.Bytes(), nil
+}
+
+// diffLines returns a line based diff of the expected and the actual texts. It is empty if they are same.
+func diffLines(expected, actual string) string {
+	if expected == actual {
+		return ""
+	}
+	a := strings.Split(strings.TrimSuffix(expected, "\n"), "\n")
+	b := strings.Split(strings.TrimSuffix(actual, "\n"), "\n")
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var diff strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			fmt.Fprintf(&diff, "+ %s\n", b[j])
+			j++
+		default:
+			fmt.Fprintf(&diff, "- %s\n", a[i])
+			i++
+		}
+	}
+	return diff.String()
+}
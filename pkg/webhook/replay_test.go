@@ -0,0 +1,51 @@
+package webhook
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/h3poteto/fluentd-sidecar-injector/pkg/webhook/sidecarinjector"
+)
+
+// TestReplayGolden replays AdmissionReviews in testdata. Please run `fluentd-sidecar-injector replay --update` to update golden files.
+func TestReplayGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "admissionreviews", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed := 0
+	for _, file := range files {
+		if strings.HasSuffix(file, ".golden.json") {
+			continue
+		}
+		golden := strings.TrimSuffix(file, ".json") + ".golden.json"
+		diff, err := ReplayFile(sidecarinjector.NewInjector("", nil, nil, nil, nil), file, golden, false)
+		if err != nil {
+			t.Errorf("Failed to replay %s: %v", file, err)
+			continue
+		}
+		if diff != "" {
+			t.Errorf("Result of %s is not matched:\n%s", file, diff)
+		}
+		replayed++
+	}
+	if replayed == 0 {
+		t.Error("AdmissionReviews are not found in testdata")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	if _, err := Replay(sidecarinjector.NewInjector("", nil, nil, nil, nil), []byte(`{"apiVersion":"admission.k8s.io/v1","kind":"AdmissionReview"}`)); err == nil {
+		t.Error("AdmissionReview without request should be rejected")
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	if diff := diffLines("a\nb\nc\n", "a\nb\nc\n"); diff != "" {
+		t.Errorf("Diff of same texts is not matched: %s", diff)
+	}
+	if diff := diffLines("a\nb\nc\n", "a\nc\nd\n"); diff != "- b\n+ d\n" {
+		t.Errorf("Diff is not matched: %q", diff)
+	}
+}
@@ -2,8 +2,10 @@ package webhook
 
 import (
 	"bytes"
+	"crypto/tls"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/h3poteto/fluentd-sidecar-injector/pkg/webhook/sidecarinjector"
 	admissionv1 "k8s.io/api/admission/v1"
@@ -13,22 +15,35 @@ import (
 	klog "k8s.io/klog/v2"
 )
 
-func Server(port int32, tlsCertFile, tlsKeyFile string) error {
+// keyPairReloadInterval is the interval to check whether the certificate files are changed.
+const keyPairReloadInterval = 10 * time.Second
+
+func Server(port int32, tlsCertFile, tlsKeyFile string, injector *sidecarinjector.Injector, stopCh <-chan struct{}) error {
 	http.HandleFunc("/healthz", Healthz)
-	http.HandleFunc("/mutate", ValidateSidecarInjector)
+	http.HandleFunc("/mutate", ValidateSidecarInjector(injector))
 
 	listen := fmt.Sprintf(":%d", port)
 	ssl := tlsCertFile != "" && tlsKeyFile != ""
 
 	klog.Infof("Listening on %s, SSL is %t", listen, ssl)
 
-	var err error
 	if !ssl {
-		err = http.ListenAndServe(listen, nil)
-	} else {
-		err = http.ListenAndServeTLS(listen, tlsCertFile, tlsKeyFile, nil)
+		return http.ListenAndServe(listen, nil)
+	}
+
+	reloader, err := newKeyPairReloader(tlsCertFile, tlsKeyFile)
+	if err != nil {
+		return err
+	}
+	go reloader.Watch(keyPairReloadInterval, stopCh)
+	server := &http.Server{
+		Addr: listen,
+		TLSConfig: &tls.Config{
+			GetCertificate: reloader.GetCertificate,
+		},
 	}
-	return err
+	// The key pair is provided by TLSConfig.
+	return server.ListenAndServeTLS("", "")
 }
 
 func Healthz(w http.ResponseWriter, r *http.Request) {
@@ -36,28 +51,30 @@ func Healthz(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func ValidateSidecarInjector(w http.ResponseWriter, r *http.Request) {
-	klog.Infof("validate-sidecarinjector")
-	in, err := parseRequest(*r)
-	if err != nil {
-		klog.Error(err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	response := sidecarinjector.Validate(in)
-	out, err := response.ToJSON()
-	if err != nil {
-		klog.Error(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	_, err = w.Write(out)
-	if err != nil {
-		klog.Error(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+func ValidateSidecarInjector(injector *sidecarinjector.Injector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		klog.Infof("validate-sidecarinjector")
+		in, err := parseRequest(*r)
+		if err != nil {
+			klog.Error(err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		response := injector.Validate(in)
+		out, err := response.ToJSON()
+		if err != nil {
+			klog.Error(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, err = w.Write(out)
+		if err != nil {
+			klog.Error(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 	}
 }
 
@@ -103,6 +120,9 @@ func parseAdmissionReview(body []byte) (*sidecarinjector.AdmissionReviewRequest,
 
 	switch ar := review.(type) {
 	case *admissionv1beta1.AdmissionReview:
+		if ar.Request == nil {
+			return nil, fmt.Errorf("empty request")
+		}
 		return &sidecarinjector.AdmissionReviewRequest{
 			TypeMeta: ar.TypeMeta,
 			Request: &sidecarinjector.AdmissionRequest{
@@ -116,6 +136,9 @@ func parseAdmissionReview(body []byte) (*sidecarinjector.AdmissionReviewRequest,
 			},
 		}, nil
 	case *admissionv1.AdmissionReview:
+		if ar.Request == nil {
+			return nil, fmt.Errorf("empty request")
+		}
 		return &sidecarinjector.AdmissionReviewRequest{
 			TypeMeta: ar.TypeMeta,
 			Request: &sidecarinjector.AdmissionRequest{
@@ -0,0 +1,192 @@
+package sidecarinjector
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// aggregatorServers are servers of the forward output in the order of preference for the pod.
+type aggregatorServers struct {
+	servers []sidecarinjectorv1alpha1.AggregatorServer
+	// zone of the pod. It is empty if the zone is not known until the pod is scheduled.
+	zone string
+}
+
+// resolveAggregators returns aggregators from the aggregators annotation, or aggregators of the spec.
+// It returns nil if the pod uses a single aggregator host, so the aggregator-host annotation wins over aggregators of the spec.
+func resolveAggregators(pod *corev1.Pod, specServers []sidecarinjectorv1alpha1.AggregatorServer, annotations podAnnotations, defaultPort string) (*aggregatorServers, error) {
+	var servers []sidecarinjectorv1alpha1.AggregatorServer
+	if value, ok := annotations.value("aggregators"); ok {
+		// The configuration of config-volume only reads the most preferred aggregator from environment variables.
+		if _, ok := annotations.value("config-volume"); ok {
+			return nil, fmt.Errorf("aggregators can not be used with config-volume")
+		}
+		if err := json.Unmarshal([]byte(value), &servers); err != nil {
+			return nil, fmt.Errorf("aggregators must be a JSON list of servers: %w", err)
+		}
+		if len(servers) == 0 {
+			return nil, fmt.Errorf("aggregators must have at least one server")
+		}
+	} else if _, ok := annotations.value("aggregator-host"); ok {
+		return nil, nil
+	} else {
+		servers = append(servers, specServers...)
+	}
+	if len(servers) == 0 {
+		return nil, nil
+	}
+
+	port, err := parsePort(defaultPort)
+	if err != nil {
+		port = 24224
+	}
+	active := false
+	for i := range servers {
+		server := &servers[i]
+		if server.Host == "" || strings.ContainsAny(server.Host, " \"'\r\n") {
+			return nil, fmt.Errorf("aggregator %d must have a valid host, %q is not matched", i, server.Host)
+		}
+		if server.Port == 0 {
+			server.Port = port
+		}
+		if server.Port < 0 || server.Port > 65535 {
+			return nil, fmt.Errorf("port of aggregator %d must be a port number", i)
+		}
+		if server.Weight < 0 {
+			return nil, fmt.Errorf("weight of aggregator %d must be a positive integer", i)
+		}
+		if errs := validation.IsValidLabelValue(server.Zone); len(errs) > 0 {
+			return nil, fmt.Errorf("zone of aggregator %d is invalid: %s", i, strings.Join(errs, ", "))
+		}
+		active = active || !server.Standby
+	}
+	if !active {
+		return nil, fmt.Errorf("aggregators must have at least one active server")
+	}
+
+	resolved := &aggregatorServers{servers: servers, zone: podZone(pod, annotations)}
+	// Aggregators in the zone of the pod come first, and standby aggregators come last.
+	sort.SliceStable(resolved.servers, func(i, j int) bool {
+		return resolved.rank(i) < resolved.rank(j)
+	})
+	return resolved, nil
+}
+
+func (a *aggregatorServers) rank(i int) int {
+	server := a.servers[i]
+	switch {
+	case a.standby(i):
+		return 2
+	case a.zone != "" && server.Zone == a.zone:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// standbyZones returns zones of pods for which the aggregator is standby, because their zones have active aggregators.
+func (a *aggregatorServers) standbyZones(i int) []string {
+	server := a.servers[i]
+	if server.Standby || server.Zone == "" {
+		return nil
+	}
+	zones := map[string]bool{}
+	for _, s := range a.servers {
+		if !s.Standby && s.Zone != "" && s.Zone != server.Zone {
+			zones[s.Zone] = true
+		}
+	}
+	var result []string
+	for zone := range zones {
+		result = append(result, zone)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// standby returns whether the aggregator is standby for the pod. It only returns explicit standby if the zone of the pod is not known.
+func (a *aggregatorServers) standby(i int) bool {
+	if a.servers[i].Standby {
+		return true
+	}
+	if a.zone == "" {
+		return false
+	}
+	for _, zone := range a.standbyZones(i) {
+		if zone == a.zone {
+			return true
+		}
+	}
+	return false
+}
+
+// fluentBitWarning rejects standby aggregators, because Upstream of fluent-bit only balances logs between nodes and can not fail over.
+// It returns a warning if logs are balanced between zones, because the zone of the pod is not known.
+func (a *aggregatorServers) fluentBitWarning() (string, error) {
+	zones := false
+	for i, server := range a.servers {
+		if server.Standby {
+			return "", fmt.Errorf("standby of aggregator %d is not supported by fluent-bit", i)
+		}
+		zones = zones || server.Zone != ""
+	}
+	if a.zone == "" && zones {
+		return "The zone of the pod is not known, so fluent-bit balances logs between aggregators in all zones", nil
+	}
+	return "", nil
+}
+
+// env returns environment variables of the most preferred aggregator, and the zone of the pod.
+// The zone is read from the label of the pod with the downward API if it is not known, which is set by the scheduler with PodTopologyLabelsAdmission.
+func (a *aggregatorServers) env() []corev1.EnvVar {
+	zone := corev1.EnvVar{Name: "AGGREGATOR_ZONE", Value: a.zone}
+	if a.zone == "" {
+		zone.ValueFrom = &corev1.EnvVarSource{
+			FieldRef: &corev1.ObjectFieldSelector{
+				FieldPath: fmt.Sprintf("metadata.labels['%s']", corev1.LabelTopologyZone),
+			},
+		}
+	}
+	return []corev1.EnvVar{
+		{Name: "AGGREGATOR_HOST", Value: a.servers[0].Host},
+		{Name: "AGGREGATOR_PORT", Value: strconv.Itoa(int(a.servers[0].Port))},
+		zone,
+	}
+}
+
+// podZone returns the zone of the pod from the topology-zone annotation, the node selector or the required node affinity.
+// It returns an empty string if the pod can be scheduled to multiple zones.
+func podZone(pod *corev1.Pod, annotations podAnnotations) string {
+	if value, ok := annotations.value("topology-zone"); ok {
+		return value
+	}
+	if zone, ok := pod.Spec.NodeSelector[corev1.LabelTopologyZone]; ok {
+		return zone
+	}
+	affinity := pod.Spec.Affinity
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return ""
+	}
+	// Terms are ORed, so all of them must require the same zone.
+	zone := ""
+	for _, term := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		termZone := ""
+		for _, expression := range term.MatchExpressions {
+			if expression.Key == corev1.LabelTopologyZone && expression.Operator == corev1.NodeSelectorOpIn && len(expression.Values) == 1 {
+				termZone = expression.Values[0]
+			}
+		}
+		if termZone == "" || (zone != "" && zone != termZone) {
+			return ""
+		}
+		zone = termZone
+	}
+	return zone
+}
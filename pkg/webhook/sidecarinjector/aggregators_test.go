@@ -0,0 +1,226 @@
+package sidecarinjector
+
+import (
+	"strings"
+	"testing"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var testAggregators = []sidecarinjectorv1alpha1.AggregatorServer{
+	{Host: "aggregator-a.local", Zone: "zone-a"},
+	{Host: "aggregator-b.local", Port: 24225, Weight: 30, Zone: "zone-b"},
+	{Host: "aggregator-backup.local", Standby: true},
+	{Host: "aggregator-c.local", Zone: "zone-c"},
+}
+
+func TestResolveAggregators(t *testing.T) {
+	pod := &corev1.Pod{}
+	resolved, err := resolveAggregators(pod, testAggregators, podAnnotations{"topology-zone": "zone-b"}, "24224")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hosts []string
+	for i, server := range resolved.servers {
+		hosts = append(hosts, server.Host)
+		if server.Port == 0 {
+			t.Errorf("Port of %s should be defaulted", server.Host)
+		}
+		if standby := resolved.standby(i); standby != (server.Host != "aggregator-b.local") {
+			t.Errorf("Standby of %s is not matched: %v", server.Host, standby)
+		}
+	}
+	expected := "aggregator-b.local,aggregator-a.local,aggregator-backup.local,aggregator-c.local"
+	if strings.Join(hosts, ",") != expected {
+		t.Errorf("Order of aggregators is not matched: %v", hosts)
+	}
+	if testAggregators[0].Port != 0 {
+		t.Error("Aggregators of the spec should not be modified")
+	}
+
+	resolved, err = resolveAggregators(pod, testAggregators, podAnnotations{}, "24224")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.zone != "" || resolved.servers[3].Host != "aggregator-backup.local" {
+		t.Errorf("Only explicit standby should be the last without the zone: %#v", resolved)
+	}
+	if zones := resolved.standbyZones(0); strings.Join(zones, ",") != "zone-b,zone-c" {
+		t.Errorf("Standby zones are not matched: %v", zones)
+	}
+
+	resolved, err = resolveAggregators(pod, testAggregators, podAnnotations{"aggregator-host": "my-aggregator.local"}, "24224")
+	if err != nil || resolved != nil {
+		t.Errorf("aggregator-host should win over aggregators of the spec: %#v, %v", resolved, err)
+	}
+	resolved, err = resolveAggregators(pod, nil, podAnnotations{"aggregator-host": "my-aggregator.local", "aggregators": `[{"host": "aggregator.local"}]`}, "24224")
+	if err != nil || resolved == nil || resolved.servers[0].Port != 24224 {
+		t.Errorf("aggregators annotation should be used: %#v, %v", resolved, err)
+	}
+
+	for _, value := range []string{
+		`{"host": "aggregator.local"}`,
+		`[]`,
+		`[{"port": 24224}]`,
+		`[{"host": "aggregator.local\n"}]`,
+		`[{"host": "aggregator.local", "port": 70000}]`,
+		`[{"host": "aggregator.local", "weight": -1}]`,
+		`[{"host": "aggregator.local", "zone": "zone a"}]`,
+		`[{"host": "aggregator.local", "standby": true}]`,
+	} {
+		if _, err := resolveAggregators(pod, nil, podAnnotations{"aggregators": value}, "24224"); err == nil {
+			t.Errorf("%s should be invalid", value)
+		}
+	}
+	if _, err := resolveAggregators(pod, nil, podAnnotations{"aggregators": `[{"host": "aggregator.local"}]`, "config-volume": "my-config"}, "24224"); err == nil {
+		t.Error("aggregators annotation should be rejected with config-volume")
+	}
+}
+
+func TestPodZone(t *testing.T) {
+	required := func(zones ...string) *corev1.Affinity {
+		affinity := &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{}}}
+		for _, zone := range zones {
+			affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms = append(affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms, corev1.NodeSelectorTerm{
+				MatchExpressions: []corev1.NodeSelectorRequirement{
+					{Key: corev1.LabelTopologyZone, Operator: corev1.NodeSelectorOpIn, Values: []string{zone}},
+				},
+			})
+		}
+		return affinity
+	}
+	cases := []struct {
+		title       string
+		spec        corev1.PodSpec
+		annotations podAnnotations
+		expected    string
+	}{
+		{"annotation", corev1.PodSpec{NodeSelector: map[string]string{corev1.LabelTopologyZone: "zone-b"}}, podAnnotations{"topology-zone": "zone-a"}, "zone-a"},
+		{"node selector", corev1.PodSpec{NodeSelector: map[string]string{corev1.LabelTopologyZone: "zone-b"}}, podAnnotations{}, "zone-b"},
+		{"node affinity", corev1.PodSpec{Affinity: required("zone-c", "zone-c")}, podAnnotations{}, "zone-c"},
+		{"node affinity of multiple zones", corev1.PodSpec{Affinity: required("zone-a", "zone-c")}, podAnnotations{}, ""},
+		{"no topology", corev1.PodSpec{}, podAnnotations{}, ""},
+	}
+	for _, c := range cases {
+		if zone := podZone(&corev1.Pod{Spec: c.spec}, c.annotations); zone != c.expected {
+			t.Errorf("Zone of %s is not matched: %s", c.title, zone)
+		}
+	}
+}
+
+func TestInjectFluentDWithAggregators(t *testing.T) {
+	pod := newTestPod(map[string]string{
+		annotationPrefix + "/log-sources": `[{"path": "/var/log/nginx/access.log"}]`,
+	})
+	delete(pod.Annotations, annotationPrefix+"/aggregator-host")
+	defaults := &sidecarinjectorv1alpha1.SidecarInjectorPolicySpec{
+		FluentD: &sidecarinjectorv1alpha1.FluentDSpec{Aggregators: testAggregators},
+	}
+
+	if _, err := sidecarInjectMutator(pod, defaults, false); err != nil {
+		t.Fatal(err)
+	}
+	sidecar := findSidecar(pod)
+	if env := findEnv(sidecar.Env, "AGGREGATOR_HOST"); env == nil || env.Value != "aggregator-a.local" {
+		t.Errorf("AGGREGATOR_HOST is not matched: %#v", env)
+	}
+	if env := findEnv(sidecar.Env, "AGGREGATOR_ZONE"); env == nil || env.ValueFrom == nil || env.ValueFrom.FieldRef.FieldPath != "metadata.labels['topology.kubernetes.io/zone']" {
+		t.Errorf("AGGREGATOR_ZONE should be read from the label: %#v", env)
+	}
+	config := pod.Annotations[annotationPrefix+"/sources-config"]
+	for _, expected := range []string{
+		"    name aggregator0\n    host aggregator-a.local\n    port 24224\n    standby \"#{%w(zone-b zone-c).include?(ENV['AGGREGATOR_ZONE'])}\"\n",
+		"    host aggregator-b.local\n    port 24225\n    weight 30\n",
+		"    host aggregator-backup.local\n    port 24224\n    standby true\n",
+	} {
+		if !strings.Contains(config, expected) {
+			t.Errorf("Config does not contain %q:\n%s", expected, config)
+		}
+	}
+	if strings.Contains(config, "ENV['AGGREGATOR_HOST']") {
+		t.Errorf("Config should not use AGGREGATOR_HOST:\n%s", config)
+	}
+}
+
+func TestInjectFluentBitWithAggregators(t *testing.T) {
+	pod := newTestPod(map[string]string{
+		annotationPrefix + "/collector":   "fluent-bit",
+		annotationPrefix + "/log-sources": `[{"path": "/var/log/nginx/access.log"}]`,
+		annotationPrefix + "/aggregators": `[{"host": "aggregator-a.local", "zone": "zone-a"}, {"host": "aggregator-b.local", "zone": "zone-b"}]`,
+		annotationPrefix + "/tls":         "true",
+	})
+	pod.Spec.NodeSelector = map[string]string{corev1.LabelTopologyZone: "zone-b"}
+
+	if _, err := sidecarInjectMutator(pod, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	sidecar := findSidecar(pod)
+	for name, expected := range map[string]string{"AGGREGATOR_HOST": "aggregator-b.local", "AGGREGATOR_PORT": "24224", "AGGREGATOR_ZONE": "zone-b"} {
+		if env := findEnv(sidecar.Env, name); env == nil || env.Value != expected {
+			t.Errorf("%s is not matched: %#v", name, env)
+		}
+	}
+	volume := findVolume(pod.Spec.Volumes, SourcesVolumeName)
+	if volume == nil || len(volume.DownwardAPI.Items) != 3 || volume.DownwardAPI.Items[2].Path != fluentBitUpstreamKey {
+		t.Fatalf("Sources volume is not matched: %#v", volume)
+	}
+	if config := pod.Annotations[annotationPrefix+"/sources-config"]; !strings.Contains(config, "    Upstream /fluent-bit/etc/upstream.conf\n") || strings.Contains(config, "tls On") {
+		t.Errorf("Output should use the upstream:\n%s", config)
+	}
+	upstream := pod.Annotations[annotationPrefix+"/sources-upstream"]
+	expected := "[UPSTREAM]\n    Name aggregators\n\n[NODE]\n    Name aggregator0\n    Host aggregator-b.local\n    Port 24224\n    tls On\n    tls.verify On\n"
+	if upstream != expected {
+		t.Errorf("Upstream is not matched:\n%s", upstream)
+	}
+
+	removeInjection(pod)
+	if _, ok := pod.Annotations[annotationPrefix+"/sources-upstream"]; ok {
+		t.Error("Failed to remove the upstream")
+	}
+}
+
+func TestInjectWithAggregatorsWithoutLogSources(t *testing.T) {
+	value := `[{"host": "aggregator-a.local"}, {"host": "aggregator-backup.local", "standby": true}]`
+	pod := newTestPod(map[string]string{
+		annotationPrefix + "/aggregators": value,
+	})
+	if _, err := sidecarInjectMutator(pod, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	// The image only forwards logs to AGGREGATOR_HOST, so the configuration is rendered without log-sources.
+	config := pod.Annotations[annotationPrefix+"/sources-config"]
+	for _, expected := range []string{
+		"  path /var/log/nginx/*.log\n",
+		"    host aggregator-a.local\n",
+		"    host aggregator-backup.local\n    port 24224\n    standby true\n",
+	} {
+		if !strings.Contains(config, expected) {
+			t.Errorf("Config does not contain %q:\n%s", expected, config)
+		}
+	}
+
+	pod = newTestPod(map[string]string{
+		annotationPrefix + "/collector":   "fluent-bit",
+		annotationPrefix + "/aggregators": value,
+	})
+	if _, err := sidecarInjectMutator(pod, nil, false); err == nil {
+		t.Error("Standby aggregators should be rejected for fluent-bit")
+	}
+
+	pod = newTestPod(map[string]string{
+		annotationPrefix + "/collector":   "fluent-bit",
+		annotationPrefix + "/aggregators": `[{"host": "aggregator-a.local", "zone": "zone-a"}, {"host": "aggregator-b.local", "zone": "zone-b"}]`,
+	})
+	result, err := sidecarInjectMutator(pod, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "all zones") {
+		t.Errorf("Warnings are not matched: %v", result.Warnings)
+	}
+	upstream := pod.Annotations[annotationPrefix+"/sources-upstream"]
+	if !strings.Contains(upstream, "    Host aggregator-a.local\n") || !strings.Contains(upstream, "    Host aggregator-b.local\n") {
+		t.Errorf("Upstream is not matched:\n%s", upstream)
+	}
+}
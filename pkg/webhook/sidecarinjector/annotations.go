@@ -0,0 +1,246 @@
+package sidecarinjector
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// annotationType is the type of an annotation value.
+type annotationType int
+
+const (
+	stringAnnotation annotationType = iota
+	boolAnnotation
+	portAnnotation
+	quantityAnnotation
+	// integerAnnotation is a non-negative integer.
+	integerAnnotation
+	// durationAnnotation is a time value of fluentd configuration, e.g. 60s.
+	durationAnnotation
+	pathAnnotation
+)
+
+// annotationSpec describes a pod annotation under annotationPrefix.
+type annotationSpec struct {
+	typ annotationType
+	// enum is the allowed values. Any value of the type is allowed if it is empty.
+	enum []string
+}
+
+var fluentdDurationPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?[smhd]?$`)
+
+func (s annotationSpec) validate(value string) error {
+	if len(s.enum) > 0 && !slices.Contains(s.enum, value) {
+		return fmt.Errorf("must be one of %s", strings.Join(s.enum, ", "))
+	}
+	switch s.typ {
+	case boolAnnotation:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("must be true or false")
+		}
+	case portAnnotation:
+		if _, err := parsePort(value); err != nil {
+			return err
+		}
+	case quantityAnnotation:
+		if _, err := resource.ParseQuantity(value); err != nil {
+			return fmt.Errorf("must be a quantity, e.g. 100m or 200Mi")
+		}
+	case integerAnnotation:
+		if v, err := strconv.ParseInt(value, 10, 64); err != nil || v < 0 {
+			return fmt.Errorf("must be a non-negative integer")
+		}
+	case durationAnnotation:
+		if !fluentdDurationPattern.MatchString(value) {
+			return fmt.Errorf("must be a duration, e.g. 60s")
+		}
+	case pathAnnotation:
+		if !path.IsAbs(value) {
+			return fmt.Errorf("must be an absolute path")
+		}
+	}
+	return nil
+}
+
+func parsePort(value string) (int32, error) {
+	port, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, fmt.Errorf("must be a port number")
+	}
+	return int32(port), nil
+}
+
+// commonAnnotations are read regardless of the collector.
+var commonAnnotations = map[string]annotationSpec{
+	"injection":             {typ: stringAnnotation, enum: []string{"enabled", "disabled"}},
+	"injector":              {typ: stringAnnotation},
+	"collector":             {typ: stringAnnotation, enum: []string{"fluentd", "fluent-bit", "otel-collector"}},
+	"docker-image":          {typ: stringAnnotation},
+	"application-log-dir":   {typ: pathAnnotation},
+	"tag-prefix":            {typ: stringAnnotation},
+	"custom-env":            {typ: stringAnnotation},
+	"expose-port":           {typ: portAnnotation},
+	"config-volume":         {typ: stringAnnotation},
+	"memory-request":        {typ: quantityAnnotation},
+	"memory-limit":          {typ: quantityAnnotation},
+	"cpu-request":           {typ: quantityAnnotation},
+	"cpu-limit":             {typ: quantityAnnotation},
+	"native-sidecar":        {typ: boolAnnotation},
+	"startup-probe-port":    {typ: portAnnotation},
+	"shutdown-delay":        {typ: integerAnnotation},
+	"shutdown-flush-period": {typ: integerAnnotation},
+	"shutdown-handshake":    {typ: stringAnnotation, enum: []string{"enabled", "disabled"}},
+	"log-sources":           {typ: stringAnnotation},
+	"log-containers":        {typ: stringAnnotation},
+	"buffer-size":           {typ: quantityAnnotation},
+	"buffer-medium":         {typ: stringAnnotation, enum: []string{"Default", "Memory"}},
+	"buffer-storage-class":  {typ: stringAnnotation},
+	"topology-zone":         {typ: stringAnnotation},
+	// They are set by the webhook server.
+	"status":           {typ: stringAnnotation},
+	"config-hash":      {typ: stringAnnotation},
+	"sources-config":   {typ: stringAnnotation},
+	"sources-parsers":  {typ: stringAnnotation},
+	"sources-upstream": {typ: stringAnnotation},
+}
+
+// forwardAnnotations are read by collectors which forward logs to aggregators. Direct outputs ignore them.
+var forwardAnnotations = map[string]annotationSpec{
+	"aggregator-host":    {typ: stringAnnotation},
+	"aggregator-port":    {typ: portAnnotation},
+	"aggregators":        {typ: stringAnnotation},
+	"tls":                {typ: boolAnnotation},
+	"tls-verify":         {typ: boolAnnotation},
+	"ca-secret":          {typ: stringAnnotation},
+	"client-cert-secret": {typ: stringAnnotation},
+	"shared-key-secret":  {typ: stringAnnotation},
+	"user-secret":        {typ: stringAnnotation},
+}
+
+// annotationSchemas are annotations which each collector reads in addition to commonAnnotations.
+var annotationSchemas = map[string]map[string]annotationSpec{
+	"fluentd": withForwardAnnotations(map[string]annotationSpec{
+		"send-timeout": {typ: durationAnnotation},
+		"recover-wait": {typ: durationAnnotation},
+		"hard-timeout": {typ: durationAnnotation},
+		"log-format":   {typ: stringAnnotation},
+		"time-key":     {typ: stringAnnotation},
+		"time-format":  {typ: stringAnnotation},
+	}),
+	"fluent-bit": withForwardAnnotations(map[string]annotationSpec{
+		"refresh-interval": {typ: integerAnnotation},
+		"rotate-wait":      {typ: integerAnnotation},
+	}),
+	"otel-collector": {
+		"otlp-endpoint": {typ: stringAnnotation},
+		"otlp-protocol": {typ: stringAnnotation, enum: []string{"grpc", "http"}},
+		"otlp-insecure": {typ: boolAnnotation},
+	},
+}
+
+// withForwardAnnotations adds forwardAnnotations to the schema of a collector.
+func withForwardAnnotations(schema map[string]annotationSpec) map[string]annotationSpec {
+	maps.Copy(schema, forwardAnnotations)
+	return schema
+}
+
+// podAnnotations are annotations of a pod which are valid for the collector. Keys do not have annotationPrefix.
+type podAnnotations map[string]string
+
+// parseAnnotations validates annotations of the pod with the schema of the collector.
+// It returns problems of unknown keys and malformed values, and malformed values are not contained in podAnnotations.
+func parseAnnotations(pod *corev1.Pod, collector string) (podAnnotations, []string) {
+	keys := make([]string, 0, len(pod.Annotations))
+	for key := range pod.Annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	annotations := podAnnotations{}
+	problems := []string{}
+	for _, key := range keys {
+		name, ok := strings.CutPrefix(key, annotationPrefix+"/")
+		if !ok {
+			continue
+		}
+		value := pod.Annotations[key]
+		spec, ok := commonAnnotations[name]
+		if !ok {
+			spec, ok = annotationSchemas[collector][name]
+		}
+		if !ok {
+			if otherCollector(collector, name) {
+				problems = append(problems, fmt.Sprintf("annotation %s is not used by %s", key, collector))
+			} else {
+				problems = append(problems, fmt.Sprintf("unknown annotation %s", key))
+			}
+			continue
+		}
+		if err := spec.validate(value); err != nil {
+			problems = append(problems, fmt.Sprintf("annotation %s is ignored: %q %v", key, value, err))
+			continue
+		}
+		annotations[name] = value
+	}
+	return annotations, problems
+}
+
+// otherCollector returns whether the annotation is read by another collector.
+func otherCollector(collector, name string) bool {
+	for c, schema := range annotationSchemas {
+		if _, ok := schema[name]; ok && c != collector {
+			return true
+		}
+	}
+	return false
+}
+
+func (a podAnnotations) value(name string) (string, bool) {
+	value, ok := a[name]
+	return value, ok
+}
+
+func (a podAnnotations) port(name string) (int32, bool) {
+	value, ok := a[name]
+	if !ok {
+		return 0, false
+	}
+	port, err := parsePort(value)
+	return port, err == nil
+}
+
+func (a podAnnotations) quantity(name string) (resource.Quantity, bool) {
+	value, ok := a[name]
+	if !ok {
+		return resource.Quantity{}, false
+	}
+	quantity, err := resource.ParseQuantity(value)
+	return quantity, err == nil
+}
+
+func (a podAnnotations) boolean(name string) (bool, bool) {
+	value, ok := a[name]
+	if !ok {
+		return false, false
+	}
+	b, err := strconv.ParseBool(value)
+	return b, err == nil
+}
+
+func (a podAnnotations) integer(name string) (int64, bool) {
+	value, ok := a[name]
+	if !ok {
+		return 0, false
+	}
+	i, err := strconv.ParseInt(value, 10, 64)
+	return i, err == nil
+}
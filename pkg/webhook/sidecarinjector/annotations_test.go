@@ -0,0 +1,123 @@
+package sidecarinjector
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestParseAnnotations(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				annotationPrefix + "/aggregator-host":  "my-aggregator.local",
+				annotationPrefix + "/aggregator-port":  "70000",
+				annotationPrefix + "/cpu-limit":        "1",
+				annotationPrefix + "/memory-request":   "lots",
+				annotationPrefix + "/send-timeout":     "30s",
+				annotationPrefix + "/refresh-interval": "30",
+				annotationPrefix + "/agregator-host":   "my-aggregator.local",
+				"example.com/other":                    "value",
+			},
+		},
+	}
+
+	annotations, problems := parseAnnotations(pod, "fluentd")
+	if value, ok := annotations.value("aggregator-host"); !ok || value != "my-aggregator.local" {
+		t.Errorf("aggregator-host is not matched: %s", value)
+	}
+	if value, ok := annotations.value("send-timeout"); !ok || value != "30s" {
+		t.Errorf("send-timeout is not matched: %s", value)
+	}
+	if quantity, ok := annotations.quantity("cpu-limit"); !ok || !quantity.Equal(resource.MustParse("1")) {
+		t.Errorf("cpu-limit is not matched: %v", quantity)
+	}
+	if _, ok := annotations.port("aggregator-port"); ok {
+		t.Error("Malformed aggregator-port should be ignored")
+	}
+	if _, ok := annotations.quantity("memory-request"); ok {
+		t.Error("Malformed memory-request should be ignored")
+	}
+	if _, ok := annotations.value("refresh-interval"); ok {
+		t.Error("refresh-interval should not be used by fluentd")
+	}
+
+	expected := []string{
+		"annotation " + annotationPrefix + "/aggregator-port is ignored: \"70000\" must be a port number",
+		"unknown annotation " + annotationPrefix + "/agregator-host",
+		"annotation " + annotationPrefix + "/memory-request is ignored: \"lots\" must be a quantity, e.g. 100m or 200Mi",
+		"annotation " + annotationPrefix + "/refresh-interval is not used by fluentd",
+	}
+	if strings.Join(problems, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Problems are not matched: %#v", problems)
+	}
+
+	annotations, problems = parseAnnotations(pod, "fluent-bit")
+	if value, ok := annotations.value("refresh-interval"); !ok || value != "30" {
+		t.Errorf("refresh-interval is not matched: %s", value)
+	}
+	if !slices.Contains(problems, "annotation "+annotationPrefix+"/send-timeout is not used by fluent-bit") {
+		t.Errorf("send-timeout should be reported for fluent-bit: %#v", problems)
+	}
+
+	annotations, problems = parseAnnotations(pod, "otel-collector")
+	if _, ok := annotations.value("aggregator-host"); ok {
+		t.Error("aggregator-host should not be used by otel-collector")
+	}
+	if !slices.Contains(problems, "annotation "+annotationPrefix+"/aggregator-host is not used by otel-collector") {
+		t.Errorf("aggregator-host should be reported for otel-collector: %#v", problems)
+	}
+}
+
+func TestInjectFluentDWithInvalidAnnotations(t *testing.T) {
+	pod := newTestPod(map[string]string{
+		annotationPrefix + "/expose-port":    "http",
+		annotationPrefix + "/memory-request": "512Mi",
+		annotationPrefix + "/tagprefix":      "my-app",
+	})
+
+	result, err := sidecarInjectMutator(pod, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Warnings) != 2 {
+		t.Errorf("Warnings are not matched: %#v", result.Warnings)
+	}
+	container := findContainer(pod.Spec.Containers, ContainerName)
+	if container == nil {
+		t.Fatalf("Failed to inject sidecar container: %#v", pod.Spec.Containers)
+	}
+	if len(container.Ports) != 0 {
+		t.Errorf("Malformed expose-port should be ignored: %#v", container.Ports)
+	}
+	if memory := container.Resources.Requests[corev1.ResourceMemory]; !memory.Equal(resource.MustParse("512Mi")) {
+		t.Errorf("Memory request is not matched: %v", memory.String())
+	}
+}
+
+func TestInjectWithStrictAnnotations(t *testing.T) {
+	pod := newTestPod(map[string]string{
+		annotationPrefix + "/tagprefix": "my-app",
+	})
+	defaults := &sidecarinjectorv1alpha1.SidecarInjectorPolicySpec{StrictAnnotations: ptr.To(true)}
+	if _, err := sidecarInjectMutator(pod, defaults, false); err == nil {
+		t.Error("Unknown annotation should be rejected in strict mode")
+	}
+
+	pod = newTestPod(map[string]string{
+		annotationPrefix + "/tag-prefix": "my-app",
+	})
+	result, err := sidecarInjectMutator(pod, defaults, false)
+	if err != nil {
+		t.Error(err)
+	}
+	if result.Mutated == nil || len(result.Warnings) != 0 {
+		t.Errorf("Valid annotations should be injected in strict mode: %#v", result)
+	}
+}
@@ -0,0 +1,93 @@
+package sidecarinjector
+
+import (
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// BufferVolumeName is a volume where the collector spools chunks, so they survive restarts of the sidecar and outages of the aggregator.
+const BufferVolumeName = "fluentd-sidecar-injector-buffer"
+
+// sidecarBuffer is the buffer of the collector. limit is zero if the size is not specified.
+type sidecarBuffer struct {
+	path  string
+	limit int64
+}
+
+// configureBuffer attaches the buffer volume to the sidecar if buffer annotations are specified.
+// The volume is an emptyDir, or a generic ephemeral volume if the storage class is specified.
+// A buffer on memory is counted in the memory of the sidecar, so it must fit in the memory limit.
+func configureBuffer(pod *corev1.Pod, sidecar *corev1.Container, annotations podAnnotations, collector string) (*sidecarBuffer, error) {
+	size, hasSize := annotations.quantity("buffer-size")
+	medium, hasMedium := annotations.value("buffer-medium")
+	storageClass, hasStorageClass := annotations.value("buffer-storage-class")
+	if !hasSize && !hasMedium && !hasStorageClass {
+		return nil, nil
+	}
+
+	volume := corev1.Volume{Name: BufferVolumeName}
+	if hasStorageClass {
+		if !hasSize {
+			return nil, fmt.Errorf("buffer-size is required for buffer-storage-class")
+		}
+		if hasMedium {
+			return nil, fmt.Errorf("buffer-medium can not be used with buffer-storage-class")
+		}
+		volume.Ephemeral = &corev1.EphemeralVolumeSource{
+			VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+					StorageClassName: &storageClass,
+					Resources: corev1.VolumeResourceRequirements{
+						Requests: corev1.ResourceList{
+							corev1.ResourceStorage: size,
+						},
+					},
+				},
+			},
+		}
+	} else {
+		volume.EmptyDir = &corev1.EmptyDirVolumeSource{}
+		if medium == string(corev1.StorageMediumMemory) {
+			limit, ok := sidecar.Resources.Limits[corev1.ResourceMemory]
+			if !hasSize || !ok {
+				return nil, fmt.Errorf("buffer-size and memory-limit are required for buffer-medium Memory")
+			}
+			if size.Cmp(limit) >= 0 {
+				return nil, fmt.Errorf("buffer-size %s must be less than memory-limit %s for buffer-medium Memory", size.String(), limit.String())
+			}
+			volume.EmptyDir.Medium = corev1.StorageMediumMemory
+		}
+		if hasSize {
+			volume.EmptyDir.SizeLimit = &size
+		}
+	}
+
+	buffer := &sidecarBuffer{path: "/fluentd/buffer"}
+	switch collector {
+	case "fluent-bit":
+		buffer.path = "/fluent-bit/buffer"
+	case "otel-collector":
+		buffer.path = "/otelcol/buffer"
+	}
+	pod.Spec.Volumes = append(pod.Spec.Volumes, volume)
+	sidecar.VolumeMounts = append(sidecar.VolumeMounts, corev1.VolumeMount{
+		Name:      BufferVolumeName,
+		MountPath: buffer.path,
+	})
+	sidecar.Env = append(sidecar.Env, corev1.EnvVar{
+		Name:  "BUFFER_PATH",
+		Value: buffer.path,
+	})
+	if hasSize {
+		// Leave room for metadata of chunks, because the sidecar is evicted when the volume exceeds the size. The value is bytes.
+		buffer.limit = size.Value() / 10 * 9
+		sidecar.Env = append(sidecar.Env, corev1.EnvVar{
+			Name:  "BUFFER_LIMIT_SIZE",
+			Value: strconv.FormatInt(buffer.limit, 10),
+		})
+	}
+	return buffer, nil
+}
@@ -0,0 +1,123 @@
+package sidecarinjector
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestInjectWithBuffer(t *testing.T) {
+	pod := newTestPod(map[string]string{
+		annotationPrefix + "/buffer-size":   "1Gi",
+		annotationPrefix + "/buffer-medium": "Default",
+	})
+
+	if _, err := sidecarInjectMutator(pod, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	volume := findVolume(pod.Spec.Volumes, BufferVolumeName)
+	if volume == nil || volume.EmptyDir == nil || volume.EmptyDir.Medium != corev1.StorageMediumDefault || !volume.EmptyDir.SizeLimit.Equal(resource.MustParse("1Gi")) {
+		t.Fatalf("Buffer volume is not matched: %#v", volume)
+	}
+	sidecar := findSidecar(pod)
+	if mount := findMount(sidecar.VolumeMounts, BufferVolumeName); mount == nil || mount.MountPath != "/fluentd/buffer" {
+		t.Errorf("Buffer mount is not matched: %#v", mount)
+	}
+	if env := findEnv(sidecar.Env, "BUFFER_PATH"); env == nil || env.Value != "/fluentd/buffer" {
+		t.Errorf("BUFFER_PATH is not matched: %#v", env)
+	}
+	if env := findEnv(sidecar.Env, "BUFFER_LIMIT_SIZE"); env == nil || env.Value != "966367638" {
+		t.Errorf("BUFFER_LIMIT_SIZE is not matched: %#v", env)
+	}
+	// The image does not use the buffer, so the configuration is rendered without log-sources.
+	config := pod.Annotations[annotationPrefix+"/sources-config"]
+	for _, expected := range []string{
+		"  path /var/log/nginx/*.log\n",
+		"  <buffer>\n    @type file\n    path /fluentd/buffer/forward\n    total_limit_size 966367638\n",
+	} {
+		if !strings.Contains(config, expected) {
+			t.Errorf("Config does not contain %q:\n%s", expected, config)
+		}
+	}
+
+	removeInjection(pod)
+	if findVolume(pod.Spec.Volumes, BufferVolumeName) != nil {
+		t.Error("Failed to remove the buffer volume")
+	}
+}
+
+func TestInjectWithBufferStorageClass(t *testing.T) {
+	pod := newTestPod(map[string]string{
+		annotationPrefix + "/collector":            "fluent-bit",
+		annotationPrefix + "/buffer-size":          "10Gi",
+		annotationPrefix + "/buffer-storage-class": "standard",
+	})
+
+	if _, err := sidecarInjectMutator(pod, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	volume := findVolume(pod.Spec.Volumes, BufferVolumeName)
+	if volume == nil || volume.Ephemeral == nil {
+		t.Fatalf("Buffer volume is not matched: %#v", volume)
+	}
+	spec := volume.Ephemeral.VolumeClaimTemplate.Spec
+	if *spec.StorageClassName != "standard" || !spec.Resources.Requests.Storage().Equal(resource.MustParse("10Gi")) {
+		t.Errorf("Volume claim template is not matched: %#v", spec)
+	}
+	if mount := findMount(findSidecar(pod).VolumeMounts, BufferVolumeName); mount == nil || mount.MountPath != "/fluent-bit/buffer" {
+		t.Errorf("Buffer mount is not matched: %#v", mount)
+	}
+	if config := pod.Annotations[annotationPrefix+"/sources-config"]; !strings.Contains(config, "    storage.path /fluent-bit/buffer\n") {
+		t.Errorf("Config does not spool chunks to the buffer:\n%s", config)
+	}
+}
+
+func TestInjectWithInvalidBuffer(t *testing.T) {
+	cases := []struct {
+		title       string
+		annotations map[string]string
+	}{
+		{"storage class without size", map[string]string{annotationPrefix + "/buffer-storage-class": "standard"}},
+		{"storage class with medium", map[string]string{annotationPrefix + "/buffer-storage-class": "standard", annotationPrefix + "/buffer-size": "1Gi", annotationPrefix + "/buffer-medium": "Memory"}},
+		{"memory without size", map[string]string{annotationPrefix + "/buffer-medium": "Memory"}},
+		{"memory over the limit", map[string]string{annotationPrefix + "/buffer-medium": "Memory", annotationPrefix + "/buffer-size": "1Gi", annotationPrefix + "/memory-limit": "512Mi"}},
+		{"memory over the limit of fluent-bit", map[string]string{annotationPrefix + "/collector": "fluent-bit", annotationPrefix + "/buffer-medium": "Memory", annotationPrefix + "/buffer-size": "800Mi", annotationPrefix + "/memory-limit": "512Mi"}},
+	}
+	for _, c := range cases {
+		if _, err := sidecarInjectMutator(newTestPod(c.annotations), nil, false); err == nil {
+			t.Errorf("Buffer with %s should be rejected", c.title)
+		}
+	}
+
+	pod := newTestPod(map[string]string{
+		annotationPrefix + "/buffer-medium": "Memory",
+		annotationPrefix + "/buffer-size":   "256Mi",
+		annotationPrefix + "/memory-limit":  "512Mi",
+	})
+	if _, err := sidecarInjectMutator(pod, nil, false); err != nil {
+		t.Errorf("Buffer on memory within the limit should be injected: %v", err)
+	}
+}
+
+func TestRenderSourcesWithBuffer(t *testing.T) {
+	sources := []LogSource{{Path: "/var/log/app/app.log", Parser: ParserJSON, Tag: "app"}}
+	buffer := &sidecarBuffer{path: "/fluentd/buffer", limit: 1024}
+
+	config := renderFluentDSources(sources, sourcesOutput{buffer: buffer})["fluent.conf"]
+	if !strings.Contains(config, "  <buffer>\n    @type file\n    path /fluentd/buffer/forward\n    total_limit_size 1024\n    retry_forever true\n  </buffer>\n</match>\n") {
+		t.Errorf("Buffer of fluentd is not matched:\n%s", config)
+	}
+
+	buffer.path = "/fluent-bit/buffer"
+	config = renderFluentBitSources(sources, sourcesOutput{buffer: buffer})["fluent-bit.conf"]
+	for _, expected := range []string{"    storage.path /fluent-bit/buffer\n", "    storage.type filesystem\n", "    storage.total_limit_size 1024\n"} {
+		if !strings.Contains(config, expected) {
+			t.Errorf("Config does not contain %q:\n%s", expected, config)
+		}
+	}
+	if config := renderFluentBitSources(sources, sourcesOutput{})["fluent-bit.conf"]; strings.Contains(config, "storage.") {
+		t.Errorf("Storage should not be configured without the buffer:\n%s", config)
+	}
+}
@@ -0,0 +1,168 @@
+package sidecarinjector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// StatusInjected is a value of the status annotation which is set to injected pods.
+	StatusInjected = "injected"
+)
+
+var (
+	statusAnnotation     = annotationPrefix + "/status"
+	configHashAnnotation = annotationPrefix + "/config-hash"
+)
+
+// previousInjection detects the sidecar which was injected before, e.g. by reinvocation of the webhook or a manifest exported from a running pod.
+// It returns the config hash of the previous injection, and it is empty when the pod does not have the hash.
+func previousInjection(pod *corev1.Pod) (string, bool) {
+	if pod.Annotations[statusAnnotation] == StatusInjected {
+		return pod.Annotations[configHashAnnotation], true
+	}
+	if findSidecar(pod) != nil {
+		return "", true
+	}
+	for i := range pod.Spec.Volumes {
+		if pod.Spec.Volumes[i].Name == VolumeName {
+			return "", true
+		}
+	}
+	return "", false
+}
+
+// removeInjection removes the sidecar and related settings from the pod, so the sidecar can be re-rendered in place.
+// terminationGracePeriodSeconds is kept, because the original value is unknown.
+func removeInjection(pod *corev1.Pod) {
+	pod.Spec.InitContainers = removeContainer(pod.Spec.InitContainers, ContainerName)
+	pod.Spec.Containers = removeContainer(pod.Spec.Containers, ContainerName)
+	for i := range pod.Spec.InitContainers {
+		container := &pod.Spec.InitContainers[i]
+		container.VolumeMounts = removeLogMounts(container.VolumeMounts)
+	}
+	for i := range pod.Spec.Containers {
+		container := &pod.Spec.Containers[i]
+		container.VolumeMounts = removeLogMounts(container.VolumeMounts)
+		env := container.Env[:0]
+		for _, e := range container.Env {
+			if e.Name != ShutdownFileEnv {
+				env = append(env, e)
+			}
+		}
+		container.Env = env
+	}
+	volumes := pod.Spec.Volumes[:0]
+	for _, volume := range pod.Spec.Volumes {
+		if !injectedLogVolume(volume.Name) && volume.Name != ConfigVolumeName && volume.Name != SourcesVolumeName && volume.Name != BufferVolumeName && volume.Name != CAVolumeName && volume.Name != ClientCertVolumeName {
+			volumes = append(volumes, volume)
+		}
+	}
+	pod.Spec.Volumes = volumes
+	delete(pod.Annotations, statusAnnotation)
+	delete(pod.Annotations, configHashAnnotation)
+	for _, annotation := range sourcesAnnotations {
+		delete(pod.Annotations, annotation)
+	}
+}
+
+func removeLogMounts(volumeMounts []corev1.VolumeMount) []corev1.VolumeMount {
+	mounts := volumeMounts[:0]
+	for _, mount := range volumeMounts {
+		if !injectedLogVolume(mount.Name) {
+			mounts = append(mounts, mount)
+		}
+	}
+	return mounts
+}
+
+// injectedLogVolume returns whether the volume is the log volume, or a volume of a log source directory.
+func injectedLogVolume(name string) bool {
+	if name == VolumeName {
+		return true
+	}
+	index, ok := strings.CutPrefix(name, VolumeName+"-")
+	if !ok {
+		return false
+	}
+	_, err := strconv.Atoi(index)
+	return err == nil
+}
+
+func removeContainer(containers []corev1.Container, name string) []corev1.Container {
+	result := containers[:0]
+	for _, container := range containers {
+		if container.Name != name {
+			result = append(result, container)
+		}
+	}
+	return result
+}
+
+// injectionHash returns a hash of the injected sidecar and volumes of the sidecar, which changes when the configuration is changed.
+// Names of containers are also included, because the log volume is mounted to containers which are added by other webhooks.
+// The configuration of log sources and log containers is in annotations, so it is also included.
+func injectionHash(pod *corev1.Pod) (string, error) {
+	var volume, buffer *corev1.Volume
+	var secrets []corev1.Volume
+	for i := range pod.Spec.Volumes {
+		switch pod.Spec.Volumes[i].Name {
+		case VolumeName:
+			volume = &pod.Spec.Volumes[i]
+		case BufferVolumeName:
+			buffer = &pod.Spec.Volumes[i]
+		case CAVolumeName, ClientCertVolumeName:
+			secrets = append(secrets, pod.Spec.Volumes[i])
+		}
+	}
+	var containers []string
+	for _, container := range pod.Spec.Containers {
+		containers = append(containers, container.Name)
+	}
+	data, err := json.Marshal(struct {
+		Sidecar       *corev1.Container `json:"sidecar"`
+		Volume        *corev1.Volume    `json:"volume"`
+		Containers    []string          `json:"containers"`
+		Sources       []string          `json:"sources,omitempty"`
+		LogContainers string            `json:"logContainers,omitempty"`
+		Buffer        *corev1.Volume    `json:"buffer,omitempty"`
+		Secrets       []corev1.Volume   `json:"secrets,omitempty"`
+	}{
+		Sidecar:       findSidecar(pod),
+		Volume:        volume,
+		Containers:    containers,
+		Sources:       sourcesConfig(pod),
+		LogContainers: pod.Annotations[annotationPrefix+"/log-containers"],
+		Buffer:        buffer,
+		Secrets:       secrets,
+	})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func sourcesConfig(pod *corev1.Pod) []string {
+	var config []string
+	for _, annotation := range []string{annotationPrefix + "/sources-config", annotationPrefix + "/sources-parsers", annotationPrefix + "/sources-upstream"} {
+		if value, ok := pod.Annotations[annotation]; ok {
+			config = append(config, value)
+		}
+	}
+	return config
+}
+
+// setInjectionStatus marks the pod as injected with the config hash.
+func setInjectionStatus(pod *corev1.Pod, hash string) {
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[statusAnnotation] = StatusInjected
+	pod.Annotations[configHashAnnotation] = hash
+}
@@ -0,0 +1,152 @@
+package sidecarinjector
+
+import (
+	"encoding/json"
+	"testing"
+
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// admit sends the pod to the injector, and returns the patched pod.
+func admit(t *testing.T, injector *Injector, pod *corev1.Pod) (*corev1.Pod, *AdmissionResponse) {
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	review := injector.Validate(&AdmissionReviewRequest{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "AdmissionReview",
+			APIVersion: "admission.k8s.io/v1",
+		},
+		Request: &AdmissionRequest{
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Namespace: "default",
+			Operation: "CREATE",
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	})
+	if !review.Response.Allowed {
+		t.Fatalf("Pod is not allowed: %v", review.Response.Warnings)
+	}
+	if review.Response.Patch == nil {
+		return pod, review.Response
+	}
+	patch, err := jsonpatch.DecodePatch(review.Response.Patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patched, err := patch.Apply(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := &corev1.Pod{}
+	if err := json.Unmarshal(patched, result); err != nil {
+		t.Fatal(err)
+	}
+	return result, review.Response
+}
+
+func countSidecars(pod *corev1.Pod) int {
+	count := 0
+	for _, container := range append(pod.Spec.Containers, pod.Spec.InitContainers...) {
+		if container.Name == ContainerName {
+			count++
+		}
+	}
+	return count
+}
+
+func TestReinjection(t *testing.T) {
+	injector := NewInjector("", nil, nil, nil, nil)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "web",
+			Annotations: map[string]string{
+				annotationPrefix + "/injection":           "enabled",
+				annotationPrefix + "/aggregator-host":     "my-aggregator.local",
+				annotationPrefix + "/application-log-dir": "/var/log/nginx",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "nginx",
+					Image: "nginx:latest",
+				},
+			},
+		},
+	}
+
+	injected, _ := admit(t, injector, pod)
+	if injected.Annotations[statusAnnotation] != StatusInjected {
+		t.Errorf("Status annotation is not matched: %s", injected.Annotations[statusAnnotation])
+	}
+	hash := injected.Annotations[configHashAnnotation]
+	if hash == "" {
+		t.Error("Config hash is not set")
+	}
+
+	// Reinvocation does not change the pod.
+	reinvoked, response := admit(t, injector, injected)
+	if response.Patch != nil {
+		t.Errorf("Pod should not be patched: %s", string(response.Patch))
+	}
+	if count := countSidecars(reinvoked); count != 1 {
+		t.Errorf("Sidecar is duplicated: %d", count)
+	}
+
+	// The sidecar is re-rendered in place when the configuration is changed, e.g. by another webhook.
+	injected.Annotations[annotationPrefix+"/aggregator-host"] = "another-aggregator.local"
+	injected.Spec.Containers = append(injected.Spec.Containers, corev1.Container{
+		Name:  "proxy",
+		Image: "envoy:latest",
+	})
+	rerendered, _ := admit(t, injector, injected)
+	if count := countSidecars(rerendered); count != 1 {
+		t.Errorf("Sidecar is duplicated: %d", count)
+	}
+	if len(rerendered.Spec.Volumes) != 1 {
+		t.Errorf("Volume is duplicated: %#v", rerendered.Spec.Volumes)
+	}
+	if rerendered.Annotations[configHashAnnotation] == hash {
+		t.Errorf("Config hash is not updated: %s", hash)
+	}
+	sidecar := findContainer(rerendered.Spec.Containers, ContainerName)
+	if aggregatorHost := findEnv(sidecar.Env, "AGGREGATOR_HOST"); aggregatorHost.Value != "another-aggregator.local" {
+		t.Errorf("Container env aggregator host is not matched: %v", aggregatorHost)
+	}
+	for _, container := range rerendered.Spec.Containers {
+		mounts := 0
+		for _, mount := range container.VolumeMounts {
+			if mount.Name == VolumeName {
+				mounts++
+			}
+		}
+		if mounts != 1 {
+			t.Errorf("Log volume is mounted %d times to %s", mounts, container.Name)
+		}
+	}
+}
+
+func TestReinjectionWithoutStatus(t *testing.T) {
+	// A manifest which is exported from a running pod may not have the status annotation.
+	pod := newTestPod(map[string]string{})
+	if _, err := sidecarInjectMutator(pod, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	hash, ok := previousInjection(pod)
+	if !ok || hash != "" {
+		t.Errorf("Previous injection is not detected: %s %v", hash, ok)
+	}
+
+	injected, _ := admit(t, NewInjector("", nil, nil, nil, nil), pod)
+	if count := countSidecars(injected); count != 1 {
+		t.Errorf("Sidecar is duplicated: %d", count)
+	}
+	if injected.Annotations[statusAnnotation] != StatusInjected {
+		t.Errorf("Status annotation is not matched: %s", injected.Annotations[statusAnnotation])
+	}
+}
@@ -0,0 +1,132 @@
+package sidecarinjector
+
+import (
+	"sync/atomic"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	listers "github.com/h3poteto/fluentd-sidecar-injector/pkg/client/listers/sidecarinjectorcontroller/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/validation"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	klog "k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+)
+
+var (
+	// injectorAnnotation specifies the SidecarInjector which injects the sidecar to the pod.
+	injectorAnnotation = annotationPrefix + "/injector"
+	// injectorLabel is set to injected pods with the name of the SidecarInjector.
+	injectorLabel = annotationPrefix + "/injector"
+)
+
+// Injector injects sidecar containers to pods with the defaults of SidecarInjector and SidecarInjectorPolicy.
+type Injector struct {
+	// name is the name of the SidecarInjector which owns this webhook server. It is empty if the configuration is read from environment variables.
+	name            string
+	policyLister    listers.SidecarInjectorPolicyLister
+	namespaceLister corelisters.NamespaceLister
+	// spec is the spec of the SidecarInjector which owns this webhook server.
+	// It is swapped as a whole when the SidecarInjector is changed, so a request always reads a consistent spec.
+	spec atomic.Pointer[sidecarinjectorv1alpha1.SidecarInjectorSpec]
+	// workloadResolver resolves the workload which owns a pod. It can be nil.
+	workloadResolver WorkloadResolver
+	// configMapLister lists ConfigMaps of the pipeline. It can be nil.
+	configMapLister corelisters.ConfigMapLister
+}
+
+// +kubebuilder:rbac:groups=operator.h3poteto.dev,resources=sidecarinjectors;sidecarinjectorpolicies,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+// NewInjector returns a new Injector for the SidecarInjector. If policyLister is nil, SidecarInjectorPolicy is not used.
+// If namespaceLister is nil, labels of namespaces are not used.
+// If workloadResolver is nil, the direct controller of the pod is used as the workload.
+// If configMapLister is nil, the ConfigMap of the pipeline is mounted without checking that it exists.
+func NewInjector(name string, policyLister listers.SidecarInjectorPolicyLister, namespaceLister corelisters.NamespaceLister, workloadResolver WorkloadResolver, configMapLister corelisters.ConfigMapLister) *Injector {
+	return &Injector{
+		name:             name,
+		policyLister:     policyLister,
+		namespaceLister:  namespaceLister,
+		workloadResolver: workloadResolver,
+		configMapLister:  configMapLister,
+	}
+}
+
+// SidecarInjectorSpec returns the current spec of the owner SidecarInjector. It returns nil if the owner is unknown.
+func (i *Injector) SidecarInjectorSpec() *sidecarinjectorv1alpha1.SidecarInjectorSpec {
+	return i.spec.Load()
+}
+
+// SetSidecarInjectorSpec replaces the spec of the owner SidecarInjector.
+func (i *Injector) SetSidecarInjectorSpec(spec *sidecarinjectorv1alpha1.SidecarInjectorSpec) {
+	i.spec.Store(spec)
+}
+
+// SidecarInjectorEventHandler returns an event handler which keeps the spec up to date with the owner SidecarInjector.
+// The informer should watch only the owner SidecarInjector.
+func (i *Injector) SidecarInjectorEventHandler(name string) cache.ResourceEventHandler {
+	return cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			sidecarInjector, ok := obj.(*sidecarinjectorv1alpha1.SidecarInjector)
+			return ok && sidecarInjector.Name == name
+		},
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				i.updateSidecarInjector(obj.(*sidecarinjectorv1alpha1.SidecarInjector))
+			},
+			UpdateFunc: func(old, new interface{}) {
+				i.updateSidecarInjector(new.(*sidecarinjectorv1alpha1.SidecarInjector))
+			},
+			DeleteFunc: func(obj interface{}) {
+				klog.Infof("SidecarInjector %s is deleted", name)
+				i.SetSidecarInjectorSpec(nil)
+			},
+		},
+	}
+}
+
+func (i *Injector) updateSidecarInjector(sidecarInjector *sidecarinjectorv1alpha1.SidecarInjector) {
+	if current := i.SidecarInjectorSpec(); current != nil && equality.Semantic.DeepEqual(current, &sidecarInjector.Spec) {
+		return
+	}
+	klog.Infof("SidecarInjector %s is updated, reloading configuration", sidecarInjector.Name)
+	spec := sidecarInjector.Spec.DeepCopy()
+	i.SetSidecarInjectorSpec(spec)
+}
+
+// handles returns whether this injector handles the pod. Pods which specify another SidecarInjector in the injector annotation are skipped,
+// and pods without the annotation are only handled by the default SidecarInjector.
+func (i *Injector) handles(pod *corev1.Pod) bool {
+	if i.name == "" {
+		return true
+	}
+	name, ok := pod.Annotations[injectorAnnotation]
+	if !ok {
+		spec := i.SidecarInjectorSpec()
+		return spec != nil && ptr.Deref(spec.Default, false)
+	}
+	return name == i.name
+}
+
+// claim records the SidecarInjector to the pod, so other SidecarInjectors do not inject sidecars to it.
+// The pod is also labeled, so the controller can count injected pods. The label is skipped if the name is not a valid label value.
+func (i *Injector) claim(pod *corev1.Pod) {
+	if i.name == "" {
+		return
+	}
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[injectorAnnotation] = i.name
+	if len(validation.IsValidLabelValue(i.name)) > 0 {
+		return
+	}
+	if pod.Labels == nil {
+		pod.Labels = map[string]string{}
+	}
+	pod.Labels[injectorLabel] = i.name
+}
@@ -0,0 +1,142 @@
+package sidecarinjector
+
+import (
+	"strings"
+	"testing"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestSidecarInjectorEventHandler(t *testing.T) {
+	injector := NewInjector("", nil, nil, nil, nil)
+	handler := injector.SidecarInjectorEventHandler("my-injector")
+
+	owner := &sidecarinjectorv1alpha1.SidecarInjector{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "my-injector",
+		},
+		Spec: sidecarinjectorv1alpha1.SidecarInjectorSpec{
+			Collector: "fluentd",
+			FluentD: &sidecarinjectorv1alpha1.FluentDSpec{
+				AggregatorHost: "my-aggregator.local",
+			},
+		},
+	}
+	handler.OnAdd(owner, true)
+	if spec := injector.SidecarInjectorSpec(); spec == nil || spec.FluentD.AggregatorHost != "my-aggregator.local" {
+		t.Errorf("Spec is not loaded: %#v", spec)
+	}
+
+	other := &sidecarinjectorv1alpha1.SidecarInjector{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "other-injector",
+		},
+		Spec: sidecarinjectorv1alpha1.SidecarInjectorSpec{
+			Collector: "fluent-bit",
+		},
+	}
+	handler.OnAdd(other, true)
+	if spec := injector.SidecarInjectorSpec(); spec.Collector != "fluentd" {
+		t.Errorf("Spec of other SidecarInjector is loaded: %#v", spec)
+	}
+
+	updated := owner.DeepCopy()
+	updated.Spec.FluentD.AggregatorHost = "new-aggregator.local"
+	handler.OnUpdate(owner, updated)
+	if spec := injector.SidecarInjectorSpec(); spec.FluentD.AggregatorHost != "new-aggregator.local" {
+		t.Errorf("Spec is not reloaded: %#v", spec)
+	}
+	// The loaded spec must not share memory with the informer cache.
+	updated.Spec.FluentD.AggregatorHost = "modified.local"
+	if spec := injector.SidecarInjectorSpec(); spec.FluentD.AggregatorHost != "new-aggregator.local" {
+		t.Errorf("Spec is modified from outside: %#v", spec)
+	}
+
+	handler.OnDelete(updated)
+	if spec := injector.SidecarInjectorSpec(); spec != nil {
+		t.Errorf("Spec is not cleared: %#v", spec)
+	}
+}
+
+func TestResolveDefaults(t *testing.T) {
+	spec := &sidecarinjectorv1alpha1.SidecarInjectorSpec{
+		Collector: "fluentd",
+		FluentD: &sidecarinjectorv1alpha1.FluentDSpec{
+			AggregatorHost: "cluster-aggregator.local",
+			TagPrefix:      "cluster",
+		},
+	}
+	policy := &sidecarinjectorv1alpha1.SidecarInjectorPolicySpec{
+		FluentD: &sidecarinjectorv1alpha1.FluentDSpec{
+			TagPrefix: "team-a",
+		},
+	}
+
+	defaults := resolveDefaults(spec, policy)
+	if defaults.Collector != "fluentd" {
+		t.Errorf("Collector is not matched: %s", defaults.Collector)
+	}
+	if defaults.FluentD.AggregatorHost != "cluster-aggregator.local" {
+		t.Errorf("Aggregator host is not matched: %s", defaults.FluentD.AggregatorHost)
+	}
+	if defaults.FluentD.TagPrefix != "team-a" {
+		t.Errorf("Tag prefix is not matched: %s", defaults.FluentD.TagPrefix)
+	}
+	if spec.FluentD.TagPrefix != "cluster" {
+		t.Errorf("SidecarInjector spec is modified: %s", spec.FluentD.TagPrefix)
+	}
+}
+
+func TestMultipleInjectors(t *testing.T) {
+	fluentd := NewInjector("fluentd-fleet", nil, nil, nil, nil)
+	fluentd.SetSidecarInjectorSpec(&sidecarinjectorv1alpha1.SidecarInjectorSpec{})
+	fluentBit := NewInjector("fluent-bit-fleet", nil, nil, nil, nil)
+	fluentBit.SetSidecarInjectorSpec(&sidecarinjectorv1alpha1.SidecarInjectorSpec{Default: ptr.To(true)})
+
+	// Only the default injector claims pods without the injector annotation.
+	pod := newTestPod(map[string]string{})
+	_, response := admit(t, fluentd, pod)
+	if response.Patch != nil {
+		t.Errorf("Pod without the injector annotation should not be patched by a non-default injector: %s", string(response.Patch))
+	}
+	injected, _ := admit(t, fluentBit, pod)
+	if injected.Annotations[injectorAnnotation] != "fluent-bit-fleet" {
+		t.Errorf("Injector annotation is not matched: %s", injected.Annotations[injectorAnnotation])
+	}
+	if injected.Labels[injectorLabel] != "fluent-bit-fleet" {
+		t.Errorf("Injector label is not matched: %s", injected.Labels[injectorLabel])
+	}
+	_, response = admit(t, fluentd, injected)
+	if response.Patch != nil {
+		t.Errorf("Pod which is claimed by another injector should not be patched: %s", string(response.Patch))
+	}
+
+	// Pods can specify the injector.
+	pod = newTestPod(map[string]string{
+		annotationPrefix + "/injector": "fluentd-fleet",
+	})
+	_, response = admit(t, fluentBit, pod)
+	if response.Patch != nil {
+		t.Errorf("Pod which specifies another injector should not be patched: %s", string(response.Patch))
+	}
+	injected, _ = admit(t, fluentd, pod)
+	if countSidecars(injected) != 1 {
+		t.Errorf("Sidecar is not injected: %#v", injected.Spec.Containers)
+	}
+}
+
+func TestClaimWithLongName(t *testing.T) {
+	// Names of SidecarInjectors can be longer than label values.
+	name := strings.Repeat("a", 64)
+	pod := &corev1.Pod{}
+	NewInjector(name, nil, nil, nil, nil).claim(pod)
+	if pod.Annotations[injectorAnnotation] != name {
+		t.Errorf("Injector annotation is not matched: %s", pod.Annotations[injectorAnnotation])
+	}
+	if _, ok := pod.Labels[injectorLabel]; ok {
+		t.Errorf("Injector label should not be set: %s", pod.Labels[injectorLabel])
+	}
+}
@@ -0,0 +1,80 @@
+package sidecarinjector
+
+import (
+	"time"
+
+	"github.com/h3poteto/fluentd-sidecar-injector/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Outcomes of admission requests.
+const (
+	OutcomeInjected = "injected"
+	OutcomeSkipped  = "skipped"
+	OutcomeRejected = "rejected"
+	OutcomeError    = "error"
+)
+
+// Reasons of skipped injections.
+const (
+	skipReasonOperation       = "operation"
+	skipReasonAnotherInjector = "another_injector"
+	skipReasonDisabled        = "injection_disabled"
+	skipReasonAlreadyInjected = "already_injected"
+)
+
+var (
+	admissionRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "webhook",
+		Name:      "admission_requests_total",
+		Help:      "Number of admission requests by outcome, which is injected, skipped, rejected or error.",
+	}, []string{"collector", "namespace", "outcome"})
+	mutationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "webhook",
+		Name:      "mutation_duration_seconds",
+		Help:      "Latency of admission requests in seconds.",
+		Buckets:   []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+	}, []string{"collector", "namespace"})
+	skippedInjections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "webhook",
+		Name:      "skipped_injections_total",
+		Help:      "Number of admission requests which are allowed without injection by reason.",
+	}, []string{"collector", "namespace", "reason"})
+)
+
+func init() {
+	prometheus.MustRegister(admissionRequests, mutationDuration, skippedInjections)
+}
+
+// admissionRecord is the result of an admission request, which is recorded to metrics when the request is finished.
+type admissionRecord struct {
+	start     time.Time
+	namespace string
+	collector string
+	outcome   string
+	reason    string
+}
+
+func newAdmissionRecord(namespace string) *admissionRecord {
+	return &admissionRecord{
+		start:     time.Now(),
+		namespace: namespace,
+		outcome:   OutcomeError,
+	}
+}
+
+func (r *admissionRecord) skip(reason string) {
+	r.outcome = OutcomeSkipped
+	r.reason = reason
+}
+
+func (r *admissionRecord) observe() {
+	admissionRequests.WithLabelValues(r.collector, r.namespace, r.outcome).Inc()
+	mutationDuration.WithLabelValues(r.collector, r.namespace).Observe(time.Since(r.start).Seconds())
+	if r.outcome == OutcomeSkipped {
+		skippedInjections.WithLabelValues(r.collector, r.namespace, r.reason).Inc()
+	}
+}
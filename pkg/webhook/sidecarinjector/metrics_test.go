@@ -0,0 +1,38 @@
+package sidecarinjector
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAdmissionMetrics(t *testing.T) {
+	injector := NewInjector("", nil, nil, nil, nil)
+	injected := admissionRequests.WithLabelValues("fluentd", "default", OutcomeInjected)
+	skipped := skippedInjections.WithLabelValues("fluentd", "default", skipReasonAlreadyInjected)
+	disabled := skippedInjections.WithLabelValues("", "default", skipReasonDisabled)
+	before := []float64{testutil.ToFloat64(injected), testutil.ToFloat64(skipped), testutil.ToFloat64(disabled)}
+
+	pod, _ := admit(t, injector, newTestPod(map[string]string{}))
+	admit(t, injector, pod)
+	admit(t, injector, &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "without-injection",
+		},
+	})
+
+	if value := testutil.ToFloat64(injected); value != before[0]+1 {
+		t.Errorf("Injected requests are not matched: %f", value)
+	}
+	if value := testutil.ToFloat64(skipped); value != before[1]+1 {
+		t.Errorf("Skipped injections by reinvocation are not matched: %f", value)
+	}
+	if value := testutil.ToFloat64(disabled); value != before[2]+1 {
+		t.Errorf("Skipped injections without annotation are not matched: %f", value)
+	}
+	if count := testutil.CollectAndCount(mutationDuration); count == 0 {
+		t.Error("Mutation duration is not observed")
+	}
+}
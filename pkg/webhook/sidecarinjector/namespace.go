@@ -0,0 +1,38 @@
+package sidecarinjector
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	klog "k8s.io/klog/v2"
+)
+
+var injectionKey = annotationPrefix + "/injection"
+
+// namespaceInjectionEnabled returns true when the namespace has the injection label.
+func (i *Injector) namespaceInjectionEnabled(name string) bool {
+	if i.namespaceLister == nil {
+		return false
+	}
+	namespace, err := i.namespaceLister.Get(name)
+	if errors.IsNotFound(err) {
+		return false
+	}
+	if err != nil {
+		klog.Errorf("Failed to get namespace %s: %v", name, err)
+		return false
+	}
+	return namespace.Labels[injectionKey] == "enabled"
+}
+
+// injectionEnabled returns whether the sidecar is injected to the pod.
+// The annotation of the pod takes precedence over the label of the namespace, so a pod can disable injection in an enabled namespace.
+func injectionEnabled(pod *corev1.Pod, namespaceEnabled bool) bool {
+	switch pod.Annotations[injectionKey] {
+	case "enabled":
+		return true
+	case "disabled":
+		return false
+	default:
+		return namespaceEnabled
+	}
+}
@@ -0,0 +1,73 @@
+package sidecarinjector
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestNamespaceInjectionEnabled(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, namespace := range []*corev1.Namespace{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "team-a",
+				Labels: map[string]string{
+					annotationPrefix + "/injection": "enabled",
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "team-b",
+			},
+		},
+	} {
+		if err := indexer.Add(namespace); err != nil {
+			t.Fatal(err)
+		}
+	}
+	injector := NewInjector("", nil, corelisters.NewNamespaceLister(indexer), nil, nil)
+
+	if !injector.namespaceInjectionEnabled("team-a") {
+		t.Error("Injection should be enabled in team-a")
+	}
+	if injector.namespaceInjectionEnabled("team-b") {
+		t.Error("Injection should not be enabled in team-b")
+	}
+	if injector.namespaceInjectionEnabled("team-c") {
+		t.Error("Injection should not be enabled in unknown namespaces")
+	}
+	if NewInjector("", nil, nil, nil, nil).namespaceInjectionEnabled("team-a") {
+		t.Error("Injection should not be enabled without namespace lister")
+	}
+}
+
+func TestInjectionEnabled(t *testing.T) {
+	cases := []struct {
+		annotation       string
+		namespaceEnabled bool
+		expected         bool
+	}{
+		{"", false, false},
+		{"", true, true},
+		{"enabled", false, true},
+		{"enabled", true, true},
+		{"disabled", true, false},
+		{"disabled", false, false},
+	}
+	for _, c := range cases {
+		pod := &corev1.Pod{}
+		if c.annotation != "" {
+			pod.Annotations = map[string]string{
+				annotationPrefix + "/injection": c.annotation,
+			}
+		}
+		if enabled := injectionEnabled(pod, c.namespaceEnabled); enabled != c.expected {
+			t.Errorf("Injection with annotation %q in enabled namespace %v is not matched: %v", c.annotation, c.namespaceEnabled, enabled)
+		}
+	}
+}
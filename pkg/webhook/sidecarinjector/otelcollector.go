@@ -0,0 +1,292 @@
+package sidecarinjector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	"github.com/kelseyhightower/envconfig"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// OtelCollectorEnv is required environment variables for otel-collector settings.
+type OtelCollectorEnv struct {
+	DockerImage       string `envconfig:"DOCKER_IMAGE" default:"otel/opentelemetry-collector-contrib:latest"`
+	ApplicationLogDir string `envconfig:"APPLICATION_LOG_DIR"`
+	TagPrefix         string `envconfig:"TAG_PREFIX" default:"app"`
+	OTLPEndpoint      string `envconfig:"OTLP_ENDPOINT"`
+	OTLPProtocol      string `envconfig:"OTLP_PROTOCOL" default:"grpc"`
+	OTLPInsecure      bool   `envconfig:"OTLP_INSECURE" default:"false"`
+	CustomEnv         string `envconfig:"CUSTOM_ENV"`
+}
+
+const (
+	// otelCollectorConfigDir is the directory of the rendered configuration. The image does not have configuration for the sidecar, so it is always rendered.
+	otelCollectorConfigDir = "/otelcol/etc"
+	otelCollectorConfigKey = "config.yaml"
+	// otelCollectorPositionsDir is in the log volume, so positions of log files survive restarts of the sidecar.
+	otelCollectorPositionsDir = ".fluentd-sidecar-injector-otelcol"
+)
+
+// otlpExporter is the exporter of otel-collector. The endpoint is read from OTLP_ENDPOINT of the sidecar.
+type otlpExporter struct {
+	protocol string
+	insecure bool
+}
+
+func injectOtelCollector(pod *corev1.Pod, defaults *sidecarinjectorv1alpha1.OtelCollectorSpec, native bool) (*Result, error) {
+	var otelCollectorEnv OtelCollectorEnv
+	err := envconfig.Process("otelcollector", &otelCollectorEnv)
+	if err != nil {
+		return &Result{}, err
+	}
+	applyOtelCollectorSpec(&otelCollectorEnv, defaults)
+	annotations, warnings := parseAnnotations(pod, "otel-collector")
+	// The default image is distroless, so it does not have sh for the handshake.
+	if value, _ := annotations.value("shutdown-handshake"); value == "enabled" {
+		return &Result{}, errors.New("shutdown-handshake is not supported by otel-collector")
+	}
+
+	dockerImage := otelCollectorEnv.DockerImage
+	if value, ok := annotations.value("docker-image"); ok {
+		dockerImage = value
+	}
+
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: VolumeName,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	})
+
+	sidecar := corev1.Container{
+		Name:      ContainerName,
+		Image:     dockerImage,
+		Args:      []string{"--config=" + path.Join(otelCollectorConfigDir, otelCollectorConfigKey)},
+		Resources: sidecarResources(annotations),
+	}
+
+	if port, ok := annotations.port("expose-port"); ok {
+		sidecar.Ports = []corev1.ContainerPort{{ContainerPort: port}}
+	}
+
+	// Override env with otelCollectorEnv and Pod's annotations.
+	endpoint := otelCollectorEnv.OTLPEndpoint
+	if value, ok := annotations.value("otlp-endpoint"); ok {
+		endpoint = value
+	}
+	if endpoint == "" {
+		return &Result{}, errors.New("otlp endpoint is required")
+	}
+	sidecar.Env = append(sidecar.Env, corev1.EnvVar{
+		Name:  "OTLP_ENDPOINT",
+		Value: endpoint,
+	})
+
+	exporter := &otlpExporter{protocol: otelCollectorEnv.OTLPProtocol, insecure: otelCollectorEnv.OTLPInsecure}
+	if value, ok := annotations.value("otlp-protocol"); ok {
+		exporter.protocol = value
+	}
+	if exporter.protocol != sidecarinjectorv1alpha1.OTLPProtocolGRPC && exporter.protocol != sidecarinjectorv1alpha1.OTLPProtocolHTTP {
+		return &Result{}, fmt.Errorf("otlp protocol must be grpc or http, %s is not matched", exporter.protocol)
+	}
+	if value, ok := annotations.value("otlp-insecure"); ok {
+		exporter.insecure, _ = strconv.ParseBool(value)
+	}
+
+	customEnv := otelCollectorEnv.CustomEnv
+	if value, ok := annotations.value("custom-env"); ok {
+		customEnv = value
+	}
+	if customEnv != "" {
+		sidecar.Env = append(sidecar.Env, corev1.EnvVar{
+			Name:  "CUSTOM_ENV",
+			Value: customEnv,
+		})
+	}
+
+	sources, err := logSources(annotations)
+	if err != nil {
+		return &Result{}, err
+	}
+
+	applicationLogDir := otelCollectorEnv.ApplicationLogDir
+	if value, ok := annotations.value("application-log-dir"); ok {
+		applicationLogDir = value
+	}
+	if applicationLogDir == "" && len(sources) > 0 {
+		applicationLogDir = path.Dir(sources[0].Path)
+	}
+	if applicationLogDir == "" {
+		return &Result{}, errors.New("application log dir is required")
+	}
+	sidecar.Env = append(sidecar.Env, corev1.EnvVar{
+		Name:  "APPLICATION_LOG_DIR",
+		Value: applicationLogDir,
+	})
+
+	volumeMount := corev1.VolumeMount{
+		Name:      VolumeName,
+		ReadOnly:  false,
+		MountPath: applicationLogDir,
+	}
+	sidecar.VolumeMounts = []corev1.VolumeMount{
+		volumeMount,
+	}
+
+	configVolume, hasConfigVolume := annotations.value("config-volume")
+	if hasConfigVolume {
+		mountsCnt := len(sidecar.VolumeMounts)
+		for _, volume := range pod.Spec.Volumes {
+			if volume.Name == configVolume {
+				sidecar.VolumeMounts = append(sidecar.VolumeMounts, corev1.VolumeMount{
+					Name:      volume.Name,
+					MountPath: otelCollectorConfigDir})
+				break
+			}
+		}
+		if mountsCnt == len(sidecar.VolumeMounts) {
+			return &Result{}, errors.New("config volume does not exist")
+		}
+	}
+
+	tagPrefix := otelCollectorEnv.TagPrefix
+	if value, ok := annotations.value("tag-prefix"); ok {
+		tagPrefix = value
+	}
+	if tagPrefix != "" {
+		sidecar.Env = append(sidecar.Env, corev1.EnvVar{
+			Name:  "TAG_PREFIX",
+			Value: tagPrefix,
+		})
+	}
+
+	// They are resource attributes of records.
+	for _, field := range [][2]string{{"NODE_NAME", "spec.nodeName"}, {"POD_NAME", "metadata.name"}, {"POD_NAMESPACE", "metadata.namespace"}} {
+		sidecar.Env = append(sidecar.Env, corev1.EnvVar{
+			Name: field[0],
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{
+					FieldPath: field[1],
+				},
+			},
+		})
+	}
+
+	buffer, err := configureBuffer(pod, &sidecar, annotations, "otel-collector")
+	if err != nil {
+		return &Result{}, err
+	}
+	containers, err := logContainers(pod, annotations, applicationLogDir)
+	if err != nil {
+		return &Result{}, err
+	}
+	// Logs of log-containers are in subdirectories of the log directory, so all directories are tailed by default.
+	if !hasConfigVolume && len(sources) == 0 {
+		sources = []LogSource{{Path: path.Join(applicationLogDir, "**", "*.log"), Parser: ParserNone}}
+	}
+	logMounts := configureLogSources(pod, &sidecar, sources, tagPrefix, applicationLogDir, "otel-collector", sourcesOutput{buffer: buffer, otlp: exporter})
+	if containers != nil && len(logMounts) > 0 {
+		return &Result{}, errors.New("log sources must be in the application log dir when log-containers is specified")
+	}
+
+	if err := appendSidecar(pod, annotations, sidecar, append([]corev1.VolumeMount{volumeMount}, logMounts...), containers, native, otelCollectorHealthPort); err != nil {
+		return &Result{}, err
+	}
+
+	return &Result{
+		Mutated:  pod,
+		Warnings: warnings,
+	}, nil
+}
+
+// renderOtelCollectorSources returns config.yaml which reads each source with the filelog receiver, and exports records with OTLP.
+// Positions of files are stored in the log directory, and the sending queue is stored in the buffer if it is configured.
+func renderOtelCollectorSources(sources []LogSource, logDir string, output sourcesOutput) map[string]string {
+	var b strings.Builder
+	extensions := []string{"health_check", "file_storage/positions"}
+	fmt.Fprintf(&b, "extensions:\n  health_check:\n    endpoint: 0.0.0.0:%d\n", otelCollectorHealthPort)
+	fmt.Fprintf(&b, "  file_storage/positions:\n    directory: %s\n    create_directory: true\n", otelString(path.Join(logDir, otelCollectorPositionsDir)))
+	if output.buffer != nil {
+		extensions = append(extensions, "file_storage/buffer")
+		fmt.Fprintf(&b, "  file_storage/buffer:\n    directory: %s\n", otelString(output.buffer.path))
+	}
+
+	var receivers []string
+	b.WriteString("receivers:\n")
+	for i, source := range sources {
+		name := fmt.Sprintf("filelog/%d", i)
+		receivers = append(receivers, name)
+		fmt.Fprintf(&b, "  %s:\n    include:\n      - %s\n", name, otelString(source.Path))
+		b.WriteString("    start_at: beginning\n    storage: file_storage/positions\n")
+		fmt.Fprintf(&b, "    attributes:\n      tag: %s\n", otelString(source.Tag))
+		b.WriteString("    resource:\n      k8s.node.name: ${env:NODE_NAME}\n      k8s.pod.name: ${env:POD_NAME}\n      k8s.namespace.name: ${env:POD_NAMESPACE}\n")
+
+		parser, regex, timeKey, timeFormat := "", source.Expression, source.TimeKey, source.TimeFormat
+		switch source.Parser {
+		case ParserJSON:
+			parser = "json_parser"
+		case ParserRegexp:
+			parser = "regex_parser"
+		case ParserNginx, ParserApache:
+			parser, regex = "regex_parser", fluentBitNginxRegex
+			if source.Parser == ParserApache {
+				regex = fluentBitApacheRegex
+			}
+			if timeKey == "" {
+				timeKey = "time"
+			}
+			if timeFormat == "" {
+				timeFormat = fluentBitAccessLogTime
+			}
+		case ParserMultiline:
+			fmt.Fprintf(&b, "    multiline:\n      line_start_pattern: %s\n", otelString(source.FirstLine))
+			if source.Expression != "" {
+				parser = "regex_parser"
+			}
+		}
+		if parser == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "    operators:\n      - type: %s\n", parser)
+		if parser == "regex_parser" {
+			fmt.Fprintf(&b, "        regex: %s\n", otelString(regex))
+		}
+		if timeKey != "" && timeFormat != "" {
+			fmt.Fprintf(&b, "        timestamp:\n          parse_from: %s\n          layout_type: strptime\n          layout: %s\n", otelString("attributes."+timeKey), otelString(timeFormat))
+		}
+	}
+
+	b.WriteString("processors:\n  batch: {}\n")
+
+	exporter := "otlp"
+	if output.otlp.protocol == sidecarinjectorv1alpha1.OTLPProtocolHTTP {
+		exporter = "otlphttp"
+	}
+	fmt.Fprintf(&b, "exporters:\n  %s:\n    endpoint: ${env:OTLP_ENDPOINT}\n", exporter)
+	if output.otlp.insecure {
+		b.WriteString("    tls:\n      insecure: true\n")
+	}
+	if output.buffer != nil {
+		// Records are kept until the endpoint comes back, because they are stored in the buffer.
+		b.WriteString("    sending_queue:\n      storage: file_storage/buffer\n    retry_on_failure:\n      max_elapsed_time: 0s\n")
+	}
+
+	fmt.Fprintf(&b, "service:\n  extensions: [%s]\n", strings.Join(extensions, ", "))
+	fmt.Fprintf(&b, "  pipelines:\n    logs:\n      receivers: [%s]\n      processors: [batch]\n      exporters: [%s]\n", strings.Join(receivers, ", "), exporter)
+	return map[string]string{otelCollectorConfigKey: b.String()}
+}
+
+// otelString quotes a value of config.yaml. JSON strings are valid in YAML, and $ is escaped, because the collector expands environment variables in values.
+func otelString(value string) string {
+	var b strings.Builder
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	// Encoding a string to strings.Builder does not fail.
+	_ = encoder.Encode(strings.ReplaceAll(value, "$", "$$"))
+	return strings.TrimSuffix(b.String(), "\n")
+}
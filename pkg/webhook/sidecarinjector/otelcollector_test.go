@@ -0,0 +1,145 @@
+package sidecarinjector
+
+import (
+	"strings"
+	"testing"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+)
+
+func TestInjectOtelCollector(t *testing.T) {
+	pod := newTestPod(map[string]string{
+		annotationPrefix + "/collector":      "otel-collector",
+		annotationPrefix + "/otlp-endpoint":  "http://otel-gateway.monitoring:4318",
+		annotationPrefix + "/otlp-protocol":  "http",
+		annotationPrefix + "/memory-limit":   "500Mi",
+		annotationPrefix + "/log-containers": "nginx",
+	})
+	delete(pod.Annotations, annotationPrefix+"/aggregator-host")
+	defaults := &sidecarinjectorv1alpha1.SidecarInjectorPolicySpec{
+		OtelCollector: &sidecarinjectorv1alpha1.OtelCollectorSpec{Endpoint: "otel-gateway.monitoring:4317", Insecure: true},
+	}
+
+	result, err := sidecarInjectMutator(pod, defaults, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Collector != "otel-collector" || len(result.Warnings) != 0 {
+		t.Errorf("Result is not matched: %#v", result)
+	}
+	sidecar := findSidecar(pod)
+	if sidecar.Image != "otel/opentelemetry-collector-contrib:latest" {
+		t.Errorf("Image is not matched: %s", sidecar.Image)
+	}
+	if len(sidecar.Args) != 1 || sidecar.Args[0] != "--config=/otelcol/etc/config.yaml" {
+		t.Errorf("Args are not matched: %v", sidecar.Args)
+	}
+	if limit := sidecar.Resources.Limits.Memory().String(); limit != "500Mi" {
+		t.Errorf("Memory limit is not matched: %s", limit)
+	}
+	if env := findEnv(sidecar.Env, "OTLP_ENDPOINT"); env == nil || env.Value != "http://otel-gateway.monitoring:4318" {
+		t.Errorf("OTLP_ENDPOINT is not matched: %#v", env)
+	}
+	volume := findVolume(pod.Spec.Volumes, SourcesVolumeName)
+	if volume == nil || len(volume.DownwardAPI.Items) != 1 || volume.DownwardAPI.Items[0].Path != otelCollectorConfigKey {
+		t.Fatalf("Sources volume is not matched: %#v", volume)
+	}
+	if mount := findMount(sidecar.VolumeMounts, SourcesVolumeName); mount == nil || mount.MountPath != otelCollectorConfigDir {
+		t.Errorf("Sources mount is not matched: %#v", mount)
+	}
+
+	config := pod.Annotations[annotationPrefix+"/sources-config"]
+	for _, expected := range []string{
+		"    include:\n      - \"/var/log/nginx/**/*.log\"\n",
+		"      tag: \"app.0\"\n",
+		"    directory: \"/var/log/nginx/.fluentd-sidecar-injector-otelcol\"\n",
+		"exporters:\n  otlphttp:\n    endpoint: ${env:OTLP_ENDPOINT}\n    tls:\n      insecure: true\n",
+		"      exporters: [otlphttp]\n",
+	} {
+		if !strings.Contains(config, expected) {
+			t.Errorf("Config does not contain %q:\n%s", expected, config)
+		}
+	}
+	if strings.Contains(config, "operators:") {
+		t.Errorf("Default source should not be parsed:\n%s", config)
+	}
+
+	removeInjection(pod)
+	if _, ok := pod.Annotations[annotationPrefix+"/sources-config"]; ok || findVolume(pod.Spec.Volumes, SourcesVolumeName) != nil {
+		t.Error("Failed to remove the config")
+	}
+}
+
+func TestInjectOtelCollectorAsNativeSidecar(t *testing.T) {
+	pod := newTestPod(map[string]string{
+		annotationPrefix + "/collector":      "otel-collector",
+		annotationPrefix + "/otlp-endpoint":  "otel-gateway.monitoring:4317",
+		annotationPrefix + "/send-timeout":   "30s",
+		annotationPrefix + "/native-sidecar": "true",
+	})
+
+	result, err := sidecarInjectMutator(pod, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Annotations of the forward output are not used by otel-collector either.
+	expected := []string{
+		"annotation " + annotationPrefix + "/aggregator-host is not used by otel-collector",
+		"annotation " + annotationPrefix + "/send-timeout is not used by otel-collector",
+	}
+	if strings.Join(result.Warnings, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Warnings are not matched: %v", result.Warnings)
+	}
+	sidecar := findContainer(pod.Spec.InitContainers, ContainerName)
+	if sidecar == nil || sidecar.StartupProbe == nil || sidecar.StartupProbe.TCPSocket.Port.IntValue() != otelCollectorHealthPort {
+		t.Fatalf("Startup probe should check the health check extension: %#v", sidecar)
+	}
+	if config := pod.Annotations[annotationPrefix+"/sources-config"]; !strings.Contains(config, "exporters:\n  otlp:\n    endpoint: ${env:OTLP_ENDPOINT}\n") || strings.Contains(config, "insecure") {
+		t.Errorf("Exporter is not matched:\n%s", config)
+	}
+
+	pod = newTestPod(map[string]string{
+		annotationPrefix + "/collector": "otel-collector",
+	})
+	if _, err := sidecarInjectMutator(pod, nil, false); err == nil {
+		t.Error("OTLP endpoint should be required")
+	}
+
+	pod = newTestPod(map[string]string{
+		annotationPrefix + "/collector":          "otel-collector",
+		annotationPrefix + "/otlp-endpoint":      "otel-gateway.monitoring:4317",
+		annotationPrefix + "/shutdown-handshake": "enabled",
+		annotationPrefix + "/shutdown-delay":     "5",
+	})
+	if _, err := sidecarInjectMutator(pod, nil, false); err == nil {
+		t.Error("shutdown-handshake should be rejected for otel-collector")
+	}
+}
+
+func TestRenderOtelCollectorSources(t *testing.T) {
+	sources := []LogSource{
+		{Path: "/var/log/app/app.json", Parser: ParserJSON, Tag: "app.json", TimeKey: "ts", TimeFormat: "%Y-%m-%dT%H:%M:%S%z"},
+		{Path: "/var/log/app/app.log", Parser: ParserRegexp, Tag: "app.regexp", Expression: `^(?<level>\w+) (?<message>.*)$`},
+		{Path: "/var/log/app/trace.log", Parser: ParserMultiline, Tag: "app.multiline", FirstLine: `^\d{4}-`},
+		{Path: "/var/log/nginx/access.log", Parser: ParserNginx, Tag: "nginx"},
+	}
+	output := sourcesOutput{
+		buffer: &sidecarBuffer{path: "/otelcol/buffer", limit: 1000},
+		otlp:   &otlpExporter{protocol: sidecarinjectorv1alpha1.OTLPProtocolGRPC},
+	}
+	config := renderOtelCollectorSources(sources, "/var/log/app", output)[otelCollectorConfigKey]
+	for _, expected := range []string{
+		"  file_storage/buffer:\n    directory: \"/otelcol/buffer\"\n",
+		"    operators:\n      - type: json_parser\n        timestamp:\n          parse_from: \"attributes.ts\"\n          layout_type: strptime\n          layout: \"%Y-%m-%dT%H:%M:%S%z\"\n",
+		"      - type: regex_parser\n        regex: \"^(?<level>\\\\w+) (?<message>.*)$$\"\n  filelog/2:\n",
+		"    multiline:\n      line_start_pattern: \"^\\\\d{4}-\"\n  filelog/3:\n",
+		"          layout: \"%d/%b/%Y:%H:%M:%S %z\"\n",
+		"    sending_queue:\n      storage: file_storage/buffer\n    retry_on_failure:\n      max_elapsed_time: 0s\n",
+		"  extensions: [health_check, file_storage/positions, file_storage/buffer]\n",
+		"      receivers: [filelog/0, filelog/1, filelog/2, filelog/3]\n",
+	} {
+		if !strings.Contains(config, expected) {
+			t.Errorf("Config does not contain %q:\n%s", expected, config)
+		}
+	}
+}
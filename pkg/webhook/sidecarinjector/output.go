@@ -0,0 +1,356 @@
+package sidecarinjector
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/url"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// directOutput validates the output, and returns it if the sidecar sends logs to the backend directly. It returns nil for the forward output.
+func directOutput(output *sidecarinjectorv1alpha1.OutputSpec) (*sidecarinjectorv1alpha1.OutputSpec, error) {
+	if output == nil || output.Type == "" || output.Type == sidecarinjectorv1alpha1.OutputForward {
+		return nil, nil
+	}
+	var values []string
+	switch output.Type {
+	case sidecarinjectorv1alpha1.OutputStdout:
+	case sidecarinjectorv1alpha1.OutputElasticsearch, sidecarinjectorv1alpha1.OutputOpenSearch:
+		search := searchOutput(output)
+		if search == nil || search.Host == "" {
+			return nil, fmt.Errorf("%s output requires host", output.Type)
+		}
+		values = append(values, search.Host, search.Index)
+	case sidecarinjectorv1alpha1.OutputLoki:
+		if output.Loki == nil {
+			return nil, fmt.Errorf("loki output requires url")
+		}
+		u, err := parseOutputURL(output.Loki.URL)
+		if err != nil {
+			return nil, err
+		}
+		// Both collectors append the push path to the URL.
+		if strings.HasSuffix(strings.TrimSuffix(u.Path, "/"), lokiPushPath) || u.RawQuery != "" {
+			return nil, fmt.Errorf("url of loki must be the base URL without %s and queries, %q is not matched", lokiPushPath, output.Loki.URL)
+		}
+		values = append(values, output.Loki.URL, output.Loki.TenantID)
+		values = append(values, mapValues(output.Loki.Labels)...)
+	case sidecarinjectorv1alpha1.OutputS3:
+		if output.S3 == nil || output.S3.Bucket == "" {
+			return nil, fmt.Errorf("s3 output requires bucket")
+		}
+		if output.S3.Endpoint != "" {
+			if _, err := parseOutputURL(output.S3.Endpoint); err != nil {
+				return nil, err
+			}
+		}
+		values = append(values, output.S3.Bucket, output.S3.Region, output.S3.Endpoint, output.S3.PathPrefix)
+	case sidecarinjectorv1alpha1.OutputKafka:
+		if output.Kafka == nil || len(output.Kafka.Brokers) == 0 || output.Kafka.Topic == "" {
+			return nil, fmt.Errorf("kafka output requires brokers and topic")
+		}
+		values = append(values, output.Kafka.Topic)
+		values = append(values, output.Kafka.Brokers...)
+	case sidecarinjectorv1alpha1.OutputHTTP:
+		if output.HTTP == nil {
+			return nil, fmt.Errorf("http output requires url")
+		}
+		if _, err := parseOutputURL(output.HTTP.URL); err != nil {
+			return nil, err
+		}
+		values = append(values, output.HTTP.URL)
+		values = append(values, mapValues(output.HTTP.Headers)...)
+	default:
+		return nil, fmt.Errorf("output type must be forward, stdout, elasticsearch, opensearch, loki, s3, kafka or http, %s is not matched", output.Type)
+	}
+	for _, value := range values {
+		if strings.ContainsAny(value, " \"'\r\n") {
+			return nil, fmt.Errorf("%s output must not contain spaces, quotes and line breaks, %q is not matched", output.Type, value)
+		}
+	}
+	return output, nil
+}
+
+// lokiPushPath is the path of the push API of Loki under the URL of the output.
+const lokiPushPath = "/loki/api/v1/push"
+
+// forwardWarnings returns warnings of forward annotations which are specified with the direct output.
+func forwardWarnings(annotations podAnnotations, output *sidecarinjectorv1alpha1.OutputSpec) []string {
+	var warnings []string
+	for _, name := range slices.Sorted(maps.Keys(forwardAnnotations)) {
+		if _, ok := annotations.value(name); ok {
+			warnings = append(warnings, fmt.Sprintf("annotation %s/%s is ignored, because the output type is %s", annotationPrefix, name, output.Type))
+		}
+	}
+	return warnings
+}
+
+func searchOutput(output *sidecarinjectorv1alpha1.OutputSpec) *sidecarinjectorv1alpha1.SearchOutputSpec {
+	if output.Type == sidecarinjectorv1alpha1.OutputOpenSearch {
+		return output.OpenSearch
+	}
+	return output.Elasticsearch
+}
+
+// parseOutputURL parses an http or https URL, and fills the default port of the scheme.
+func parseOutputURL(value string) (*url.URL, error) {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return nil, fmt.Errorf("url of the output must be an http or https URL, %q is not matched", value)
+	}
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		u.Host = u.Hostname() + ":" + port
+	}
+	return u, nil
+}
+
+// mapValues returns keys and values of the map in the order of keys.
+func mapValues(m map[string]string) []string {
+	var values []string
+	for _, key := range sortedKeys(m) {
+		values = append(values, key, m[key])
+	}
+	return values
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// configureOutput sets credentials of the backend to environment variables of the sidecar from the Secret.
+// S3 credentials are read by the AWS SDK of collectors, and others are read by the rendered configuration.
+func configureOutput(sidecar *corev1.Container, output *sidecarinjectorv1alpha1.OutputSpec) {
+	if output.CredentialsSecretName == "" {
+		return
+	}
+	if output.Type == sidecarinjectorv1alpha1.OutputS3 {
+		sidecar.Env = append(sidecar.Env,
+			secretEnv("AWS_ACCESS_KEY_ID", output.CredentialsSecretName, sidecarinjectorv1alpha1.OutputAccessKeyIDKey),
+			secretEnv("AWS_SECRET_ACCESS_KEY", output.CredentialsSecretName, sidecarinjectorv1alpha1.OutputSecretAccessKeyKey),
+		)
+		return
+	}
+	sidecar.Env = append(sidecar.Env,
+		secretEnv("OUTPUT_USERNAME", output.CredentialsSecretName, corev1.BasicAuthUsernameKey),
+		secretEnv("OUTPUT_PASSWORD", output.CredentialsSecretName, corev1.BasicAuthPasswordKey),
+	)
+}
+
+// defaultLogSources returns sources which tail log files in the application log directory, because the configuration of the image is hidden by the rendered one.
+// With log-containers, logs of each container are in the subdirectory of its name, so a source is returned for each container.
+func defaultLogSources(logDir string, containers map[string]string, tagPrefix, logFormat, timeKey, timeFormat string) []LogSource {
+	source := LogSource{Path: path.Join(logDir, "*.log"), Parser: ParserNone}
+	if logFormat == ParserJSON {
+		source.Parser = ParserJSON
+		source.TimeKey = timeKey
+		source.TimeFormat = timeFormat
+	}
+	if containers == nil {
+		return []LogSource{source}
+	}
+	names := make([]string, 0, len(containers))
+	for name := range containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sources := make([]LogSource, 0, len(names))
+	for _, name := range names {
+		s := source
+		s.Path = path.Join(logDir, name, "*.log")
+		s.Tag = name
+		if tagPrefix != "" {
+			s.Tag = tagPrefix + "." + name
+		}
+		sources = append(sources, s)
+	}
+	return sources
+}
+
+// writeFluentDOutput writes parameters of the output plugin in the match section.
+func writeFluentDOutput(b *strings.Builder, output *sidecarinjectorv1alpha1.OutputSpec) {
+	credentials := output.CredentialsSecretName != ""
+	switch output.Type {
+	case sidecarinjectorv1alpha1.OutputStdout:
+		b.WriteString("  @type stdout\n")
+	case sidecarinjectorv1alpha1.OutputElasticsearch, sidecarinjectorv1alpha1.OutputOpenSearch:
+		search := searchOutput(output)
+		fmt.Fprintf(b, "  @type %s\n  host %s\n  port %d\n", output.Type, search.Host, searchPort(search))
+		if search.TLS {
+			b.WriteString("  scheme https\n")
+		}
+		fmt.Fprintf(b, "  index_name %s\n", searchIndex(search))
+		if credentials {
+			b.WriteString("  user \"#{ENV['OUTPUT_USERNAME']}\"\n  password \"#{ENV['OUTPUT_PASSWORD']}\"\n")
+		}
+	case sidecarinjectorv1alpha1.OutputLoki:
+		labels, _ := json.Marshal(lokiLabels(output.Loki))
+		fmt.Fprintf(b, "  @type loki\n  url %s\n  extra_labels %s\n", strings.TrimSuffix(output.Loki.URL, "/"), labels)
+		if output.Loki.TenantID != "" {
+			fmt.Fprintf(b, "  tenant %s\n", output.Loki.TenantID)
+		}
+		if credentials {
+			b.WriteString("  username \"#{ENV['OUTPUT_USERNAME']}\"\n  password \"#{ENV['OUTPUT_PASSWORD']}\"\n")
+		}
+	case sidecarinjectorv1alpha1.OutputS3:
+		fmt.Fprintf(b, "  @type s3\n  s3_bucket %s\n  s3_region %s\n", output.S3.Bucket, s3Region(output.S3))
+		if output.S3.Endpoint != "" {
+			fmt.Fprintf(b, "  s3_endpoint %s\n  force_path_style true\n", output.S3.Endpoint)
+		}
+		if output.S3.PathPrefix != "" {
+			fmt.Fprintf(b, "  path %s/\n", strings.Trim(output.S3.PathPrefix, "/"))
+		}
+	case sidecarinjectorv1alpha1.OutputKafka:
+		fmt.Fprintf(b, "  @type kafka2\n  brokers %s\n  default_topic %s\n", strings.Join(output.Kafka.Brokers, ","), output.Kafka.Topic)
+		if credentials {
+			fmt.Fprintf(b, "  username \"#{ENV['OUTPUT_USERNAME']}\"\n  password \"#{ENV['OUTPUT_PASSWORD']}\"\n  sasl_over_ssl %t\n", output.Kafka.TLS)
+		}
+		if output.Kafka.TLS {
+			b.WriteString("  ssl_ca_certs_from_system true\n")
+		}
+		b.WriteString("  <format>\n    @type json\n  </format>\n")
+	case sidecarinjectorv1alpha1.OutputHTTP:
+		fmt.Fprintf(b, "  @type http\n  endpoint %s\n  json_array true\n", output.HTTP.URL)
+		if len(output.HTTP.Headers) > 0 {
+			headers, _ := json.Marshal(output.HTTP.Headers)
+			fmt.Fprintf(b, "  headers %s\n", headers)
+		}
+		b.WriteString("  <format>\n    @type json\n  </format>\n")
+		if credentials {
+			b.WriteString("  <auth>\n    method basic\n    username \"#{ENV['OUTPUT_USERNAME']}\"\n    password \"#{ENV['OUTPUT_PASSWORD']}\"\n  </auth>\n")
+		}
+	}
+}
+
+// writeFluentBitOutput writes parameters of the output plugin in the OUTPUT section.
+func writeFluentBitOutput(b *strings.Builder, output *sidecarinjectorv1alpha1.OutputSpec) {
+	credentials := output.CredentialsSecretName != ""
+	switch output.Type {
+	case sidecarinjectorv1alpha1.OutputStdout:
+		b.WriteString("    Name stdout\n    Match *\n    Format json_lines\n")
+	case sidecarinjectorv1alpha1.OutputElasticsearch, sidecarinjectorv1alpha1.OutputOpenSearch:
+		search := searchOutput(output)
+		name := "es"
+		if output.Type == sidecarinjectorv1alpha1.OutputOpenSearch {
+			name = "opensearch"
+		}
+		fmt.Fprintf(b, "    Name %s\n    Match *\n    Host %s\n    Port %d\n    Index %s\n    Suppress_Type_Name On\n", name, search.Host, searchPort(search), searchIndex(search))
+		if search.TLS {
+			b.WriteString("    tls On\n")
+		}
+		if credentials {
+			b.WriteString("    HTTP_User ${OUTPUT_USERNAME}\n    HTTP_Passwd ${OUTPUT_PASSWORD}\n")
+		}
+	case sidecarinjectorv1alpha1.OutputLoki:
+		u, _ := parseOutputURL(output.Loki.URL)
+		fmt.Fprintf(b, "    Name loki\n    Match *\n    Host %s\n    Port %s\n", u.Hostname(), u.Port())
+		if p := strings.TrimSuffix(u.Path, "/"); p != "" {
+			fmt.Fprintf(b, "    Uri %s%s\n", p, lokiPushPath)
+		}
+		if u.Scheme == "https" {
+			b.WriteString("    tls On\n")
+		}
+		labels := lokiLabels(output.Loki)
+		var pairs []string
+		for _, key := range sortedKeys(labels) {
+			pairs = append(pairs, key+"="+labels[key])
+		}
+		fmt.Fprintf(b, "    Labels %s\n", strings.Join(pairs, ", "))
+		if output.Loki.TenantID != "" {
+			fmt.Fprintf(b, "    Tenant_ID %s\n", output.Loki.TenantID)
+		}
+		if credentials {
+			b.WriteString("    HTTP_User ${OUTPUT_USERNAME}\n    HTTP_Passwd ${OUTPUT_PASSWORD}\n")
+		}
+	case sidecarinjectorv1alpha1.OutputS3:
+		fmt.Fprintf(b, "    Name s3\n    Match *\n    bucket %s\n    region %s\n", output.S3.Bucket, s3Region(output.S3))
+		if output.S3.Endpoint != "" {
+			fmt.Fprintf(b, "    endpoint %s\n    use_put_object On\n", output.S3.Endpoint)
+		}
+		if output.S3.PathPrefix != "" {
+			fmt.Fprintf(b, "    s3_key_format /%s/$TAG/%%Y/%%m/%%d/%%H/%%M/%%S\n", strings.Trim(output.S3.PathPrefix, "/"))
+		}
+	case sidecarinjectorv1alpha1.OutputKafka:
+		fmt.Fprintf(b, "    Name kafka\n    Match *\n    Brokers %s\n    Topics %s\n    Format json\n", strings.Join(output.Kafka.Brokers, ","), output.Kafka.Topic)
+		protocol := ""
+		switch {
+		case credentials && output.Kafka.TLS:
+			protocol = "SASL_SSL"
+		case credentials:
+			protocol = "SASL_PLAINTEXT"
+		case output.Kafka.TLS:
+			protocol = "SSL"
+		}
+		if protocol != "" {
+			fmt.Fprintf(b, "    rdkafka.security.protocol %s\n", protocol)
+		}
+		if credentials {
+			b.WriteString("    rdkafka.sasl.mechanism PLAIN\n    rdkafka.sasl.username ${OUTPUT_USERNAME}\n    rdkafka.sasl.password ${OUTPUT_PASSWORD}\n")
+		}
+	case sidecarinjectorv1alpha1.OutputHTTP:
+		u, _ := parseOutputURL(output.HTTP.URL)
+		uri := u.RequestURI()
+		fmt.Fprintf(b, "    Name http\n    Match *\n    Host %s\n    Port %s\n    URI %s\n    Format json\n", u.Hostname(), u.Port(), uri)
+		if u.Scheme == "https" {
+			b.WriteString("    tls On\n")
+		}
+		if credentials {
+			b.WriteString("    HTTP_User ${OUTPUT_USERNAME}\n    HTTP_Passwd ${OUTPUT_PASSWORD}\n")
+		}
+		for _, key := range sortedKeys(output.HTTP.Headers) {
+			fmt.Fprintf(b, "    Header %s %s\n", key, output.HTTP.Headers[key])
+		}
+	}
+}
+
+func searchPort(search *sidecarinjectorv1alpha1.SearchOutputSpec) int32 {
+	if search.Port == 0 {
+		return 9200
+	}
+	return search.Port
+}
+
+func searchIndex(search *sidecarinjectorv1alpha1.SearchOutputSpec) string {
+	if search.Index == "" {
+		return "fluentd"
+	}
+	return search.Index
+}
+
+func s3Region(s3 *sidecarinjectorv1alpha1.S3OutputSpec) string {
+	if s3.Region == "" {
+		return "us-east-1"
+	}
+	return s3.Region
+}
+
+// lokiLabels returns labels of streams. Loki requires at least one label.
+func lokiLabels(loki *sidecarinjectorv1alpha1.LokiOutputSpec) map[string]string {
+	if len(loki.Labels) == 0 {
+		return map[string]string{"job": "fluentd-sidecar-injector"}
+	}
+	return loki.Labels
+}
+
+// outputName returns the name of the output, which is used for the directory of the buffer.
+func outputName(output *sidecarinjectorv1alpha1.OutputSpec) string {
+	if output == nil {
+		return sidecarinjectorv1alpha1.OutputForward
+	}
+	return output.Type
+}
@@ -0,0 +1,187 @@
+package sidecarinjector
+
+import (
+	"strings"
+	"testing"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestDirectOutput(t *testing.T) {
+	cases := []struct {
+		title  string
+		output *sidecarinjectorv1alpha1.OutputSpec
+		direct bool
+		valid  bool
+	}{
+		{"no output", nil, false, true},
+		{"forward", &sidecarinjectorv1alpha1.OutputSpec{Type: sidecarinjectorv1alpha1.OutputForward}, false, true},
+		{"stdout", &sidecarinjectorv1alpha1.OutputSpec{Type: sidecarinjectorv1alpha1.OutputStdout}, true, true},
+		{"opensearch without opensearch", &sidecarinjectorv1alpha1.OutputSpec{Type: sidecarinjectorv1alpha1.OutputOpenSearch, Elasticsearch: &sidecarinjectorv1alpha1.SearchOutputSpec{Host: "es.local"}}, false, false},
+		{"loki without scheme", &sidecarinjectorv1alpha1.OutputSpec{Type: sidecarinjectorv1alpha1.OutputLoki, Loki: &sidecarinjectorv1alpha1.LokiOutputSpec{URL: "loki:3100"}}, false, false},
+		{"loki with the push path", &sidecarinjectorv1alpha1.OutputSpec{Type: sidecarinjectorv1alpha1.OutputLoki, Loki: &sidecarinjectorv1alpha1.LokiOutputSpec{URL: "http://loki:3100/loki/api/v1/push"}}, false, false},
+		{"loki with a path prefix", &sidecarinjectorv1alpha1.OutputSpec{Type: sidecarinjectorv1alpha1.OutputLoki, Loki: &sidecarinjectorv1alpha1.LokiOutputSpec{URL: "http://gateway/loki"}}, true, true},
+		{"s3 without bucket", &sidecarinjectorv1alpha1.OutputSpec{Type: sidecarinjectorv1alpha1.OutputS3, S3: &sidecarinjectorv1alpha1.S3OutputSpec{}}, false, false},
+		{"kafka without topic", &sidecarinjectorv1alpha1.OutputSpec{Type: sidecarinjectorv1alpha1.OutputKafka, Kafka: &sidecarinjectorv1alpha1.KafkaOutputSpec{Brokers: []string{"kafka:9092"}}}, false, false},
+		{"http header with a line break", &sidecarinjectorv1alpha1.OutputSpec{Type: sidecarinjectorv1alpha1.OutputHTTP, HTTP: &sidecarinjectorv1alpha1.HTTPOutputSpec{URL: "http://sink.local", Headers: map[string]string{"X-Token": "a\nb"}}}, false, false},
+		{"unknown type", &sidecarinjectorv1alpha1.OutputSpec{Type: "syslog"}, false, false},
+	}
+	for _, c := range cases {
+		output, err := directOutput(c.output)
+		if c.valid != (err == nil) {
+			t.Errorf("Validation of %s is not matched: %v", c.title, err)
+		}
+		if c.direct != (output != nil) {
+			t.Errorf("%s should be direct: %v", c.title, c.direct)
+		}
+	}
+}
+
+func TestRenderDirectOutputs(t *testing.T) {
+	sources := []LogSource{{Path: "/var/log/app/app.log", Parser: ParserJSON, Tag: "app"}}
+	cases := []struct {
+		output    sidecarinjectorv1alpha1.OutputSpec
+		fluentd   []string
+		fluentBit []string
+	}{
+		{
+			sidecarinjectorv1alpha1.OutputSpec{Type: sidecarinjectorv1alpha1.OutputStdout},
+			[]string{"<match **>\n  @type stdout\n"},
+			[]string{"[OUTPUT]\n    Name stdout\n    Match *\n    Format json_lines\n"},
+		},
+		{
+			sidecarinjectorv1alpha1.OutputSpec{Type: sidecarinjectorv1alpha1.OutputElasticsearch, CredentialsSecretName: "es-user", Elasticsearch: &sidecarinjectorv1alpha1.SearchOutputSpec{Host: "es.logging.svc", TLS: true}},
+			[]string{"  @type elasticsearch\n  host es.logging.svc\n  port 9200\n  scheme https\n  index_name fluentd\n  user \"#{ENV['OUTPUT_USERNAME']}\"\n"},
+			[]string{"    Name es\n    Match *\n    Host es.logging.svc\n    Port 9200\n    Index fluentd\n    Suppress_Type_Name On\n    tls On\n    HTTP_User ${OUTPUT_USERNAME}\n"},
+		},
+		{
+			sidecarinjectorv1alpha1.OutputSpec{Type: sidecarinjectorv1alpha1.OutputOpenSearch, OpenSearch: &sidecarinjectorv1alpha1.SearchOutputSpec{Host: "opensearch.logging.svc", Port: 9201, Index: "app"}},
+			[]string{"  @type opensearch\n  host opensearch.logging.svc\n  port 9201\n  index_name app\n"},
+			[]string{"    Name opensearch\n    Match *\n    Host opensearch.logging.svc\n    Port 9201\n    Index app\n"},
+		},
+		{
+			sidecarinjectorv1alpha1.OutputSpec{Type: sidecarinjectorv1alpha1.OutputLoki, Loki: &sidecarinjectorv1alpha1.LokiOutputSpec{URL: "https://loki.example.com", Labels: map[string]string{"team": "a", "env": "prod"}, TenantID: "team-a"}},
+			[]string{"  @type loki\n  url https://loki.example.com\n  extra_labels {\"env\":\"prod\",\"team\":\"a\"}\n  tenant team-a\n"},
+			[]string{"    Name loki\n    Match *\n    Host loki.example.com\n    Port 443\n    tls On\n    Labels env=prod, team=a\n    Tenant_ID team-a\n"},
+		},
+		{
+			sidecarinjectorv1alpha1.OutputSpec{Type: sidecarinjectorv1alpha1.OutputLoki, Loki: &sidecarinjectorv1alpha1.LokiOutputSpec{URL: "http://gateway.monitoring.svc/loki/"}},
+			[]string{"  @type loki\n  url http://gateway.monitoring.svc/loki\n"},
+			[]string{"    Name loki\n    Match *\n    Host gateway.monitoring.svc\n    Port 80\n    Uri /loki/loki/api/v1/push\n"},
+		},
+		{
+			sidecarinjectorv1alpha1.OutputSpec{Type: sidecarinjectorv1alpha1.OutputS3, CredentialsSecretName: "minio", S3: &sidecarinjectorv1alpha1.S3OutputSpec{Bucket: "logs", Endpoint: "http://minio.minio.svc:9000", PathPrefix: "/app/"}},
+			[]string{"  @type s3\n  s3_bucket logs\n  s3_region us-east-1\n  s3_endpoint http://minio.minio.svc:9000\n  force_path_style true\n  path app/\n"},
+			[]string{"    Name s3\n    Match *\n    bucket logs\n    region us-east-1\n    endpoint http://minio.minio.svc:9000\n    use_put_object On\n    s3_key_format /app/$TAG/%Y/%m/%d/%H/%M/%S\n"},
+		},
+		{
+			sidecarinjectorv1alpha1.OutputSpec{Type: sidecarinjectorv1alpha1.OutputKafka, CredentialsSecretName: "kafka-user", Kafka: &sidecarinjectorv1alpha1.KafkaOutputSpec{Brokers: []string{"kafka-0:9092", "kafka-1:9092"}, Topic: "logs", TLS: true}},
+			[]string{"  @type kafka2\n  brokers kafka-0:9092,kafka-1:9092\n  default_topic logs\n  username \"#{ENV['OUTPUT_USERNAME']}\"\n  password \"#{ENV['OUTPUT_PASSWORD']}\"\n  sasl_over_ssl true\n"},
+			[]string{"    Name kafka\n    Match *\n    Brokers kafka-0:9092,kafka-1:9092\n    Topics logs\n    Format json\n    rdkafka.security.protocol SASL_SSL\n    rdkafka.sasl.mechanism PLAIN\n"},
+		},
+	}
+	for _, c := range cases {
+		output := sourcesOutput{backend: &c.output, buffer: &sidecarBuffer{path: "/buffer"}}
+		config := renderFluentDSources(sources, output)["fluent.conf"]
+		for _, expected := range append(c.fluentd, "  <buffer>\n    @type file\n    path /buffer/"+c.output.Type+"\n") {
+			if !strings.Contains(config, expected) {
+				t.Errorf("Config of %s does not contain %q:\n%s", c.output.Type, expected, config)
+			}
+		}
+		config = renderFluentBitSources(sources, output)["fluent-bit.conf"]
+		for _, expected := range append(c.fluentBit, "    Retry_Limit no_limits\n") {
+			if !strings.Contains(config, expected) {
+				t.Errorf("Config of %s does not contain %q:\n%s", c.output.Type, expected, config)
+			}
+		}
+		if strings.Contains(config, "AGGREGATOR_HOST") {
+			t.Errorf("Config of %s should not use the aggregator:\n%s", c.output.Type, config)
+		}
+	}
+}
+
+func TestInjectWithHTTPOutput(t *testing.T) {
+	pod := newTestPod(map[string]string{
+		annotationPrefix + "/collector": "fluent-bit",
+		annotationPrefix + "/tls":       "true",
+	})
+	delete(pod.Annotations, annotationPrefix+"/aggregator-host")
+	defaults := &sidecarinjectorv1alpha1.SidecarInjectorPolicySpec{
+		Output: &sidecarinjectorv1alpha1.OutputSpec{
+			Type:                  sidecarinjectorv1alpha1.OutputHTTP,
+			CredentialsSecretName: "sink-user",
+			HTTP: &sidecarinjectorv1alpha1.HTTPOutputSpec{
+				URL:     "http://sink.logging.svc:8080/ingest?source=sidecar",
+				Headers: map[string]string{"X-Source": "sidecar"},
+			},
+		},
+	}
+
+	result, err := sidecarInjectMutator(pod, defaults, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "/tls is ignored, because the output type is http") {
+		t.Errorf("Warnings are not matched: %v", result.Warnings)
+	}
+	sidecar := findSidecar(pod)
+	if env := findEnv(sidecar.Env, "AGGREGATOR_HOST"); env != nil {
+		t.Errorf("AGGREGATOR_HOST should not be set: %#v", env)
+	}
+	if env := findEnv(sidecar.Env, "TLS_ENABLED"); env != nil {
+		t.Errorf("Forward security should not be configured: %#v", env)
+	}
+	if env := findEnv(sidecar.Env, "OUTPUT_PASSWORD"); env == nil || env.ValueFrom.SecretKeyRef.Name != "sink-user" || env.ValueFrom.SecretKeyRef.Key != corev1.BasicAuthPasswordKey {
+		t.Errorf("OUTPUT_PASSWORD is not matched: %#v", env)
+	}
+	config := pod.Annotations[annotationPrefix+"/sources-config"]
+	for _, expected := range []string{
+		"[INPUT]\n    Name tail\n    Path /var/log/nginx/*.log\n",
+		"    Name http\n    Match *\n    Host sink.logging.svc\n    Port 8080\n    URI /ingest?source=sidecar\n    Format json\n",
+		"    HTTP_User ${OUTPUT_USERNAME}\n    HTTP_Passwd ${OUTPUT_PASSWORD}\n    Header X-Source sidecar\n",
+	} {
+		if !strings.Contains(config, expected) {
+			t.Errorf("Config does not contain %q:\n%s", expected, config)
+		}
+	}
+}
+
+func TestInjectFluentDWithS3Output(t *testing.T) {
+	pod := newTestPod(map[string]string{})
+	delete(pod.Annotations, annotationPrefix+"/aggregator-host")
+	defaults := resolveDefaults(&sidecarinjectorv1alpha1.SidecarInjectorSpec{
+		Collector: "fluentd",
+		Output: &sidecarinjectorv1alpha1.OutputSpec{
+			Type:                  sidecarinjectorv1alpha1.OutputS3,
+			CredentialsSecretName: "minio",
+			S3:                    &sidecarinjectorv1alpha1.S3OutputSpec{Bucket: "logs", Endpoint: "http://minio.minio.svc:9000"},
+		},
+	}, nil)
+
+	if _, err := sidecarInjectMutator(pod, defaults, false); err != nil {
+		t.Fatal(err)
+	}
+	sidecar := findSidecar(pod)
+	for name, key := range map[string]string{"AWS_ACCESS_KEY_ID": "access_key_id", "AWS_SECRET_ACCESS_KEY": "secret_access_key"} {
+		if env := findEnv(sidecar.Env, name); env == nil || env.ValueFrom.SecretKeyRef.Name != "minio" || env.ValueFrom.SecretKeyRef.Key != key {
+			t.Errorf("%s is not matched: %#v", name, env)
+		}
+	}
+	config := pod.Annotations[annotationPrefix+"/sources-config"]
+	for _, expected := range []string{
+		"  path /var/log/nginx/*.log\n",
+		"  <parse>\n    @type json\n    time_key time\n",
+		"  s3_endpoint http://minio.minio.svc:9000\n",
+	} {
+		if !strings.Contains(config, expected) {
+			t.Errorf("Config does not contain %q:\n%s", expected, config)
+		}
+	}
+
+	pod = newTestPod(map[string]string{})
+	defaults.Output.S3.Endpoint = "minio:9000"
+	if _, err := sidecarInjectMutator(pod, defaults, false); err == nil {
+		t.Error("Invalid output should be rejected")
+	}
+}
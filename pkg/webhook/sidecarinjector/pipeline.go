@@ -0,0 +1,65 @@
+package sidecarinjector
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/h3poteto/fluentd-sidecar-injector/pkg/pipeline"
+	corev1 "k8s.io/api/core/v1"
+	klog "k8s.io/klog/v2"
+)
+
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+
+// ConfigVolumeName is a volume of the ConfigMap which is rendered from the pipeline of the SidecarInjector.
+const ConfigVolumeName = "fluentd-sidecar-injector-config"
+
+// mountPipelineConfig mounts the ConfigMap of the pipeline to the sidecar, so the sidecar reads the configuration instead of the one in the image.
+// It is skipped when the SidecarInjector does not have a pipeline, the pod specifies its own configuration with config-volume,
+// or the configuration is rendered by the webhook, e.g. from log-sources or the output.
+// It is also skipped when the ConfigMap is not published to the namespace yet, because the pod can not start without it. It returns a warning in that case.
+func (i *Injector) mountPipelineConfig(pod *corev1.Pod, namespace, collector string) string {
+	spec := i.SidecarInjectorSpec()
+	if i.name == "" || spec == nil || spec.Pipeline == nil {
+		return ""
+	}
+	if _, ok := pod.Annotations[annotationPrefix+"/config-volume"]; ok {
+		return ""
+	}
+	sidecar := findSidecar(pod)
+	if sidecar == nil || slices.ContainsFunc(sidecar.VolumeMounts, func(m corev1.VolumeMount) bool { return m.Name == SourcesVolumeName }) {
+		return ""
+	}
+	name := pipeline.ConfigMapName(i.name)
+	if i.configMapLister != nil {
+		if _, err := i.configMapLister.ConfigMaps(namespace).Get(name); err != nil {
+			klog.Warningf("Failed to get ConfigMap %s/%s of the pipeline: %v", namespace, name, err)
+			return fmt.Sprintf("ConfigMap %s of the pipeline does not exist in %s, so the configuration of the image is used", name, namespace)
+		}
+	}
+	var items []corev1.KeyToPath
+	for _, key := range pipeline.Keys(collector) {
+		items = append(items, corev1.KeyToPath{Key: key, Path: key})
+	}
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: ConfigVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: name,
+				},
+				Items: items,
+			},
+		},
+	})
+	mountPath := "/fluentd/etc"
+	if collector == "fluent-bit" {
+		mountPath = "/fluent-bit/etc"
+	}
+	sidecar.VolumeMounts = append(sidecar.VolumeMounts, corev1.VolumeMount{
+		Name:      ConfigVolumeName,
+		ReadOnly:  true,
+		MountPath: mountPath,
+	})
+	return ""
+}
@@ -0,0 +1,125 @@
+package sidecarinjector
+
+import (
+	"strings"
+	"testing"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	"github.com/h3poteto/fluentd-sidecar-injector/pkg/pipeline"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+var testPipelineSpec = sidecarinjectorv1alpha1.SidecarInjectorSpec{
+	Collector: "fluentd",
+	Pipeline: &sidecarinjectorv1alpha1.PipelineSpec{
+		Outputs: []sidecarinjectorv1alpha1.PipelinePlugin{{Type: "stdout"}},
+	},
+}
+
+func TestMountPipelineConfig(t *testing.T) {
+	injector := NewInjector("my-injector", nil, nil, nil, nil)
+	injector.SetSidecarInjectorSpec(testPipelineSpec.DeepCopy())
+	pod := newTestPod(map[string]string{
+		annotationPrefix + "/collector": "fluent-bit",
+	})
+	result, err := sidecarInjectMutator(pod, resolveDefaults(injector.SidecarInjectorSpec(), nil), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	injector.mountPipelineConfig(pod, "default", result.Collector)
+
+	volume := findVolume(pod.Spec.Volumes, ConfigVolumeName)
+	if volume == nil || volume.ConfigMap == nil {
+		t.Fatalf("ConfigMap volume is not added: %#v", pod.Spec.Volumes)
+	}
+	if volume.ConfigMap.Name != pipeline.ConfigMapName("my-injector") {
+		t.Errorf("ConfigMap name is not matched: %s", volume.ConfigMap.Name)
+	}
+	if len(volume.ConfigMap.Items) != 2 || volume.ConfigMap.Items[0].Key != pipeline.FluentBitConfigKey {
+		t.Errorf("ConfigMap items are not matched: %#v", volume.ConfigMap.Items)
+	}
+	if mount := findMount(findSidecar(pod).VolumeMounts, ConfigVolumeName); mount.MountPath != "/fluent-bit/etc" || !mount.ReadOnly {
+		t.Errorf("Volume mount is not matched: %#v", mount)
+	}
+
+	removeInjection(pod)
+	if volume := findVolume(pod.Spec.Volumes, ConfigVolumeName); volume != nil {
+		t.Errorf("ConfigMap volume should be removed: %#v", pod.Spec.Volumes)
+	}
+}
+
+func TestMountPipelineConfigWithConfigVolume(t *testing.T) {
+	injector := NewInjector("my-injector", nil, nil, nil, nil)
+	injector.SetSidecarInjectorSpec(testPipelineSpec.DeepCopy())
+	pod := newTestPod(map[string]string{
+		annotationPrefix + "/config-volume": "my-config",
+	})
+	injector.mountPipelineConfig(pod, "default", "fluentd")
+	if volume := findVolume(pod.Spec.Volumes, ConfigVolumeName); volume != nil {
+		t.Errorf("ConfigMap volume should not be added with config-volume: %#v", pod.Spec.Volumes)
+	}
+
+	injector.SetSidecarInjectorSpec(&sidecarinjectorv1alpha1.SidecarInjectorSpec{})
+	pod = newTestPod(map[string]string{})
+	if _, err := sidecarInjectMutator(pod, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	injector.mountPipelineConfig(pod, "default", "fluentd")
+	if volume := findVolume(pod.Spec.Volumes, ConfigVolumeName); volume != nil {
+		t.Errorf("ConfigMap volume should not be added without pipeline: %#v", pod.Spec.Volumes)
+	}
+}
+
+func TestMountPipelineConfigWithOutput(t *testing.T) {
+	injector := NewInjector("my-injector", nil, nil, nil, nil)
+	injector.SetSidecarInjectorSpec(testPipelineSpec.DeepCopy())
+	spec := injector.SidecarInjectorSpec().DeepCopy()
+	spec.Output = &sidecarinjectorv1alpha1.OutputSpec{Type: sidecarinjectorv1alpha1.OutputStdout}
+	injector.SetSidecarInjectorSpec(spec)
+	pod := newTestPod(map[string]string{})
+	result, err := sidecarInjectMutator(pod, resolveDefaults(injector.SidecarInjectorSpec(), nil), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	injector.mountPipelineConfig(pod, "default", result.Collector)
+	if volume := findVolume(pod.Spec.Volumes, ConfigVolumeName); volume != nil {
+		t.Errorf("ConfigMap volume should not be added with the rendered configuration: %#v", pod.Spec.Volumes)
+	}
+}
+
+func TestMountPipelineConfigWithoutConfigMap(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	if err := indexer.Add(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pipeline.ConfigMapName("my-injector"),
+			Namespace: "team-a",
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	injector := NewInjector("my-injector", nil, nil, nil, corelisters.NewConfigMapLister(indexer))
+	injector.SetSidecarInjectorSpec(testPipelineSpec.DeepCopy())
+
+	pod := newTestPod(map[string]string{})
+	if _, err := sidecarInjectMutator(pod, resolveDefaults(injector.SidecarInjectorSpec(), nil), false); err != nil {
+		t.Fatal(err)
+	}
+	if warning := injector.mountPipelineConfig(pod, "team-a", "fluentd"); warning != "" || findVolume(pod.Spec.Volumes, ConfigVolumeName) == nil {
+		t.Errorf("ConfigMap volume should be added: %s", warning)
+	}
+
+	pod = newTestPod(map[string]string{})
+	if _, err := sidecarInjectMutator(pod, resolveDefaults(injector.SidecarInjectorSpec(), nil), false); err != nil {
+		t.Fatal(err)
+	}
+	warning := injector.mountPipelineConfig(pod, "team-b", "fluentd")
+	if !strings.Contains(warning, "does not exist in team-b") {
+		t.Errorf("Warning is not matched: %s", warning)
+	}
+	if volume := findVolume(pod.Spec.Volumes, ConfigVolumeName); volume != nil {
+		t.Errorf("ConfigMap volume should not be added without the ConfigMap: %#v", pod.Spec.Volumes)
+	}
+}
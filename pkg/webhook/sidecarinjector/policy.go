@@ -0,0 +1,260 @@
+package sidecarinjector
+
+import (
+	"fmt"
+	"sort"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	listers "github.com/h3poteto/fluentd-sidecar-injector/pkg/client/listers/sidecarinjectorcontroller/v1alpha1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/utils/ptr"
+)
+
+// namespacePolicy merges all SidecarInjectorPolicies in the namespace.
+// Policies are applied in alphabetical order of their names, so a later policy overrides an earlier one.
+// It returns nil when the namespace does not have any policies.
+func namespacePolicy(lister listers.SidecarInjectorPolicyLister, namespace string) (*sidecarinjectorv1alpha1.SidecarInjectorPolicySpec, error) {
+	if lister == nil || namespace == "" {
+		return nil, nil
+	}
+	policies, err := lister.SidecarInjectorPolicies(namespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) == 0 {
+		return nil, nil
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].Name < policies[j].Name
+	})
+
+	merged := &sidecarinjectorv1alpha1.SidecarInjectorPolicySpec{}
+	for _, policy := range policies {
+		mergePolicySpec(merged, &policy.Spec)
+	}
+	return merged, nil
+}
+
+// resolveDefaults merges the SidecarInjector spec and the namespace policy, and the policy takes precedence.
+// Both of them can be nil.
+func resolveDefaults(spec *sidecarinjectorv1alpha1.SidecarInjectorSpec, policy *sidecarinjectorv1alpha1.SidecarInjectorPolicySpec) *sidecarinjectorv1alpha1.SidecarInjectorPolicySpec {
+	defaults := &sidecarinjectorv1alpha1.SidecarInjectorPolicySpec{}
+	if spec != nil {
+		mergePolicySpec(defaults, &sidecarinjectorv1alpha1.SidecarInjectorPolicySpec{
+			Collector:         spec.Collector,
+			FluentD:           spec.FluentD,
+			FluentBit:         spec.FluentBit,
+			OtelCollector:     spec.OtelCollector,
+			NativeSidecar:     spec.NativeSidecar,
+			StrictAnnotations: spec.StrictAnnotations,
+			Output:            spec.Output,
+		})
+	}
+	if policy != nil {
+		mergePolicySpec(defaults, policy)
+	}
+	return defaults
+}
+
+func mergePolicySpec(dst, src *sidecarinjectorv1alpha1.SidecarInjectorPolicySpec) {
+	if src.Collector != "" {
+		dst.Collector = src.Collector
+	}
+	if src.NativeSidecar != nil {
+		dst.NativeSidecar = ptr.To(*src.NativeSidecar)
+	}
+	if src.StrictAnnotations != nil {
+		dst.StrictAnnotations = ptr.To(*src.StrictAnnotations)
+	}
+	// Output is replaced as a whole, because fields of different types do not work together.
+	if src.Output != nil {
+		dst.Output = src.Output.DeepCopy()
+	}
+	if src.FluentD != nil {
+		if dst.FluentD == nil {
+			dst.FluentD = &sidecarinjectorv1alpha1.FluentDSpec{}
+		}
+		mergeFluentDSpec(dst.FluentD, src.FluentD)
+	}
+	if src.FluentBit != nil {
+		if dst.FluentBit == nil {
+			dst.FluentBit = &sidecarinjectorv1alpha1.FluentBitSpec{}
+		}
+		mergeFluentBitSpec(dst.FluentBit, src.FluentBit)
+	}
+	if src.OtelCollector != nil {
+		if dst.OtelCollector == nil {
+			dst.OtelCollector = &sidecarinjectorv1alpha1.OtelCollectorSpec{}
+		}
+		mergeOtelCollectorSpec(dst.OtelCollector, src.OtelCollector)
+	}
+}
+
+func mergeFluentDSpec(dst, src *sidecarinjectorv1alpha1.FluentDSpec) {
+	if src.DockerImage != "" {
+		dst.DockerImage = src.DockerImage
+	}
+	// A single aggregator host of the later level wins over aggregators of the earlier level.
+	if src.AggregatorHost != "" {
+		dst.AggregatorHost = src.AggregatorHost
+		dst.Aggregators = nil
+	}
+	if src.AggregatorPort != 0 {
+		dst.AggregatorPort = src.AggregatorPort
+	}
+	if len(src.Aggregators) > 0 {
+		dst.Aggregators = append([]sidecarinjectorv1alpha1.AggregatorServer{}, src.Aggregators...)
+	}
+	if src.ApplicationLogDir != "" {
+		dst.ApplicationLogDir = src.ApplicationLogDir
+	}
+	if src.TagPrefix != "" {
+		dst.TagPrefix = src.TagPrefix
+	}
+	if src.TimeKey != "" {
+		dst.TimeKey = src.TimeKey
+	}
+	if src.TimeFormat != "" {
+		dst.TimeFormat = src.TimeFormat
+	}
+	if src.CustomEnv != "" {
+		dst.CustomEnv = src.CustomEnv
+	}
+	// Security is replaced as a whole, because Secrets of different levels do not work together.
+	if src.Security != nil {
+		dst.Security = src.Security.DeepCopy()
+	}
+}
+
+func mergeFluentBitSpec(dst, src *sidecarinjectorv1alpha1.FluentBitSpec) {
+	if src.DockerImage != "" {
+		dst.DockerImage = src.DockerImage
+	}
+	// A single aggregator host of the later level wins over aggregators of the earlier level.
+	if src.AggregatorHost != "" {
+		dst.AggregatorHost = src.AggregatorHost
+		dst.Aggregators = nil
+	}
+	if src.AggregatorPort != 0 {
+		dst.AggregatorPort = src.AggregatorPort
+	}
+	if len(src.Aggregators) > 0 {
+		dst.Aggregators = append([]sidecarinjectorv1alpha1.AggregatorServer{}, src.Aggregators...)
+	}
+	if src.ApplicationLogDir != "" {
+		dst.ApplicationLogDir = src.ApplicationLogDir
+	}
+	if src.TagPrefix != "" {
+		dst.TagPrefix = src.TagPrefix
+	}
+	if src.CustomEnv != "" {
+		dst.CustomEnv = src.CustomEnv
+	}
+	// Security is replaced as a whole, because Secrets of different levels do not work together.
+	if src.Security != nil {
+		dst.Security = src.Security.DeepCopy()
+	}
+}
+
+func mergeOtelCollectorSpec(dst, src *sidecarinjectorv1alpha1.OtelCollectorSpec) {
+	if src.DockerImage != "" {
+		dst.DockerImage = src.DockerImage
+	}
+	// The endpoint and its protocol and TLS are replaced together, because they depend on each other.
+	if src.Endpoint != "" {
+		dst.Endpoint = src.Endpoint
+		dst.Protocol = src.Protocol
+		dst.Insecure = src.Insecure
+	}
+	if src.ApplicationLogDir != "" {
+		dst.ApplicationLogDir = src.ApplicationLogDir
+	}
+	if src.TagPrefix != "" {
+		dst.TagPrefix = src.TagPrefix
+	}
+	if src.CustomEnv != "" {
+		dst.CustomEnv = src.CustomEnv
+	}
+}
+
+// applyFluentDSpec overrides fluentd environment variables with the non-empty fields of the spec.
+func applyFluentDSpec(env *FluentDEnv, spec *sidecarinjectorv1alpha1.FluentDSpec) {
+	if spec == nil {
+		return
+	}
+	if spec.DockerImage != "" {
+		env.DockerImage = spec.DockerImage
+	}
+	if spec.AggregatorHost != "" {
+		env.AggregatorHost = spec.AggregatorHost
+	}
+	if spec.AggregatorPort != 0 {
+		env.AggregatorPort = fmt.Sprintf("%d", spec.AggregatorPort)
+	}
+	if spec.ApplicationLogDir != "" {
+		env.ApplicationLogDir = spec.ApplicationLogDir
+	}
+	if spec.TagPrefix != "" {
+		env.TagPrefix = spec.TagPrefix
+	}
+	if spec.TimeKey != "" {
+		env.TimeKey = spec.TimeKey
+	}
+	if spec.TimeFormat != "" {
+		env.TimeFormat = spec.TimeFormat
+	}
+	if spec.CustomEnv != "" {
+		env.CustomEnv = spec.CustomEnv
+	}
+}
+
+// applyFluentBitSpec overrides fluent-bit environment variables with the non-empty fields of the spec.
+func applyFluentBitSpec(env *FluentBitEnv, spec *sidecarinjectorv1alpha1.FluentBitSpec) {
+	if spec == nil {
+		return
+	}
+	if spec.DockerImage != "" {
+		env.DockerImage = spec.DockerImage
+	}
+	if spec.AggregatorHost != "" {
+		env.AggregatorHost = spec.AggregatorHost
+	}
+	if spec.AggregatorPort != 0 {
+		env.AggregatorPort = fmt.Sprintf("%d", spec.AggregatorPort)
+	}
+	if spec.ApplicationLogDir != "" {
+		env.ApplicationLogDir = spec.ApplicationLogDir
+	}
+	if spec.TagPrefix != "" {
+		env.TagPrefix = spec.TagPrefix
+	}
+	if spec.CustomEnv != "" {
+		env.CustomEnv = spec.CustomEnv
+	}
+}
+
+// applyOtelCollectorSpec overrides otel-collector environment variables with the non-empty fields of the spec.
+func applyOtelCollectorSpec(env *OtelCollectorEnv, spec *sidecarinjectorv1alpha1.OtelCollectorSpec) {
+	if spec == nil {
+		return
+	}
+	if spec.DockerImage != "" {
+		env.DockerImage = spec.DockerImage
+	}
+	if spec.Endpoint != "" {
+		env.OTLPEndpoint = spec.Endpoint
+		env.OTLPInsecure = spec.Insecure
+	}
+	if spec.Protocol != "" {
+		env.OTLPProtocol = spec.Protocol
+	}
+	if spec.ApplicationLogDir != "" {
+		env.ApplicationLogDir = spec.ApplicationLogDir
+	}
+	if spec.TagPrefix != "" {
+		env.TagPrefix = spec.TagPrefix
+	}
+	if spec.CustomEnv != "" {
+		env.CustomEnv = spec.CustomEnv
+	}
+}
@@ -0,0 +1,170 @@
+package sidecarinjector
+
+import (
+	"testing"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	listers "github.com/h3poteto/fluentd-sidecar-injector/pkg/client/listers/sidecarinjectorcontroller/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newPolicyLister(t *testing.T, policies ...*sidecarinjectorv1alpha1.SidecarInjectorPolicy) listers.SidecarInjectorPolicyLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, policy := range policies {
+		if err := indexer.Add(policy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return listers.NewSidecarInjectorPolicyLister(indexer)
+}
+
+func TestNamespacePolicy(t *testing.T) {
+	lister := newPolicyLister(t,
+		&sidecarinjectorv1alpha1.SidecarInjectorPolicy{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "b-policy",
+				Namespace: "team-a",
+			},
+			Spec: sidecarinjectorv1alpha1.SidecarInjectorPolicySpec{
+				FluentD: &sidecarinjectorv1alpha1.FluentDSpec{
+					AggregatorHost: "team-a-aggregator.local",
+				},
+			},
+		},
+		&sidecarinjectorv1alpha1.SidecarInjectorPolicy{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "a-policy",
+				Namespace: "team-a",
+			},
+			Spec: sidecarinjectorv1alpha1.SidecarInjectorPolicySpec{
+				Collector: "fluentd",
+				FluentD: &sidecarinjectorv1alpha1.FluentDSpec{
+					AggregatorHost: "overridden.local",
+					TagPrefix:      "team-a",
+				},
+			},
+		},
+		&sidecarinjectorv1alpha1.SidecarInjectorPolicy{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "policy",
+				Namespace: "team-b",
+			},
+			Spec: sidecarinjectorv1alpha1.SidecarInjectorPolicySpec{
+				Collector: "fluent-bit",
+			},
+		},
+	)
+
+	policy, err := namespacePolicy(lister, "team-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.Collector != "fluentd" {
+		t.Errorf("Collector is not matched: %s", policy.Collector)
+	}
+	if policy.FluentD.AggregatorHost != "team-a-aggregator.local" {
+		t.Errorf("Aggregator host is not matched: %s", policy.FluentD.AggregatorHost)
+	}
+	if policy.FluentD.TagPrefix != "team-a" {
+		t.Errorf("Tag prefix is not matched: %s", policy.FluentD.TagPrefix)
+	}
+	if policy.FluentBit != nil {
+		t.Errorf("FluentBit should be nil: %#v", policy.FluentBit)
+	}
+
+	policy, err = namespacePolicy(lister, "team-c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy != nil {
+		t.Errorf("Policy should be nil: %#v", policy)
+	}
+}
+
+func TestMergeAggregators(t *testing.T) {
+	spec := &sidecarinjectorv1alpha1.FluentDSpec{AggregatorHost: "cluster-aggregator.local"}
+	mergeFluentDSpec(spec, &sidecarinjectorv1alpha1.FluentDSpec{Aggregators: testAggregators})
+	if len(spec.Aggregators) != len(testAggregators) {
+		t.Errorf("Aggregators are not matched: %#v", spec.Aggregators)
+	}
+	mergeFluentDSpec(spec, &sidecarinjectorv1alpha1.FluentDSpec{AggregatorHost: "team-a-aggregator.local"})
+	if spec.Aggregators != nil || spec.AggregatorHost != "team-a-aggregator.local" {
+		t.Errorf("Aggregator host should win over aggregators of the earlier level: %#v", spec)
+	}
+}
+
+func TestInjectWithPolicy(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "",
+			Namespace: "team-a",
+			Annotations: map[string]string{
+				annotationPrefix + "/injection":  "enabled",
+				annotationPrefix + "/tag-prefix": "my-pod",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "nginx",
+					Image: "nginx:latest",
+				},
+			},
+		},
+	}
+	policy := &sidecarinjectorv1alpha1.SidecarInjectorPolicySpec{
+		Collector: "fluent-bit",
+		FluentBit: &sidecarinjectorv1alpha1.FluentBitSpec{
+			AggregatorHost:    "team-a-aggregator.local",
+			AggregatorPort:    24225,
+			ApplicationLogDir: "/var/log/team-a",
+			TagPrefix:         "team-a",
+		},
+	}
+
+	result, err := sidecarInjectMutator(pod, policy, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Mutated == nil {
+		t.Fatal("Could not inject sidecar")
+	}
+	container := findContainer(pod.Spec.Containers, ContainerName)
+	if container == nil {
+		t.Fatalf("Failed to inject sidecar container: %#v", pod.Spec.Containers)
+	}
+	if refreshInterval := findEnv(container.Env, "REFRESH_INTERVAL"); refreshInterval == nil {
+		t.Errorf("Collector in policy is not used: %#v", container.Env)
+	}
+	if aggregatorHost := findEnv(container.Env, "AGGREGATOR_HOST"); aggregatorHost.Value != "team-a-aggregator.local" {
+		t.Errorf("Container env aggregator host is not matched: %v", aggregatorHost)
+	}
+	if aggregatorPort := findEnv(container.Env, "AGGREGATOR_PORT"); aggregatorPort.Value != "24225" {
+		t.Errorf("Container env aggregator port is not matched: %v", aggregatorPort)
+	}
+	if logDir := findEnv(container.Env, "APPLICATION_LOG_DIR"); logDir.Value != "/var/log/team-a" {
+		t.Errorf("Container env log dir is not matched: %v", logDir)
+	}
+	// Pod annotations override the policy.
+	if tagPrefix := findEnv(container.Env, "TAG_PREFIX"); tagPrefix.Value != "my-pod" {
+		t.Errorf("Container env tag prefix is not matched: %v", tagPrefix)
+	}
+}
+
+func TestMergeOtelCollector(t *testing.T) {
+	defaults := resolveDefaults(
+		&sidecarinjectorv1alpha1.SidecarInjectorSpec{
+			OtelCollector: &sidecarinjectorv1alpha1.OtelCollectorSpec{Endpoint: "http://cluster-gateway:4318", Protocol: "http", TagPrefix: "cluster"},
+		},
+		&sidecarinjectorv1alpha1.SidecarInjectorPolicySpec{
+			Collector:     "otel-collector",
+			OtelCollector: &sidecarinjectorv1alpha1.OtelCollectorSpec{Endpoint: "team-a-gateway:4317"},
+		},
+	)
+	spec := defaults.OtelCollector
+	if defaults.Collector != "otel-collector" || spec.Endpoint != "team-a-gateway:4317" || spec.Protocol != "" || spec.TagPrefix != "cluster" {
+		t.Errorf("Merged spec is not matched: %#v", spec)
+	}
+}
@@ -0,0 +1,150 @@
+package sidecarinjector
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Volumes of Secrets for TLS of the forward protocol.
+const (
+	CAVolumeName         = "fluentd-sidecar-injector-ca"
+	ClientCertVolumeName = "fluentd-sidecar-injector-client-cert"
+)
+
+// forwardSecurity is the resolved security of the forward output. Paths are empty if they are not used.
+type forwardSecurity struct {
+	tls       bool
+	verify    bool
+	caFile    string
+	certFile  string
+	keyFile   string
+	sharedKey bool
+	user      bool
+}
+
+// resolveSecurity overrides the security of the spec with annotations. It returns nil if nothing is configured.
+func resolveSecurity(spec *sidecarinjectorv1alpha1.ForwardSecuritySpec, annotations podAnnotations) (*sidecarinjectorv1alpha1.ForwardSecuritySpec, error) {
+	security := &sidecarinjectorv1alpha1.ForwardSecuritySpec{}
+	if spec != nil {
+		security = spec.DeepCopy()
+	}
+	if value, ok := annotations.value("tls"); ok {
+		security.TLS, _ = strconv.ParseBool(value)
+	}
+	if value, ok := annotations.value("tls-verify"); ok {
+		verify, _ := strconv.ParseBool(value)
+		security.TLSVerify = &verify
+	}
+	if value, ok := annotations.value("ca-secret"); ok {
+		security.CASecretName = value
+	}
+	if value, ok := annotations.value("client-cert-secret"); ok {
+		security.ClientCertSecretName = value
+	}
+	if value, ok := annotations.value("shared-key-secret"); ok {
+		security.SharedKeySecretName = value
+	}
+	if value, ok := annotations.value("user-secret"); ok {
+		security.UserSecretName = value
+	}
+
+	if !security.TLS && (security.CASecretName != "" || security.ClientCertSecretName != "") {
+		return nil, fmt.Errorf("tls is required for the CA and the client certificate")
+	}
+	if security.UserSecretName != "" && security.SharedKeySecretName == "" {
+		return nil, fmt.Errorf("shared key is required for username and password")
+	}
+	if !security.TLS && security.SharedKeySecretName == "" {
+		return nil, nil
+	}
+	return security, nil
+}
+
+// configureSecurity mounts Secrets of TLS to the sidecar, and sets the configuration to environment variables.
+// The shared key, the username and the password are read from Secrets as environment variables, so they are not written in the pod.
+func configureSecurity(pod *corev1.Pod, sidecar *corev1.Container, spec *sidecarinjectorv1alpha1.ForwardSecuritySpec, annotations podAnnotations, collector string) (*forwardSecurity, error) {
+	resolved, err := resolveSecurity(spec, annotations)
+	if err != nil || resolved == nil {
+		return nil, err
+	}
+	secretsDir := "/fluentd/secrets"
+	if collector == "fluent-bit" {
+		secretsDir = "/fluent-bit/secrets"
+	}
+
+	security := &forwardSecurity{
+		tls:       resolved.TLS,
+		verify:    resolved.TLSVerify == nil || *resolved.TLSVerify,
+		sharedKey: resolved.SharedKeySecretName != "",
+		user:      resolved.UserSecretName != "",
+	}
+	if security.tls {
+		sidecar.Env = append(sidecar.Env,
+			corev1.EnvVar{Name: "TLS_ENABLED", Value: "true"},
+			corev1.EnvVar{Name: "TLS_VERIFY", Value: strconv.FormatBool(security.verify)},
+		)
+	}
+	if resolved.CASecretName != "" {
+		dir := path.Join(secretsDir, "ca")
+		mountSecret(pod, sidecar, CAVolumeName, resolved.CASecretName, dir, sidecarinjectorv1alpha1.ForwardCAKey)
+		security.caFile = path.Join(dir, sidecarinjectorv1alpha1.ForwardCAKey)
+		sidecar.Env = append(sidecar.Env, corev1.EnvVar{Name: "TLS_CA_FILE", Value: security.caFile})
+	}
+	if resolved.ClientCertSecretName != "" {
+		dir := path.Join(secretsDir, "client")
+		mountSecret(pod, sidecar, ClientCertVolumeName, resolved.ClientCertSecretName, dir, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+		security.certFile = path.Join(dir, corev1.TLSCertKey)
+		security.keyFile = path.Join(dir, corev1.TLSPrivateKeyKey)
+		sidecar.Env = append(sidecar.Env,
+			corev1.EnvVar{Name: "TLS_CERT_FILE", Value: security.certFile},
+			corev1.EnvVar{Name: "TLS_KEY_FILE", Value: security.keyFile},
+		)
+	}
+	if security.sharedKey {
+		sidecar.Env = append(sidecar.Env, secretEnv("SHARED_KEY", resolved.SharedKeySecretName, sidecarinjectorv1alpha1.ForwardSharedKeyKey))
+	}
+	if security.user {
+		sidecar.Env = append(sidecar.Env,
+			secretEnv("AGGREGATOR_USERNAME", resolved.UserSecretName, corev1.BasicAuthUsernameKey),
+			secretEnv("AGGREGATOR_PASSWORD", resolved.UserSecretName, corev1.BasicAuthPasswordKey),
+		)
+	}
+	return security, nil
+}
+
+func mountSecret(pod *corev1.Pod, sidecar *corev1.Container, volumeName, secretName, dir string, keys ...string) {
+	var items []corev1.KeyToPath
+	for _, key := range keys {
+		items = append(items, corev1.KeyToPath{Key: key, Path: key})
+	}
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: volumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: secretName,
+				Items:      items,
+			},
+		},
+	})
+	sidecar.VolumeMounts = append(sidecar.VolumeMounts, corev1.VolumeMount{
+		Name:      volumeName,
+		ReadOnly:  true,
+		MountPath: dir,
+	})
+}
+
+func secretEnv(name, secretName, key string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+				Key:                  key,
+			},
+		},
+	}
+}
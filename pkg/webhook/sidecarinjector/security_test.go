@@ -0,0 +1,141 @@
+package sidecarinjector
+
+import (
+	"strings"
+	"testing"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	"github.com/h3poteto/fluentd-sidecar-injector/pkg/pipeline"
+	"k8s.io/utils/ptr"
+)
+
+func TestInjectWithSecurity(t *testing.T) {
+	pod := newTestPod(map[string]string{
+		annotationPrefix + "/tls-verify":  "false",
+		annotationPrefix + "/user-secret": "aggregator-user",
+	})
+	defaults := &sidecarinjectorv1alpha1.SidecarInjectorPolicySpec{
+		FluentD: &sidecarinjectorv1alpha1.FluentDSpec{
+			Security: &sidecarinjectorv1alpha1.ForwardSecuritySpec{
+				TLS:                  true,
+				CASecretName:         "aggregator-ca",
+				ClientCertSecretName: "client-cert",
+				SharedKeySecretName:  "aggregator-key",
+			},
+		},
+	}
+
+	if _, err := sidecarInjectMutator(pod, defaults, false); err != nil {
+		t.Fatal(err)
+	}
+	sidecar := findSidecar(pod)
+	for name, expected := range map[string]string{
+		"TLS_ENABLED":   "true",
+		"TLS_VERIFY":    "false",
+		"TLS_CA_FILE":   "/fluentd/secrets/ca/ca.crt",
+		"TLS_CERT_FILE": "/fluentd/secrets/client/tls.crt",
+		"TLS_KEY_FILE":  "/fluentd/secrets/client/tls.key",
+	} {
+		if env := findEnv(sidecar.Env, name); env == nil || env.Value != expected {
+			t.Errorf("%s is not matched: %#v", name, env)
+		}
+	}
+	for name, expected := range map[string][2]string{
+		"SHARED_KEY":          {"aggregator-key", "shared_key"},
+		"AGGREGATOR_USERNAME": {"aggregator-user", "username"},
+		"AGGREGATOR_PASSWORD": {"aggregator-user", "password"},
+	} {
+		env := findEnv(sidecar.Env, name)
+		if env == nil || env.ValueFrom == nil || env.ValueFrom.SecretKeyRef.Name != expected[0] || env.ValueFrom.SecretKeyRef.Key != expected[1] {
+			t.Errorf("%s is not matched: %#v", name, env)
+		}
+	}
+	for name, secretName := range map[string]string{CAVolumeName: "aggregator-ca", ClientCertVolumeName: "client-cert"} {
+		volume := findVolume(pod.Spec.Volumes, name)
+		if volume == nil || volume.Secret == nil || volume.Secret.SecretName != secretName {
+			t.Errorf("Volume %s is not matched: %#v", name, volume)
+		}
+		if mount := findMount(sidecar.VolumeMounts, name); mount == nil || !mount.ReadOnly {
+			t.Errorf("Mount %s is not matched: %#v", name, mount)
+		}
+	}
+
+	// The image forwards logs in plaintext, so the configuration is rendered without log-sources.
+	config := pod.Annotations[annotationPrefix+"/sources-config"]
+	for _, expected := range []string{
+		"  path /var/log/nginx/*.log\n",
+		"  transport tls\n",
+		"    shared_key \"#{ENV['SHARED_KEY']}\"\n",
+	} {
+		if !strings.Contains(config, expected) {
+			t.Errorf("Config does not contain %q:\n%s", expected, config)
+		}
+	}
+
+	removeInjection(pod)
+	if findVolume(pod.Spec.Volumes, CAVolumeName) != nil || findVolume(pod.Spec.Volumes, ClientCertVolumeName) != nil {
+		t.Errorf("Failed to remove volumes of secrets: %#v", pod.Spec.Volumes)
+	}
+}
+
+func TestResolveSecurity(t *testing.T) {
+	security, err := resolveSecurity(nil, podAnnotations{})
+	if err != nil || security != nil {
+		t.Errorf("Security should not be configured: %#v, %v", security, err)
+	}
+
+	spec := &sidecarinjectorv1alpha1.ForwardSecuritySpec{TLS: true, TLSVerify: ptr.To(true)}
+	security, err = resolveSecurity(spec, podAnnotations{"tls": "false", "shared-key-secret": "aggregator-key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if security.TLS || security.SharedKeySecretName != "aggregator-key" {
+		t.Errorf("Annotations should override the spec: %#v", security)
+	}
+	if !spec.TLS {
+		t.Error("The spec should not be modified")
+	}
+
+	for _, annotations := range []podAnnotations{
+		{"ca-secret": "aggregator-ca"},
+		{"client-cert-secret": "client-cert"},
+		{"tls": "true", "user-secret": "aggregator-user"},
+	} {
+		if _, err := resolveSecurity(nil, annotations); err == nil {
+			t.Errorf("Security should be rejected: %#v", annotations)
+		}
+	}
+}
+
+func TestRenderSourcesWithSecurity(t *testing.T) {
+	sources := []LogSource{{Path: "/var/log/app/app.log", Parser: ParserJSON, Tag: "app"}}
+	security := &forwardSecurity{
+		tls:       true,
+		verify:    true,
+		caFile:    "/fluentd/secrets/ca/ca.crt",
+		sharedKey: true,
+		user:      true,
+	}
+
+	config := renderFluentDSources(sources, sourcesOutput{security: security})[pipeline.FluentDConfigKey]
+	for _, expected := range []string{
+		"  transport tls\n  tls_cert_path /fluentd/secrets/ca/ca.crt\n",
+		"  <security>\n    self_hostname \"#{ENV['POD_NAME']}\"\n    shared_key \"#{ENV['SHARED_KEY']}\"\n  </security>\n",
+		"    username \"#{ENV['AGGREGATOR_USERNAME']}\"\n",
+	} {
+		if !strings.Contains(config, expected) {
+			t.Errorf("Config does not contain %q:\n%s", expected, config)
+		}
+	}
+	if strings.Contains(config, "tls_insecure_mode") {
+		t.Errorf("Config should verify the aggregator:\n%s", config)
+	}
+
+	security.verify = false
+	config = renderFluentBitSources(sources, sourcesOutput{security: security})[pipeline.FluentBitConfigKey]
+	for _, expected := range []string{"    tls On\n    tls.verify Off\n", "    tls.ca_file /fluentd/secrets/ca/ca.crt\n", "    Shared_Key ${SHARED_KEY}\n", "    Password ${AGGREGATOR_PASSWORD}\n"} {
+		if !strings.Contains(config, expected) {
+			t.Errorf("Config does not contain %q:\n%s", expected, config)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package sidecarinjector
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	defaultShutdownDelay       = 0
+	defaultShutdownFlushPeriod = 30
+	// defaultTerminationGracePeriod is the default of terminationGracePeriodSeconds in Kubernetes.
+	defaultTerminationGracePeriod = 30
+	// ShutdownFileEnv is an environment variable of application containers which has a path of the handshake file.
+	ShutdownFileEnv = "FLUENTD_SIDECAR_SHUTDOWN_FILE"
+	// shutdownDir is a directory for handshake files in the log volume.
+	shutdownDir = ".fluentd-sidecar-injector"
+)
+
+// configureShutdown delays termination of the sidecar, so that it can read logs which are written while application containers are shutting down.
+// It does nothing unless the delay is set. The sidecar waits for the delay in preStop hook, and terminationGracePeriodSeconds of the pod is extended to flush buffers after that.
+// If handshake is enabled, the sidecar stops waiting when all application containers which mount the log volume create handshake files in it.
+func configureShutdown(pod *corev1.Pod, annotations podAnnotations, sidecar *corev1.Container, logDir string) error {
+	delay, ok := annotations.integer("shutdown-delay")
+	if !ok {
+		delay = defaultShutdownDelay
+	}
+	flushPeriod, ok := annotations.integer("shutdown-flush-period")
+	if !ok {
+		flushPeriod = defaultShutdownFlushPeriod
+	}
+
+	if value, _ := annotations.value("shutdown-handshake"); value == "enabled" {
+		if delay == 0 {
+			return fmt.Errorf("shutdown-handshake requires shutdown-delay")
+		}
+		var files []string
+		for i := range pod.Spec.Containers {
+			container := &pod.Spec.Containers[i]
+			mount := logVolumeMount(container)
+			if mount == nil {
+				continue
+			}
+			container.Env = append(container.Env, corev1.EnvVar{
+				Name:  ShutdownFileEnv,
+				Value: path.Join(mount.MountPath, shutdownDir, container.Name),
+			})
+			// The sidecar mounts the whole volume on the log directory, so a subPath is a subdirectory in the sidecar.
+			files = append(files, path.Join(logDir, mount.SubPath, shutdownDir, container.Name))
+		}
+		// Only init containers may write logs, and then there is no container to wait for.
+		if len(files) > 0 {
+			sidecar.Lifecycle = &corev1.Lifecycle{
+				PreStop: &corev1.LifecycleHandler{
+					Exec: &corev1.ExecAction{
+						Command: []string{"sh", "-c", handshakeScript(files, delay)},
+					},
+				},
+			}
+		}
+	} else if delay == 0 {
+		return nil
+	}
+	if sidecar.Lifecycle == nil {
+		// Sleep action requires Kubernetes 1.30 or later, but it does not require any command in the sidecar image.
+		sidecar.Lifecycle = &corev1.Lifecycle{
+			PreStop: &corev1.LifecycleHandler{
+				Sleep: &corev1.SleepAction{
+					Seconds: delay,
+				},
+			},
+		}
+	}
+
+	// The preStop hook consumes the grace period, so the sidecar needs the flush period in addition to it.
+	required := delay + flushPeriod
+	current := int64(defaultTerminationGracePeriod)
+	if pod.Spec.TerminationGracePeriodSeconds != nil {
+		current = *pod.Spec.TerminationGracePeriodSeconds
+	}
+	if current < required {
+		pod.Spec.TerminationGracePeriodSeconds = ptr.To(required)
+	}
+	return nil
+}
+
+func logVolumeMount(container *corev1.Container) *corev1.VolumeMount {
+	for i := range container.VolumeMounts {
+		if container.VolumeMounts[i].Name == VolumeName {
+			return &container.VolumeMounts[i]
+		}
+	}
+	return nil
+}
+
+// handshakeScript waits until all files exist, but it gives up after timeout seconds.
+func handshakeScript(files []string, timeout int64) string {
+	conditions := make([]string, len(files))
+	for i, file := range files {
+		conditions[i] = fmt.Sprintf("[ -f %q ]", file)
+	}
+	return fmt.Sprintf("i=0; while [ $i -lt %d ]; do %s && exit 0; sleep 1; i=$((i+1)); done", timeout, strings.Join(conditions, " && "))
+}
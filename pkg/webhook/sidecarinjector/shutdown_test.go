@@ -0,0 +1,175 @@
+package sidecarinjector
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestConfigureShutdown(t *testing.T) {
+	// Nothing is changed by default.
+	pod := newTestPod(map[string]string{})
+	sidecar := &corev1.Container{Name: ContainerName}
+	annotations, _ := parseAnnotations(pod, "fluentd")
+	if err := configureShutdown(pod, annotations, sidecar, "/var/log/nginx"); err != nil {
+		t.Fatal(err)
+	}
+	if sidecar.Lifecycle != nil {
+		t.Errorf("PreStop hook should not be set: %#v", sidecar.Lifecycle)
+	}
+	if grace := pod.Spec.TerminationGracePeriodSeconds; grace != nil {
+		t.Errorf("TerminationGracePeriodSeconds should not be set: %d", *grace)
+	}
+
+	pod = newTestPod(map[string]string{
+		annotationPrefix + "/shutdown-delay": "5",
+	})
+	sidecar = &corev1.Container{Name: ContainerName}
+	annotations, _ = parseAnnotations(pod, "fluentd")
+	if err := configureShutdown(pod, annotations, sidecar, "/var/log/nginx"); err != nil {
+		t.Fatal(err)
+	}
+	if sidecar.Lifecycle == nil || sidecar.Lifecycle.PreStop == nil || sidecar.Lifecycle.PreStop.Sleep == nil {
+		t.Fatalf("PreStop hook is not matched: %#v", sidecar.Lifecycle)
+	}
+	if seconds := sidecar.Lifecycle.PreStop.Sleep.Seconds; seconds != 5 {
+		t.Errorf("PreStop sleep is not matched: %d", seconds)
+	}
+	if grace := pod.Spec.TerminationGracePeriodSeconds; grace == nil || *grace != 5+defaultShutdownFlushPeriod {
+		t.Errorf("TerminationGracePeriodSeconds is not matched: %v", grace)
+	}
+	if env := findEnv(pod.Spec.Containers[0].Env, ShutdownFileEnv); env != nil {
+		t.Errorf("Handshake file should not be set: %v", env)
+	}
+
+	// The grace period is not shortened.
+	pod = newTestPod(map[string]string{
+		annotationPrefix + "/shutdown-delay":        "10",
+		annotationPrefix + "/shutdown-flush-period": "20",
+	})
+	pod.Spec.TerminationGracePeriodSeconds = ptr.To(int64(60))
+	sidecar = &corev1.Container{Name: ContainerName}
+	annotations, _ = parseAnnotations(pod, "fluentd")
+	if err := configureShutdown(pod, annotations, sidecar, "/var/log/nginx"); err != nil {
+		t.Fatal(err)
+	}
+	if seconds := sidecar.Lifecycle.PreStop.Sleep.Seconds; seconds != 10 {
+		t.Errorf("PreStop sleep is not matched: %d", seconds)
+	}
+	if grace := *pod.Spec.TerminationGracePeriodSeconds; grace != 60 {
+		t.Errorf("TerminationGracePeriodSeconds is not matched: %d", grace)
+	}
+
+	// Malformed values are ignored, because they are returned as warnings.
+	pod = newTestPod(map[string]string{
+		annotationPrefix + "/shutdown-delay": "-1",
+	})
+	annotations, _ = parseAnnotations(pod, "fluentd")
+	sidecar = &corev1.Container{Name: ContainerName}
+	if err := configureShutdown(pod, annotations, sidecar, "/var/log/nginx"); err != nil {
+		t.Fatal(err)
+	}
+	if sidecar.Lifecycle != nil {
+		t.Errorf("PreStop hook should not be set: %#v", sidecar.Lifecycle)
+	}
+}
+
+func TestConfigureShutdownWithHandshake(t *testing.T) {
+	pod := newTestPod(map[string]string{
+		annotationPrefix + "/shutdown-handshake": "enabled",
+		annotationPrefix + "/shutdown-delay":     "60",
+	})
+	pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: "worker", Image: "worker:latest"})
+	mountLogVolume(pod, nil, corev1.VolumeMount{Name: VolumeName, MountPath: "/var/log/nginx"})
+	sidecar := &corev1.Container{Name: ContainerName}
+	annotations, _ := parseAnnotations(pod, "fluentd")
+	if err := configureShutdown(pod, annotations, sidecar, "/var/log/nginx"); err != nil {
+		t.Fatal(err)
+	}
+	for _, container := range pod.Spec.Containers {
+		env := findEnv(container.Env, ShutdownFileEnv)
+		if env == nil || env.Value != "/var/log/nginx/.fluentd-sidecar-injector/"+container.Name {
+			t.Errorf("Handshake file of %s is not matched: %v", container.Name, env)
+		}
+	}
+	if sidecar.Lifecycle == nil || sidecar.Lifecycle.PreStop == nil || sidecar.Lifecycle.PreStop.Exec == nil {
+		t.Fatalf("PreStop hook is not matched: %#v", sidecar.Lifecycle)
+	}
+	script := sidecar.Lifecycle.PreStop.Exec.Command[2]
+	if !strings.Contains(script, `[ -f "/var/log/nginx/.fluentd-sidecar-injector/nginx" ] && [ -f "/var/log/nginx/.fluentd-sidecar-injector/worker" ]`) {
+		t.Errorf("PreStop script does not wait for handshake files: %s", script)
+	}
+	if !strings.Contains(script, "-lt 60") {
+		t.Errorf("PreStop script timeout is not matched: %s", script)
+	}
+	if grace := *pod.Spec.TerminationGracePeriodSeconds; grace != 60+defaultShutdownFlushPeriod {
+		t.Errorf("TerminationGracePeriodSeconds is not matched: %d", grace)
+	}
+
+	// Malformed values are ignored, because they are returned as warnings.
+	pod = newTestPod(map[string]string{
+		annotationPrefix + "/shutdown-handshake": "true",
+		annotationPrefix + "/shutdown-delay":     "5",
+	})
+	annotations, _ = parseAnnotations(pod, "fluentd")
+	sidecar = &corev1.Container{Name: ContainerName}
+	if err := configureShutdown(pod, annotations, sidecar, "/var/log/nginx"); err != nil {
+		t.Fatal(err)
+	}
+	if sleep := sidecar.Lifecycle.PreStop.Sleep; sleep == nil || sleep.Seconds != 5 {
+		t.Errorf("PreStop sleep is not matched: %v", sleep)
+	}
+
+	pod = newTestPod(map[string]string{
+		annotationPrefix + "/shutdown-handshake": "enabled",
+	})
+	annotations, _ = parseAnnotations(pod, "fluentd")
+	if err := configureShutdown(pod, annotations, &corev1.Container{}, "/var/log/nginx"); err == nil {
+		t.Error("Handshake without shutdown-delay should be rejected")
+	}
+}
+
+func TestConfigureShutdownWithLogContainers(t *testing.T) {
+	pod := newTestPod(map[string]string{
+		annotationPrefix + "/shutdown-handshake": "enabled",
+		annotationPrefix + "/shutdown-delay":     "5",
+	})
+	pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: "worker", Image: "worker:latest"})
+	mountLogVolume(pod, map[string]string{"nginx": "/var/log/nginx"}, corev1.VolumeMount{Name: VolumeName, MountPath: "/var/log/app"})
+	sidecar := &corev1.Container{Name: ContainerName}
+	annotations, _ := parseAnnotations(pod, "fluentd")
+	if err := configureShutdown(pod, annotations, sidecar, "/var/log/app"); err != nil {
+		t.Fatal(err)
+	}
+	if env := findEnv(pod.Spec.Containers[0].Env, ShutdownFileEnv); env == nil || env.Value != "/var/log/nginx/.fluentd-sidecar-injector/nginx" {
+		t.Errorf("Handshake file of nginx is not matched: %v", env)
+	}
+	if env := findEnv(pod.Spec.Containers[1].Env, ShutdownFileEnv); env != nil {
+		t.Errorf("Handshake file should not be set to the container without the log volume: %v", env)
+	}
+	script := sidecar.Lifecycle.PreStop.Exec.Command[2]
+	if !strings.Contains(script, `do [ -f "/var/log/app/nginx/.fluentd-sidecar-injector/nginx" ] && exit 0`) {
+		t.Errorf("PreStop script does not wait for the handshake file in the subPath: %s", script)
+	}
+}
+
+func TestConfigureShutdownWithOnlyInitContainers(t *testing.T) {
+	pod := newTestPod(map[string]string{
+		annotationPrefix + "/shutdown-handshake": "enabled",
+		annotationPrefix + "/shutdown-delay":     "5",
+	})
+	mountLogVolume(pod, map[string]string{"setup": "/tmp/logs"}, corev1.VolumeMount{Name: VolumeName, MountPath: "/var/log/app"})
+	sidecar := &corev1.Container{Name: ContainerName}
+	annotations, _ := parseAnnotations(pod, "fluentd")
+	if err := configureShutdown(pod, annotations, sidecar, "/var/log/app"); err != nil {
+		t.Fatal(err)
+	}
+	if sidecar.Lifecycle.PreStop.Exec != nil {
+		t.Errorf("PreStop should not wait for handshake files without containers: %v", sidecar.Lifecycle.PreStop.Exec)
+	}
+	if sleep := sidecar.Lifecycle.PreStop.Sleep; sleep == nil || sleep.Seconds != 5 {
+		t.Errorf("PreStop sleep is not matched: %v", sleep)
+	}
+}
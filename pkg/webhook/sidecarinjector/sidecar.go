@@ -0,0 +1,156 @@
+package sidecarinjector
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// Default ports of monitoring endpoints, which are used for startup probes of native sidecars.
+	fluentDMonitorPort      = 24220
+	fluentBitMonitorPort    = 2020
+	otelCollectorHealthPort = 13133
+)
+
+// sidecarResources returns resources of the sidecar, which are overridden with annotations.
+func sidecarResources(annotations podAnnotations) corev1.ResourceRequirements {
+	resourceRequirements := corev1.ResourceRequirements{
+		Requests: map[corev1.ResourceName]resource.Quantity{
+			corev1.ResourceMemory: *resource.NewQuantity(200*1024*1024, resource.BinarySI),
+			corev1.ResourceCPU:    *resource.NewMilliQuantity(100, resource.DecimalSI),
+		},
+		Limits: map[corev1.ResourceName]resource.Quantity{
+			corev1.ResourceMemory: *resource.NewQuantity(1000*1024*1024, resource.BinarySI),
+		},
+	}
+	if value, ok := annotations.quantity("memory-request"); ok {
+		resourceRequirements.Requests[corev1.ResourceMemory] = value
+	}
+	if value, ok := annotations.quantity("memory-limit"); ok {
+		resourceRequirements.Limits[corev1.ResourceMemory] = value
+	}
+	if value, ok := annotations.quantity("cpu-request"); ok {
+		resourceRequirements.Requests[corev1.ResourceCPU] = value
+	}
+	if value, ok := annotations.quantity("cpu-limit"); ok {
+		resourceRequirements.Limits[corev1.ResourceCPU] = value
+	}
+	return resourceRequirements
+}
+
+// appendSidecar mounts log volumes to containers in the pod, and adds the sidecar to the pod. The first mount is the application log directory.
+// The native-sidecar annotation overrides native. A native sidecar is added to the init containers with restartPolicy Always, so it starts before and stops after the application containers.
+// Otherwise the shutdown of the sidecar is delayed to read logs until application containers exit.
+func appendSidecar(pod *corev1.Pod, annotations podAnnotations, sidecar corev1.Container, volumeMounts []corev1.VolumeMount, logContainers map[string]string, native bool, defaultProbePort int32) error {
+	if !nativeSidecar(annotations, native) {
+		mountLogVolume(pod, logContainers, volumeMounts...)
+		if err := configureShutdown(pod, annotations, &sidecar, volumeMounts[0].MountPath); err != nil {
+			return err
+		}
+		pod.Spec.Containers = append(pod.Spec.Containers, sidecar)
+		return nil
+	}
+
+	port := startupProbePort(annotations, defaultProbePort)
+	mountLogVolume(pod, logContainers, volumeMounts...)
+	always := corev1.ContainerRestartPolicyAlways
+	sidecar.RestartPolicy = &always
+	// Application containers are not started until the startup probe succeeds.
+	sidecar.StartupProbe = &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			TCPSocket: &corev1.TCPSocketAction{
+				Port: intstr.FromInt32(port),
+			},
+		},
+		PeriodSeconds:    2,
+		FailureThreshold: 30,
+	}
+	// Append after existing init containers, because they may prepare the pod for all containers, e.g. network.
+	pod.Spec.InitContainers = append(pod.Spec.InitContainers, sidecar)
+	return nil
+}
+
+// mountLogVolume injects volume mounts for all containers in the pod.
+// If logContainers is specified, only these containers and init containers mount the log volume on their log directories.
+// Each of them mounts a subPath of its name, so containers can not overwrite log files of each other.
+func mountLogVolume(pod *corev1.Pod, logContainers map[string]string, volumeMounts ...corev1.VolumeMount) {
+	if logContainers == nil {
+		for i := range pod.Spec.Containers {
+			container := &pod.Spec.Containers[i]
+			container.VolumeMounts = append(container.VolumeMounts, volumeMounts...)
+		}
+		return
+	}
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for i := range containers {
+			container := &containers[i]
+			dir, ok := logContainers[container.Name]
+			if !ok {
+				continue
+			}
+			container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+				Name:      volumeMounts[0].Name,
+				MountPath: dir,
+				SubPath:   container.Name,
+			})
+		}
+	}
+}
+
+// logContainers parses the log-containers annotation, which is a comma separated list of containers with optional log directories, e.g. nginx:/var/log/nginx,migrate.
+// The directory defaults to the application log directory. It returns nil if the annotation is not specified.
+func logContainers(pod *corev1.Pod, annotations podAnnotations, logDir string) (map[string]string, error) {
+	value, ok := annotations.value("log-containers")
+	if !ok {
+		return nil, nil
+	}
+	names := map[string]bool{}
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, container := range containers {
+			names[container.Name] = true
+		}
+	}
+	result := map[string]string{}
+	for _, item := range strings.Split(value, ",") {
+		name, dir, _ := strings.Cut(strings.TrimSpace(item), ":")
+		if name == "" || name == ContainerName || !names[name] {
+			return nil, fmt.Errorf("log-containers must be names of containers in the pod, %s is not matched", name)
+		}
+		if _, ok := result[name]; ok {
+			return nil, fmt.Errorf("container %s is duplicated in log-containers", name)
+		}
+		if dir == "" {
+			dir = logDir
+		}
+		if !path.IsAbs(dir) {
+			return nil, fmt.Errorf("log directory of container %s must be an absolute path, %s is not matched", name, dir)
+		}
+		result[name] = dir
+	}
+	return result, nil
+}
+
+// nativeSidecar returns whether the sidecar is injected as a native sidecar. The annotation overrides the default.
+func nativeSidecar(annotations podAnnotations, defaultValue bool) bool {
+	if native, ok := annotations.boolean("native-sidecar"); ok {
+		return native
+	}
+	return defaultValue
+}
+
+// startupProbePort returns the port for the startup probe of native sidecars.
+// It is specified by the annotation, and the exposed port and the monitoring port of the collector are used as fallbacks.
+func startupProbePort(annotations podAnnotations, defaultPort int32) int32 {
+	if port, ok := annotations.port("startup-probe-port"); ok {
+		return port
+	}
+	if port, ok := annotations.port("expose-port"); ok {
+		return port
+	}
+	return defaultPort
+}
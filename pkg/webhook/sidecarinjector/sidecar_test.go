@@ -0,0 +1,200 @@
+package sidecarinjector
+
+import (
+	"strings"
+	"testing"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestInjectNativeSidecar(t *testing.T) {
+	pod := newTestPod(map[string]string{
+		annotationPrefix + "/native-sidecar": "true",
+	})
+
+	if _, err := sidecarInjectMutator(pod, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(pod.Spec.Containers) != 1 {
+		t.Errorf("Sidecar should not be injected to containers: %#v", pod.Spec.Containers)
+	}
+	if len(pod.Spec.InitContainers) != 2 || pod.Spec.InitContainers[1].Name != ContainerName {
+		t.Fatalf("Sidecar is not injected after existing init containers: %#v", pod.Spec.InitContainers)
+	}
+	sidecar := pod.Spec.InitContainers[1]
+	if sidecar.RestartPolicy == nil || *sidecar.RestartPolicy != corev1.ContainerRestartPolicyAlways {
+		t.Errorf("Sidecar restart policy is not matched: %v", sidecar.RestartPolicy)
+	}
+	if sidecar.StartupProbe == nil || sidecar.StartupProbe.TCPSocket == nil {
+		t.Fatalf("Sidecar startup probe is not matched: %#v", sidecar.StartupProbe)
+	}
+	if port := sidecar.StartupProbe.TCPSocket.Port.IntValue(); port != fluentDMonitorPort {
+		t.Errorf("Startup probe port is not matched: %d", port)
+	}
+	if findMount(pod.Spec.Containers[0].VolumeMounts, VolumeName) == nil {
+		t.Errorf("Log volume is not mounted to application containers: %#v", pod.Spec.Containers[0].VolumeMounts)
+	}
+	if findMount(pod.Spec.InitContainers[0].VolumeMounts, VolumeName) != nil {
+		t.Errorf("Log volume should not be mounted to init containers: %#v", pod.Spec.InitContainers[0].VolumeMounts)
+	}
+}
+
+func TestInjectNativeSidecarWithPolicy(t *testing.T) {
+	policy := &sidecarinjectorv1alpha1.SidecarInjectorPolicySpec{
+		Collector:     "fluent-bit",
+		NativeSidecar: ptr.To(true),
+	}
+
+	pod := newTestPod(map[string]string{
+		annotationPrefix + "/expose-port": "2021",
+	})
+	if _, err := sidecarInjectMutator(pod, policy, false); err != nil {
+		t.Fatal(err)
+	}
+	sidecar := findContainer(pod.Spec.InitContainers, ContainerName)
+	if sidecar == nil {
+		t.Fatalf("Sidecar is not injected to init containers: %#v", pod.Spec.InitContainers)
+	}
+	if port := sidecar.StartupProbe.TCPSocket.Port.IntValue(); port != 2021 {
+		t.Errorf("Startup probe port is not matched: %d", port)
+	}
+
+	pod = newTestPod(map[string]string{
+		annotationPrefix + "/expose-port":        "2021",
+		annotationPrefix + "/startup-probe-port": "2020",
+	})
+	if _, err := sidecarInjectMutator(pod, policy, false); err != nil {
+		t.Fatal(err)
+	}
+	sidecar = findContainer(pod.Spec.InitContainers, ContainerName)
+	if port := sidecar.StartupProbe.TCPSocket.Port.IntValue(); port != 2020 {
+		t.Errorf("Startup probe port is not matched: %d", port)
+	}
+
+	// Pod annotations override the policy.
+	pod = newTestPod(map[string]string{
+		annotationPrefix + "/native-sidecar": "false",
+	})
+	if _, err := sidecarInjectMutator(pod, policy, false); err != nil {
+		t.Fatal(err)
+	}
+	if findContainer(pod.Spec.Containers, ContainerName) == nil {
+		t.Errorf("Sidecar is not injected to containers: %#v", pod.Spec.Containers)
+	}
+	if len(pod.Spec.InitContainers) != 1 {
+		t.Errorf("Sidecar should not be injected to init containers: %#v", pod.Spec.InitContainers)
+	}
+}
+
+func TestInjectNativeSidecarWithInvalidAnnotations(t *testing.T) {
+	// Malformed values are returned as warnings and ignored.
+	pod := newTestPod(map[string]string{
+		annotationPrefix + "/native-sidecar": "yes",
+	})
+	result, err := sidecarInjectMutator(pod, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "native-sidecar") {
+		t.Errorf("Warnings are not matched: %v", result.Warnings)
+	}
+	if findContainer(pod.Spec.Containers, ContainerName) == nil {
+		t.Errorf("Sidecar is not injected to containers: %#v", pod.Spec.Containers)
+	}
+
+	pod = newTestPod(map[string]string{
+		annotationPrefix + "/native-sidecar":     "true",
+		annotationPrefix + "/startup-probe-port": "http",
+	})
+	result, err = sidecarInjectMutator(pod, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "startup-probe-port") {
+		t.Errorf("Warnings are not matched: %v", result.Warnings)
+	}
+	sidecar := findContainer(pod.Spec.InitContainers, ContainerName)
+	if sidecar == nil {
+		t.Fatalf("Sidecar is not injected to init containers: %#v", pod.Spec.InitContainers)
+	}
+	if port := sidecar.StartupProbe.TCPSocket.Port.IntValue(); port != fluentDMonitorPort {
+		t.Errorf("Startup probe port is not matched: %d", port)
+	}
+
+	// They are rejected with strict annotations.
+	pod = newTestPod(map[string]string{
+		annotationPrefix + "/native-sidecar": "yes",
+	})
+	if _, err := sidecarInjectMutator(pod, &sidecarinjectorv1alpha1.SidecarInjectorPolicySpec{StrictAnnotations: ptr.To(true)}, false); err == nil {
+		t.Error("Invalid native-sidecar annotation should be rejected with strict annotations")
+	}
+}
+
+func TestInjectWithLogContainers(t *testing.T) {
+	pod := newTestPod(map[string]string{
+		annotationPrefix + "/log-containers": "nginx:/var/log/nginx, setup:/tmp/logs",
+	})
+	pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: "metrics", Image: "metrics:latest"})
+
+	if _, err := sidecarInjectMutator(pod, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []struct {
+		container *corev1.Container
+		mountPath string
+		subPath   string
+	}{
+		{findContainer(pod.Spec.InitContainers, "setup"), "/tmp/logs", "setup"},
+		{findContainer(pod.Spec.Containers, "nginx"), "/var/log/nginx", "nginx"},
+		{findContainer(pod.Spec.Containers, ContainerName), "/var/log/nginx", ""},
+	} {
+		mount := findMount(expected.container.VolumeMounts, VolumeName)
+		if mount == nil || mount.MountPath != expected.mountPath || mount.SubPath != expected.subPath {
+			t.Errorf("Log volume mount of %s is not matched: %#v", expected.container.Name, mount)
+		}
+	}
+	if mount := findMount(findContainer(pod.Spec.Containers, "metrics").VolumeMounts, VolumeName); mount != nil {
+		t.Errorf("Log volume should not be mounted to metrics: %#v", mount)
+	}
+	// The image only reads the log directory, so sources of subdirectories are rendered.
+	config := pod.Annotations[annotationPrefix+"/sources-config"]
+	for _, expected := range []string{
+		"  path /var/log/nginx/nginx/*.log\n  pos_file /var/log/nginx/nginx/.fluentd-sidecar-injector-0.pos\n  tag app.nginx\n",
+		"  path /var/log/nginx/setup/*.log\n  pos_file /var/log/nginx/setup/.fluentd-sidecar-injector-1.pos\n  tag app.setup\n",
+	} {
+		if !strings.Contains(config, expected) {
+			t.Errorf("Config does not contain %q:\n%s", expected, config)
+		}
+	}
+
+	hash, err := injectionHash(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	removeInjection(pod)
+	if len(pod.Spec.InitContainers[0].VolumeMounts) != 0 || len(pod.Spec.Containers[0].VolumeMounts) != 0 {
+		t.Errorf("Failed to remove log volume mounts: %#v", pod.Spec)
+	}
+	delete(pod.Annotations, annotationPrefix+"/log-containers")
+	if _, err := sidecarInjectMutator(pod, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := injectionHash(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash == changed {
+		t.Error("Config hash should be changed with log containers")
+	}
+
+	for _, value := range []string{"unknown", "nginx,nginx", "nginx:var/log", ContainerName} {
+		pod := newTestPod(map[string]string{
+			annotationPrefix + "/log-containers": value,
+		})
+		if _, err := sidecarInjectMutator(pod, nil, false); err == nil {
+			t.Errorf("log-containers %s should be rejected", value)
+		}
+	}
+}
@@ -0,0 +1,490 @@
+package sidecarinjector
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
+	"github.com/h3poteto/fluentd-sidecar-injector/pkg/pipeline"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SourcesVolumeName is a volume of the collector configuration which is rendered from log sources.
+const SourcesVolumeName = "fluentd-sidecar-injector-sources"
+
+// Parsers of log sources.
+const (
+	ParserNone      = "none"
+	ParserJSON      = "json"
+	ParserRegexp    = "regexp"
+	ParserMultiline = "multiline"
+	ParserNginx     = "nginx"
+	ParserApache    = "apache"
+)
+
+// LogSource is a log file which the collector tails. It is specified as a JSON list in the log-sources annotation.
+type LogSource struct {
+	// Path is a glob of log files. The directory must not contain wildcards, because it is mounted.
+	Path string `json:"path"`
+	// Parser is one of none, json, regexp, multiline, nginx and apache. Default is none.
+	Parser string `json:"parser,omitempty"`
+	// Expression is a regular expression with named captures for regexp, and for the whole record of multiline.
+	Expression string `json:"expression,omitempty"`
+	// FirstLine is a regular expression which matches the first line of a record for multiline.
+	FirstLine string `json:"firstLine,omitempty"`
+	// Tag of records. Default is the tag prefix and the index of the source, e.g. app.0.
+	Tag        string `json:"tag,omitempty"`
+	TimeKey    string `json:"timeKey,omitempty"`
+	TimeFormat string `json:"timeFormat,omitempty"`
+}
+
+// logSources parses the log-sources annotation. It returns nil if the annotation is not specified.
+func logSources(annotations podAnnotations) ([]LogSource, error) {
+	value, ok := annotations.value("log-sources")
+	if !ok {
+		return nil, nil
+	}
+	if _, ok := annotations.value("config-volume"); ok {
+		return nil, fmt.Errorf("log-sources can not be used with config-volume")
+	}
+	var sources []LogSource
+	if err := json.Unmarshal([]byte(value), &sources); err != nil {
+		return nil, fmt.Errorf("log-sources must be a JSON list of sources: %w", err)
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("log-sources must have at least one source")
+	}
+	for i := range sources {
+		source := &sources[i]
+		if !path.IsAbs(source.Path) {
+			return nil, fmt.Errorf("path of log source %d must be an absolute path, %s is not matched", i, source.Path)
+		}
+		if strings.ContainsAny(path.Dir(source.Path), "*?[") {
+			return nil, fmt.Errorf("directory of log source %d must not contain wildcards, %s is not matched", i, source.Path)
+		}
+		if source.Parser == "" {
+			source.Parser = ParserNone
+		}
+		switch source.Parser {
+		case ParserNone, ParserJSON, ParserNginx, ParserApache:
+		case ParserRegexp:
+			if source.Expression == "" {
+				return nil, fmt.Errorf("log source %d requires expression for regexp", i)
+			}
+		case ParserMultiline:
+			if source.FirstLine == "" {
+				return nil, fmt.Errorf("log source %d requires firstLine for multiline", i)
+			}
+		default:
+			return nil, fmt.Errorf("parser of log source %d must be none, json, regexp, multiline, nginx or apache, %s is not matched", i, source.Parser)
+		}
+		for _, value := range []string{source.Path, source.Expression, source.FirstLine, source.Tag, source.TimeKey, source.TimeFormat} {
+			if strings.ContainsAny(value, "\r\n") {
+				return nil, fmt.Errorf("log source %d must not contain line breaks", i)
+			}
+		}
+	}
+	return sources, nil
+}
+
+// configureLogSources renders the collector configuration which tails each source, and mounts it to the sidecar.
+// It returns mounts of directories which are not in the application log directory, and they should be mounted to all containers.
+// Records are forwarded with the buffer, the security and aggregators of the output if they are configured.
+func configureLogSources(pod *corev1.Pod, sidecar *corev1.Container, sources []LogSource, tagPrefix, logDir, collector string, output sourcesOutput) []corev1.VolumeMount {
+	if len(sources) == 0 {
+		return nil
+	}
+	for i := range sources {
+		if sources[i].Tag == "" {
+			sources[i].Tag = strconv.Itoa(i)
+			if tagPrefix != "" {
+				sources[i].Tag = tagPrefix + "." + sources[i].Tag
+			}
+		}
+	}
+	mounts := mountLogSources(pod, sources, logDir)
+	sidecar.VolumeMounts = append(sidecar.VolumeMounts, mounts...)
+
+	var files map[string]string
+	var configDir string
+	switch collector {
+	case "fluent-bit":
+		files = renderFluentBitSources(sources, output)
+		configDir = "/fluent-bit/etc"
+	case "otel-collector":
+		files = renderOtelCollectorSources(sources, logDir, output)
+		configDir = otelCollectorConfigDir
+	default:
+		files = renderFluentDSources(sources, output)
+		configDir = "/fluentd/etc"
+	}
+	mountSourcesConfig(pod, sidecar, configDir, files)
+	return mounts
+}
+
+// mountLogSources adds volumes for directories of sources which are not in the application log directory, and returns their mounts.
+// Directories are sorted, so a nested directory shares the volume of its parent.
+func mountLogSources(pod *corev1.Pod, sources []LogSource, logDir string) []corev1.VolumeMount {
+	var dirs []string
+	for _, source := range sources {
+		dirs = append(dirs, path.Dir(source.Path))
+	}
+	sort.Strings(dirs)
+
+	var mounts []corev1.VolumeMount
+	mounted := []string{logDir}
+	for _, dir := range dirs {
+		if slices.ContainsFunc(mounted, func(m string) bool { return inDir(dir, m) }) {
+			continue
+		}
+		mounted = append(mounted, dir)
+		name := fmt.Sprintf("%s-%d", VolumeName, len(mounts)+1)
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name: name,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      name,
+			MountPath: dir,
+		})
+	}
+	return mounts
+}
+
+func inDir(p, dir string) bool {
+	return p == dir || strings.HasPrefix(p, strings.TrimSuffix(dir, "/")+"/")
+}
+
+// mountSourcesConfig sets the rendered configuration to annotations of the pod, and projects them to files in the config directory of the sidecar.
+// The webhook can not create ConfigMaps for each pod, so the downward API is used instead.
+func mountSourcesConfig(pod *corev1.Pod, sidecar *corev1.Container, configDir string, files map[string]string) {
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	var names []string
+	for file := range files {
+		names = append(names, file)
+	}
+	sort.Strings(names)
+	var items []corev1.DownwardAPIVolumeFile
+	for _, file := range names {
+		annotation := sourcesAnnotations[file]
+		pod.Annotations[annotation] = files[file]
+		items = append(items, corev1.DownwardAPIVolumeFile{
+			Path: file,
+			FieldRef: &corev1.ObjectFieldSelector{
+				FieldPath: fmt.Sprintf("metadata.annotations['%s']", annotation),
+			},
+		})
+	}
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: SourcesVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			DownwardAPI: &corev1.DownwardAPIVolumeSource{
+				Items: items,
+			},
+		},
+	})
+	sidecar.VolumeMounts = append(sidecar.VolumeMounts, corev1.VolumeMount{
+		Name:      SourcesVolumeName,
+		ReadOnly:  true,
+		MountPath: configDir,
+	})
+}
+
+// sourcesAnnotations are annotations which have the rendered configuration files.
+var sourcesAnnotations = map[string]string{
+	pipeline.FluentDConfigKey:    annotationPrefix + "/sources-config",
+	pipeline.FluentBitConfigKey:  annotationPrefix + "/sources-config",
+	pipeline.FluentBitParsersKey: annotationPrefix + "/sources-parsers",
+	fluentBitUpstreamKey:         annotationPrefix + "/sources-upstream",
+	otelCollectorConfigKey:       annotationPrefix + "/sources-config",
+}
+
+// fluentBitUpstreamKey is a file of fluent-bit which lists aggregators, because the forward output of fluent-bit has only one host.
+const fluentBitUpstreamKey = "upstream.conf"
+
+// sourcesOutput is the output of the rendered configuration. Fields are nil if they are not configured.
+// Records are sent to the backend directly if it is specified, otherwise they are forwarded to the aggregator with the security.
+// otel-collector only uses the buffer and otlp.
+type sourcesOutput struct {
+	buffer      *sidecarBuffer
+	security    *forwardSecurity
+	aggregators *aggregatorServers
+	backend     *sidecarinjectorv1alpha1.OutputSpec
+	otlp        *otlpExporter
+}
+
+// positionFile returns a file which records positions of the source. It is in the log volume, because the volume is writable.
+func positionFile(source LogSource, index int, ext string) string {
+	return path.Join(path.Dir(source.Path), fmt.Sprintf(".fluentd-sidecar-injector-%d.%s", index, ext))
+}
+
+// renderFluentDSources returns fluent.conf which tails each source, and forwards records to the aggregator.
+// Settings of the aggregator are read from environment variables of the sidecar, unless multiple aggregators are configured.
+// monitor_agent listens on the monitoring port, which is checked by the startup probe of native sidecars.
+func renderFluentDSources(sources []LogSource, output sourcesOutput) map[string]string {
+	buffer, security := output.buffer, output.security
+	var b strings.Builder
+	fmt.Fprintf(&b, "<source>\n  @type monitor_agent\n  bind 0.0.0.0\n  port %d\n</source>\n\n", fluentDMonitorPort)
+	for i, source := range sources {
+		b.WriteString("<source>\n")
+		b.WriteString("  @type tail\n")
+		fmt.Fprintf(&b, "  path %s\n", source.Path)
+		fmt.Fprintf(&b, "  pos_file %s\n", positionFile(source, i, "pos"))
+		fmt.Fprintf(&b, "  tag %s\n", source.Tag)
+		b.WriteString("  <parse>\n")
+		switch source.Parser {
+		case ParserApache:
+			b.WriteString("    @type apache2\n")
+		case ParserRegexp:
+			b.WriteString("    @type regexp\n")
+			fmt.Fprintf(&b, "    expression /%s/\n", source.Expression)
+		case ParserMultiline:
+			b.WriteString("    @type multiline\n")
+			fmt.Fprintf(&b, "    format_firstline /%s/\n", source.FirstLine)
+			expression := source.Expression
+			if expression == "" {
+				expression = "(?<message>.*)"
+			}
+			fmt.Fprintf(&b, "    format1 /%s/\n", expression)
+		default:
+			fmt.Fprintf(&b, "    @type %s\n", source.Parser)
+		}
+		if source.TimeKey != "" {
+			fmt.Fprintf(&b, "    time_key %s\n", source.TimeKey)
+		}
+		if source.TimeFormat != "" {
+			fmt.Fprintf(&b, "    time_format %s\n", source.TimeFormat)
+		}
+		b.WriteString("  </parse>\n")
+		b.WriteString("</source>\n\n")
+	}
+	b.WriteString("<match **>\n")
+	if output.backend != nil {
+		writeFluentDOutput(&b, output.backend)
+	} else {
+		b.WriteString(`  @type forward
+  send_timeout "#{ENV['SEND_TIMEOUT']}"
+  recover_wait "#{ENV['RECOVER_WAIT']}"
+  hard_timeout "#{ENV['HARD_TIMEOUT']}"
+`)
+		writeFluentDSecurity(&b, security)
+		writeFluentDServers(&b, output.aggregators, security)
+	}
+	if buffer != nil {
+		// Chunks are kept until the backend comes back, because the size of the buffer is limited.
+		b.WriteString("  <buffer>\n    @type file\n")
+		fmt.Fprintf(&b, "    path %s\n", path.Join(buffer.path, outputName(output.backend)))
+		if buffer.limit > 0 {
+			fmt.Fprintf(&b, "    total_limit_size %d\n", buffer.limit)
+		}
+		b.WriteString("    retry_forever true\n  </buffer>\n")
+	}
+	b.WriteString("</match>\n")
+	return map[string]string{pipeline.FluentDConfigKey: b.String()}
+}
+
+// Regular expressions of the parsers which are bundled with fluent-bit. They are rendered, because parsers.conf of the image is hidden by the mount.
+const (
+	fluentBitNginxRegex    = `^(?<remote>[^ ]*) (?<host>[^ ]*) (?<user>[^ ]*) \[(?<time>[^\]]*)\] "(?<method>\S+)(?: +(?<path>[^\"]*?)(?: +\S*)?)?" (?<code>[^ ]*) (?<size>[^ ]*)(?: "(?<referer>[^\"]*)" "(?<agent>[^\"]*)")`
+	fluentBitApacheRegex   = `^(?<host>[^ ]*) [^ ]* (?<user>[^ ]*) \[(?<time>[^\]]*)\] "(?<method>\S+)(?: +(?<path>[^ ]*) +\S*)?" (?<code>[^ ]*) (?<size>[^ ]*)(?: "(?<referer>[^\"]*)" "(?<agent>[^\"]*)")?$`
+	fluentBitAccessLogTime = "%d/%b/%Y:%H:%M:%S %z"
+)
+
+// renderFluentBitSources returns fluent-bit.conf and parsers.conf which tail each source with its own parser.
+// Multiple aggregators are rendered to upstream.conf, and fluent-bit balances records between active aggregators with round robin.
+// The HTTP server listens on the monitoring port, which is checked by the startup probe of native sidecars.
+func renderFluentBitSources(sources []LogSource, output sourcesOutput) map[string]string {
+	buffer, security := output.buffer, output.security
+	var config, parsers strings.Builder
+	config.WriteString("[SERVICE]\n    Parsers_File parsers.conf\n")
+	fmt.Fprintf(&config, "    HTTP_Server On\n    HTTP_Listen 0.0.0.0\n    HTTP_Port %d\n", fluentBitMonitorPort)
+	if buffer != nil {
+		fmt.Fprintf(&config, "    storage.path %s\n", buffer.path)
+	}
+	config.WriteString("\n")
+	for i, source := range sources {
+		name := fmt.Sprintf("source%d", i)
+		config.WriteString("[INPUT]\n    Name tail\n")
+		fmt.Fprintf(&config, "    Path %s\n", source.Path)
+		fmt.Fprintf(&config, "    DB %s\n", positionFile(source, i, "db"))
+		fmt.Fprintf(&config, "    Tag %s\n", source.Tag)
+		config.WriteString("    Refresh_Interval ${REFRESH_INTERVAL}\n    Rotate_Wait ${ROTATE_WAIT}\n")
+		if buffer != nil {
+			config.WriteString("    storage.type filesystem\n")
+		}
+
+		format, regex, timeKey, timeFormat := "", source.Expression, source.TimeKey, source.TimeFormat
+		switch source.Parser {
+		case ParserJSON:
+			format = "json"
+		case ParserRegexp:
+			format = "regex"
+		case ParserNginx, ParserApache:
+			format, regex = "regex", fluentBitNginxRegex
+			if source.Parser == ParserApache {
+				regex = fluentBitApacheRegex
+			}
+			if timeKey == "" {
+				timeKey = "time"
+			}
+			if timeFormat == "" {
+				timeFormat = fluentBitAccessLogTime
+			}
+		case ParserMultiline:
+			fmt.Fprintf(&config, "    multiline.parser %s\n", name)
+			fmt.Fprintf(&parsers, "[MULTILINE_PARSER]\n    Name %s\n    Type regex\n    Flush_Timeout 1000\n", name)
+			fmt.Fprintf(&parsers, "    Rule \"start_state\" \"/%s/\" \"cont\"\n", source.FirstLine)
+			fmt.Fprintf(&parsers, "    Rule \"cont\" \"/^(?!%s)/\" \"cont\"\n\n", strings.TrimPrefix(source.FirstLine, "^"))
+			if source.Expression != "" {
+				format = "regex"
+			}
+		}
+		if format != "" {
+			if source.Parser == ParserMultiline {
+				// Concatenated records are parsed by a filter, because the tail input accepts only one of parser and multiline.parser.
+				fmt.Fprintf(&config, "\n[FILTER]\n    Name parser\n    Match %s\n    Key_Name log\n    Parser %s\n", source.Tag, name)
+			} else {
+				fmt.Fprintf(&config, "    Parser %s\n", name)
+			}
+			fmt.Fprintf(&parsers, "[PARSER]\n    Name %s\n    Format %s\n", name, format)
+			if format == "regex" {
+				fmt.Fprintf(&parsers, "    Regex %s\n", regex)
+			}
+			if timeKey != "" {
+				fmt.Fprintf(&parsers, "    Time_Key %s\n", timeKey)
+			}
+			if timeFormat != "" {
+				fmt.Fprintf(&parsers, "    Time_Format %s\n", timeFormat)
+			}
+			parsers.WriteString("\n")
+		}
+		config.WriteString("\n")
+	}
+	config.WriteString("[OUTPUT]\n")
+	if output.backend != nil {
+		writeFluentBitOutput(&config, output.backend)
+	} else if output.aggregators == nil {
+		config.WriteString("    Name forward\n    Match *\n")
+		config.WriteString("    Host ${AGGREGATOR_HOST}\n    Port ${AGGREGATOR_PORT}\n")
+		writeFluentBitSecurity(&config, security)
+	} else {
+		config.WriteString("    Name forward\n    Match *\n")
+		fmt.Fprintf(&config, "    Upstream %s\n", path.Join("/fluent-bit/etc", fluentBitUpstreamKey))
+	}
+	if buffer != nil {
+		config.WriteString("    Retry_Limit no_limits\n")
+		if buffer.limit > 0 {
+			fmt.Fprintf(&config, "    storage.total_limit_size %d\n", buffer.limit)
+		}
+	}
+	files := map[string]string{
+		pipeline.FluentBitConfigKey:  config.String(),
+		pipeline.FluentBitParsersKey: parsers.String(),
+	}
+	if output.backend == nil && output.aggregators != nil {
+		files[fluentBitUpstreamKey] = renderFluentBitUpstream(output.aggregators, security)
+	}
+	return files
+}
+
+// renderFluentBitUpstream returns upstream.conf of active aggregators. Security is configured for each node in the upstream.
+func renderFluentBitUpstream(aggregators *aggregatorServers, security *forwardSecurity) string {
+	var b strings.Builder
+	b.WriteString("[UPSTREAM]\n    Name aggregators\n")
+	for i, server := range aggregators.servers {
+		if aggregators.standby(i) {
+			continue
+		}
+		fmt.Fprintf(&b, "\n[NODE]\n    Name aggregator%d\n    Host %s\n    Port %d\n", i, server.Host, server.Port)
+		writeFluentBitSecurity(&b, security)
+	}
+	return b.String()
+}
+
+// writeFluentDServers writes a server of environment variables, or servers of aggregators.
+// If the zone of the pod is not known, whether an aggregator is standby is decided with AGGREGATOR_ZONE when fluentd starts.
+func writeFluentDServers(b *strings.Builder, aggregators *aggregatorServers, security *forwardSecurity) {
+	user := func() {
+		if security != nil && security.user {
+			b.WriteString("    username \"#{ENV['AGGREGATOR_USERNAME']}\"\n    password \"#{ENV['AGGREGATOR_PASSWORD']}\"\n")
+		}
+	}
+	if aggregators == nil {
+		b.WriteString(`  <server>
+    host "#{ENV['AGGREGATOR_HOST']}"
+    port "#{ENV['AGGREGATOR_PORT']}"
+`)
+		user()
+		b.WriteString("  </server>\n")
+		return
+	}
+	for i, server := range aggregators.servers {
+		fmt.Fprintf(b, "  <server>\n    name aggregator%d\n    host %s\n    port %d\n", i, server.Host, server.Port)
+		if server.Weight > 0 {
+			fmt.Fprintf(b, "    weight %d\n", server.Weight)
+		}
+		if aggregators.standby(i) {
+			b.WriteString("    standby true\n")
+		} else if zones := aggregators.standbyZones(i); aggregators.zone == "" && len(zones) > 0 {
+			fmt.Fprintf(b, "    standby \"#{%%w(%s).include?(ENV['AGGREGATOR_ZONE'])}\"\n", strings.Join(zones, " "))
+		}
+		user()
+		b.WriteString("  </server>\n")
+	}
+}
+
+func writeFluentDSecurity(b *strings.Builder, security *forwardSecurity) {
+	if security == nil {
+		return
+	}
+	if security.tls {
+		b.WriteString("  transport tls\n")
+		if !security.verify {
+			b.WriteString("  tls_verify_hostname false\n  tls_insecure_mode true\n")
+		}
+	}
+	if security.caFile != "" {
+		fmt.Fprintf(b, "  tls_cert_path %s\n", security.caFile)
+	}
+	if security.certFile != "" {
+		fmt.Fprintf(b, "  tls_client_cert_path %s\n  tls_client_private_key_path %s\n", security.certFile, security.keyFile)
+	}
+	if security.sharedKey {
+		b.WriteString("  <security>\n    self_hostname \"#{ENV['POD_NAME']}\"\n    shared_key \"#{ENV['SHARED_KEY']}\"\n  </security>\n")
+	}
+}
+
+func writeFluentBitSecurity(b *strings.Builder, security *forwardSecurity) {
+	if security == nil {
+		return
+	}
+	if security.tls {
+		b.WriteString("    tls On\n")
+		if security.verify {
+			b.WriteString("    tls.verify On\n")
+		} else {
+			b.WriteString("    tls.verify Off\n")
+		}
+	}
+	if security.caFile != "" {
+		fmt.Fprintf(b, "    tls.ca_file %s\n", security.caFile)
+	}
+	if security.certFile != "" {
+		fmt.Fprintf(b, "    tls.crt_file %s\n    tls.key_file %s\n", security.certFile, security.keyFile)
+	}
+	if security.sharedKey {
+		b.WriteString("    Shared_Key ${SHARED_KEY}\n    Self_Hostname ${POD_NAME}\n")
+	}
+	if security.user {
+		b.WriteString("    Username ${AGGREGATOR_USERNAME}\n    Password ${AGGREGATOR_PASSWORD}\n")
+	}
+}
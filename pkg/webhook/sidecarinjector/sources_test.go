@@ -0,0 +1,205 @@
+package sidecarinjector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/h3poteto/fluentd-sidecar-injector/pkg/pipeline"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const testLogSources = `[
+  {"path": "/var/log/nginx/access.log", "parser": "nginx", "tag": "nginx.access"},
+  {"path": "/var/log/app/*.json", "parser": "json", "timeKey": "ts"},
+  {"path": "/var/log/app/gc/gc.log", "parser": "multiline", "firstLine": "^\\[\\d+", "expression": "^\\[(?<time>[^\\]]+)\\] (?<message>.*)"}
+]`
+
+func TestLogSources(t *testing.T) {
+	cases := []struct {
+		title string
+		value string
+		valid bool
+	}{
+		{"valid sources", testLogSources, true},
+		{"malformed JSON", `{"path": "/var/log/app.log"}`, false},
+		{"no sources", `[]`, false},
+		{"relative path", `[{"path": "app.log"}]`, false},
+		{"wildcard in directory", `[{"path": "/var/log/*/app.log"}]`, false},
+		{"regexp without expression", `[{"path": "/var/log/app.log", "parser": "regexp"}]`, false},
+		{"multiline without firstLine", `[{"path": "/var/log/app.log", "parser": "multiline"}]`, false},
+		{"unknown parser", `[{"path": "/var/log/app.log", "parser": "syslog"}]`, false},
+		{"line break", `[{"path": "/var/log/app.log", "tag": "app\n</source>"}]`, false},
+	}
+	for _, c := range cases {
+		_, err := logSources(podAnnotations{"log-sources": c.value})
+		if c.valid && err != nil {
+			t.Errorf("%s should be valid: %v", c.title, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("%s should be invalid", c.title)
+		}
+	}
+
+	if _, err := logSources(podAnnotations{"log-sources": testLogSources, "config-volume": "my-config"}); err == nil {
+		t.Error("log-sources should not be used with config-volume")
+	}
+}
+
+func TestInjectFluentDWithLogSources(t *testing.T) {
+	pod := newTestPod(map[string]string{
+		annotationPrefix + "/log-sources": testLogSources,
+	})
+	delete(pod.Annotations, annotationPrefix+"/application-log-dir")
+
+	result, err := sidecarInjectMutator(pod, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sidecar := findSidecar(result.Mutated.(*corev1.Pod))
+	if sidecar == nil {
+		t.Fatalf("Failed to inject sidecar container: %#v", pod.Spec.Containers)
+	}
+	if env := findEnv(sidecar.Env, "APPLICATION_LOG_DIR"); env == nil || env.Value != "/var/log/nginx" {
+		t.Errorf("APPLICATION_LOG_DIR should be the directory of the first source: %#v", env)
+	}
+	if findVolume(pod.Spec.Volumes, VolumeName+"-1") == nil {
+		t.Errorf("Failed to add the volume of /var/log/app: %#v", pod.Spec.Volumes)
+	}
+	if findVolume(pod.Spec.Volumes, VolumeName+"-2") != nil {
+		t.Errorf("/var/log/app/gc should use the volume of /var/log/app: %#v", pod.Spec.Volumes)
+	}
+	nginx := findContainer(pod.Spec.Containers, "nginx")
+	for _, container := range []struct {
+		name   string
+		mounts []string
+	}{
+		{"nginx", []string{mountPath(nginx, VolumeName), mountPath(nginx, VolumeName+"-1")}},
+		{ContainerName, []string{mountPath(sidecar, VolumeName), mountPath(sidecar, VolumeName+"-1"), mountPath(sidecar, SourcesVolumeName)}},
+	} {
+		expected := []string{"/var/log/nginx", "/var/log/app", "/fluentd/etc"}[:len(container.mounts)]
+		if strings.Join(container.mounts, ",") != strings.Join(expected, ",") {
+			t.Errorf("Mounts of %s are not matched: %v", container.name, container.mounts)
+		}
+	}
+
+	volume := findVolume(pod.Spec.Volumes, SourcesVolumeName)
+	if volume == nil || volume.DownwardAPI == nil || len(volume.DownwardAPI.Items) != 1 || volume.DownwardAPI.Items[0].Path != pipeline.FluentDConfigKey {
+		t.Fatalf("Sources volume is not matched: %#v", volume)
+	}
+	config := pod.Annotations[annotationPrefix+"/sources-config"]
+	for _, expected := range []string{
+		"  path /var/log/nginx/access.log\n  pos_file /var/log/nginx/.fluentd-sidecar-injector-0.pos\n  tag nginx.access\n  <parse>\n    @type nginx\n",
+		"  tag app.1\n  <parse>\n    @type json\n    time_key ts\n",
+		"    @type multiline\n    format_firstline /^\\[\\d+/\n",
+		"    host \"#{ENV['AGGREGATOR_HOST']}\"\n",
+	} {
+		if !strings.Contains(config, expected) {
+			t.Errorf("Config does not contain %q:\n%s", expected, config)
+		}
+	}
+
+	hash, err := injectionHash(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	removeInjection(pod)
+	if len(pod.Spec.Volumes) != 0 || len(pod.Spec.Containers[0].VolumeMounts) != 0 {
+		t.Errorf("Failed to remove volumes of log sources: %#v", pod.Spec)
+	}
+	if _, ok := pod.Annotations[annotationPrefix+"/sources-config"]; ok {
+		t.Error("Failed to remove the rendered config")
+	}
+
+	pod.Annotations[annotationPrefix+"/log-sources"] = `[{"path": "/var/log/nginx/access.log", "parser": "apache"}]`
+	if _, err := sidecarInjectMutator(pod, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := injectionHash(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash == changed {
+		t.Error("Config hash should be changed with log sources")
+	}
+}
+
+func TestInjectFluentBitWithLogSources(t *testing.T) {
+	pod := newTestPod(map[string]string{
+		annotationPrefix + "/collector":   "fluent-bit",
+		annotationPrefix + "/log-sources": testLogSources,
+	})
+
+	if _, err := sidecarInjectMutator(pod, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	volume := findVolume(pod.Spec.Volumes, SourcesVolumeName)
+	if volume == nil || volume.DownwardAPI == nil || len(volume.DownwardAPI.Items) != 2 {
+		t.Fatalf("Sources volume is not matched: %#v", volume)
+	}
+	if mount := findMount(findSidecar(pod).VolumeMounts, SourcesVolumeName); mount == nil || mount.MountPath != "/fluent-bit/etc" {
+		t.Errorf("Sources mount is not matched: %#v", mount)
+	}
+
+	config := pod.Annotations[annotationPrefix+"/sources-config"]
+	for _, expected := range []string{
+		"    Parsers_File parsers.conf\n",
+		"    Path /var/log/nginx/access.log\n    DB /var/log/nginx/.fluentd-sidecar-injector-0.db\n    Tag nginx.access\n",
+		"    Parser source1\n",
+		"    multiline.parser source2\n",
+		"[FILTER]\n    Name parser\n    Match app.2\n    Key_Name log\n    Parser source2\n",
+		"    Host ${AGGREGATOR_HOST}\n",
+	} {
+		if !strings.Contains(config, expected) {
+			t.Errorf("Config does not contain %q:\n%s", expected, config)
+		}
+	}
+	parsers := pod.Annotations[annotationPrefix+"/sources-parsers"]
+	for _, expected := range []string{
+		"[PARSER]\n    Name source0\n    Format regex\n    Regex " + fluentBitNginxRegex + "\n    Time_Key time\n",
+		"[PARSER]\n    Name source1\n    Format json\n    Time_Key ts\n",
+		"[MULTILINE_PARSER]\n    Name source2\n",
+		"    Rule \"cont\" \"/^(?!\\[\\d+)/\" \"cont\"\n",
+	} {
+		if !strings.Contains(parsers, expected) {
+			t.Errorf("Parsers do not contain %q:\n%s", expected, parsers)
+		}
+	}
+}
+
+func TestInjectNativeSidecarWithLogSources(t *testing.T) {
+	// The rendered configuration must listen on the port of the startup probe, otherwise application containers are never started.
+	for _, c := range []struct {
+		collector string
+		port      int
+		expected  string
+	}{
+		{"fluentd", fluentDMonitorPort, "<source>\n  @type monitor_agent\n  bind 0.0.0.0\n  port 24220\n</source>\n"},
+		{"fluent-bit", fluentBitMonitorPort, "[SERVICE]\n    Parsers_File parsers.conf\n    HTTP_Server On\n    HTTP_Listen 0.0.0.0\n    HTTP_Port 2020\n"},
+	} {
+		pod := newTestPod(map[string]string{
+			annotationPrefix + "/collector":      c.collector,
+			annotationPrefix + "/native-sidecar": "true",
+			annotationPrefix + "/log-sources":    testLogSources,
+		})
+		if _, err := sidecarInjectMutator(pod, nil, false); err != nil {
+			t.Fatal(err)
+		}
+		sidecar := findContainer(pod.Spec.InitContainers, ContainerName)
+		if sidecar == nil || sidecar.StartupProbe == nil || sidecar.StartupProbe.TCPSocket == nil {
+			t.Fatalf("Startup probe of %s is not matched: %#v", c.collector, sidecar)
+		}
+		if port := sidecar.StartupProbe.TCPSocket.Port.IntValue(); port != c.port {
+			t.Errorf("Startup probe port of %s is not matched: %d", c.collector, port)
+		}
+		if config := pod.Annotations[annotationPrefix+"/sources-config"]; !strings.Contains(config, c.expected) {
+			t.Errorf("Config of %s does not contain %q:\n%s", c.collector, c.expected, config)
+		}
+	}
+}
+
+func mountPath(container *corev1.Container, name string) string {
+	if mount := findMount(container.VolumeMounts, name); mount != nil {
+		return mount.MountPath
+	}
+	return ""
+}
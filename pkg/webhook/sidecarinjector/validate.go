@@ -4,14 +4,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"strconv"
+	"path"
+	"strings"
 
+	sidecarinjectorv1alpha1 "github.com/h3poteto/fluentd-sidecar-injector/pkg/apis/sidecarinjectorcontroller/v1alpha1"
 	"github.com/kelseyhightower/envconfig"
 	"gomodules.xyz/jsonpatch/v3"
 	admissionv1 "k8s.io/api/admission/v1"
 	admissionv1beta1 "k8s.io/api/admission/v1beta1"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -99,7 +100,9 @@ var annotationPrefix = "fluentd-sidecar-injector.h3poteto.dev"
 
 // GeneralEnv is required environment variables to run this server.
 type GeneralEnv struct {
-	Collector string `envconfig:"COLLECTOR" default:"fluentd"`
+	Collector         string `envconfig:"COLLECTOR" default:"fluentd"`
+	NativeSidecar     bool   `envconfig:"NATIVE_SIDECAR" default:"false"`
+	StrictAnnotations bool   `envconfig:"STRICT_ANNOTATIONS" default:"false"`
 }
 
 const (
@@ -129,15 +132,20 @@ type FluentBitEnv struct {
 	CustomEnv         string `envconfig:"CUSTOM_ENV"`
 }
 
-func Validate(admission *AdmissionReviewRequest) *AdmissionReviewResponse {
+func (i *Injector) Validate(admission *AdmissionReviewRequest) *AdmissionReviewResponse {
+	record := newAdmissionRecord(admission.Request.Namespace)
+	defer record.observe()
+
 	if admission.Request.Kind.Kind != "Pod" {
 		err := fmt.Errorf("%s is not supported", admission.Request.Kind.Kind)
 		klog.Error(err)
+		record.outcome = OutcomeRejected
 		return reviewResponse(admission, false, []string{err.Error()})
 	}
 
 	if !admission.Request.Operation.IsCreate() {
 		klog.Info("Operation is not Create")
+		record.skip(skipReasonOperation)
 		return reviewResponse(admission, true, []string{})
 	}
 
@@ -147,21 +155,61 @@ func Validate(admission *AdmissionReviewRequest) *AdmissionReviewResponse {
 		return reviewResponse(admission, false, []string{err.Error()})
 	}
 
-	result, err := sidecarInjectMutator(&pod)
+	if !i.handles(&pod) {
+		klog.Infof("Skip injector because the pod does not specify this SidecarInjector: %q", pod.Annotations[injectorAnnotation])
+		record.skip(skipReasonAnotherInjector)
+		return reviewResponse(admission, true, []string{})
+	}
+
+	policy, err := namespacePolicy(i.policyLister, admission.Request.Namespace)
+	if err != nil {
+		klog.Error(err)
+		return reviewResponse(admission, false, []string{err.Error()})
+	}
+
+	// The sidecar is re-rendered in place when it is already injected, so it is not duplicated.
+	previousHash, reinjection := previousInjection(&pod)
+	if reinjection {
+		removeInjection(&pod)
+	}
+
+	result, err := sidecarInjectMutator(&pod, resolveDefaults(i.SidecarInjectorSpec(), policy), i.namespaceInjectionEnabled(admission.Request.Namespace))
+	record.collector = result.Collector
 	if err != nil {
 		klog.Error(err)
+		record.outcome = OutcomeRejected
 		return reviewResponse(admission, false, []string{err.Error()})
 	}
 	if result.Mutated == nil {
 		klog.Info("Object is not mutated")
+		record.skip(skipReasonDisabled)
 		return reviewResponse(admission, true, []string{"Object is not mutated"})
 	}
+	kind, name := i.workload(&pod, admission.Request.Namespace)
+	setWorkloadEnv(&pod, kind, name)
+	if warning := i.mountPipelineConfig(&pod, admission.Request.Namespace, result.Collector); warning != "" {
+		result.Warnings = append(result.Warnings, warning)
+	}
 
-	response, err := mutatedReviewResponse(admission, result.Mutated, []string{})
+	hash, err := injectionHash(&pod)
 	if err != nil {
 		klog.Error(err)
 		return reviewResponse(admission, false, []string{err.Error()})
 	}
+	if reinjection && hash == previousHash {
+		klog.Info("Skip injector because sidecar is already injected")
+		record.skip(skipReasonAlreadyInjected)
+		return reviewResponse(admission, true, result.Warnings)
+	}
+	setInjectionStatus(&pod, hash)
+	i.claim(&pod)
+
+	response, err := mutatedReviewResponse(admission, result.Mutated, result.Warnings)
+	if err != nil {
+		klog.Error(err)
+		return reviewResponse(admission, false, []string{err.Error()})
+	}
+	record.outcome = OutcomeInjected
 	return response
 
 }
@@ -216,16 +264,22 @@ func mutatedReviewResponse(admission *AdmissionReviewRequest, mutatedObject meta
 
 type Result struct {
 	Mutated metav1.Object
+	// Warnings are problems of annotations, e.g. unknown keys and malformed values.
+	Warnings []string
+	// Collector is the resolved collector. It is empty if injection is not enabled.
+	Collector string
 }
 
 // sidecarInjectMutator mutates requested pod definition to inject fluentd as sidecar.
 // This function retunrs bool, and error to detect stop applying.
 // If return false, API server does not stop applying. But if return true, API server stop applying, and say errors to kubectl.
-func sidecarInjectMutator(pod *corev1.Pod) (*Result, error) {
+// The defaults are resolved from SidecarInjector and SidecarInjectorPolicy, and it can be nil.
+// If namespaceEnabled is true, the sidecar is injected unless the pod disables injection.
+func sidecarInjectMutator(pod *corev1.Pod, defaults *sidecarinjectorv1alpha1.SidecarInjectorPolicySpec, namespaceEnabled bool) (*Result, error) {
 	klog.Infof("Receive pod: %s/%s/%s", pod.Namespace, pod.GenerateName, pod.Name)
 
-	if pod.Annotations[annotationPrefix+"/injection"] != "enabled" {
-		klog.Info("Skip injector because annotation is not specified")
+	if !injectionEnabled(pod, namespaceEnabled) {
+		klog.Info("Skip injector because injection is not enabled")
 		return &Result{}, nil
 	}
 
@@ -236,28 +290,54 @@ func sidecarInjectMutator(pod *corev1.Pod) (*Result, error) {
 	}
 
 	collector := generalEnv.Collector
+	if defaults != nil && defaults.Collector != "" {
+		collector = defaults.Collector
+	}
 	if value, ok := pod.Annotations[annotationPrefix+"/collector"]; ok {
 		collector = value
 	}
+	if defaults == nil {
+		defaults = &sidecarinjectorv1alpha1.SidecarInjectorPolicySpec{}
+	}
+	native := generalEnv.NativeSidecar
+	if defaults.NativeSidecar != nil {
+		native = *defaults.NativeSidecar
+	}
+	strict := generalEnv.StrictAnnotations
+	if defaults.StrictAnnotations != nil {
+		strict = *defaults.StrictAnnotations
+	}
+	var result *Result
 	switch collector {
 	case "fluentd", "":
-		return injectFluentD(pod)
+		collector = "fluentd"
+		result, err = injectFluentD(pod, defaults.FluentD, defaults.Output, native)
 	case "fluent-bit":
-		return injectFluentBit(pod)
+		result, err = injectFluentBit(pod, defaults.FluentBit, defaults.Output, native)
+	case "otel-collector":
+		// The collector exports logs with OTLP, so the output is not used.
+		result, err = injectOtelCollector(pod, defaults.OtelCollector, native)
 	default:
-		return &Result{}, fmt.Errorf("collector must be fluentd or fluent-bit, %s is not matched", collector)
+		return &Result{Collector: collector}, fmt.Errorf("collector must be fluentd, fluent-bit or otel-collector, %s is not matched", collector)
+	}
+	result.Collector = collector
+	if err == nil && strict && len(result.Warnings) > 0 {
+		return &Result{Collector: collector}, fmt.Errorf("invalid annotations: %s", strings.Join(result.Warnings, "; "))
 	}
+	return result, err
 }
 
-func injectFluentD(pod *corev1.Pod) (*Result, error) {
+func injectFluentD(pod *corev1.Pod, defaults *sidecarinjectorv1alpha1.FluentDSpec, output *sidecarinjectorv1alpha1.OutputSpec, native bool) (*Result, error) {
 	var fluentdEnv FluentDEnv
 	err := envconfig.Process("fluentd", &fluentdEnv)
 	if err != nil {
 		return &Result{}, err
 	}
+	applyFluentDSpec(&fluentdEnv, defaults)
+	annotations, warnings := parseAnnotations(pod, "fluentd")
 
 	dockerImage := fluentdEnv.DockerImage
-	if value, ok := pod.Annotations[annotationPrefix+"/docker-image"]; ok {
+	if value, ok := annotations.value("docker-image"); ok {
 		dockerImage = value
 	}
 
@@ -268,54 +348,19 @@ func injectFluentD(pod *corev1.Pod) (*Result, error) {
 		},
 	})
 
-	resourceRequirements := corev1.ResourceRequirements{
-		Requests: map[corev1.ResourceName]resource.Quantity{
-			corev1.ResourceMemory: *resource.NewQuantity(200*1024*1024, resource.BinarySI),
-			corev1.ResourceCPU:    *resource.NewMilliQuantity(100, resource.DecimalSI),
-		},
-		Limits: map[corev1.ResourceName]resource.Quantity{
-			corev1.ResourceMemory: *resource.NewQuantity(1000*1024*1024, resource.BinarySI),
-		},
-	}
-
-	if value, ok := pod.Annotations[annotationPrefix+"/memory-request"]; ok {
-		resourceRequirements.Requests[corev1.ResourceMemory] = resource.Quantity{
-			Format: resource.Format(value),
-		}
-	}
-
-	if value, ok := pod.Annotations[annotationPrefix+"/memory-limit"]; ok {
-		resourceRequirements.Limits[corev1.ResourceMemory] = resource.Quantity{
-			Format: resource.Format(value),
-		}
-	}
-
-	if value, ok := pod.Annotations[annotationPrefix+"/cpu-request"]; ok {
-		resourceRequirements.Requests[corev1.ResourceCPU] = resource.Quantity{
-			Format: resource.Format(value),
-		}
-	}
-
-	if value, ok := pod.Annotations[annotationPrefix+"/cpu-limit"]; ok {
-		resourceRequirements.Limits[corev1.ResourceCPU] = resource.Quantity{
-			Format: resource.Format(value),
-		}
-	}
-
 	sidecar := corev1.Container{
 		Name:      ContainerName,
 		Image:     dockerImage,
-		Resources: resourceRequirements,
+		Resources: sidecarResources(annotations),
 	}
 
-	if value, ok := pod.Annotations[annotationPrefix+"/expose-port"]; ok {
-		port, _ := strconv.Atoi(value)
-		sidecar.Ports = []corev1.ContainerPort{{ContainerPort: int32(port)}}
+	if port, ok := annotations.port("expose-port"); ok {
+		sidecar.Ports = []corev1.ContainerPort{{ContainerPort: port}}
 	}
 
 	// Override env with Pod's annotations.
 	sendTimeout := "60s"
-	if value, ok := pod.Annotations[annotationPrefix+"/send-timeout"]; ok {
+	if value, ok := annotations.value("send-timeout"); ok {
 		sendTimeout = value
 	}
 	sidecar.Env = append(sidecar.Env, corev1.EnvVar{
@@ -324,7 +369,7 @@ func injectFluentD(pod *corev1.Pod) (*Result, error) {
 	})
 
 	recoverWait := "10s"
-	if value, ok := pod.Annotations[annotationPrefix+"/recover-wait"]; ok {
+	if value, ok := annotations.value("recover-wait"); ok {
 		recoverWait = value
 	}
 	sidecar.Env = append(sidecar.Env, corev1.EnvVar{
@@ -333,7 +378,7 @@ func injectFluentD(pod *corev1.Pod) (*Result, error) {
 	})
 
 	hardTimeout := "120s"
-	if value, ok := pod.Annotations[annotationPrefix+"/hard-timeout"]; ok {
+	if value, ok := annotations.value("hard-timeout"); ok {
 		hardTimeout = value
 	}
 	sidecar.Env = append(sidecar.Env, corev1.EnvVar{
@@ -343,32 +388,56 @@ func injectFluentD(pod *corev1.Pod) (*Result, error) {
 
 	// Override env with fluentdEnv and Pod's annotations.
 	aggregatorHost := fluentdEnv.AggregatorHost
-	if value, ok := pod.Annotations[annotationPrefix+"/aggregator-host"]; ok {
+	if value, ok := annotations.value("aggregator-host"); ok {
 		aggregatorHost = value
 	}
 
-	if aggregatorHost == "" {
-		return &Result{}, errors.New("aggregator host is required")
-	}
-	sidecar.Env = append(sidecar.Env, corev1.EnvVar{
-		Name:  "AGGREGATOR_HOST",
-		Value: aggregatorHost,
-	})
-
 	aggregatorPort := fluentdEnv.AggregatorPort
-	if value, ok := pod.Annotations[annotationPrefix+"/aggregator-port"]; ok {
+	if value, ok := annotations.value("aggregator-port"); ok {
 		aggregatorPort = value
 	}
 
-	if aggregatorPort != "" {
+	var specServers []sidecarinjectorv1alpha1.AggregatorServer
+	if defaults != nil {
+		specServers = defaults.Aggregators
+	}
+	// The aggregator is not used if the sidecar sends logs to the backend directly.
+	backend, err := directOutput(output)
+	if err != nil {
+		return &Result{}, err
+	}
+	var aggregators *aggregatorServers
+	if backend == nil {
+		aggregators, err = resolveAggregators(pod, specServers, annotations, aggregatorPort)
+		if err != nil {
+			return &Result{}, err
+		}
+	}
+	switch {
+	case backend != nil:
+		configureOutput(&sidecar, backend)
+		warnings = append(warnings, forwardWarnings(annotations, backend)...)
+	case aggregators != nil:
+		sidecar.Env = append(sidecar.Env, aggregators.env()...)
+	default:
+		if aggregatorHost == "" {
+			return &Result{}, errors.New("aggregator host is required")
+		}
 		sidecar.Env = append(sidecar.Env, corev1.EnvVar{
-			Name:  "AGGREGATOR_PORT",
-			Value: aggregatorPort,
+			Name:  "AGGREGATOR_HOST",
+			Value: aggregatorHost,
 		})
+
+		if aggregatorPort != "" {
+			sidecar.Env = append(sidecar.Env, corev1.EnvVar{
+				Name:  "AGGREGATOR_PORT",
+				Value: aggregatorPort,
+			})
+		}
 	}
 
 	logFormat := fluentdEnv.LogFormat
-	if value, ok := pod.Annotations[annotationPrefix+"/log-format"]; ok {
+	if value, ok := annotations.value("log-format"); ok {
 		logFormat = value
 	}
 
@@ -380,7 +449,7 @@ func injectFluentD(pod *corev1.Pod) (*Result, error) {
 	}
 
 	customEnv := fluentdEnv.CustomEnv
-	if value, ok := pod.Annotations[annotationPrefix+"/custom-env"]; ok {
+	if value, ok := annotations.value("custom-env"); ok {
 		customEnv = value
 	}
 
@@ -391,10 +460,18 @@ func injectFluentD(pod *corev1.Pod) (*Result, error) {
 		})
 	}
 
+	sources, err := logSources(annotations)
+	if err != nil {
+		return &Result{}, err
+	}
+
 	applicationLogDir := fluentdEnv.ApplicationLogDir
-	if value, ok := pod.Annotations[annotationPrefix+"/application-log-dir"]; ok {
+	if value, ok := annotations.value("application-log-dir"); ok {
 		applicationLogDir = value
 	}
+	if applicationLogDir == "" && len(sources) > 0 {
+		applicationLogDir = path.Dir(sources[0].Path)
+	}
 	if applicationLogDir == "" {
 		return &Result{}, errors.New("application log dir is required")
 	}
@@ -413,7 +490,7 @@ func injectFluentD(pod *corev1.Pod) (*Result, error) {
 	}
 
 	mountsCnt := len(sidecar.VolumeMounts)
-	if value, ok := pod.Annotations[annotationPrefix+"/config-volume"]; ok {
+	if value, ok := annotations.value("config-volume"); ok {
 		volumes := pod.Spec.Volumes
 		for i := range volumes {
 			if name := volumes[i].Name; name == value {
@@ -430,7 +507,7 @@ func injectFluentD(pod *corev1.Pod) (*Result, error) {
 	}
 
 	tagPrefix := fluentdEnv.TagPrefix
-	if value, ok := pod.Annotations[annotationPrefix+"/tag-prefix"]; ok {
+	if value, ok := annotations.value("tag-prefix"); ok {
 		tagPrefix = value
 	}
 	if tagPrefix != "" {
@@ -441,7 +518,7 @@ func injectFluentD(pod *corev1.Pod) (*Result, error) {
 	}
 
 	timeKey := fluentdEnv.TimeKey
-	if value, ok := pod.Annotations[annotationPrefix+"/time-key"]; ok {
+	if value, ok := annotations.value("time-key"); ok {
 		timeKey = value
 	}
 	if timeKey != "" {
@@ -533,7 +610,7 @@ func injectFluentD(pod *corev1.Pod) (*Result, error) {
 	)
 
 	timeFormat := fluentdEnv.TimeFormat
-	if value, ok := pod.Annotations[annotationPrefix+"/time-format"]; ok {
+	if value, ok := annotations.value("time-format"); ok {
 		timeFormat = value
 	}
 	if timeFormat != "" {
@@ -543,31 +620,42 @@ func injectFluentD(pod *corev1.Pod) (*Result, error) {
 		})
 	}
 
-	// Inject volume mount for all containers in the pod.
-	var containers []corev1.Container
-
-	for _, container := range pod.Spec.Containers {
-		container.VolumeMounts = append(container.VolumeMounts, volumeMount)
-		containers = append(containers, container)
+	var securitySpec *sidecarinjectorv1alpha1.ForwardSecuritySpec
+	if defaults != nil {
+		securitySpec = defaults.Security
+	}
+	logs := forwardLogs{
+		sources:           sources,
+		applicationLogDir: applicationLogDir,
+		tagPrefix:         tagPrefix,
+		logFormat:         logFormat,
+		timeKey:           timeKey,
+		timeFormat:        timeFormat,
+		backend:           backend,
+		aggregators:       aggregators,
+		security:          securitySpec,
+	}
+	if err := appendForwardSidecar(pod, annotations, sidecar, volumeMount, logs, "fluentd", native, fluentDMonitorPort); err != nil {
+		return &Result{}, err
 	}
-	containers = append(containers, sidecar)
-
-	pod.Spec.Containers = containers
 
 	return &Result{
-		Mutated: pod,
+		Mutated:  pod,
+		Warnings: warnings,
 	}, nil
 }
 
-func injectFluentBit(pod *corev1.Pod) (*Result, error) {
+func injectFluentBit(pod *corev1.Pod, defaults *sidecarinjectorv1alpha1.FluentBitSpec, output *sidecarinjectorv1alpha1.OutputSpec, native bool) (*Result, error) {
 	var fluentBitEnv FluentBitEnv
 	err := envconfig.Process("fluentbit", &fluentBitEnv)
 	if err != nil {
 		return &Result{}, err
 	}
+	applyFluentBitSpec(&fluentBitEnv, defaults)
+	annotations, warnings := parseAnnotations(pod, "fluent-bit")
 
 	dockerImage := fluentBitEnv.DockerImage
-	if value, ok := pod.Annotations[annotationPrefix+"/docker-image"]; ok {
+	if value, ok := annotations.value("docker-image"); ok {
 		dockerImage = value
 	}
 
@@ -579,27 +667,18 @@ func injectFluentBit(pod *corev1.Pod) (*Result, error) {
 	})
 
 	sidecar := corev1.Container{
-		Name:  ContainerName,
-		Image: dockerImage,
-		Resources: corev1.ResourceRequirements{
-			Requests: map[corev1.ResourceName]resource.Quantity{
-				corev1.ResourceMemory: *resource.NewQuantity(200*1024*1024, resource.BinarySI),
-				corev1.ResourceCPU:    *resource.NewMilliQuantity(100, resource.DecimalSI),
-			},
-			Limits: map[corev1.ResourceName]resource.Quantity{
-				corev1.ResourceMemory: *resource.NewQuantity(1000*1024*1024, resource.BinarySI),
-			},
-		},
+		Name:      ContainerName,
+		Image:     dockerImage,
+		Resources: sidecarResources(annotations),
 	}
 
-	if value, ok := pod.Annotations[annotationPrefix+"/expose-port"]; ok {
-		port, _ := strconv.Atoi(value)
-		sidecar.Ports = []corev1.ContainerPort{{ContainerPort: int32(port)}}
+	if port, ok := annotations.port("expose-port"); ok {
+		sidecar.Ports = []corev1.ContainerPort{{ContainerPort: port}}
 	}
 
 	// Override env with Pod's annotations.
 	refreshInterval := "60"
-	if value, ok := pod.Annotations[annotationPrefix+"/refresh-interval"]; ok {
+	if value, ok := annotations.value("refresh-interval"); ok {
 		refreshInterval = value
 	}
 	sidecar.Env = append(sidecar.Env, corev1.EnvVar{
@@ -608,7 +687,7 @@ func injectFluentBit(pod *corev1.Pod) (*Result, error) {
 	})
 
 	rotateWait := "5"
-	if value, ok := pod.Annotations[annotationPrefix+"/rotate-wait"]; ok {
+	if value, ok := annotations.value("rotate-wait"); ok {
 		rotateWait = value
 	}
 	sidecar.Env = append(sidecar.Env, corev1.EnvVar{
@@ -618,32 +697,65 @@ func injectFluentBit(pod *corev1.Pod) (*Result, error) {
 
 	// Override env with fluentBitEnv and Pod's annotations.
 	aggregatorHost := fluentBitEnv.AggregatorHost
-	if value, ok := pod.Annotations[annotationPrefix+"/aggregator-host"]; ok {
+	if value, ok := annotations.value("aggregator-host"); ok {
 		aggregatorHost = value
 	}
 
-	if aggregatorHost == "" {
-		return &Result{}, errors.New("aggregator host is required")
-	}
-	sidecar.Env = append(sidecar.Env, corev1.EnvVar{
-		Name:  "AGGREGATOR_HOST",
-		Value: aggregatorHost,
-	})
-
 	aggregatorPort := fluentBitEnv.AggregatorPort
-	if value, ok := pod.Annotations[annotationPrefix+"/aggregator-port"]; ok {
+	if value, ok := annotations.value("aggregator-port"); ok {
 		aggregatorPort = value
 	}
 
-	if aggregatorPort != "" {
+	var specServers []sidecarinjectorv1alpha1.AggregatorServer
+	if defaults != nil {
+		specServers = defaults.Aggregators
+	}
+	// The aggregator is not used if the sidecar sends logs to the backend directly.
+	backend, err := directOutput(output)
+	if err != nil {
+		return &Result{}, err
+	}
+	var aggregators *aggregatorServers
+	if backend == nil {
+		aggregators, err = resolveAggregators(pod, specServers, annotations, aggregatorPort)
+		if err != nil {
+			return &Result{}, err
+		}
+	}
+	if aggregators != nil {
+		warning, err := aggregators.fluentBitWarning()
+		if err != nil {
+			return &Result{}, err
+		}
+		if warning != "" {
+			warnings = append(warnings, warning)
+		}
+	}
+	switch {
+	case backend != nil:
+		configureOutput(&sidecar, backend)
+		warnings = append(warnings, forwardWarnings(annotations, backend)...)
+	case aggregators != nil:
+		sidecar.Env = append(sidecar.Env, aggregators.env()...)
+	default:
+		if aggregatorHost == "" {
+			return &Result{}, errors.New("aggregator host is required")
+		}
 		sidecar.Env = append(sidecar.Env, corev1.EnvVar{
-			Name:  "AGGREGATOR_PORT",
-			Value: aggregatorPort,
+			Name:  "AGGREGATOR_HOST",
+			Value: aggregatorHost,
 		})
+
+		if aggregatorPort != "" {
+			sidecar.Env = append(sidecar.Env, corev1.EnvVar{
+				Name:  "AGGREGATOR_PORT",
+				Value: aggregatorPort,
+			})
+		}
 	}
 
 	customEnv := fluentBitEnv.CustomEnv
-	if value, ok := pod.Annotations[annotationPrefix+"/custom-env"]; ok {
+	if value, ok := annotations.value("custom-env"); ok {
 		customEnv = value
 	}
 
@@ -654,10 +766,18 @@ func injectFluentBit(pod *corev1.Pod) (*Result, error) {
 		})
 	}
 
+	sources, err := logSources(annotations)
+	if err != nil {
+		return &Result{}, err
+	}
+
 	applicationLogDir := fluentBitEnv.ApplicationLogDir
-	if value, ok := pod.Annotations[annotationPrefix+"/application-log-dir"]; ok {
+	if value, ok := annotations.value("application-log-dir"); ok {
 		applicationLogDir = value
 	}
+	if applicationLogDir == "" && len(sources) > 0 {
+		applicationLogDir = path.Dir(sources[0].Path)
+	}
 	if applicationLogDir == "" {
 		return &Result{}, errors.New("application log dir is required")
 	}
@@ -676,7 +796,7 @@ func injectFluentBit(pod *corev1.Pod) (*Result, error) {
 	}
 
 	mountsCnt := len(sidecar.VolumeMounts)
-	if value, ok := pod.Annotations[annotationPrefix+"/config-volume"]; ok {
+	if value, ok := annotations.value("config-volume"); ok {
 		volumes := pod.Spec.Volumes
 		for i := range volumes {
 			if name := volumes[i].Name; name == value {
@@ -693,7 +813,7 @@ func injectFluentBit(pod *corev1.Pod) (*Result, error) {
 	}
 
 	tagPrefix := fluentBitEnv.TagPrefix
-	if value, ok := pod.Annotations[annotationPrefix+"/tag-prefix"]; ok {
+	if value, ok := annotations.value("tag-prefix"); ok {
 		tagPrefix = value
 	}
 	if tagPrefix != "" {
@@ -784,14 +904,69 @@ func injectFluentBit(pod *corev1.Pod) (*Result, error) {
 		},
 	)
 
-	// Inject volume mount for all containers in the pod.
-	for i := range pod.Spec.Containers {
-		container := &pod.Spec.Containers[i]
-		container.VolumeMounts = append(container.VolumeMounts, volumeMount)
+	var securitySpec *sidecarinjectorv1alpha1.ForwardSecuritySpec
+	if defaults != nil {
+		securitySpec = defaults.Security
+	}
+	logs := forwardLogs{
+		sources:           sources,
+		applicationLogDir: applicationLogDir,
+		tagPrefix:         tagPrefix,
+		backend:           backend,
+		aggregators:       aggregators,
+		security:          securitySpec,
+	}
+	if err := appendForwardSidecar(pod, annotations, sidecar, volumeMount, logs, "fluent-bit", native, fluentBitMonitorPort); err != nil {
+		return &Result{}, err
 	}
-	pod.Spec.Containers = append(pod.Spec.Containers, sidecar)
 
 	return &Result{
-		Mutated: pod,
+		Mutated:  pod,
+		Warnings: warnings,
 	}, nil
 }
+
+// forwardLogs are logs which fluentd and fluent-bit read, and where they send logs.
+type forwardLogs struct {
+	sources           []LogSource
+	applicationLogDir string
+	tagPrefix         string
+	// logFormat, timeKey and timeFormat parse logs in the application log dir, when the configuration is rendered without log sources.
+	logFormat   string
+	timeKey     string
+	timeFormat  string
+	backend     *sidecarinjectorv1alpha1.OutputSpec
+	aggregators *aggregatorServers
+	security    *sidecarinjectorv1alpha1.ForwardSecuritySpec
+}
+
+// appendForwardSidecar configures the security, the buffer and log sources of fluentd or fluent-bit, and adds the sidecar to the pod.
+func appendForwardSidecar(pod *corev1.Pod, annotations podAnnotations, sidecar corev1.Container, volumeMount corev1.VolumeMount, logs forwardLogs, collector string, native bool, probePort int32) error {
+	var security *forwardSecurity
+	if logs.backend == nil {
+		var err error
+		security, err = configureSecurity(pod, &sidecar, logs.security, annotations, collector)
+		if err != nil {
+			return err
+		}
+	}
+	buffer, err := configureBuffer(pod, &sidecar, annotations, collector)
+	if err != nil {
+		return err
+	}
+	containers, err := logContainers(pod, annotations, logs.applicationLogDir)
+	if err != nil {
+		return err
+	}
+	sources := logs.sources
+	// The configuration of the image only forwards logs in the application log dir to a single aggregator in plaintext without the buffer,
+	// so the direct output, log-containers, the buffer, the security and aggregators require the rendered configuration.
+	if _, ok := annotations.value("config-volume"); !ok && len(sources) == 0 && (logs.backend != nil || containers != nil || buffer != nil || security != nil || logs.aggregators != nil) {
+		sources = defaultLogSources(logs.applicationLogDir, containers, logs.tagPrefix, logs.logFormat, logs.timeKey, logs.timeFormat)
+	}
+	logMounts := configureLogSources(pod, &sidecar, sources, logs.tagPrefix, logs.applicationLogDir, collector, sourcesOutput{buffer: buffer, security: security, aggregators: logs.aggregators, backend: logs.backend})
+	if containers != nil && len(logMounts) > 0 {
+		return errors.New("log sources must be in the application log dir when log-containers is specified")
+	}
+	return appendSidecar(pod, annotations, sidecar, append([]corev1.VolumeMount{volumeMount}, logMounts...), containers, native, probePort)
+}
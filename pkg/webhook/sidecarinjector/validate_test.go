@@ -29,7 +29,7 @@ func TestInjectFluentD(t *testing.T) {
 		},
 	}
 
-	result, err := injectFluentD(pod)
+	result, err := injectFluentD(pod, nil, nil, false)
 	if err != nil {
 		t.Error(err)
 	}
@@ -129,7 +129,7 @@ func TestInjectFluentDDWithAnnotations(t *testing.T) {
 		},
 	}
 
-	result, err := injectFluentD(pod)
+	result, err := injectFluentD(pod, nil, nil, false)
 	if err != nil {
 		t.Error(err)
 	}
@@ -223,7 +223,7 @@ func TestInjectFluentDWithEnv(t *testing.T) {
 		},
 	}
 
-	result, err := injectFluentD(pod)
+	result, err := injectFluentD(pod, nil, nil, false)
 	if err != nil {
 		t.Error(err)
 	}
@@ -304,7 +304,7 @@ func TestInjectFluentBit(t *testing.T) {
 		},
 	}
 
-	result, err := injectFluentBit(pod)
+	result, err := injectFluentBit(pod, nil, nil, false)
 	if err != nil {
 		t.Error(err)
 	}
@@ -367,6 +367,10 @@ func TestInjectFluentBitWithAnnotations(t *testing.T) {
 				annotationPrefix + "/rotate-wait":         "10",
 				annotationPrefix + "/config-volume":       "my-custom-config",
 				annotationPrefix + "/tag-prefix":          "my-app",
+				annotationPrefix + "/memory-request":      "100Mi",
+				annotationPrefix + "/memory-limit":        "300Mi",
+				annotationPrefix + "/cpu-request":         "50m",
+				annotationPrefix + "/cpu-limit":           "200m",
 			},
 		},
 		Spec: corev1.PodSpec{
@@ -391,7 +395,7 @@ func TestInjectFluentBitWithAnnotations(t *testing.T) {
 		},
 	}
 
-	result, err := injectFluentBit(pod)
+	result, err := injectFluentBit(pod, nil, nil, false)
 	if err != nil {
 		t.Error(err)
 	}
@@ -416,6 +420,12 @@ func TestInjectFluentBitWithAnnotations(t *testing.T) {
 	if container.Ports[0].ContainerPort != int32(80) {
 		t.Errorf("Container port is not matched: %d", container.Ports[0].ContainerPort)
 	}
+	if container.Resources.Requests.Memory().String() != "100Mi" || container.Resources.Limits.Memory().String() != "300Mi" {
+		t.Errorf("Container memory is not matched: %v", container.Resources)
+	}
+	if container.Resources.Requests.Cpu().String() != "50m" || container.Resources.Limits.Cpu().String() != "200m" {
+		t.Errorf("Container cpu is not matched: %v", container.Resources)
+	}
 
 	if refreshInterval := findEnv(container.Env, "REFRESH_INTERVAL"); refreshInterval.Value != "30" {
 		t.Errorf("Container env refresh interval is not matched: %v", refreshInterval)
@@ -470,7 +480,7 @@ func TestInjectFluentBitWithEnv(t *testing.T) {
 		},
 	}
 
-	result, err := injectFluentBit(pod)
+	result, err := injectFluentBit(pod, nil, nil, false)
 	if err != nil {
 		t.Error(err)
 	}
@@ -524,6 +534,32 @@ func TestInjectFluentBitWithEnv(t *testing.T) {
 	os.Unsetenv("FLUENTBIT_AGGREGATOR_PORT")
 }
 
+// newTestPod returns a pod which has an init container and an application container, and annotations to inject the sidecar.
+func newTestPod(annotations map[string]string) *corev1.Pod {
+	annotations[annotationPrefix+"/injection"] = "enabled"
+	annotations[annotationPrefix+"/aggregator-host"] = "my-aggregator.local"
+	annotations[annotationPrefix+"/application-log-dir"] = "/var/log/nginx"
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: annotations,
+		},
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{
+				{
+					Name:  "setup",
+					Image: "busybox:latest",
+				},
+			},
+			Containers: []corev1.Container{
+				{
+					Name:  "nginx",
+					Image: "nginx:latest",
+				},
+			},
+		},
+	}
+}
+
 func findVolume(volumes []corev1.Volume, targetName string) *corev1.Volume {
 	for i := range volumes {
 		if volumes[i].Name == targetName {
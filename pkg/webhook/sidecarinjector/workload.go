@@ -0,0 +1,87 @@
+package sidecarinjector
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	WorkloadKindEnv = "WORKLOAD_KIND"
+	WorkloadNameEnv = "WORKLOAD_NAME"
+	// workloadResolveTimeout is shorter than the timeout of the webhook, because resolving workloads should not block creating pods.
+	workloadResolveTimeout = 3 * time.Second
+)
+
+// Metadata of ReplicaSets and Jobs are cached, and other owners are fetched.
+// +kubebuilder:rbac:groups="apps",resources=replicasets,verbs=get;list;watch
+// +kubebuilder:rbac:groups="apps",resources=statefulsets;daemonsets,verbs=get
+// +kubebuilder:rbac:groups="batch",resources=jobs,verbs=get;list;watch
+// +kubebuilder:rbac:groups="batch",resources=cronjobs,verbs=get
+// +kubebuilder:rbac:groups="argoproj.io",resources=rollouts,verbs=get
+
+// WorkloadResolver resolves the top-level workload which owns a pod.
+type WorkloadResolver interface {
+	ResolveWorkload(ctx context.Context, namespace string, refs []metav1.OwnerReference) (string, string, error)
+}
+
+// workload returns the kind and the name of the workload which owns the pod.
+// The pod itself is the workload when it does not have any controllers.
+func (i *Injector) workload(pod *corev1.Pod, namespace string) (string, string) {
+	var kind, name string
+	if i.workloadResolver != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), workloadResolveTimeout)
+		defer cancel()
+		var err error
+		kind, name, err = i.workloadResolver.ResolveWorkload(ctx, namespace, pod.OwnerReferences)
+		if kerrors.IsForbidden(err) {
+			klog.Errorf("Failed to resolve workload, %s %s is used. Please grant get permission of owners to the service account of the webhook server: %v", kind, name, err)
+		} else if err != nil {
+			klog.Warningf("Failed to resolve workload, %s %s is used: %v", kind, name, err)
+		}
+	} else if owner := metav1.GetControllerOfNoCopy(pod); owner != nil {
+		kind, name = owner.Kind, owner.Name
+	}
+	if kind == "" {
+		kind = "Pod"
+		name = pod.Name
+		if name == "" {
+			name = pod.GenerateName
+		}
+	}
+	return kind, name
+}
+
+// setWorkloadEnv exposes the workload to the sidecar, so logs can be grouped by the workload.
+func setWorkloadEnv(pod *corev1.Pod, kind, name string) {
+	sidecar := findSidecar(pod)
+	if sidecar == nil {
+		return
+	}
+	sidecar.Env = append(sidecar.Env,
+		corev1.EnvVar{
+			Name:  WorkloadKindEnv,
+			Value: kind,
+		},
+		corev1.EnvVar{
+			Name:  WorkloadNameEnv,
+			Value: name,
+		},
+	)
+}
+
+// findSidecar returns the injected sidecar in containers or init containers.
+func findSidecar(pod *corev1.Pod) *corev1.Container {
+	for _, containers := range [][]corev1.Container{pod.Spec.Containers, pod.Spec.InitContainers} {
+		for i := range containers {
+			if containers[i].Name == ContainerName {
+				return &containers[i]
+			}
+		}
+	}
+	return nil
+}
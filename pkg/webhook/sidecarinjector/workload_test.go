@@ -0,0 +1,86 @@
+package sidecarinjector
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+type fakeWorkloadResolver struct {
+	kind string
+	name string
+	err  error
+}
+
+func (r *fakeWorkloadResolver) ResolveWorkload(ctx context.Context, namespace string, refs []metav1.OwnerReference) (string, string, error) {
+	return r.kind, r.name, r.err
+}
+
+func TestWorkload(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "web-5d4f-",
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: "apps/v1",
+					Kind:       "ReplicaSet",
+					Name:       "web-5d4f",
+					Controller: ptr.To(true),
+				},
+			},
+		},
+	}
+
+	cases := []struct {
+		title    string
+		resolver WorkloadResolver
+		kind     string
+		name     string
+	}{
+		{"resolved", &fakeWorkloadResolver{kind: "Deployment", name: "web"}, "Deployment", "web"},
+		{"partially resolved", &fakeWorkloadResolver{kind: "ReplicaSet", name: "web-5d4f", err: fmt.Errorf("forbidden")}, "ReplicaSet", "web-5d4f"},
+		{"without resolver", nil, "ReplicaSet", "web-5d4f"},
+	}
+	for _, c := range cases {
+		kind, name := NewInjector("", nil, nil, c.resolver, nil).workload(pod, "default")
+		if kind != c.kind || name != c.name {
+			t.Errorf("Workload is not matched in %s: %s %s", c.title, kind, name)
+		}
+	}
+
+	// A pod without controllers is the workload.
+	pod = &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "debug",
+		},
+	}
+	kind, name := NewInjector("", nil, nil, &fakeWorkloadResolver{}, nil).workload(pod, "default")
+	if kind != "Pod" || name != "debug" {
+		t.Errorf("Workload is not matched: %s %s", kind, name)
+	}
+}
+
+func TestSetWorkloadEnv(t *testing.T) {
+	pod := newTestPod(map[string]string{
+		annotationPrefix + "/native-sidecar": "true",
+	})
+	if _, err := sidecarInjectMutator(pod, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	setWorkloadEnv(pod, "CronJob", "backup")
+
+	sidecar := findContainer(pod.Spec.InitContainers, ContainerName)
+	if sidecar == nil {
+		t.Fatalf("Failed to inject sidecar container: %#v", pod.Spec.InitContainers)
+	}
+	if kind := findEnv(sidecar.Env, WorkloadKindEnv); kind == nil || kind.Value != "CronJob" {
+		t.Errorf("Container env workload kind is not matched: %v", kind)
+	}
+	if name := findEnv(sidecar.Env, WorkloadNameEnv); name == nil || name.Value != "backup" {
+		t.Errorf("Container env workload name is not matched: %v", name)
+	}
+}